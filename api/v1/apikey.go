@@ -0,0 +1,335 @@
+package v1
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
+)
+
+const (
+	// apiKeyPrefix starts every API key, it makes leaked keys easy to recognize
+	apiKeyPrefix = "ds_"
+	// apiKeyVisibleLength is the number of leading characters of a key kept in APIKey.Prefix
+	apiKeyVisibleLength = len(apiKeyPrefix) + 8
+)
+
+// APIKey lets scripts and integrations call the API on behalf of a user without a session.
+// The key acts with the permissions of the user that are listed in its scopes.
+type APIKey struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uuid.UUID `json:"user_id"`
+
+	// Name describes what the key is used for
+	Name string `json:"name"`
+	// Prefix is the start of the key, it helps users to recognize their keys
+	Prefix string `json:"prefix"`
+	// Scopes are the permissions of the user the key may use, an empty list limits the key
+	// to the resources owned by the user
+	Scopes []string `json:"scopes"`
+	// ExpiresAt ends the validity of the key, keys without expiry are valid until they are revoked
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Key is the secret sent as bearer token. It is only returned on creation, the stores
+	// keep its hash.
+	Key string `json:"key,omitempty"`
+}
+
+// Validate implements validation.Validatable.
+func (k APIKey) Validate(op validation.Operation) error {
+	var v validation.Violations
+	v.NotEmpty("name", k.Name)
+	for i, scope := range k.Scopes {
+		field := fmt.Sprintf("scopes.%d", i)
+		v.OneOf(field, scope, Permissions...)
+		v.Check(!slices.Contains(k.Scopes[:i], scope), field, "is listed more than once")
+	}
+	v.Check(k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()), "expires_at", "must be in the future")
+	return v.Err()
+}
+
+// Expired reports whether the key has expired at the given time.
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// NewAPIKey returns a random API key with at least 128 bits of entropy.
+func NewAPIKey() string {
+	return apiKeyPrefix + rand.Text()
+}
+
+// HashAPIKey returns the hash the stores keep instead of the key. The keys are random, a
+// fast hash does not make them easier to guess and allows looking them up by their hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyStore interface for API key operations
+type APIKeyStore interface {
+	// Create stores a new API key, it fails with ErrAlreadyExists if the ID is taken.
+	// Only the hash of the key is stored, it cannot be read back.
+	Create(ctx context.Context, key *APIKey) error
+	// ListByUser returns the API keys of a user ordered by creation time.
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]APIKey, error)
+	Get(ctx context.Context, id uuid.UUID) (*APIKey, error)
+	// GetByKey returns the API key with the given secret, or an error wrapping ErrNotFound.
+	GetByKey(ctx context.Context, key string) (*APIKey, error)
+	// Delete revokes the API key.
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// APIKeyIdentity is the user a valid API key acts for
+type APIKeyIdentity struct {
+	KeyID    uuid.UUID `json:"key_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	// Permissions are the scopes of the key the user currently holds
+	Permissions []string `json:"permissions"`
+}
+
+// Session returns the session the gateway serves a request authenticated with the key in.
+// It is never stored, the key is validated on every request.
+func (i *APIKeyIdentity) Session() *Session {
+	now := time.Now()
+	return &Session{
+		UserID:      i.UserID,
+		Username:    i.Username,
+		Permissions: i.Permissions,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+	}
+}
+
+// APIKeyValidator validates API keys. It is implemented by the UserClient of the user service.
+type APIKeyValidator interface {
+	// ValidateAPIKey returns the identity of a valid key, otherwise an error wrapping ErrUnauthorized
+	ValidateAPIKey(ctx context.Context, key string) (*APIKeyIdentity, error)
+}
+
+// APIKeyValidationRequest represents a request to validate an API key
+type APIKeyValidationRequest struct {
+	Key string `json:"key"`
+}
+
+// Validate implements validation.Validatable.
+func (a APIKeyValidationRequest) Validate(op validation.Operation) error {
+	var v validation.Violations
+	v.NotEmpty("key", a.Key)
+	return v.Err()
+}
+
+// ValidateAPIKey returns the identity of the user the key belongs to. The key is granted the
+// scopes the user still holds, so it loses permissions together with its user. Unknown,
+// expired and orphaned keys result in an error wrapping ErrUnauthorized.
+func ValidateAPIKey(ctx context.Context, keys APIKeyStore, users UserStore, roles RoleStore, key string) (*APIKeyIdentity, error) {
+	apiKey, err := keys.GetByKey(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown API key", ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if apiKey.Expired(time.Now()) {
+		return nil, fmt.Errorf("%w: API key has expired", ErrUnauthorized)
+	}
+
+	user, err := users.Get(ctx, apiKey.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: the user of the API key does not exist", ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	held := func(string) bool { return true }
+	if !user.IsAdmin {
+		var permissions []string
+		if roles != nil {
+			permissions, err = ResolvePermissions(ctx, roles, user.Roles)
+			if err != nil {
+				return nil, err
+			}
+		}
+		held = func(scope string) bool { return slices.Contains(permissions, scope) }
+	}
+	identity := &APIKeyIdentity{KeyID: apiKey.ID, UserID: user.ID, Permissions: []string{}}
+	if user.Username != nil {
+		identity.Username = *user.Username
+	}
+	for _, scope := range apiKey.Scopes {
+		if held(scope) {
+			identity.Permissions = append(identity.Permissions, scope)
+		}
+	}
+	return identity, nil
+}
+
+// apiKeyRoutes are the routes of the API keys of a user, they are served by the UserRouter
+// as the keys are managed below the users they belong to.
+func (u *UserRouter) apiKeyRoutes() []router.PathObject {
+	return []router.PathObject{
+		handlers.Post("/{id}/apikeys", u.createAPIKey).WithCaller(router.CallerVerified),
+		handlers.List("/{id}/apikeys", u.listAPIKeys).WithCaller(router.CallerVerified),
+		handlers.Delete("/{id}/apikeys/{keyID}", u.revokeAPIKey).WithCaller(router.CallerVerified),
+		handlers.Action("/apikeys/validate", "Validate an API key", u.validateAPIKey).WithCaller(router.CallerService),
+	}
+}
+
+// createAPIKey creates an API key for the user given in the path. Callers can only grant the
+// scopes they hold themselves, keys cannot be used to create keys with more permissions.
+func (u *UserRouter) createAPIKey(ctx context.Context, r *http.Request, key *APIKey) error {
+	u.processedAPIKeyCreateRequests.Inc()
+
+	if u.UserStore == nil || u.APIKeyStore == nil {
+		u.processedAPIKeyCreateFailures.Inc()
+		return router.ErrObjectStorageNotImplemented
+	}
+
+	userID, err := handlers.GetUUIDFromPathValue(r, "id")
+	if err != nil {
+		u.processedAPIKeyCreateFailures.Inc()
+		return err
+	}
+	if err := checkAPIKeyOwner(ctx, userID); err != nil {
+		u.processedAPIKeyCreateFailures.Inc()
+		return err
+	}
+	if _, err := u.UserStore.Get(ctx, userID); err != nil {
+		u.processedAPIKeyCreateFailures.Inc()
+		return err
+	}
+	identity := router.IdentityFromContext(ctx)
+	for _, scope := range key.Scopes {
+		if !identity.Can(scope) {
+			u.processedAPIKeyCreateFailures.Inc()
+			return fmt.Errorf("%w: the scope %s requires the %s permission", ErrForbidden, scope, scope)
+		}
+	}
+
+	key.ID = uuid.New()
+	key.CreatedAt = time.Now()
+	key.UserID = userID
+	key.Key = NewAPIKey()
+	key.Prefix = key.Key[:apiKeyVisibleLength]
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+
+	err = u.APIKeyStore.Create(ctx, key)
+	if err != nil {
+		u.processedAPIKeyCreateFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+// listAPIKeys lists the API keys of the user given in the path, their secrets are not returned
+func (u *UserRouter) listAPIKeys(ctx context.Context, r *http.Request, filters handlers.FilterObjectList) ([]APIKey, int, error) {
+	u.processedAPIKeyListRequests.Inc()
+
+	if u.APIKeyStore == nil {
+		u.processedAPIKeyListFailures.Inc()
+		return nil, 0, router.ErrObjectStorageNotImplemented
+	}
+
+	userID, err := handlers.GetUUIDFromPathValue(r, "id")
+	if err != nil {
+		u.processedAPIKeyListFailures.Inc()
+		return nil, 0, err
+	}
+	if err := checkAPIKeyOwner(ctx, userID); err != nil {
+		u.processedAPIKeyListFailures.Inc()
+		return nil, 0, err
+	}
+
+	keys, err := u.APIKeyStore.ListByUser(ctx, userID)
+	if err != nil {
+		u.processedAPIKeyListFailures.Inc()
+		return nil, 0, err
+	}
+	return keys, len(keys), nil
+}
+
+// revokeAPIKey revokes an API key of the user given in the path. Keys of other users are
+// reported as missing.
+func (u *UserRouter) revokeAPIKey(ctx context.Context, r *http.Request, _ *APIKey) error {
+	u.processedAPIKeyRevokeRequests.Inc()
+
+	if u.APIKeyStore == nil {
+		u.processedAPIKeyRevokeFailures.Inc()
+		return router.ErrObjectStorageNotImplemented
+	}
+
+	userID, err := handlers.GetUUIDFromPathValue(r, "id")
+	if err != nil {
+		u.processedAPIKeyRevokeFailures.Inc()
+		return err
+	}
+	keyID, err := handlers.GetUUIDFromPathValue(r, "keyID")
+	if err != nil {
+		u.processedAPIKeyRevokeFailures.Inc()
+		return err
+	}
+	if err := checkAPIKeyOwner(ctx, userID); err != nil {
+		u.processedAPIKeyRevokeFailures.Inc()
+		return err
+	}
+
+	key, err := u.APIKeyStore.Get(ctx, keyID)
+	if err == nil && key.UserID != userID {
+		err = fmt.Errorf("api key %w", ErrNotFound)
+	}
+	if err == nil {
+		err = u.APIKeyStore.Delete(ctx, keyID)
+	}
+	if err != nil {
+		u.processedAPIKeyRevokeFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+// checkAPIKeyOwner ensures the caller manages the API keys of the user, which only the user
+// itself and user administrators do. Services do not act on behalf of users with keys.
+func checkAPIKeyOwner(ctx context.Context, userID uuid.UUID) error {
+	identity := router.IdentityFromContext(ctx)
+	switch {
+	case identity == nil:
+		return fmt.Errorf("%w: missing identity", ErrUnauthorized)
+	case identity.Can(PermissionUsersWrite):
+		return nil
+	case identity.Service != "" || identity.Anonymous || identity.UserID != userID:
+		return fmt.Errorf("%w: the API keys of other users require the %s permission", ErrForbidden, PermissionUsersWrite)
+	}
+	return nil
+}
+
+// validateAPIKey returns the identity of a valid API key. The endpoint is meant for the
+// gateway and not exposed through it.
+func (u *UserRouter) validateAPIKey(ctx context.Context, r *http.Request, req *APIKeyValidationRequest) (*APIKeyIdentity, error) {
+	u.processedAPIKeyValidateRequests.Inc()
+
+	if u.UserStore == nil || u.APIKeyStore == nil {
+		u.processedAPIKeyValidateFailures.Inc()
+		return nil, router.ErrObjectStorageNotImplemented
+	}
+
+	identity, err := ValidateAPIKey(ctx, u.APIKeyStore, u.UserStore, u.RoleStore, req.Key)
+	if err != nil {
+		u.processedAPIKeyValidateFailures.Inc()
+		return nil, err
+	}
+	return identity, nil
+}
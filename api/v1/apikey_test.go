@@ -0,0 +1,289 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
+)
+
+// MockAPIKeyStore implements APIKeyStore interface for testing
+type MockAPIKeyStore struct {
+	keys map[uuid.UUID]*APIKey
+	// hashes maps the hashes of the keys to their IDs
+	hashes map[string]uuid.UUID
+}
+
+func NewMockAPIKeyStore() *MockAPIKeyStore {
+	return &MockAPIKeyStore{
+		keys:   make(map[uuid.UUID]*APIKey),
+		hashes: make(map[string]uuid.UUID),
+	}
+}
+
+func (m *MockAPIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	stored := *key
+	stored.Key = ""
+	m.keys[key.ID] = &stored
+	m.hashes[HashAPIKey(key.Key)] = key.ID
+	return nil
+}
+
+func (m *MockAPIKeyStore) ListByUser(ctx context.Context, userID uuid.UUID) ([]APIKey, error) {
+	keys := []APIKey{}
+	for _, key := range m.keys {
+		if key.UserID == userID {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MockAPIKeyStore) Get(ctx context.Context, id uuid.UUID) (*APIKey, error) {
+	key, exists := m.keys[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return key, nil
+}
+
+func (m *MockAPIKeyStore) GetByKey(ctx context.Context, key string) (*APIKey, error) {
+	id, exists := m.hashes[HashAPIKey(key)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return m.Get(ctx, id)
+}
+
+func (m *MockAPIKeyStore) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, exists := m.keys[id]; !exists {
+		return ErrNotFound
+	}
+	delete(m.keys, id)
+	return nil
+}
+
+func TestAPIKey_Validate(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		key     APIKey
+		wantErr bool
+	}{
+		{name: "valid", key: APIKey{Name: "ci", Scopes: []string{PermissionItemsWrite}, ExpiresAt: &future}},
+		{name: "without scopes", key: APIKey{Name: "ci"}},
+		{name: "missing name", key: APIKey{Scopes: []string{PermissionItemsWrite}}, wantErr: true},
+		{name: "unknown scope", key: APIKey{Name: "ci", Scopes: []string{"items:delete"}}, wantErr: true},
+		{name: "duplicate scope", key: APIKey{Name: "ci", Scopes: []string{PermissionItemsWrite, PermissionItemsWrite}}, wantErr: true},
+		{name: "expired", key: APIKey{Name: "ci", ExpiresAt: &past}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.key.Validate(validation.Create)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewAPIKey(t *testing.T) {
+	key := NewAPIKey()
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(key) < apiKeyVisibleLength+16 || key == NewAPIKey() {
+		t.Errorf("Expected random keys starting with %s, got %q", apiKeyPrefix, key)
+	}
+	if HashAPIKey(key) == key || HashAPIKey(key) != HashAPIKey(key) {
+		t.Error("Expected a stable hash that differs from the key")
+	}
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	roles := NewMockRoleStore(Role{ID: uuid.New(), Name: "catalog", Permissions: []string{PermissionItemsWrite}})
+	users := NewMockUserStore()
+	alice, admin := uuid.New(), uuid.New()
+	aliceName, adminName := "alice", "admin"
+	for _, user := range []*UserModificationRequest{
+		{User: User{ID: alice, Username: &aliceName, Roles: []string{"catalog"}}},
+		{User: User{ID: admin, Username: &adminName, IsAdmin: true}},
+	} {
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	keys := NewMockAPIKeyStore()
+	newKey := func(userID uuid.UUID, expiresAt *time.Time, scopes ...string) string {
+		key := &APIKey{ID: uuid.New(), UserID: userID, Name: "test", Scopes: scopes, ExpiresAt: expiresAt, Key: NewAPIKey()}
+		if err := keys.Create(ctx, key); err != nil {
+			t.Fatalf("Failed to create key: %v", err)
+		}
+		return key.Key
+	}
+	past := time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name            string
+		key             string
+		wantPermissions []string
+		wantErr         error
+	}{
+		{name: "scopes held by the user", key: newKey(alice, nil, PermissionItemsWrite, PermissionUsersRead), wantPermissions: []string{PermissionItemsWrite}},
+		{name: "without scopes", key: newKey(alice, nil), wantPermissions: []string{}},
+		{name: "admin", key: newKey(admin, nil, PermissionUsersRead, PermissionUsersWrite), wantPermissions: []string{PermissionUsersRead, PermissionUsersWrite}},
+		{name: "expired", key: newKey(alice, &past, PermissionItemsWrite), wantErr: ErrUnauthorized},
+		{name: "unknown", key: NewAPIKey(), wantErr: ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := ValidateAPIKey(ctx, keys, users, roles, tt.key)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected error wrapping %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateAPIKey failed: %v", err)
+			}
+			if strings.Join(identity.Permissions, ",") != strings.Join(tt.wantPermissions, ",") {
+				t.Errorf("Expected permissions %v, got %v", tt.wantPermissions, identity.Permissions)
+			}
+			if session := identity.Session(); session.IsAdmin || session.UserID != identity.UserID {
+				t.Errorf("Expected a session of user %s without admin privileges, got %+v", identity.UserID, session)
+			}
+		})
+	}
+}
+
+func TestUserRouter_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	users := NewMockUserStore()
+	alice := uuid.New()
+	username := "alice"
+	if err := users.Create(ctx, &UserModificationRequest{User: User{ID: alice, Username: &username}}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	keys := NewMockAPIKeyStore()
+	serverURL := newServiceServer(t, NewUserRouter(users, NewMockRoleStore(), keys))
+
+	as := func(identity *router.Identity) string {
+		token, err := identityTokens.Sign(identity)
+		if err != nil {
+			t.Fatalf("Failed to sign identity: %v", err)
+		}
+		return token
+	}
+	aliceToken := as(&router.Identity{UserID: alice, Username: username})
+	adminToken := as(&router.Identity{UserID: uuid.New(), Username: "admin", IsAdmin: true})
+	malloryToken := as(&router.Identity{UserID: uuid.New(), Username: "mallory"})
+	anonymousToken := as(&router.Identity{Anonymous: true})
+	gatewayToken := as(&router.Identity{Service: "gateway"})
+
+	do := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, serverURL+"/api/v1/core/users"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(router.HeaderIdentityToken, token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	keysPath := "/" + alice.String() + "/apikeys"
+
+	resp := do(http.MethodPost, keysPath, aliceToken, `{"name":"ci"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+	var created APIKey
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode key: %v", err)
+	}
+	if created.UserID != alice || !strings.HasPrefix(created.Key, created.Prefix) || len(created.Prefix) != apiKeyVisibleLength {
+		t.Errorf("Expected a key of alice with its secret, got %+v", created)
+	}
+
+	if resp := do(http.MethodPost, keysPath, aliceToken, `{"name":"ci","scopes":["items:write"]}`); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected scopes the caller does not hold to be rejected with %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, keysPath, adminToken, `{"name":"catalog import","scopes":["items:write"]}`); resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected admins to grant any scope, got %d", resp.StatusCode)
+	}
+
+	resp = do(http.MethodGet, keysPath, aliceToken, "")
+	var list ListResponse[APIKey]
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode keys: %v", err)
+	}
+	if list.Total != 2 {
+		t.Fatalf("Expected 2 keys, got %d", list.Total)
+	}
+	for _, key := range list.Items {
+		if key.Key != "" {
+			t.Errorf("Expected listed keys without secret, got %q", key.Key)
+		}
+	}
+
+	// only alice and user administrators manage the keys of alice
+	for _, tt := range []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{name: "without token", status: http.StatusUnauthorized},
+		{name: "as another user", token: malloryToken, status: http.StatusForbidden},
+		{name: "as anonymous", token: anonymousToken, status: http.StatusForbidden},
+		{name: "as gateway", token: gatewayToken, status: http.StatusForbidden},
+	} {
+		if resp := do(http.MethodPost, keysPath, tt.token, `{"name":"backdoor"}`); resp.StatusCode != tt.status {
+			t.Errorf("Expected creating a key %s to be rejected with %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+		if resp := do(http.MethodGet, keysPath, tt.token, ""); resp.StatusCode != tt.status {
+			t.Errorf("Expected listing the keys %s to be rejected with %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+		if resp := do(http.MethodDelete, keysPath+"/"+created.ID.String(), tt.token, `{}`); resp.StatusCode != tt.status {
+			t.Errorf("Expected revoking a key %s to be rejected with %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+	}
+	if list, _ := keys.ListByUser(ctx, alice); len(list) != 2 {
+		t.Errorf("Expected the keys of alice not to be changed, got %d keys", len(list))
+	}
+
+	if resp := do(http.MethodPost, "/apikeys/validate", adminToken, `{"key":"`+created.Key+`"}`); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected validations by users to be rejected with %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+	resp = do(http.MethodPost, "/apikeys/validate", gatewayToken, `{"key":"`+created.Key+`"}`)
+	var identity APIKeyIdentity
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		t.Fatalf("Failed to decode identity: %v", err)
+	}
+	if identity.KeyID != created.ID || identity.UserID != alice || identity.Username != username {
+		t.Errorf("Expected the identity of alice, got %+v", identity)
+	}
+
+	if resp := do(http.MethodDelete, "/"+uuid.NewString()+"/apikeys/"+created.ID.String(), adminToken, `{}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the key not to be found below another user, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodDelete, keysPath+"/"+created.ID.String(), aliceToken, `{}`); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, "/apikeys/validate", gatewayToken, `{"key":"`+created.Key+`"}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked key to be rejected with %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
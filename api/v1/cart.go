@@ -2,13 +2,14 @@ package v1
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
 	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -16,6 +17,7 @@ type Cart struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"`
 
 	OwnerID uuid.UUID  `json:"owner_id"`
 	Items   []CartItem `json:"items"`
@@ -26,11 +28,37 @@ type CartItem struct {
 	Quantity int       `json:"quantity"`
 }
 
+// Validate implements validation.Validatable.
+func (c Cart) Validate(op validation.Operation) error {
+	var v validation.Violations
+	if op == validation.Update {
+		v.NotNilUUID("id", c.ID)
+	}
+	v.NotNilUUID("owner_id", c.OwnerID)
+
+	seen := make(map[uuid.UUID]bool, len(c.Items))
+	for i, item := range c.Items {
+		field := fmt.Sprintf("items.%d", i)
+		v.NotNilUUID(field+".item_id", item.ItemID)
+		v.Check(item.Quantity > 0, field+".quantity", "must be greater than zero")
+		if item.ItemID != uuid.Nil {
+			v.Check(!seen[item.ItemID], field+".item_id", "is already part of the cart, increase the quantity instead")
+			seen[item.ItemID] = true
+		}
+	}
+	return v.Err()
+}
+
 type CartStore interface {
 	Create(ctx context.Context, cart *Cart) error
 	Get(ctx context.Context, id uuid.UUID) (*Cart, error)
+	// GetByOwner returns the oldest cart of the user, or an error wrapping ErrNotFound if the
+	// user has no cart.
+	GetByOwner(ctx context.Context, ownerID uuid.UUID) (*Cart, error)
+	// Update replaces the object and increments its version, a non-zero version must match the stored one.
 	Update(ctx context.Context, cart *Cart) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	// Delete deletes the object if its version matches, a version of 0 deletes it unconditionally.
+	Delete(ctx context.Context, id uuid.UUID, version int64) error
 }
 
 type CartRouter struct {
@@ -44,6 +72,8 @@ type CartRouter struct {
 	processedGetFailures    prometheus.Counter
 	processedListRequests   prometheus.Counter
 	processedListFailures   prometheus.Counter
+	processedLookupRequests prometheus.Counter
+	processedLookupFailures prometheus.Counter
 
 	Store CartStore
 }
@@ -90,6 +120,14 @@ func NewCartRouter(store CartStore) *CartRouter {
 			Name: "cart_list_failures_total",
 			Help: "Total number of cart list failures",
 		}),
+		processedLookupRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cart_lookup_requests_total",
+			Help: "Total number of cart lookup requests",
+		}),
+		processedLookupFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cart_lookup_failures_total",
+			Help: "Total number of cart lookup failures",
+		}),
 		Store: store,
 	}
 }
@@ -107,26 +145,14 @@ func (c *CartRouter) GetKind() string {
 }
 
 func (c *CartRouter) Routes() []router.PathObject {
+	// carts belong to their owners, the gateway and the handlers check the ownership
 	return []router.PathObject{
-		{
-			Method: "POST",
-			Func:   handlers.HttpPost(c.createCart),
-		},
-		{
-			Path:   "/{id}",
-			Method: "GET",
-			Func:   handlers.HttpGet(c.getCart),
-		},
-		{
-			Path:   "/{id}",
-			Method: "PUT",
-			Func:   handlers.HttpUpdate(c.updateCart),
-		},
-		{
-			Path:   "/{id}",
-			Method: "DELETE",
-			Func:   handlers.HttpDelete(c.deleteCart),
-		},
+		handlers.Post("", c.createCart).WithCaller(router.CallerVerified),
+		handlers.Get("/{id}", c.getCart).WithCaller(router.CallerVerified),
+		handlers.Update("/{id}", c.updateCart).WithCaller(router.CallerVerified),
+		handlers.Patch("/{id}", c.getCart, c.updateCart).WithCaller(router.CallerVerified),
+		handlers.Delete("/{id}", c.deleteCart).WithCaller(router.CallerVerified),
+		handlers.Action("/lookup", "Look up the cart of a user", c.lookupCart).WithCaller(router.CallerService),
 	}
 }
 
@@ -135,7 +161,11 @@ func (c *CartRouter) createCart(ctx context.Context, r *http.Request, cart *Cart
 
 	if c.Store == nil {
 		c.processedCreateFailures.Inc()
-		return errors.New("cart store is not initialized")
+		return fmt.Errorf("%w: cart store is not initialized", ErrUnavailable)
+	}
+	if err := checkOwner(ctx, "cart", cart.OwnerID, PermissionCartsWrite); err != nil {
+		c.processedCreateFailures.Inc()
+		return err
 	}
 	if cart.ID == uuid.Nil {
 		cart.ID = uuid.New()
@@ -156,7 +186,7 @@ func (c *CartRouter) getCart(ctx context.Context, r *http.Request) (*Cart, error
 
 	if c.Store == nil {
 		c.processedGetFailures.Inc()
-		return nil, errors.New("cart store is not initialized")
+		return nil, fmt.Errorf("%w: cart store is not initialized", ErrUnavailable)
 	}
 
 	id, err := handlers.GetUUIDFromPathValue(r, "id")
@@ -170,6 +200,12 @@ func (c *CartRouter) getCart(ctx context.Context, r *http.Request) (*Cart, error
 		c.processedGetFailures.Inc()
 		return nil, err
 	}
+	if cart != nil {
+		if err := checkOwner(ctx, "cart", cart.OwnerID, PermissionCartsRead); err != nil {
+			c.processedGetFailures.Inc()
+			return nil, err
+		}
+	}
 
 	return cart, nil
 }
@@ -179,17 +215,30 @@ func (c *CartRouter) updateCart(ctx context.Context, r *http.Request, cart *Cart
 
 	if c.Store == nil {
 		c.processedUpdateFailures.Inc()
-		return errors.New("cart store is not initialized")
+		return fmt.Errorf("%w: cart store is not initialized", ErrUnavailable)
 	}
-
-	if cart.ID == uuid.Nil {
+	id, err := handlers.GetUUIDFromPathValue(r, "id")
+	if err != nil {
+		c.processedUpdateFailures.Inc()
+		return err
+	}
+	if id != cart.ID {
 		c.processedUpdateFailures.Inc()
-		return errors.New("cart ID cannot be empty")
+		return NewValidationError(Violation{Field: "id", Message: "does not match the ID in the path"})
+	}
+	// the cart must neither belong to nor be handed over to another user
+	if err := c.authorizeCart(ctx, id, PermissionCartsWrite); err != nil {
+		c.processedUpdateFailures.Inc()
+		return err
+	}
+	if err := checkOwner(ctx, "cart", cart.OwnerID, PermissionCartsWrite); err != nil {
+		c.processedUpdateFailures.Inc()
+		return err
 	}
 
 	cart.UpdatedAt = time.Now()
 
-	err := c.Store.Update(ctx, cart)
+	err = c.Store.Update(ctx, cart)
 	if err != nil {
 		c.processedUpdateFailures.Inc()
 		return err
@@ -202,7 +251,7 @@ func (c *CartRouter) deleteCart(ctx context.Context, r *http.Request, cart *Cart
 
 	if c.Store == nil {
 		c.processedDeleteFailures.Inc()
-		return errors.New("cart store is not initialized")
+		return fmt.Errorf("%w: cart store is not initialized", ErrUnavailable)
 	}
 	id, err := handlers.GetUUIDFromPathValue(r, "id")
 	if err != nil {
@@ -211,13 +260,59 @@ func (c *CartRouter) deleteCart(ctx context.Context, r *http.Request, cart *Cart
 	}
 	if id != cart.ID {
 		c.processedDeleteFailures.Inc()
-		return errors.New("cart ID from path does not match cart ID in body")
+		return NewValidationError(Violation{Field: "id", Message: "does not match the ID in the path"})
+	}
+	if err := c.authorizeCart(ctx, id, PermissionCartsWrite); err != nil {
+		c.processedDeleteFailures.Inc()
+		return err
 	}
 
-	err = c.Store.Delete(ctx, id)
+	err = c.Store.Delete(ctx, id, cart.Version)
 	if err != nil {
 		c.processedDeleteFailures.Inc()
 		return err
 	}
 	return nil
 }
+
+// authorizeCart ensures the caller may access the stored cart with the ID
+func (c *CartRouter) authorizeCart(ctx context.Context, id uuid.UUID, permission string) error {
+	cart, err := c.Store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if cart == nil {
+		return fmt.Errorf("cart %w", ErrNotFound)
+	}
+	return checkOwner(ctx, "cart", cart.OwnerID, permission)
+}
+
+// CartLookupRequest represents a request for the cart of a user
+type CartLookupRequest struct {
+	OwnerID uuid.UUID `json:"owner_id"`
+}
+
+// Validate implements validation.Validatable.
+func (c CartLookupRequest) Validate(op validation.Operation) error {
+	var v validation.Violations
+	v.NotNilUUID("owner_id", c.OwnerID)
+	return v.Err()
+}
+
+// lookupCart returns the cart of a user. The endpoint is meant for the gateway, which looks up
+// the cart of a user on login, and not exposed through it.
+func (c *CartRouter) lookupCart(ctx context.Context, r *http.Request, req *CartLookupRequest) (*Cart, error) {
+	c.processedLookupRequests.Inc()
+
+	if c.Store == nil {
+		c.processedLookupFailures.Inc()
+		return nil, fmt.Errorf("%w: cart store is not initialized", ErrUnavailable)
+	}
+
+	cart, err := c.Store.GetByOwner(ctx, req.OwnerID)
+	if err != nil {
+		c.processedLookupFailures.Inc()
+		return nil, err
+	}
+	return cart, nil
+}
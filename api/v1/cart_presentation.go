@@ -3,6 +3,7 @@ package v1
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
@@ -62,11 +63,7 @@ func (c *CartPresentationRouter) GetKind() string {
 
 func (c *CartPresentationRouter) Routes() []router.PathObject {
 	return []router.PathObject{
-		{
-			Path:   "/{id}",
-			Method: "GET",
-			Func:   handlers.HttpGet(c.getCartPresentation),
-		},
+		handlers.Get("/{id}", c.getCartPresentation).WithCaller(router.CallerVerified),
 	}
 }
 
@@ -77,14 +74,14 @@ func (c *CartPresentationRouter) getCartPresentation(ctx context.Context, r *htt
 	c.processedGetRequests.Inc()
 
 	if c.CartStore == nil {
-		span.RecordError(errors.New("cart store is not initialized"))
+		span.RecordError(fmt.Errorf("%w: cart store is not initialized", ErrUnavailable))
 		c.processedGetFailures.Inc()
-		return nil, errors.New("cart store is not initialized")
+		return nil, fmt.Errorf("%w: cart store is not initialized", ErrUnavailable)
 	}
 	if c.ItemStore == nil {
-		span.RecordError(errors.New("item store is not initialized"))
+		span.RecordError(fmt.Errorf("%w: item store is not initialized", ErrUnavailable))
 		c.processedGetFailures.Inc()
-		return nil, errors.New("item store is not initialized")
+		return nil, fmt.Errorf("%w: item store is not initialized", ErrUnavailable)
 	}
 
 	cartID, err := handlers.GetUUIDFromPathValue(r, "id")
@@ -102,9 +99,15 @@ func (c *CartPresentationRouter) getCartPresentation(ctx context.Context, r *htt
 	}
 
 	if cart == nil {
-		span.RecordError(errors.New("cart not found"))
+		span.RecordError(fmt.Errorf("cart %w", ErrNotFound))
 		c.processedGetFailures.Inc()
-		return nil, errors.New("cart not found")
+		return nil, fmt.Errorf("cart %w", ErrNotFound)
+	}
+	// the cart is fetched with the identity of this service, which may access all carts
+	if err := checkOwner(ctx, "cart", cart.OwnerID, PermissionCartsRead); err != nil {
+		span.RecordError(err)
+		c.processedGetFailures.Inc()
+		return nil, err
 	}
 
 	if len(cart.Items) == 0 {
@@ -124,7 +127,7 @@ func (c *CartPresentationRouter) getCartPresentation(ctx context.Context, r *htt
 		}
 		if item == nil {
 			c.processedGetFailures.Inc()
-			return nil, errors.New("item not found for cart item")
+			return nil, fmt.Errorf("item %s of cart item %w", cartItem.ItemID, ErrNotFound)
 		}
 		// create CartItemPresentation
 		cartItemPresentation := CartItemPresentation{
@@ -36,15 +36,15 @@ func (m *MockCartPresentationItemStore) Create(ctx context.Context, item *Item)
 	return nil
 }
 
-func (m *MockCartPresentationItemStore) List(ctx context.Context, page, limit int) ([]Item, error) {
+func (m *MockCartPresentationItemStore) List(ctx context.Context, opts ListOptions) ([]Item, int, error) {
 	if m.fail && m.failOn == "item_list" {
-		return nil, errors.New("mock item list error")
+		return nil, 0, errors.New("mock item list error")
 	}
 	items := make([]Item, 0, len(m.items))
 	for _, item := range m.items {
 		items = append(items, *item)
 	}
-	return items, nil
+	return items, len(items), nil
 }
 
 func (m *MockCartPresentationItemStore) Get(ctx context.Context, id uuid.UUID) (*Item, error) {
@@ -66,7 +66,7 @@ func (m *MockCartPresentationItemStore) Update(ctx context.Context, item *Item)
 	return nil
 }
 
-func (m *MockCartPresentationItemStore) Delete(ctx context.Context, id uuid.UUID) error {
+func (m *MockCartPresentationItemStore) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	if m.fail && m.failOn == "item_delete" {
 		return errors.New("mock item delete error")
 	}
@@ -111,6 +111,18 @@ func (m *MockCartPresentationCartStore) Get(ctx context.Context, id uuid.UUID) (
 	return cart, nil
 }
 
+func (m *MockCartPresentationCartStore) GetByOwner(ctx context.Context, ownerID uuid.UUID) (*Cart, error) {
+	if m.fail && m.failOn == "cart_get" {
+		return nil, errors.New("mock cart get error")
+	}
+	for _, cart := range m.carts {
+		if cart.OwnerID == ownerID {
+			return cart, nil
+		}
+	}
+	return nil, nil
+}
+
 func (m *MockCartPresentationCartStore) Update(ctx context.Context, cart *Cart) error {
 	if m.fail && m.failOn == "cart_update" {
 		return errors.New("mock cart update error")
@@ -119,7 +131,7 @@ func (m *MockCartPresentationCartStore) Update(ctx context.Context, cart *Cart)
 	return nil
 }
 
-func (m *MockCartPresentationCartStore) Delete(ctx context.Context, id uuid.UUID) error {
+func (m *MockCartPresentationCartStore) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	if m.fail && m.failOn == "cart_delete" {
 		return errors.New("mock cart delete error")
 	}
@@ -223,7 +235,7 @@ func TestCartPresentationRouter_getCartPresentation_Success(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/presentation/cart/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	presentation, err := router.getCartPresentation(context.Background(), req)
+	presentation, err := router.getCartPresentation(serviceContext(), req)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -274,7 +286,7 @@ func TestCartPresentationRouter_getCartPresentation_EmptyCart(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/presentation/cart/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	presentation, err := router.getCartPresentation(context.Background(), req)
+	presentation, err := router.getCartPresentation(serviceContext(), req)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -302,7 +314,7 @@ func TestCartPresentationRouter_getCartPresentation_CartNotFound(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/presentation/cart/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	presentation, err := router.getCartPresentation(context.Background(), req)
+	presentation, err := router.getCartPresentation(serviceContext(), req)
 
 	if err == nil {
 		t.Error("Expected error for cart not found")
@@ -313,6 +325,29 @@ func TestCartPresentationRouter_getCartPresentation_CartNotFound(t *testing.T) {
 	}
 }
 
+func TestCartPresentationRouter_getCartPresentation_ForeignCart(t *testing.T) {
+	cartStore := NewMockCartPresentationCartStore()
+	itemStore := NewMockCartPresentationItemStore()
+	router := NewCartPresentationRouter(itemStore, cartStore)
+
+	owner := uuid.New()
+	cart := &Cart{ID: uuid.New(), OwnerID: owner, Items: []CartItem{}}
+	cartStore.carts[cart.ID] = cart
+
+	req := httptest.NewRequest("GET", "/api/v1/presentation/cart/"+cart.ID.String(), nil)
+	req.SetPathValue("id", cart.ID.String())
+
+	if _, err := router.getCartPresentation(userContext(uuid.New()), req); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected %v for the cart of another user, got %v", ErrForbidden, err)
+	}
+	if _, err := router.getCartPresentation(userContext(uuid.New(), PermissionCartsRead), req); err != nil {
+		t.Errorf("Expected holders of %s to access the cart, got %v", PermissionCartsRead, err)
+	}
+	if _, err := router.getCartPresentation(userContext(owner), req); err != nil {
+		t.Errorf("Expected the owner to access the cart, got %v", err)
+	}
+}
+
 func TestCartPresentationRouter_getCartPresentation_ItemNotFound(t *testing.T) {
 	cartStore := NewMockCartPresentationCartStore()
 	itemStore := NewMockCartPresentationItemStore()
@@ -336,7 +371,7 @@ func TestCartPresentationRouter_getCartPresentation_ItemNotFound(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/presentation/cart/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	presentation, err := router.getCartPresentation(context.Background(), req)
+	presentation, err := router.getCartPresentation(serviceContext(), req)
 
 	if err == nil {
 		t.Error("Expected error for item not found")
@@ -355,7 +390,7 @@ func TestCartPresentationRouter_getCartPresentation_NilCartStore(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/presentation/cart/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	presentation, err := router.getCartPresentation(context.Background(), req)
+	presentation, err := router.getCartPresentation(serviceContext(), req)
 
 	if err == nil {
 		t.Error("Expected error for nil cart store")
@@ -374,7 +409,7 @@ func TestCartPresentationRouter_getCartPresentation_NilItemStore(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/presentation/cart/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	presentation, err := router.getCartPresentation(context.Background(), req)
+	presentation, err := router.getCartPresentation(serviceContext(), req)
 
 	if err == nil {
 		t.Error("Expected error for nil item store")
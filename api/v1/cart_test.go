@@ -3,11 +3,16 @@ package v1
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
 )
 
 // MockCartStore implements CartStore interface for testing
@@ -47,6 +52,18 @@ func (m *MockCartStore) Get(ctx context.Context, id uuid.UUID) (*Cart, error) {
 	return cart, nil
 }
 
+func (m *MockCartStore) GetByOwner(ctx context.Context, ownerID uuid.UUID) (*Cart, error) {
+	if m.fail && m.failOn == "get" {
+		return nil, errors.New("mock get error")
+	}
+	for _, cart := range m.carts {
+		if cart.OwnerID == ownerID {
+			return cart, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
 func (m *MockCartStore) Update(ctx context.Context, cart *Cart) error {
 	if m.fail && m.failOn == "update" {
 		return errors.New("mock update error")
@@ -55,7 +72,7 @@ func (m *MockCartStore) Update(ctx context.Context, cart *Cart) error {
 	return nil
 }
 
-func (m *MockCartStore) Delete(ctx context.Context, id uuid.UUID) error {
+func (m *MockCartStore) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	if m.fail && m.failOn == "delete" {
 		return errors.New("mock delete error")
 	}
@@ -109,8 +126,8 @@ func TestCartRouter_Routes(t *testing.T) {
 	router := NewCartRouter(NewMockCartStore())
 	routes := router.Routes()
 
-	if len(routes) != 4 {
-		t.Errorf("Expected 4 routes, got %d", len(routes))
+	if len(routes) != 6 {
+		t.Errorf("Expected 6 routes, got %d", len(routes))
 	}
 
 	// Check if routes contain expected methods
@@ -119,7 +136,7 @@ func TestCartRouter_Routes(t *testing.T) {
 		methods[route.Method] = true
 	}
 
-	expectedMethods := []string{"POST", "GET", "PUT", "DELETE"}
+	expectedMethods := []string{"POST", "GET", "PUT", "PATCH", "DELETE"}
 	for _, method := range expectedMethods {
 		if !methods[method] {
 			t.Errorf("Expected method %s not found in routes", method)
@@ -138,7 +155,7 @@ func TestCartRouter_createCart_Success(t *testing.T) {
 	}
 
 	req := httptest.NewRequest("POST", "/api/v1/core/carts", nil)
-	err := router.createCart(context.Background(), req, cart)
+	err := router.createCart(serviceContext(), req, cart)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -160,7 +177,7 @@ func TestCartRouter_createCart_NilStore(t *testing.T) {
 	cart := &Cart{ID: uuid.New()}
 
 	req := httptest.NewRequest("POST", "/api/v1/core/carts", nil)
-	err := router.createCart(context.Background(), req, cart)
+	err := router.createCart(serviceContext(), req, cart)
 
 	if err == nil {
 		t.Error("Expected error for nil store")
@@ -178,7 +195,7 @@ func TestCartRouter_createCart_EmptyOwnerID(t *testing.T) {
 	}
 
 	req := httptest.NewRequest("POST", "/api/v1/core/carts", nil)
-	err := router.createCart(context.Background(), req, cart)
+	err := router.createCart(serviceContext(), req, cart)
 
 	if err != nil {
 		t.Errorf("Expected no error for empty OwnerID, got %v", err)
@@ -197,7 +214,7 @@ func TestCartRouter_createCart_StoreError(t *testing.T) {
 	}
 
 	req := httptest.NewRequest("POST", "/api/v1/core/carts", nil)
-	err := router.createCart(context.Background(), req, cart)
+	err := router.createCart(serviceContext(), req, cart)
 
 	if err == nil {
 		t.Error("Expected error from store")
@@ -221,7 +238,7 @@ func TestCartRouter_getCart_Success(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/core/carts/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	cart, err := router.getCart(context.Background(), req)
+	cart, err := router.getCart(serviceContext(), req)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -244,7 +261,7 @@ func TestCartRouter_getCart_NotFound(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/core/carts/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	cart, err := router.getCart(context.Background(), req)
+	cart, err := router.getCart(serviceContext(), req)
 
 	if err != nil {
 		t.Errorf("Expected no error for cart not found, got %v", err)
@@ -280,7 +297,7 @@ func TestCartRouter_updateCart_Success(t *testing.T) {
 	req := httptest.NewRequest("PUT", "/api/v1/core/carts/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	err := router.updateCart(context.Background(), req, updatedCart)
+	err := router.updateCart(serviceContext(), req, updatedCart)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -308,7 +325,7 @@ func TestCartRouter_deleteCart_Success(t *testing.T) {
 	req := httptest.NewRequest("DELETE", "/api/v1/core/carts/"+cartID.String(), nil)
 	req.SetPathValue("id", cartID.String())
 
-	err := router.deleteCart(context.Background(), req, cart)
+	err := router.deleteCart(serviceContext(), req, cart)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -320,3 +337,119 @@ func TestCartRouter_deleteCart_Success(t *testing.T) {
 		t.Error("Expected cart to be deleted")
 	}
 }
+
+func TestCart_Validate(t *testing.T) {
+	itemID := uuid.New()
+	tests := []struct {
+		name   string
+		op     validation.Operation
+		cart   Cart
+		fields []string
+	}{
+		{
+			name: "valid",
+			op:   validation.Create,
+			cart: Cart{OwnerID: uuid.New(), Items: []CartItem{{ItemID: itemID, Quantity: 2}}},
+		},
+		{
+			name:   "missing owner",
+			op:     validation.Create,
+			cart:   Cart{Items: []CartItem{}},
+			fields: []string{"owner_id"},
+		},
+		{
+			name:   "missing id on update",
+			op:     validation.Update,
+			cart:   Cart{OwnerID: uuid.New()},
+			fields: []string{"id"},
+		},
+		{
+			name: "invalid items",
+			op:   validation.Create,
+			cart: Cart{OwnerID: uuid.New(), Items: []CartItem{
+				{ItemID: itemID, Quantity: 1},
+				{ItemID: uuid.Nil, Quantity: -1},
+				{ItemID: itemID, Quantity: 1},
+			}},
+			fields: []string{"items.1.item_id", "items.1.quantity", "items.2.item_id"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertViolations(t, tt.cart.Validate(tt.op), tt.fields)
+		})
+	}
+}
+
+func TestCartRouter_Callers(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	store := NewMockCartStore()
+	aliceCart := &Cart{ID: uuid.New(), OwnerID: alice, Items: []CartItem{}}
+	bobCart := &Cart{ID: uuid.New(), OwnerID: bob, Items: []CartItem{}}
+	store.carts[aliceCart.ID] = aliceCart
+	store.carts[bobCart.ID] = bobCart
+	serverURL := newServiceServer(t, NewCartRouter(store))
+
+	as := func(identity *router.Identity) string {
+		token, err := identityTokens.Sign(identity)
+		if err != nil {
+			t.Fatalf("Failed to sign identity: %v", err)
+		}
+		return token
+	}
+	anonymous := as(&router.Identity{Anonymous: true})
+	user := as(&router.Identity{UserID: alice, Username: "alice"})
+	support := as(&router.Identity{UserID: uuid.New(), Username: "support", Permissions: []string{PermissionCartsRead}})
+	gateway := as(&router.Identity{Service: "gateway"})
+	cartBody := func(id, owner uuid.UUID) string {
+		return fmt.Sprintf(`{"id":%q,"owner_id":%q,"items":[]}`, id, owner)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{name: "get without token", method: http.MethodGet, path: "/" + aliceCart.ID.String(), expectedStatus: http.StatusUnauthorized},
+		{name: "create without token", method: http.MethodPost, body: cartBody(uuid.Nil, alice), expectedStatus: http.StatusUnauthorized},
+		{name: "get as anonymous", method: http.MethodGet, path: "/" + aliceCart.ID.String(), token: anonymous, expectedStatus: http.StatusForbidden},
+		{name: "get own cart", method: http.MethodGet, path: "/" + aliceCart.ID.String(), token: user, expectedStatus: http.StatusOK},
+		{name: "get foreign cart", method: http.MethodGet, path: "/" + bobCart.ID.String(), token: user, expectedStatus: http.StatusForbidden},
+		{name: "get foreign cart as support", method: http.MethodGet, path: "/" + bobCart.ID.String(), token: support, expectedStatus: http.StatusOK},
+		{name: "get foreign cart as gateway", method: http.MethodGet, path: "/" + bobCart.ID.String(), token: gateway, expectedStatus: http.StatusOK},
+		{name: "create foreign cart", method: http.MethodPost, token: user, body: cartBody(uuid.Nil, bob), expectedStatus: http.StatusForbidden},
+		{name: "update foreign cart", method: http.MethodPut, path: "/" + bobCart.ID.String(), token: user, body: cartBody(bobCart.ID, alice), expectedStatus: http.StatusForbidden},
+		{name: "update foreign cart as support", method: http.MethodPut, path: "/" + bobCart.ID.String(), token: support, body: cartBody(bobCart.ID, bob), expectedStatus: http.StatusForbidden},
+		{name: "hand own cart over", method: http.MethodPut, path: "/" + aliceCart.ID.String(), token: user, body: cartBody(aliceCart.ID, bob), expectedStatus: http.StatusForbidden},
+		{name: "delete foreign cart", method: http.MethodDelete, path: "/" + bobCart.ID.String(), token: user, body: cartBody(bobCart.ID, bob), expectedStatus: http.StatusForbidden},
+		{name: "lookup as user", method: http.MethodPost, path: "/lookup", token: user, body: fmt.Sprintf(`{"owner_id":%q}`, bob), expectedStatus: http.StatusForbidden},
+		{name: "lookup as gateway", method: http.MethodPost, path: "/lookup", token: gateway, body: fmt.Sprintf(`{"owner_id":%q}`, bob), expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, serverURL+"/api/v1/core/carts"+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set(router.HeaderIdentityToken, tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+	if len(store.carts) != 2 || store.carts[bobCart.ID].OwnerID != bob || store.carts[aliceCart.ID].OwnerID != alice {
+		t.Error("Expected the carts not to be changed")
+	}
+}
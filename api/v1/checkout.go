@@ -2,13 +2,14 @@ package v1
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
 	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -16,17 +17,33 @@ type Checkout struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"`
 	UserID    uuid.UUID `json:"user_id"`
 	CartID    uuid.UUID `json:"cart_id"`
 	Total     float64   `json:"total"`
-	Status    string    `json:"status"` // e.g., "pending", "completed", "failed"
+	Status    string    `json:"status"` // one of CheckoutStatuses
+}
+
+// CheckoutStatuses lists the valid values of Checkout.Status
+var CheckoutStatuses = []string{"pending", "completed", "failed"}
+
+// Validate implements validation.Validatable.
+func (c Checkout) Validate(op validation.Operation) error {
+	var v validation.Violations
+	v.NotNilUUID("user_id", c.UserID)
+	v.NotNilUUID("cart_id", c.CartID)
+	v.Check(c.Total > 0, "total", "must be greater than zero")
+	v.OneOf("status", c.Status, CheckoutStatuses...)
+	return v.Err()
 }
 
 type CheckoutStore interface {
 	Create(ctx context.Context, checkout *Checkout) error
 	Get(ctx context.Context, id uuid.UUID) (*Checkout, error)
+	// Update replaces the object and increments its version, a non-zero version must match the stored one.
 	Update(ctx context.Context, checkout *Checkout) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	// Delete deletes the object if its version matches, a version of 0 deletes it unconditionally.
+	Delete(ctx context.Context, id uuid.UUID, version int64) error
 }
 
 type CheckoutRouter struct {
@@ -93,36 +110,22 @@ func (c *CheckoutRouter) GetKind() string {
 }
 
 func (c *CheckoutRouter) Routes() []router.PathObject {
+	// checkouts belong to their users, the gateway and the handlers check the ownership
 	return []router.PathObject{
-		{
-			Method: "POST",
-			Func:   handlers.HttpPost(c.createCheckout),
-		},
-		{
-			Method: "GET",
-			Func:   handlers.HttpGet(c.getCheckout),
-		},
-		{
-			Method: "PUT",
-			Func:   handlers.HttpUpdate(c.updateCheckout),
-		},
-		{
-			Method: "DELETE",
-			Func:   handlers.HttpDelete(c.deleteCheckout),
-		},
+		handlers.Post("", c.createCheckout).WithCaller(router.CallerVerified),
+		handlers.Get("/{id}", c.getCheckout).WithCaller(router.CallerVerified),
+		handlers.Update("/{id}", c.updateCheckout).WithCaller(router.CallerVerified),
+		handlers.Patch("/{id}", c.getCheckout, c.updateCheckout).WithCaller(router.CallerVerified),
+		handlers.Delete("/{id}", c.deleteCheckout).WithCaller(router.CallerVerified),
 	}
 }
 
 func (c *CheckoutRouter) createCheckout(ctx context.Context, r *http.Request, checkout *Checkout) error {
 	c.processedCreateRequests.Inc()
 
-	if checkout.UserID == uuid.Nil {
+	if err := checkOwner(ctx, "checkout", checkout.UserID, PermissionCheckoutsWrite); err != nil {
 		c.processedCreateFailures.Inc()
-		return errors.New("UserID cannot be nil")
-	}
-	if checkout.CartID == uuid.Nil {
-		c.processedCreateFailures.Inc()
-		return errors.New("CartID cannot be nil")
+		return err
 	}
 
 	err := c.Store.Create(ctx, checkout)
@@ -147,6 +150,10 @@ func (c *CheckoutRouter) getCheckout(ctx context.Context, r *http.Request) (*Che
 		c.processedGetFailures.Inc()
 		return nil, err
 	}
+	if err := checkOwner(ctx, "checkout", checkout.UserID, PermissionCheckoutsRead); err != nil {
+		c.processedGetFailures.Inc()
+		return nil, err
+	}
 
 	return checkout, nil
 }
@@ -154,7 +161,26 @@ func (c *CheckoutRouter) getCheckout(ctx context.Context, r *http.Request) (*Che
 func (c *CheckoutRouter) updateCheckout(ctx context.Context, r *http.Request, checkout *Checkout) error {
 	c.processedUpdateRequests.Inc()
 
-	err := c.Store.Update(ctx, checkout)
+	id, err := handlers.GetUUIDFromPathValue(r, "id")
+	if err != nil {
+		c.processedUpdateFailures.Inc()
+		return err
+	}
+	if id != checkout.ID {
+		c.processedUpdateFailures.Inc()
+		return NewValidationError(Violation{Field: "id", Message: "does not match the ID in the path"})
+	}
+	// the checkout must neither belong to nor be handed over to another user
+	if err := c.authorizeCheckout(ctx, id, PermissionCheckoutsWrite); err != nil {
+		c.processedUpdateFailures.Inc()
+		return err
+	}
+	if err := checkOwner(ctx, "checkout", checkout.UserID, PermissionCheckoutsWrite); err != nil {
+		c.processedUpdateFailures.Inc()
+		return err
+	}
+
+	err = c.Store.Update(ctx, checkout)
 	if err != nil {
 		c.processedUpdateFailures.Inc()
 		return err
@@ -167,13 +193,35 @@ func (c *CheckoutRouter) deleteCheckout(ctx context.Context, r *http.Request, ch
 
 	if checkout == nil {
 		c.processedDeleteFailures.Inc()
-		return errors.New("checkout cannot be nil")
+		return fmt.Errorf("%w: checkout cannot be nil", ErrValidation)
+	}
+	id, err := handlers.GetUUIDFromPathValue(r, "id")
+	if err != nil {
+		c.processedDeleteFailures.Inc()
+		return err
+	}
+	if id != checkout.ID {
+		c.processedDeleteFailures.Inc()
+		return NewValidationError(Violation{Field: "id", Message: "does not match the ID in the path"})
+	}
+	if err := c.authorizeCheckout(ctx, id, PermissionCheckoutsWrite); err != nil {
+		c.processedDeleteFailures.Inc()
+		return err
 	}
 
-	err := c.Store.Delete(ctx, checkout.ID)
+	err = c.Store.Delete(ctx, checkout.ID, checkout.Version)
 	if err != nil {
 		c.processedDeleteFailures.Inc()
 		return err
 	}
 	return nil
 }
+
+// authorizeCheckout ensures the caller may access the stored checkout with the ID
+func (c *CheckoutRouter) authorizeCheckout(ctx context.Context, id uuid.UUID, permission string) error {
+	checkout, err := c.Store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return checkOwner(ctx, "checkout", checkout.UserID, permission)
+}
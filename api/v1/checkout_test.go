@@ -3,11 +3,17 @@ package v1
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
 )
 
 // MockCheckoutStore implements CheckoutStore interface for testing
@@ -56,7 +62,7 @@ func (m *MockCheckoutStore) Update(ctx context.Context, checkout *Checkout) erro
 	return nil
 }
 
-func (m *MockCheckoutStore) Delete(ctx context.Context, id uuid.UUID) error {
+func (m *MockCheckoutStore) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	if m.shouldError {
 		return errors.New("mock error")
 	}
@@ -77,7 +83,7 @@ func TestCheckoutRouter_createCheckout_Success(t *testing.T) {
 	}
 
 	req := httptest.NewRequest("POST", "/api/v1/core/checkouts", nil)
-	err := router.createCheckout(context.Background(), req, checkout)
+	err := router.createCheckout(serviceContext(), req, checkout)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -108,7 +114,7 @@ func TestCheckoutRouter_createCheckout_StoreError(t *testing.T) {
 	}
 
 	req := httptest.NewRequest("POST", "/api/v1/core/checkouts", nil)
-	err := router.createCheckout(context.Background(), req, checkout)
+	err := router.createCheckout(serviceContext(), req, checkout)
 
 	if err == nil {
 		t.Error("Expected error from store")
@@ -127,11 +133,10 @@ func TestCheckoutRouter_createCheckout_InvalidUserID(t *testing.T) {
 		Status: "pending",
 	}
 
-	req := httptest.NewRequest("POST", "/api/v1/core/checkouts", nil)
-	err := router.createCheckout(context.Background(), req, checkout)
+	rec := serveJSON(t, handlers.HttpPost(router.createCheckout), "POST", "/api/v1/core/checkouts", checkout)
 
-	if err == nil {
-		t.Error("Expected error for empty UserID")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for empty UserID, got %d", rec.Code)
 	}
 }
 
@@ -147,11 +152,10 @@ func TestCheckoutRouter_createCheckout_InvalidCartID(t *testing.T) {
 		Status: "pending",
 	}
 
-	req := httptest.NewRequest("POST", "/api/v1/core/checkouts", nil)
-	err := router.createCheckout(context.Background(), req, checkout)
+	rec := serveJSON(t, handlers.HttpPost(router.createCheckout), "POST", "/api/v1/core/checkouts", checkout)
 
-	if err == nil {
-		t.Error("Expected error for empty CartID")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for empty CartID, got %d", rec.Code)
 	}
 }
 
@@ -174,7 +178,7 @@ func TestCheckoutRouter_getCheckout_Success(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/core/checkouts/"+checkoutID.String(), nil)
 	req.SetPathValue("id", checkoutID.String())
 
-	retrievedCheckout, err := router.getCheckout(context.Background(), req)
+	retrievedCheckout, err := router.getCheckout(serviceContext(), req)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -201,7 +205,7 @@ func TestCheckoutRouter_getCheckout_NotFound(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/core/checkouts/"+checkoutID.String(), nil)
 	req.SetPathValue("id", checkoutID.String())
 
-	checkout, err := router.getCheckout(context.Background(), req)
+	checkout, err := router.getCheckout(serviceContext(), req)
 
 	if err == nil {
 		t.Error("Expected error for non-existent checkout")
@@ -239,7 +243,7 @@ func TestCheckoutRouter_updateCheckout_Success(t *testing.T) {
 	req := httptest.NewRequest("PUT", "/api/v1/core/checkouts/"+checkoutID.String(), nil)
 	req.SetPathValue("id", checkoutID.String())
 
-	err := router.updateCheckout(context.Background(), req, updatedCheckout)
+	err := router.updateCheckout(serviceContext(), req, updatedCheckout)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -273,7 +277,7 @@ func TestCheckoutRouter_deleteCheckout_Success(t *testing.T) {
 	req := httptest.NewRequest("DELETE", "/api/v1/core/checkouts/"+checkoutID.String(), nil)
 	req.SetPathValue("id", checkoutID.String())
 
-	err := router.deleteCheckout(context.Background(), req, checkout)
+	err := router.deleteCheckout(serviceContext(), req, checkout)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -286,15 +290,107 @@ func TestCheckoutRouter_deleteCheckout_Success(t *testing.T) {
 	}
 }
 
+func TestCheckoutRouter_IDMismatch(t *testing.T) {
+	store := NewMockCheckoutStore()
+	router := NewCheckoutRouter(store)
+
+	victim := &Checkout{ID: uuid.New(), CartID: uuid.New(), UserID: uuid.New(), Total: 99.99, Status: "pending"}
+	store.checkouts[victim.ID] = victim
+	body := &Checkout{ID: victim.ID, CartID: uuid.New(), UserID: uuid.New(), Total: 1, Status: "completed"}
+
+	// the checkout in the body must be the one in the path
+	req := httptest.NewRequest("PUT", "/api/v1/core/checkouts/"+uuid.NewString(), nil)
+	req.SetPathValue("id", uuid.NewString())
+	if err := router.updateCheckout(serviceContext(), req, body); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected update to fail with %v, got %v", ErrValidation, err)
+	}
+	if err := router.deleteCheckout(serviceContext(), req, body); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected delete to fail with %v, got %v", ErrValidation, err)
+	}
+	if store.checkouts[victim.ID] != victim {
+		t.Error("Expected the checkout in the body to be left untouched")
+	}
+}
+
 func TestCheckoutRouter_deleteCheckout_NilCheckout(t *testing.T) {
 	store := NewMockCheckoutStore()
 	router := NewCheckoutRouter(store)
 
 	req := httptest.NewRequest("DELETE", "/api/v1/core/checkouts/"+uuid.New().String(), nil)
 
-	err := router.deleteCheckout(context.Background(), req, nil)
+	err := router.deleteCheckout(serviceContext(), req, nil)
 
 	if err == nil {
 		t.Error("Expected error for nil checkout")
 	}
 }
+
+func TestCheckout_Validate(t *testing.T) {
+	valid := Checkout{UserID: uuid.New(), CartID: uuid.New(), Total: 19.99, Status: "pending"}
+	assertViolations(t, valid.Validate(validation.Create), nil)
+
+	invalid := Checkout{Total: 0, Status: "shipped"}
+	assertViolations(t, invalid.Validate(validation.Create), []string{"user_id", "cart_id", "total", "status"})
+}
+
+func TestCheckoutRouter_Callers(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	store := NewMockCheckoutStore()
+	bobCheckout := &Checkout{ID: uuid.New(), UserID: bob, CartID: uuid.New(), Total: 10, Status: "pending"}
+	store.checkouts[bobCheckout.ID] = bobCheckout
+	serverURL := newServiceServer(t, NewCheckoutRouter(store))
+
+	as := func(identity *router.Identity) string {
+		token, err := identityTokens.Sign(identity)
+		if err != nil {
+			t.Fatalf("Failed to sign identity: %v", err)
+		}
+		return token
+	}
+	user := as(&router.Identity{UserID: alice, Username: "alice"})
+	support := as(&router.Identity{UserID: uuid.New(), Username: "support", Permissions: []string{PermissionCheckoutsRead}})
+	checkoutBody := func(id, userID uuid.UUID) string {
+		return fmt.Sprintf(`{"id":%q,"user_id":%q,"cart_id":%q,"total":10,"status":"completed"}`, id, userID, bobCheckout.CartID)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{name: "get without token", method: http.MethodGet, path: "/" + bobCheckout.ID.String(), expectedStatus: http.StatusUnauthorized},
+		{name: "get foreign checkout", method: http.MethodGet, path: "/" + bobCheckout.ID.String(), token: user, expectedStatus: http.StatusForbidden},
+		{name: "get foreign checkout as support", method: http.MethodGet, path: "/" + bobCheckout.ID.String(), token: support, expectedStatus: http.StatusOK},
+		{name: "create foreign checkout", method: http.MethodPost, token: user, body: checkoutBody(uuid.New(), bob), expectedStatus: http.StatusForbidden},
+		{name: "update foreign checkout", method: http.MethodPut, path: "/" + bobCheckout.ID.String(), token: user, body: checkoutBody(bobCheckout.ID, alice), expectedStatus: http.StatusForbidden},
+		{name: "update foreign checkout as support", method: http.MethodPut, path: "/" + bobCheckout.ID.String(), token: support, body: checkoutBody(bobCheckout.ID, bob), expectedStatus: http.StatusForbidden},
+		{name: "delete foreign checkout", method: http.MethodDelete, path: "/" + bobCheckout.ID.String(), token: user, body: checkoutBody(bobCheckout.ID, bob), expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, serverURL+"/api/v1/core/checkouts"+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set(router.HeaderIdentityToken, tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+	if len(store.checkouts) != 1 || store.checkouts[bobCheckout.ID].Status != "pending" {
+		t.Error("Expected the checkouts not to be changed")
+	}
+}
@@ -0,0 +1,38 @@
+package v1
+
+import "github.com/leonsteinhaeuser/demo-shop/internal/router"
+
+// The domain errors returned by the stores and routers of this package.
+// Use errors.Is to check for them, the HTTP clients in clients/v1 return the same values.
+var (
+	// ErrNotFound is returned if the requested resource does not exist
+	ErrNotFound = router.ErrNotFound
+	// ErrConflict is returned if the request conflicts with the current state of a resource
+	ErrConflict = router.ErrConflict
+	// ErrAlreadyExists is returned by stores if a resource with the same ID already exists, it is a more specific ErrConflict
+	ErrAlreadyExists = router.ErrAlreadyExists
+	// ErrPreconditionFailed is returned if the expected version of a resource does not match the stored one, it is a more specific ErrConflict
+	ErrPreconditionFailed = router.ErrPreconditionFailed
+	// ErrValidation is returned if the request contains invalid data
+	ErrValidation = router.ErrValidation
+	// ErrUnauthorized is returned if the request lacks valid authentication
+	ErrUnauthorized = router.ErrUnauthorized
+	// ErrForbidden is returned if the caller is not allowed to perform the request
+	ErrForbidden = router.ErrForbidden
+	// ErrUnavailable is returned if a required backend is not available
+	ErrUnavailable = router.ErrUnavailable
+	// ErrUnsupportedMediaType is returned if the content type of the request body is not supported
+	ErrUnsupportedMediaType = router.ErrUnsupportedMediaType
+)
+
+type (
+	// Violation describes why the value of a single request field is invalid
+	Violation = router.Violation
+	// ValidationError reports all invalid fields of a request, it wraps ErrValidation
+	ValidationError = router.ValidationError
+)
+
+// NewValidationError returns a ValidationError for the given violations.
+func NewValidationError(violations ...Violation) error {
+	return router.NewValidationError(violations...)
+}
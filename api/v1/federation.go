@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
+)
+
+// maxUsernameAttempts limits the usernames tried for a new federated user before giving up
+const maxUsernameAttempts = 5
+
+// FederatedIdentity is a user authenticated by an OpenID Connect provider, as described by the
+// claims of its ID token.
+type FederatedIdentity struct {
+	Issuer            string `json:"issuer"`
+	Subject           string `json:"subject"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	Locale            string `json:"locale,omitempty"`
+}
+
+// Validate implements validation.Validatable.
+// The email is required as every user has one, providers release it with the email scope.
+func (f FederatedIdentity) Validate(op validation.Operation) error {
+	var v validation.Violations
+	v.NotEmpty("issuer", f.Issuer)
+	v.NotEmpty("subject", f.Subject)
+	v.NotEmpty("email", f.Email)
+	return v.Err()
+}
+
+// UserProvisioner returns the user logging in with an identity provider, creating it on the
+// first login. It is implemented by the user client for the gateway.
+type UserProvisioner interface {
+	ProvisionUser(ctx context.Context, identity *FederatedIdentity) (*User, error)
+}
+
+// ProvisionUser returns the user linked to the identity. Unknown identities get a new user
+// without a password, known ones get the claims of the identity applied to their user if
+// they changed at the provider. Existing users are never linked by their email, the provider
+// may not have verified it.
+func ProvisionUser(ctx context.Context, store UserStore, identity *FederatedIdentity) (*User, error) {
+	user, err := store.GetBySubject(ctx, identity.Issuer, identity.Subject)
+	if errors.Is(err, ErrNotFound) {
+		return createFederatedUser(ctx, store, identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req := &UserModificationRequest{User: *user}
+	if !applyClaims(&req.User, identity) {
+		return user, nil
+	}
+	req.UpdatedAt = time.Now()
+	if err := store.Update(ctx, req); err != nil {
+		return nil, fmt.Errorf("failed to update user %s: %w", user.ID, err)
+	}
+	return &req.User, nil
+}
+
+// createFederatedUser creates the user for an identity logging in for the first time. The
+// username is taken from the identity and made unique with a random suffix if it is taken.
+func createFederatedUser(ctx context.Context, store UserStore, identity *FederatedIdentity) (*User, error) {
+	username := identity.PreferredUsername
+	if username == "" {
+		username = identity.Email
+	}
+	now := time.Now()
+	for attempt := range maxUsernameAttempts {
+		candidate := username
+		if attempt > 0 {
+			candidate = username + "-" + strings.ToLower(rand.Text()[:6])
+		}
+		req := &UserModificationRequest{
+			User: User{
+				ID:        uuid.New(),
+				CreatedAt: now,
+				UpdatedAt: now,
+				Username:  &candidate,
+				Issuer:    &identity.Issuer,
+				Subject:   &identity.Subject,
+			},
+		}
+		applyClaims(&req.User, identity)
+		err := store.Create(ctx, req)
+		if err == nil {
+			return &req.User, nil
+		}
+		if !errors.Is(err, ErrAlreadyExists) {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		// a concurrent login of the same identity may have created the user in the meantime
+		if user, err := store.GetBySubject(ctx, identity.Issuer, identity.Subject); err == nil {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no free username for %q", ErrConflict, username)
+}
+
+// applyClaims sets the user fields mapped from the claims of the identity and reports whether
+// any of them changed. Claims the provider did not release leave the fields alone.
+func applyClaims(user *User, identity *FederatedIdentity) bool {
+	changed := false
+	set := func(field **string, claim string) {
+		if claim == "" || (*field != nil && **field == claim) {
+			return
+		}
+		*field = &claim
+		changed = true
+	}
+	set(&user.Email, identity.Email)
+	set(&user.GivenName, identity.GivenName)
+	set(&user.FamilyName, identity.FamilyName)
+	set(&user.Locale, identity.Locale)
+	if user.EmailVerified != identity.EmailVerified {
+		user.EmailVerified = identity.EmailVerified
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,129 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
+)
+
+func newFederatedIdentity() *FederatedIdentity {
+	return &FederatedIdentity{
+		Issuer:            "https://idp.example.com",
+		Subject:           "248289761001",
+		PreferredUsername: "jane",
+		Email:             "jane@example.com",
+		EmailVerified:     true,
+		GivenName:         "Jane",
+		FamilyName:        "Doe",
+		Locale:            "en-US",
+	}
+}
+
+func TestFederatedIdentity_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*FederatedIdentity)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(*FederatedIdentity) {}},
+		{name: "only required claims", modify: func(f *FederatedIdentity) {
+			*f = FederatedIdentity{Issuer: f.Issuer, Subject: f.Subject, Email: f.Email}
+		}},
+		{name: "missing issuer", modify: func(f *FederatedIdentity) { f.Issuer = "" }, wantErr: true},
+		{name: "missing subject", modify: func(f *FederatedIdentity) { f.Subject = "" }, wantErr: true},
+		{name: "missing email", modify: func(f *FederatedIdentity) { f.Email = "" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity := newFederatedIdentity()
+			tt.modify(identity)
+			err := identity.Validate(validation.Create)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestProvisionUser(t *testing.T) {
+	ctx := context.Background()
+	store := NewMockUserStore()
+	identity := newFederatedIdentity()
+
+	user, err := ProvisionUser(ctx, store, identity)
+	if err != nil {
+		t.Fatalf("ProvisionUser failed: %v", err)
+	}
+	if *user.Username != "jane" || *user.Email != identity.Email || !user.EmailVerified ||
+		*user.GivenName != "Jane" || *user.FamilyName != "Doe" || *user.Locale != "en-US" {
+		t.Errorf("Expected the claims to be mapped to the user, got %+v", user)
+	}
+	if *user.Issuer != identity.Issuer || *user.Subject != identity.Subject {
+		t.Errorf("Expected the user to be linked to %s %s, got %v %v", identity.Issuer, identity.Subject, user.Issuer, user.Subject)
+	}
+	if _, hasPassword := store.passwords[user.ID]; hasPassword {
+		t.Error("Expected federated users not to have a password")
+	}
+
+	again, err := ProvisionUser(ctx, store, identity)
+	if err != nil {
+		t.Fatalf("ProvisionUser failed on the second login: %v", err)
+	}
+	if again.ID != user.ID || len(store.users) != 1 {
+		t.Errorf("Expected the second login to return user %s, got %s with %d users", user.ID, again.ID, len(store.users))
+	}
+
+	identity.Email = "jane.doe@example.com"
+	updated, err := ProvisionUser(ctx, store, identity)
+	if err != nil {
+		t.Fatalf("ProvisionUser failed after the email changed: %v", err)
+	}
+	if updated.ID != user.ID || *store.users[user.ID].Email != identity.Email {
+		t.Errorf("Expected the changed email to be stored, got %s", *store.users[user.ID].Email)
+	}
+}
+
+func TestProvisionUser_UsernameTaken(t *testing.T) {
+	ctx := context.Background()
+	store := NewMockUserStore()
+	if _, err := ProvisionUser(ctx, store, newFederatedIdentity()); err != nil {
+		t.Fatalf("ProvisionUser failed: %v", err)
+	}
+
+	// another account of the provider with the same preferred username
+	identity := newFederatedIdentity()
+	identity.Subject = "other"
+	user, err := ProvisionUser(ctx, store, identity)
+	if err != nil {
+		t.Fatalf("ProvisionUser failed: %v", err)
+	}
+	if !strings.HasPrefix(*user.Username, "jane-") {
+		t.Errorf("Expected a username with a random suffix, got %s", *user.Username)
+	}
+
+	// without a preferred username the email is used
+	identity = newFederatedIdentity()
+	identity.Subject = "third"
+	identity.PreferredUsername = ""
+	user, err = ProvisionUser(ctx, store, identity)
+	if err != nil {
+		t.Fatalf("ProvisionUser failed: %v", err)
+	}
+	if *user.Username != identity.Email {
+		t.Errorf("Expected the email as username, got %s", *user.Username)
+	}
+}
+
+func TestProvisionUser_StoreError(t *testing.T) {
+	store := NewMockUserStore()
+	store.SetFailure("create")
+
+	_, err := ProvisionUser(context.Background(), store, newFederatedIdentity())
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the store error, got %v", err)
+	}
+}
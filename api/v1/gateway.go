@@ -2,18 +2,23 @@ package v1
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
-	"strings"
+	"net/netip"
+	"reflect"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/oidc"
+	"github.com/leonsteinhaeuser/demo-shop/internal/openapi"
 	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/securecookie"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 )
@@ -35,34 +40,153 @@ type LoginResponse struct {
 	CartID string `json:"cart_id"`
 }
 
-// SessionData represents the data stored in the secure cookie
-type SessionData struct {
-	UserID   string `json:"user_id"`
-	CartID   string `json:"cart_id"`
-	Username string `json:"username"`
-	Exp      int64  `json:"exp"`
+// SessionRevocationResponse reports how many sessions have been revoked
+type SessionRevocationResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+const (
+	// defaultSessionIdleTimeout ends sessions that have not been used for this long
+	defaultSessionIdleTimeout = 24 * time.Hour
+	// defaultSessionMaxLifetime ends sessions this long after the login, regardless of their activity
+	defaultSessionMaxLifetime = 7 * 24 * time.Hour
+	// sessionTouchInterval limits how often the activity of a session is written to the store
+	sessionTouchInterval = time.Minute
+)
+
+// internalPaths are served by the upstream services for the gateway only, they are neither
+// proxied nor part of the aggregated OpenAPI document
+var internalPaths = []string{
+	"/api/v1/core/users/validate",
+	"/api/v1/core/users/lookup",
+	"/api/v1/core/users/provision",
+	"/api/v1/core/users/apikeys/validate",
+	"/api/v1/core/carts/lookup",
+}
+
+// CredentialValidator validates the credentials of users. It is implemented by the UserStores
+// and the UserClient of the user service.
+type CredentialValidator interface {
+	// ValidateCredentials returns the user if the password is valid, otherwise an error wrapping ErrUnauthorized
+	ValidateCredentials(ctx context.Context, username, password string) (*User, error)
 }
 
 // Gateway handles authentication and request proxying
 type Gateway struct {
-	userServiceURL             string
-	cartServiceURL             string
-	itemServiceURL             string
-	checkoutServiceURL         string
-	cartPresentationServiceURL string
-	cookieKey                  []byte
+	routes atomic.Pointer[routeTable]
+	// transport is shared by the proxies of all upstreams, so connections are reused across reloads
+	transport      *http.Transport
+	credentials    CredentialValidator
+	cookies        *securecookie.Codec
+	sessions       SessionStore
+	identityTokens *router.IdentityTokens
+	oidc           *oidc.Provider
+	provisioner    UserProvisioner
+	apiKeys        APIKeyValidator
+	trustedProxies []netip.Prefix
+	// dependencies checks the upstreams of the routes, the services named in criticalDependencies
+	// decide the readiness of the gateway
+	dependencies         *DependencyChecker
+	criticalDependencies []string
+	lockout              *loginLockout
+	// apiKeyLockout counts invalid API keys by client IP
+	apiKeyLockout      *loginLockout
+	sessionIdleTimeout time.Duration
+	sessionMaxLifetime time.Duration
+	auth               *http.ServeMux
+	// policies authorizes the requests of routes with the RouteAuthPolicies policy
+	policies http.Handler
+	proxy    http.Handler
+}
+
+// NewGateway creates a new gateway instance.
+// Requests are passed on to the upstream services as configured by routes, see SetRoutes.
+// Logins are verified by credentials, usually a client of the user service.
+// Sessions are kept in the given store, the session cookie only holds their encrypted ID.
+// Session cookies are encrypted with cookieEncryptionKey, cookies encrypted with one of the
+// previousCookieKeys are still accepted, which allows rotating the key without ending all sessions.
+// It panics if one of the keys is empty or routes is invalid, a nil routes proxies nothing.
+func NewGateway(routes *RouteConfig, credentials CredentialValidator, sessions SessionStore, cookieEncryptionKey []byte, previousCookieKeys ...[]byte) *Gateway {
+	g := &Gateway{
+		credentials:        credentials,
+		cookies:            securecookie.Must(securecookie.New(cookieEncryptionKey, previousCookieKeys...)),
+		sessions:           sessions,
+		sessionIdleTimeout: defaultSessionIdleTimeout,
+		sessionMaxLifetime: defaultSessionMaxLifetime,
+		auth:               http.NewServeMux(),
+		transport:          newUpstreamTransport(),
+		lockout:            newLoginLockout(defaultLoginMaxFailures, defaultLoginLockoutDuration),
+		apiKeyLockout:      newLoginLockout(defaultLoginMaxFailures, defaultLoginLockoutDuration),
+	}
+
+	// the routes are served with and without the prefix stripped by RegisterRoutes
+	for _, prefix := range []string{"", "/api/v1/auth"} {
+		g.auth.HandleFunc("POST "+prefix+"/login", g.handleLogin)
+		g.auth.HandleFunc("POST "+prefix+"/logout", g.handleLogout)
+		g.auth.HandleFunc("GET "+prefix+"/sessions", g.handleListSessions)
+		g.auth.HandleFunc("DELETE "+prefix+"/sessions", g.handleRevokeSessions)
+		g.auth.HandleFunc("DELETE "+prefix+"/sessions/{id}", g.handleRevokeSession)
+		g.auth.HandleFunc("GET "+prefix+"/users/{id}/sessions", g.handleListSessions)
+		g.auth.HandleFunc("DELETE "+prefix+"/users/{id}/sessions", g.handleRevokeSessions)
+		g.auth.HandleFunc("GET "+prefix+"/oidc/login", g.handleOIDCLogin)
+		g.auth.HandleFunc("GET "+prefix+"/oidc/callback", g.handleOIDCCallback)
+	}
+	g.auth.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		(&router.ErrorResponse{
+			Status:  http.StatusNotFound,
+			Path:    r.URL.Path,
+			Message: "endpoint not found",
+		}).WriteTo(w)
+	})
+	g.policies = g.newPolicyHandler(http.HandlerFunc(g.proxyToService))
+	g.proxy = http.HandlerFunc(g.serveRoute)
+	if routes != nil {
+		if err := g.SetRoutes(routes); err != nil {
+			panic(fmt.Sprintf("invalid routes: %v", err))
+		}
+	}
+	return g
+}
+
+// SetSessionTimeouts configures the sliding expiration of sessions. A session ends if it
+// has not been used for idleTimeout, and maxLifetime after the login at the latest.
+func (g *Gateway) SetSessionTimeouts(idleTimeout, maxLifetime time.Duration) {
+	g.sessionIdleTimeout = idleTimeout
+	g.sessionMaxLifetime = maxLifetime
+}
+
+// SetIdentityTokens configures the signing of the identity tokens passed on to the upstream
+// services. Requests made on behalf of a user are answered with 503 until it is set.
+func (g *Gateway) SetIdentityTokens(tokens *router.IdentityTokens) {
+	g.identityTokens = tokens
 }
 
-// NewGateway creates a new gateway instance
-func NewGateway(userServiceURL, cartServiceURL, itemServiceURL, checkoutServiceURL, cartPresentationServiceURL string, cookieEncryptionKey []byte) *Gateway {
-	return &Gateway{
-		userServiceURL:             userServiceURL,
-		cartServiceURL:             cartServiceURL,
-		itemServiceURL:             itemServiceURL,
-		checkoutServiceURL:         checkoutServiceURL,
-		cartPresentationServiceURL: cartPresentationServiceURL,
-		cookieKey:                  cookieEncryptionKey,
+// signIdentity returns the identity token of the session
+func (g *Gateway) signIdentity(session *Session) (string, error) {
+	if g.identityTokens == nil {
+		return "", fmt.Errorf("%w: identity tokens are not configured", ErrUnavailable)
 	}
+	return g.identityTokens.Sign(session.Identity())
+}
+
+// signAnonymous returns the identity token of requests without a session, it tells the
+// upstream services that the request has been passed on by the gateway. Requests are passed
+// on without a token until identity tokens are configured.
+func (g *Gateway) signAnonymous() (string, error) {
+	if g.identityTokens == nil {
+		return "", nil
+	}
+	return g.identityTokens.Sign(&router.Identity{Anonymous: true})
+}
+
+// signService returns the identity token of the requests the gateway sends on its own behalf,
+// e.g. to look up the cart of a user on login. They are sent without a token until identity
+// tokens are configured.
+func (g *Gateway) signService() (string, error) {
+	if g.identityTokens == nil {
+		return "", nil
+	}
+	return g.identityTokens.Sign(&router.Identity{Service: "gateway"})
 }
 
 func (g *Gateway) GetApiVersion() string {
@@ -80,38 +204,18 @@ func (g *Gateway) GetKind() string {
 func (g *Gateway) RegisterRoutes(mux *http.ServeMux) {
 	// Authentication routes
 	authPattern := fmt.Sprintf("/api/%s/auth/", g.GetApiVersion())
-	mux.Handle(authPattern, http.StripPrefix(authPattern[:len(authPattern)-1], g))
+	mux.Handle(authPattern, g.limitAuth(http.StripPrefix(authPattern[:len(authPattern)-1], g)))
 
-	// Proxy routes for other services
-	mux.HandleFunc("/api/v1/core/users", g.proxyToService)
-	mux.HandleFunc("/api/v1/core/users/", g.proxyToService)
-	mux.HandleFunc("/api/v1/core/carts", g.proxyToService)
-	mux.HandleFunc("/api/v1/core/carts/", g.proxyToService)
-	mux.HandleFunc("/api/v1/core/items", g.proxyToService)
-	mux.HandleFunc("/api/v1/core/items/", g.proxyToService)
-	mux.HandleFunc("/api/v1/core/checkouts", g.proxyToService)
-	mux.HandleFunc("/api/v1/core/checkouts/", g.proxyToService)
-	mux.HandleFunc("/api/v1/presentation/cart", g.proxyToService)
-	mux.HandleFunc("/api/v1/presentation/cart/", g.proxyToService)
+	// State of the upstreams, e.g. their circuit breakers
+	statusPattern := fmt.Sprintf("GET /api/%s/gateway/status", g.GetApiVersion())
+	mux.Handle(statusPattern, g.enforce(routePolicy{permission: PermissionGatewayRead}, http.HandlerFunc(g.handleStatus)))
+
+	// All other requests are matched against the route table, which may change at runtime
+	mux.Handle("/", g.proxy)
 }
 
 func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch {
-	case r.URL.Path == "/login" && r.Method == http.MethodPost:
-		g.handleLogin(w, r)
-	case r.URL.Path == "/logout" && r.Method == http.MethodPost:
-		g.handleLogout(w, r)
-	case r.URL.Path == "/api/v1/auth/login" && r.Method == http.MethodPost:
-		g.handleLogin(w, r)
-	case r.URL.Path == "/api/v1/auth/logout" && r.Method == http.MethodPost:
-		g.handleLogout(w, r)
-	default:
-		(&router.ErrorResponse{
-			Status:  http.StatusNotFound,
-			Path:    r.URL.Path,
-			Message: "endpoint not found",
-		}).WriteTo(w)
-	}
+	g.auth.ServeHTTP(w, r)
 }
 
 // handleLogin processes authentication requests
@@ -136,9 +240,20 @@ func (g *Gateway) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user from user service
-	userWithPassword, err := g.getUserByUsername(loginReq.Username)
-	if err != nil {
+	// clients guessing passwords are locked out, the credentials are not checked meanwhile
+	lockoutKey := g.loginLockoutKey(r, loginReq.Username)
+	if wait := g.lockout.locked(lockoutKey, time.Now()); wait > 0 {
+		writeTooManyRequests(w, r, wait, "too many failed logins")
+		return
+	}
+
+	// Validate the credentials with the user service
+	user, err := g.credentials.ValidateCredentials(r.Context(), loginReq.Username, loginReq.Password)
+	if errors.Is(err, ErrUnauthorized) {
+		if g.lockout.fail(lockoutKey, time.Now()) {
+			slog.WarnContext(r.Context(), "Locking out client after failed logins", "username", loginReq.Username, "client_ip", g.clientIP(r), "duration", g.lockout.duration)
+			loginLockouts.Inc()
+		}
 		(&router.ErrorResponse{
 			Status:  http.StatusUnauthorized,
 			Path:    r.URL.Path,
@@ -146,80 +261,101 @@ func (g *Gateway) handleLogin(w http.ResponseWriter, r *http.Request) {
 		}).WriteTo(w)
 		return
 	}
-
-	// Validate password
-	if !g.validatePassword(loginReq.Password, userWithPassword.Password) {
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to validate credentials", "error", err)
 		(&router.ErrorResponse{
-			Status:  http.StatusUnauthorized,
+			Status:  http.StatusServiceUnavailable,
 			Path:    r.URL.Path,
-			Message: "invalid credentials",
+			Message: "failed to validate credentials",
 		}).WriteTo(w)
 		return
 	}
 
-	// Create or get cart for user
-	cartID, err := g.getOrCreateCartForUser(userWithPassword.User.ID.String())
+	g.lockout.succeed(lockoutKey)
+
+	session, ok := g.beginSession(w, r, user)
+	if !ok {
+		return
+	}
+
+	// Return user profile
+	response := LoginResponse{
+		User:   *user,
+		CartID: session.CartID.String(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
 		(&router.ErrorResponse{
 			Status:  http.StatusInternalServerError,
 			Path:    r.URL.Path,
-			Message: "failed to create cart",
+			Message: "failed to encode response",
 			Error:   err.Error(),
 		}).WriteTo(w)
 		return
 	}
+}
 
-	// Create session data
-	sessionData := SessionData{
-		UserID:   userWithPassword.User.ID.String(),
-		CartID:   cartID,
-		Username: *userWithPassword.User.Username,
-		Exp:      time.Now().Add(24 * time.Hour).Unix(),
-	}
-
-	// Create secure cookie
-	if err := g.setSessionCookie(w, sessionData); err != nil {
+// beginSession creates the session of a user that has just logged in and sets the session
+// cookie. On failure an error response is written and ok is false.
+func (g *Gateway) beginSession(w http.ResponseWriter, r *http.Request, user *User) (session *Session, ok bool) {
+	// Create or get cart for user
+	cartID, err := g.getOrCreateCartForUser(r.Context(), user.ID)
+	if err != nil {
 		(&router.ErrorResponse{
 			Status:  http.StatusInternalServerError,
 			Path:    r.URL.Path,
-			Message: "failed to create session",
+			Message: "failed to create cart",
 			Error:   err.Error(),
 		}).WriteTo(w)
-		return
+		return nil, false
 	}
 
-	// Return user profile (without password)
-	response := LoginResponse{
-		User:   userWithPassword.User,
-		CartID: cartID,
+	// Create session
+	now := time.Now()
+	session = &Session{
+		ID:          NewSessionID(),
+		UserID:      user.ID,
+		CartID:      cartID,
+		Username:    *user.Username,
+		IsAdmin:     user.IsAdmin,
+		Roles:       user.Roles,
+		Permissions: user.Permissions,
+		UserAgent:   r.UserAgent(),
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   g.sessionExpiry(now, now),
+	}
+	if err := g.sessions.Create(r.Context(), session); err != nil {
+		router.NewErrorResponse(r, "failed to create session", err).WriteTo(w)
+		return nil, false
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
+	// Create secure cookie
+	if err := g.setSessionCookie(w, session); err != nil {
 		(&router.ErrorResponse{
 			Status:  http.StatusInternalServerError,
 			Path:    r.URL.Path,
-			Message: "failed to encode response",
+			Message: "failed to create session",
 			Error:   err.Error(),
 		}).WriteTo(w)
-		return
+		return nil, false
 	}
+	return session, true
 }
 
 // handleLogout processes logout requests
 func (g *Gateway) handleLogout(w http.ResponseWriter, r *http.Request) {
-	// Clear the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-	})
+	// Revoke the session, a stolen cookie must not outlive the logout
+	if session, err := g.getSession(r); err == nil {
+		if err := g.sessions.Delete(r.Context(), session.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			router.NewErrorResponse(r, "failed to revoke session", err).WriteTo(w)
+			return
+		}
+	}
+	g.clearSessionCookie(w)
 
 	w.WriteHeader(http.StatusOK)
 	_, err := w.Write([]byte(`{"message":"logged out successfully"}`))
@@ -234,121 +370,141 @@ func (g *Gateway) handleLogout(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getUserByUsername fetches user details from the user service by username
-func (g *Gateway) getUserByUsername(username string) (*UserModificationRequest, error) {
-	// Get all users and find by username
-	resp, err := http.Get(g.userServiceURL + "/api/v1/core/users")
-	if err != nil {
-		return nil, err
+// handleListSessions lists the sessions of the current user, or of the user given in the
+// path. Listing the sessions of other users requires PermissionSessionsRead.
+func (g *Gateway) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	current, userID, ok := g.authorizeSessionUser(w, r, PermissionSessionsRead)
+	if !ok {
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to fetch users")
+	sessions, err := g.sessions.ListByUser(r.Context(), userID)
+	if err != nil {
+		router.NewErrorResponse(r, "failed to list sessions", err).WriteTo(w)
+		return
 	}
-
-	var users []User
-	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
-		return nil, err
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current.ID
 	}
+	writeJSON(w, r, http.StatusOK, ListResponse[Session]{Items: sessions, Total: len(sessions), Page: 1})
+}
 
-	for _, user := range users {
-		if user.Username != nil && *user.Username == username {
-			// For this demo, we'll create a UserModificationRequest with user-specific passwords
-			// In production, you'd fetch this from a secure user store with the user record
-			var password string
-			switch *user.Username {
-			case "root":
-				password = "root"
-			case "user":
-				password = "user"
-			default:
-				password = "password123" // Default for other users
-			}
-
-			userWithPassword := &UserModificationRequest{
-				User:     user,
-				Password: &password,
-			}
-			return userWithPassword, nil
-		}
+// handleRevokeSessions revokes all sessions of the current user ("log out everywhere"), or
+// of the user given in the path. Revoking the sessions of other users requires PermissionSessionsWrite.
+func (g *Gateway) handleRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	current, userID, ok := g.authorizeSessionUser(w, r, PermissionSessionsWrite)
+	if !ok {
+		return
 	}
 
-	return nil, errors.New("user not found")
-} // validatePassword validates the provided password against the stored hash
-func (g *Gateway) validatePassword(password string, hashedPassword *string) bool {
-	if hashedPassword == nil {
-		return false
+	revoked, err := g.sessions.DeleteByUser(r.Context(), userID)
+	if err != nil {
+		router.NewErrorResponse(r, "failed to revoke sessions", err).WriteTo(w)
+		return
+	}
+	if userID == current.UserID {
+		g.clearSessionCookie(w)
 	}
-	// Simple password validation (in production, use proper bcrypt or similar)
-	hash := sha256.Sum256([]byte(password))
-	expectedHash := fmt.Sprintf("%x", hash)
-	return expectedHash == *hashedPassword || *hashedPassword == password // Allow plain text for demo
+	writeJSON(w, r, http.StatusOK, SessionRevocationResponse{Revoked: revoked})
 }
 
-// getOrCreateCartForUser creates or retrieves a cart for the user
-func (g *Gateway) getOrCreateCartForUser(userID string) (string, error) {
-	// Try to get existing cart for user
-	resp, err := http.Get(g.cartServiceURL + "/api/v1/core/carts")
+// handleRevokeSession revokes a single session. Users may revoke their own sessions, holders of
+// PermissionSessionsWrite any session.
+func (g *Gateway) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	current, err := g.getSession(r)
 	if err != nil {
-		return "", err
+		router.NewErrorResponse(r, "authentication required", err).WriteTo(w)
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		var carts []Cart
-		if err := json.NewDecoder(resp.Body).Decode(&carts); err == nil {
-			// Find cart for this user (using OwnerID field)
-			for _, cart := range carts {
-				if cart.OwnerID.String() == userID {
-					return cart.ID.String(), nil
-				}
-			}
-		}
+	// sessions of other users are reported as missing unless the caller may manage them
+	session, err := g.sessions.Get(r.Context(), r.PathValue("id"))
+	if err == nil && session.UserID != current.UserID && !current.Can(PermissionSessionsWrite) {
+		err = fmt.Errorf("session %w", ErrNotFound)
+	}
+	if err == nil {
+		err = g.sessions.Delete(r.Context(), session.ID)
+	}
+	if err != nil {
+		router.NewErrorResponse(r, "failed to revoke session", err).WriteTo(w)
+		return
 	}
 
-	// Create new cart for user
-	cartData := map[string]interface{}{
-		"owner_id": userID,
-		"items":    []interface{}{},
+	if session.ID == current.ID {
+		g.clearSessionCookie(w)
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	cartJSON, _ := json.Marshal(cartData)
-	resp, err = http.Post(g.cartServiceURL+"/api/v1/core/carts", "application/json", bytes.NewBuffer(cartJSON))
+// authorizeSessionUser returns the session of the request and the user whose sessions are
+// managed, which is the user given in the path or the current user. Managing the sessions of
+// other users requires the permission. On failure an error response is written and ok is false.
+func (g *Gateway) authorizeSessionUser(w http.ResponseWriter, r *http.Request, permission string) (current *Session, userID uuid.UUID, ok bool) {
+	current, err := g.getSession(r)
 	if err != nil {
-		return "", err
+		router.NewErrorResponse(r, "authentication required", err).WriteTo(w)
+		return nil, uuid.Nil, false
+	}
+	if r.PathValue("id") == "" {
+		return current, current.UserID, true
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		return "", errors.New("failed to create cart")
+	userID, err = uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		router.NewErrorResponse(r, "invalid user id", router.NewValidationError(router.Violation{Field: "id", Message: "must be a UUID"})).WriteTo(w)
+		return nil, uuid.Nil, false
 	}
+	if userID != current.UserID && !current.Can(permission) {
+		router.NewErrorResponse(r, "access denied", fmt.Errorf("%w: missing permission %s", ErrForbidden, permission)).WriteTo(w)
+		return nil, uuid.Nil, false
+	}
+	return current, userID, true
+}
 
+// writeJSON writes obj as JSON response with the given status code
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, obj any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+	}
+}
+
+// getOrCreateCartForUser returns the ID of the cart of the user, it creates one on the first login
+func (g *Gateway) getOrCreateCartForUser(ctx context.Context, userID uuid.UUID) (uuid.UUID, error) {
 	var cart Cart
-	if err := json.NewDecoder(resp.Body).Decode(&cart); err != nil {
-		return "", err
+	err := g.callService(ctx, http.MethodPost, "/api/v1/core/carts/lookup", &CartLookupRequest{OwnerID: userID}, &cart)
+	if err == nil {
+		return cart.ID, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return uuid.Nil, err
 	}
 
-	return cart.ID.String(), nil
+	err = g.callService(ctx, http.MethodPost, "/api/v1/core/carts", &Cart{OwnerID: userID, Items: []CartItem{}}, &cart)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return cart.ID, nil
 }
 
+// sessionCookieName is the name of the cookie holding the encrypted session ID
+const sessionCookieName = "session"
+
 // setSessionCookie creates and sets a secure session cookie
-func (g *Gateway) setSessionCookie(w http.ResponseWriter, sessionData SessionData) error {
-	// Encode session data
-	sessionJSON, err := json.Marshal(sessionData)
+func (g *Gateway) setSessionCookie(w http.ResponseWriter, session *Session) error {
+	// Encrypt the session ID, clients can neither read nor forge it
+	encoded, err := g.cookies.Encode(sessionCookieName, []byte(session.ID))
 	if err != nil {
 		return err
 	}
 
-	// Simple encoding (in production, use proper encryption/signing)
-	encoded := base64.URLEncoding.EncodeToString(sessionJSON)
-
-	// Set secure cookie
+	// Set secure cookie, it is kept as long as the session may live, the idle timeout is enforced by the store
 	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
+		Name:     sessionCookieName,
 		Value:    encoded,
 		Path:     "/",
-		MaxAge:   24 * 60 * 60, // 24 hours
+		MaxAge:   int(time.Until(session.CreatedAt.Add(g.sessionMaxLifetime)).Seconds()),
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteStrictMode,
@@ -357,48 +513,72 @@ func (g *Gateway) setSessionCookie(w http.ResponseWriter, sessionData SessionDat
 	return nil
 }
 
-// getSessionData extracts session data from cookie
-func (g *Gateway) getSessionData(r *http.Request) (*SessionData, error) {
-	cookie, err := r.Cookie("session")
+// clearSessionCookie tells the client to drop the session cookie
+func (g *Gateway) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// getSession returns the session referenced by the session cookie and extends its expiry.
+// Errors caused by a missing, invalid, expired or revoked session wrap ErrUnauthorized.
+func (g *Gateway) getSession(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(sessionCookieName)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
 	}
 
-	// Decode session data
-	sessionJSON, err := base64.URLEncoding.DecodeString(cookie.Value)
+	// Decrypt and authenticate the session ID
+	id, err := g.cookies.Decode(sessionCookieName, cookie.Value)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
 	}
 
-	var sessionData SessionData
-	if err := json.Unmarshal(sessionJSON, &sessionData); err != nil {
+	session, err := g.sessions.Get(r.Context(), string(id))
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: session expired or revoked", ErrUnauthorized)
+	}
+	if err != nil {
 		return nil, err
 	}
 
-	// Check expiration
-	if time.Now().Unix() > sessionData.Exp {
-		return nil, errors.New("session expired")
+	// Sliding expiration, the activity is written at most once per sessionTouchInterval
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		expiresAt := g.sessionExpiry(session.CreatedAt, now)
+		err := g.sessions.Touch(r.Context(), session.ID, now, expiresAt)
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: session expired or revoked", ErrUnauthorized)
+		}
+		if err != nil {
+			return nil, err
+		}
+		session.LastSeenAt, session.ExpiresAt = now, expiresAt
 	}
+	return session, nil
+}
 
-	return &sessionData, nil
+// sessionExpiry returns the expiry of a session created at createdAt that has last been used at lastSeenAt
+func (g *Gateway) sessionExpiry(createdAt, lastSeenAt time.Time) time.Time {
+	expiresAt := lastSeenAt.Add(g.sessionIdleTimeout)
+	if limit := createdAt.Add(g.sessionMaxLifetime); limit.Before(expiresAt) {
+		return limit
+	}
+	return expiresAt
 }
 
-// proxyToService handles proxying requests to appropriate microservices
+// proxyToService handles proxying requests to the upstream of their route.
+// The route is passed in the request context by serveRoute, the identity headers are set
+// from the session passed in the request context by enforce.
 func (g *Gateway) proxyToService(w http.ResponseWriter, r *http.Request) {
-	var targetURL string
-
-	switch {
-	case strings.HasPrefix(r.URL.Path, "/api/v1/core/users"):
-		targetURL = g.userServiceURL
-	case strings.HasPrefix(r.URL.Path, "/api/v1/core/carts"):
-		targetURL = g.cartServiceURL
-	case strings.HasPrefix(r.URL.Path, "/api/v1/core/items"):
-		targetURL = g.itemServiceURL
-	case strings.HasPrefix(r.URL.Path, "/api/v1/core/checkouts"):
-		targetURL = g.checkoutServiceURL
-	case strings.HasPrefix(r.URL.Path, "/api/v1/presentation/cart"):
-		targetURL = g.cartPresentationServiceURL
-	default:
+	route := routeFromContext(r.Context())
+	if route == nil {
 		(&router.ErrorResponse{
 			Status:  http.StatusNotFound,
 			Path:    r.URL.Path,
@@ -406,22 +586,21 @@ func (g *Gateway) proxyToService(w http.ResponseWriter, r *http.Request) {
 		}).WriteTo(w)
 		return
 	}
-
-	// Parse target URL
-	target, err := url.Parse(targetURL)
+	// The identity is only passed on from a valid session, never taken from the client
+	var (
+		identityToken string
+		err           error
+	)
+	if session := sessionFromContext(r.Context()); session != nil {
+		identityToken, err = g.signIdentity(session)
+	} else {
+		identityToken, err = g.signAnonymous()
+	}
 	if err != nil {
-		(&router.ErrorResponse{
-			Status:  http.StatusInternalServerError,
-			Path:    r.URL.Path,
-			Message: "invalid target URL",
-			Error:   err.Error(),
-		}).WriteTo(w)
+		router.NewErrorResponse(r, "Failed to sign identity", err).WriteTo(w)
 		return
 	}
 
-	// Create reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
 	// Set CORS headers at the gateway level
 	g.setCORSHeaders(w, r)
 
@@ -431,43 +610,110 @@ func (g *Gateway) proxyToService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Modify the request to add authentication context if needed
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-
-		// Propagate trace context to backend services
-		if r.Context() != nil {
-			// Use OpenTelemetry propagator to inject trace context into outgoing request
-			otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(req.Header))
+	// hanging upstreams must not hold the request until the write timeout of the server
+	ctx, cancel := context.WithTimeout(r.Context(), route.timeout())
+	defer cancel()
+	ctx = context.WithValue(ctx, proxyRequestContextKey{}, &proxyRequest{
+		path:          r.URL.Path,
+		identityToken: identityToken,
+	})
+	r = r.WithContext(ctx)
+
+	// bodies of idempotent requests are buffered, so they can be sent again on retries
+	if route.Retry.Attempts > 0 && isIdempotent(r.Method) && r.ContentLength > 0 && r.ContentLength <= maxRetryBodySize {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			router.NewErrorResponse(r, "failed to read request body", fmt.Errorf("%w: %w", ErrValidation, err)).WriteTo(w)
+			return
 		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
 
-		// Add session data to headers if available
-		if sessionData, err := g.getSessionData(r); err == nil {
-			if sessionData != nil {
-				req.Header.Set("X-User-ID", sessionData.UserID)
-				req.Header.Set("X-Cart-ID", sessionData.CartID)
-				req.Header.Set("X-User-Username", sessionData.Username)
-			}
+	route.pool.proxy.ServeHTTP(w, r)
+}
+
+// OpenAPI returns the OpenAPI document of the gateway, it combines the authentication routes
+// with the documents of all upstream services. Unreachable services are left out.
+// It implements router.OpenAPIFunc.
+func (g *Gateway) OpenAPI(ctx context.Context) (*openapi.Document, error) {
+	b := router.NewOpenAPIBuilder()
+	b.Add(http.MethodPost, "/api/v1/auth/login", openapi.Spec{
+		Summary:  "Log in and start a session",
+		Request:  reflect.TypeFor[LoginRequest](),
+		Response: reflect.TypeFor[LoginResponse](),
+	}, g.GetKind())
+	b.Add(http.MethodPost, "/api/v1/auth/logout", openapi.Spec{
+		Summary: "End the current session",
+	}, g.GetKind())
+	b.Add(http.MethodGet, "/api/v1/auth/sessions", openapi.Spec{
+		Summary:  "List the sessions of the current user",
+		Response: reflect.TypeFor[ListResponse[Session]](),
+	}, g.GetKind())
+	b.Add(http.MethodDelete, "/api/v1/auth/sessions", openapi.Spec{
+		Summary:  "Revoke all sessions of the current user",
+		Response: reflect.TypeFor[SessionRevocationResponse](),
+	}, g.GetKind())
+	b.Add(http.MethodDelete, "/api/v1/auth/sessions/{id}", openapi.Spec{
+		Summary: "Revoke a session",
+		Status:  http.StatusNoContent,
+	}, g.GetKind())
+	b.Add(http.MethodGet, "/api/v1/auth/users/{id}/sessions", openapi.Spec{
+		Summary:  "List the sessions of a user",
+		Response: reflect.TypeFor[ListResponse[Session]](),
+	}, g.GetKind())
+	b.Add(http.MethodDelete, "/api/v1/auth/users/{id}/sessions", openapi.Spec{
+		Summary:  "Revoke all sessions of a user",
+		Response: reflect.TypeFor[SessionRevocationResponse](),
+	}, g.GetKind())
+	b.Add(http.MethodGet, "/api/v1/gateway/status", openapi.Spec{
+		Summary:  "Get the state of the upstreams of all routes",
+		Response: reflect.TypeFor[GatewayStatus](),
+	}, g.GetKind())
+
+	docs := []*openapi.Document{b.Document()}
+	for _, serviceURL := range g.upstreamServiceURLs() {
+		doc, err := g.getOpenAPIDocument(ctx, serviceURL)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to fetch OpenAPI document", "service", serviceURL, "error", err)
+			continue
+		}
+		for _, p := range internalPaths {
+			delete(doc.Paths, p)
 		}
+		docs = append(docs, doc)
+	}
+
+	info := b.Document().Info
+	info.Description = "Aggregated API of all demo-shop services"
+	return openapi.Merge(info, docs...), nil
+}
 
-		// Add a header to indicate the request came through the gateway
-		req.Header.Set("X-Via-Gateway", "true")
+// getOpenAPIDocument fetches the OpenAPI document of an upstream service
+func (g *Gateway) getOpenAPIDocument(ctx context.Context, serviceURL string) (*openapi.Document, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serviceURL+"/api/openapi.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	// Modify the response to remove duplicate CORS headers from backend services
-	proxy.ModifyResponse = func(resp *http.Response) error {
-		// Remove CORS headers from backend services to avoid conflicts
-		resp.Header.Del("Access-Control-Allow-Origin")
-		resp.Header.Del("Access-Control-Allow-Methods")
-		resp.Header.Del("Access-Control-Allow-Headers")
-		resp.Header.Del("Access-Control-Allow-Credentials")
-		resp.Header.Del("Access-Control-Max-Age")
-		return nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	// Serve the request
-	proxy.ServeHTTP(w, r)
+	var doc openapi.Document
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
 }
 
 // setCORSHeaders sets appropriate CORS headers for the gateway
@@ -475,6 +721,7 @@ func (g *Gateway) setCORSHeaders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8088")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Origin")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Origin, If-Match, If-None-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
 	w.Header().Set("Access-Control-Max-Age", "86400")
 }
@@ -0,0 +1,46 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SetAPIKeys enables the authentication with API keys sent as bearer token. The keys are
+// validated by keys, usually a client of the user service.
+func (g *Gateway) SetAPIKeys(keys APIKeyValidator) {
+	g.apiKeys = keys
+}
+
+// authenticate returns the session of the caller. Callers authenticate with the session
+// cookie or with an API key sent as bearer token, which takes precedence. Requests
+// authenticated with an API key are served in a session that is not stored.
+// Errors caused by missing or invalid credentials wrap ErrUnauthorized.
+func (g *Gateway) authenticate(r *http.Request) (*Session, error) {
+	key, ok := bearerToken(r)
+	if !ok {
+		return g.getSession(r)
+	}
+	if g.apiKeys == nil {
+		return nil, fmt.Errorf("%w: API keys are not enabled", ErrUnauthorized)
+	}
+	identity, err := g.apiKeys.ValidateAPIKey(r.Context(), key)
+	if err != nil && !errors.Is(err, ErrUnauthorized) {
+		return nil, fmt.Errorf("%w: failed to validate API key: %w", ErrUnavailable, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return identity.Session(), nil
+}
+
+// bearerToken returns the token of the Authorization header if it uses the Bearer scheme
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
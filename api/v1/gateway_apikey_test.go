@@ -0,0 +1,171 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+// apiKeyValidatorFunc adapts a function to the APIKeyValidator interface
+type apiKeyValidatorFunc func(ctx context.Context, key string) (*APIKeyIdentity, error)
+
+func (f apiKeyValidatorFunc) ValidateAPIKey(ctx context.Context, key string) (*APIKeyIdentity, error) {
+	return f(ctx, key)
+}
+
+func TestGateway_APIKeyAuthentication(t *testing.T) {
+	ctx := context.Background()
+	alice := uuid.New()
+	username := "alice"
+	users := NewMockUserStore()
+	if err := users.Create(ctx, &UserModificationRequest{User: User{ID: alice, Username: &username, Roles: []string{"catalog"}}}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	roles := NewMockRoleStore(Role{ID: uuid.New(), Name: "catalog", Permissions: []string{PermissionItemsWrite}})
+	keys := NewMockAPIKeyStore()
+	newKey := func(scopes ...string) string {
+		key := &APIKey{ID: uuid.New(), UserID: alice, Name: "test", Scopes: scopes, Key: NewAPIKey()}
+		if err := keys.Create(ctx, key); err != nil {
+			t.Fatalf("Failed to create key: %v", err)
+		}
+		return key.Key
+	}
+	catalogKey, readOnlyKey := newKey(PermissionItemsWrite), newKey()
+
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	t.Cleanup(upstream.Close)
+
+	gateway := NewGateway(
+		DefaultRouteConfig(ServiceURLs{
+			User:             newServiceServer(t, NewUserRouter(users, roles, keys)),
+			Cart:             upstream.URL,
+			Item:             upstream.URL,
+			Checkout:         upstream.URL,
+			CartPresentation: upstream.URL,
+		}),
+		NewMockUserStore(),
+		NewMockSessionStore(),
+		cookieEncryptionKey,
+	)
+	gateway.SetIdentityTokens(identityTokens)
+
+	serve := func(method, path, authorization string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		got = nil
+		req := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, req)
+		return rr
+	}
+	itemPath := "/api/v1/core/items/" + uuid.NewString()
+
+	if rr := serve(http.MethodDelete, itemPath, "Bearer "+catalogKey, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without API keys enabled, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	gateway.SetAPIKeys(apiKeyValidatorFunc(func(ctx context.Context, key string) (*APIKeyIdentity, error) {
+		return ValidateAPIKey(ctx, keys, users, roles, key)
+	}))
+
+	if rr := serve(http.MethodDelete, itemPath, "Bearer "+catalogKey, nil); rr.Code != http.StatusOK || got == nil {
+		t.Fatalf("Expected request with a scoped key to be proxied, got %d", rr.Code)
+	}
+	if authorization := got.Get("Authorization"); authorization != "" {
+		t.Errorf("Expected the API key not to be forwarded, got %q", authorization)
+	}
+	identity, err := identityTokens.Verify(got.Get(router.HeaderIdentityToken))
+	if err != nil {
+		t.Fatalf("Expected a valid identity token, got %v", err)
+	}
+	if identity.UserID != alice || identity.Username != username || strings.Join(identity.Permissions, ",") != PermissionItemsWrite {
+		t.Errorf("Expected the identity of the key, got %+v", *identity)
+	}
+
+	if rr := serve(http.MethodDelete, itemPath, "Bearer "+readOnlyKey, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected key without scopes to be rejected with %d, got %d", http.StatusForbidden, rr.Code)
+	}
+	if rr := serve(http.MethodGet, "/api/v1/core/users/"+alice.String(), "Bearer "+readOnlyKey, nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected key without scopes to read the own profile, got %d", rr.Code)
+	}
+
+	rr := serve(http.MethodGet, "/api/v1/core/users/"+alice.String(), "Bearer "+NewAPIKey(), nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unknown key to be rejected with %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if challenge := rr.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, "Bearer") {
+		t.Errorf("Expected a bearer challenge, got %q", challenge)
+	}
+
+	_, cookie := startSession(t, gateway, alice, false)
+	if rr := serve(http.MethodGet, "/api/v1/core/users/"+alice.String(), "", cookie); rr.Code != http.StatusOK {
+		t.Errorf("Expected the session cookie to keep working, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodGet, "/api/v1/core/users/"+alice.String(), "Basic YWxpY2U6c2VjcmV0", cookie); rr.Code != http.StatusOK {
+		t.Errorf("Expected other authorization schemes to fall back to the session cookie, got %d", rr.Code)
+	}
+}
+
+func TestGateway_APIKeyLockout(t *testing.T) {
+	upstream := newEchoUpstream(t, "items")
+	gateway := NewGateway(
+		DefaultRouteConfig(ServiceURLs{User: upstream, Cart: upstream, Item: upstream, Checkout: upstream, CartPresentation: upstream}),
+		NewMockUserStore(),
+		NewMockSessionStore(),
+		cookieEncryptionKey,
+	)
+	gateway.SetIdentityTokens(identityTokens)
+	gateway.SetLoginLockout(3, time.Minute)
+	var validations atomic.Int32
+	gateway.SetAPIKeys(apiKeyValidatorFunc(func(ctx context.Context, key string) (*APIKeyIdentity, error) {
+		validations.Add(1)
+		if key != "ds_valid" {
+			return nil, fmt.Errorf("%w: unknown API key", ErrUnauthorized)
+		}
+		return &APIKeyIdentity{KeyID: uuid.New(), UserID: uuid.New(), Username: "alice"}, nil
+	}))
+
+	serve := func(key, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/core/items", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// valid keys sent between the guesses do not reset the failures of the client
+	for _, key := range []string{"ds_guess", "ds_valid", "ds_guess", "ds_valid"} {
+		serve(key, "192.0.2.1:1234")
+	}
+	if rr := serve("ds_guess", "192.0.2.1:1234"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d for the guess locking the client out, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	for _, key := range []string{"ds_guess", "ds_valid"} {
+		rr := serve(key, "192.0.2.1:1234")
+		if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected the client to be locked out, got %d", rr.Code)
+		}
+	}
+	if got := validations.Load(); got != 5 {
+		t.Errorf("Expected the keys of locked out clients not to be validated, got %d validations", got)
+	}
+	if rr := serve("ds_valid", "198.51.100.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("Expected other clients not to be locked out, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,375 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// States of a dependency and of the report of all dependencies
+const (
+	// DependencyUp dependencies passed their last check, a report is up if all dependencies are
+	DependencyUp = "up"
+	// DependencyDown dependencies failed their last check, a report is down if a critical
+	// service has no instance that is up
+	DependencyDown = "down"
+	// DependencyUnknown dependencies have not been checked yet
+	DependencyUnknown = "unknown"
+	// DependencyDegraded reports have dependencies that are not up, but all critical services
+	// have an instance that is
+	DependencyDegraded = "degraded"
+)
+
+const (
+	// defaultDependencyPath is the path the dependencies are checked at
+	defaultDependencyPath = "/health/readiness"
+	// defaultDependencyTimeout is how long a check of a dependency may take
+	defaultDependencyTimeout = 2 * time.Second
+)
+
+var (
+	dependencyUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_dependency_up",
+		Help: "Whether a dependency passed its last check (1) or not (0)",
+	}, []string{"dependency"})
+	dependencyChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_dependency_checks_total",
+		Help: "Total number of checks of a dependency by result",
+	}, []string{"dependency", "result"})
+	dependencyCheckDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_dependency_check_duration_seconds",
+		Help:    "Duration of the checks of a dependency",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"dependency"})
+)
+
+// Dependency is an instance of a service the gateway depends on
+type Dependency struct {
+	// Name identifies the dependency in the report and the metrics
+	Name string
+	// Service groups the instances of a service, it is the name if empty
+	Service string
+	// URL is the base URL of the instance
+	URL string
+	// Path is requested from the instance to check it, /health/readiness if empty
+	Path string
+	// Critical services make the gateway unready while none of their instances is up
+	Critical bool
+}
+
+// RouteDependencies returns the upstreams the routes of config pass requests on to, one
+// dependency per instance. The services named in critical are critical dependencies.
+func RouteDependencies(config *RouteConfig, critical []string) []Dependency {
+	var dependencies []Dependency
+	seen := map[string]bool{}
+	for _, route := range config.Routes {
+		service := route.serviceName()
+		for _, upstream := range route.Upstreams {
+			if seen[upstream] {
+				continue
+			}
+			seen[upstream] = true
+			name := service
+			if len(route.Upstreams) > 1 {
+				if u, err := url.Parse(upstream); err == nil {
+					name += "/" + u.Host
+				}
+			}
+			dependencies = append(dependencies, Dependency{
+				Name:     name,
+				Service:  service,
+				URL:      upstream,
+				Path:     route.HealthCheck.Path,
+				Critical: slices.Contains(critical, service),
+			})
+		}
+	}
+	return dependencies
+}
+
+// DependencyReport is the state of the dependencies of the gateway
+type DependencyReport struct {
+	// Status is DependencyUp, DependencyDegraded or DependencyDown
+	Status       string             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// DependencyStatus is the state of a dependency
+type DependencyStatus struct {
+	Name     string `json:"name"`
+	Service  string `json:"service"`
+	URL      string `json:"url"`
+	Critical bool   `json:"critical"`
+	// Status is DependencyUp, DependencyDown or DependencyUnknown
+	Status string `json:"status"`
+	// Latency is the duration of the last check
+	Latency Duration `json:"latency"`
+	// LastCheck is the time of the last check
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	// LastSuccess is the time of the last check the dependency passed
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// LastError is the error of the last failed check
+	LastError string `json:"last_error,omitempty"`
+	// Failures counts the consecutive failed checks
+	Failures int `json:"failures"`
+}
+
+// DependencyChecker periodically checks the dependencies of the gateway. The gateway is
+// ready while every critical service has an instance that is up.
+type DependencyChecker struct {
+	client *http.Client
+
+	mu           sync.RWMutex
+	dependencies []DependencyStatus
+	checkURLs    []string
+	ready        bool
+}
+
+// NewDependencyChecker returns a checker of dependencies, a check may take timeout.
+// The dependencies are unknown until they have been checked.
+func NewDependencyChecker(dependencies []Dependency, timeout time.Duration) (*DependencyChecker, error) {
+	if timeout <= 0 {
+		timeout = defaultDependencyTimeout
+	}
+	c := &DependencyChecker{client: &http.Client{Timeout: timeout}}
+	if err := c.SetDependencies(dependencies); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetDependencies replaces the dependencies that are checked. Dependencies with the same name
+// and check URL as before keep their state, new ones are unknown until they have been checked.
+func (c *DependencyChecker) SetDependencies(dependencies []Dependency) error {
+	statuses := make([]DependencyStatus, 0, len(dependencies))
+	checkURLs := make([]string, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		u, err := url.Parse(dependency.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%w: invalid URL of dependency %s: %q", ErrValidation, dependency.Name, dependency.URL)
+		}
+		path := dependency.Path
+		if path == "" {
+			path = defaultDependencyPath
+		}
+		service := dependency.Service
+		if service == "" {
+			service = dependency.Name
+		}
+		checkURLs = append(checkURLs, u.JoinPath(path).String())
+		statuses = append(statuses, DependencyStatus{
+			Name:     dependency.Name,
+			Service:  service,
+			URL:      u.String(),
+			Critical: dependency.Critical,
+			Status:   DependencyUnknown,
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range statuses {
+		if j := c.index(statuses[i].Name, checkURLs[i]); j >= 0 {
+			previous := c.dependencies[j]
+			previous.Service, previous.URL, previous.Critical = statuses[i].Service, statuses[i].URL, statuses[i].Critical
+			statuses[i] = previous
+		}
+	}
+	for _, status := range c.dependencies {
+		if !slices.ContainsFunc(statuses, func(s DependencyStatus) bool { return s.Name == status.Name }) {
+			dependencyUp.DeleteLabelValues(status.Name)
+		}
+	}
+	c.dependencies, c.checkURLs = statuses, checkURLs
+	c.ready = c.isReady()
+	return nil
+}
+
+// index returns the index of the dependency with the name and check URL, or -1. c.mu must be held.
+func (c *DependencyChecker) index(name, checkURL string) int {
+	for i, status := range c.dependencies {
+		if status.Name == name && c.checkURLs[i] == checkURL {
+			return i
+		}
+	}
+	return -1
+}
+
+// Run checks the dependencies right away and then every interval until ctx is done
+func (c *DependencyChecker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks all dependencies concurrently, changed reports whether the readiness of
+// the gateway changed
+func (c *DependencyChecker) CheckAll(ctx context.Context) (changed bool) {
+	// the dependencies may be replaced while they are checked
+	c.mu.RLock()
+	names, checkURLs := make([]string, len(c.dependencies)), slices.Clone(c.checkURLs)
+	for i, status := range c.dependencies {
+		names[i] = status.Name
+	}
+	c.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for i := range checkURLs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.check(ctx, names[i], checkURLs[i])
+		}()
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ready := c.isReady()
+	changed, c.ready = ready != c.ready, ready
+	if changed {
+		slog.InfoContext(ctx, "Readiness of the dependencies changed", "ready", ready)
+	}
+	return changed
+}
+
+// check requests the check URL of the dependency and records the result, unless the
+// dependency has been removed in the meantime
+func (c *DependencyChecker) check(ctx context.Context, name, checkURL string) {
+	start := time.Now()
+	err := c.request(ctx, checkURL)
+	latency := time.Since(start)
+	// checks interrupted by a shutdown say nothing about the dependency
+	if ctx.Err() != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.index(name, checkURL)
+	if i < 0 {
+		return
+	}
+	status := &c.dependencies[i]
+	status.Latency = Duration(latency)
+	status.LastCheck = &start
+	dependencyCheckDuration.WithLabelValues(status.Name).Observe(latency.Seconds())
+	if err != nil {
+		if status.Status != DependencyDown {
+			slog.WarnContext(ctx, "Dependency is down", "dependency", status.Name, "error", err)
+		}
+		status.Status = DependencyDown
+		status.LastError = err.Error()
+		status.Failures++
+		dependencyChecks.WithLabelValues(status.Name, outcomeFailure).Inc()
+		dependencyUp.WithLabelValues(status.Name).Set(0)
+		return
+	}
+	if status.Status == DependencyDown {
+		slog.InfoContext(ctx, "Dependency is up again", "dependency", status.Name)
+	}
+	status.Status = DependencyUp
+	status.LastSuccess = &start
+	status.Failures = 0
+	dependencyChecks.WithLabelValues(status.Name, outcomeSuccess).Inc()
+	dependencyUp.WithLabelValues(status.Name).Set(1)
+}
+
+func (c *DependencyChecker) request(ctx context.Context, checkURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// isReady reports whether every critical service has an instance that is up, c.mu must be held
+func (c *DependencyChecker) isReady() bool {
+	return len(c.criticalDown()) == 0
+}
+
+// criticalDown returns the critical services none of whose instances is up, c.mu must be held
+func (c *DependencyChecker) criticalDown() []string {
+	up := map[string]bool{}
+	for _, status := range c.dependencies {
+		if status.Status == DependencyUp {
+			up[status.Service] = true
+		}
+	}
+	var down []string
+	for _, status := range c.dependencies {
+		if status.Critical && !up[status.Service] && !slices.Contains(down, status.Service) {
+			down = append(down, status.Service)
+		}
+	}
+	return down
+}
+
+// Ready reports whether every critical service has an instance that passed its last check
+func (c *DependencyChecker) Ready() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ready
+}
+
+// Check returns an error naming the critical services that have no instance that is up. It
+// is the health check of the readiness of the gateway.
+func (c *DependencyChecker) Check(ctx context.Context) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if down := c.criticalDown(); len(down) > 0 {
+		return fmt.Errorf("critical dependencies are not up: %s", strings.Join(down, ", "))
+	}
+	return nil
+}
+
+// Report returns the state of all dependencies
+func (c *DependencyChecker) Report() DependencyReport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	report := DependencyReport{Status: DependencyUp, Dependencies: slices.Clone(c.dependencies)}
+	if len(c.criticalDown()) > 0 {
+		report.Status = DependencyDown
+		return report
+	}
+	for _, status := range c.dependencies {
+		if status.Status != DependencyUp {
+			report.Status = DependencyDegraded
+		}
+	}
+	return report
+}
+
+// ServeHTTP returns the report of the dependencies, with 503 if it is down
+func (c *DependencyChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := c.Report()
+	status := http.StatusOK
+	if report.Status == DependencyDown {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, r, status, report)
+}
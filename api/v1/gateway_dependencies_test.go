@@ -0,0 +1,258 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDependencyChecker(t *testing.T) {
+	var userDown, itemDown atomic.Bool
+	newService := func(down *atomic.Bool) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health/readiness" || down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	checker, err := NewDependencyChecker([]Dependency{
+		{Name: "test-user", URL: newService(&userDown), Critical: true},
+		{Name: "test-item", URL: newService(&itemDown)},
+	}, time.Second)
+	if err != nil {
+		t.Fatalf("NewDependencyChecker failed: %v", err)
+	}
+
+	report := func(expectedCode int) DependencyReport {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		checker.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health/dependencies", nil))
+		if rr.Code != expectedCode {
+			t.Fatalf("Expected status %d, got %d", expectedCode, rr.Code)
+		}
+		var report DependencyReport
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatalf("Failed to decode report: %v", err)
+		}
+		return report
+	}
+
+	// the dependencies are unknown until they have been checked
+	if checker.Ready() {
+		t.Error("Expected the checker not to be ready before the first check")
+	}
+	if got := report(http.StatusServiceUnavailable); got.Dependencies[0].Status != DependencyUnknown {
+		t.Errorf("Expected unknown dependency, got %+v", got.Dependencies[0])
+	}
+
+	ctx := context.Background()
+	if !checker.CheckAll(ctx) || !checker.Ready() {
+		t.Error("Expected the checker to become ready")
+	}
+	got := report(http.StatusOK)
+	if got.Status != DependencyUp || got.Dependencies[0].LastCheck == nil || got.Dependencies[0].LastSuccess == nil {
+		t.Errorf("Expected all dependencies up, got %+v", got)
+	}
+
+	// non-critical dependencies degrade the report, the gateway stays ready
+	itemDown.Store(true)
+	if checker.CheckAll(ctx) || !checker.Ready() {
+		t.Error("Expected the checker to stay ready")
+	}
+	got = report(http.StatusOK)
+	if got.Status != DependencyDegraded || got.Dependencies[1].Status != DependencyDown || got.Dependencies[1].LastError == "" || got.Dependencies[1].Failures != 1 {
+		t.Errorf("Expected the report to be degraded, got %+v", got)
+	}
+
+	// critical dependencies make the gateway unready
+	userDown.Store(true)
+	if !checker.CheckAll(ctx) || checker.Ready() {
+		t.Error("Expected the checker to become unready")
+	}
+	if got := report(http.StatusServiceUnavailable); got.Status != DependencyDown {
+		t.Errorf("Expected the report to be down, got %+v", got)
+	}
+	if err := checker.Check(ctx); err == nil || !strings.Contains(err.Error(), "test-user") {
+		t.Errorf("Expected the health check to name the critical dependency, got %v", err)
+	}
+	if got := testutil.ToFloat64(dependencyUp.WithLabelValues("test-user")); got != 0 {
+		t.Errorf("Expected the dependency to be down, got %v", got)
+	}
+	if got := testutil.ToFloat64(dependencyChecks.WithLabelValues("test-item", outcomeFailure)); got != 2 {
+		t.Errorf("Expected 2 failed checks, got %v", got)
+	}
+
+	userDown.Store(false)
+	itemDown.Store(false)
+	checker.CheckAll(ctx)
+	if got := report(http.StatusOK); got.Status != DependencyUp || got.Dependencies[1].Failures != 0 {
+		t.Errorf("Expected all dependencies up again, got %+v", got)
+	}
+}
+
+func TestDependencyChecker_Run(t *testing.T) {
+	checker, err := NewDependencyChecker([]Dependency{
+		{Name: "test-run", URL: newEchoUpstream(t, "run"), Path: "/ping", Critical: true},
+	}, time.Second)
+	if err != nil {
+		t.Fatalf("NewDependencyChecker failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go checker.Run(ctx, time.Hour)
+	// the dependencies are checked right away
+	for deadline := time.Now().Add(5 * time.Second); !checker.Ready(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the gateway to be ready after the first check")
+		}
+	}
+	if err := checker.Check(ctx); err != nil {
+		t.Errorf("Expected the health check to pass, got %v", err)
+	}
+}
+
+func TestNewDependencyChecker_InvalidURL(t *testing.T) {
+	if _, err := NewDependencyChecker([]Dependency{{Name: "user", URL: "user:8080"}}, 0); err == nil {
+		t.Error("Expected an error for a URL without scheme")
+	}
+}
+
+func TestDependencyChecker_Instances(t *testing.T) {
+	var downs [2]atomic.Bool
+	var dependencies []Dependency
+	for i := range downs {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if downs[i].Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		t.Cleanup(server.Close)
+		dependencies = append(dependencies, Dependency{Name: fmt.Sprintf("test-instance-%d", i), Service: "test-instances", URL: server.URL, Critical: true})
+	}
+	checker, err := NewDependencyChecker(dependencies, time.Second)
+	if err != nil {
+		t.Fatalf("NewDependencyChecker failed: %v", err)
+	}
+
+	// a critical service is up while one of its instances is
+	ctx := context.Background()
+	downs[0].Store(true)
+	checker.CheckAll(ctx)
+	if report := checker.Report(); !checker.Ready() || report.Status != DependencyDegraded {
+		t.Errorf("Expected the checker to be ready and the report degraded, got %+v", report)
+	}
+
+	downs[1].Store(true)
+	checker.CheckAll(ctx)
+	if report := checker.Report(); checker.Ready() || report.Status != DependencyDown {
+		t.Errorf("Expected the checker to be unready and the report down, got %+v", report)
+	}
+	if err := checker.Check(ctx); err == nil || !strings.Contains(err.Error(), "test-instances") {
+		t.Errorf("Expected the health check to name the critical service, got %v", err)
+	}
+}
+
+func TestDependencyChecker_SetDependencies(t *testing.T) {
+	upstream := newEchoUpstream(t, "set")
+	checker, err := NewDependencyChecker([]Dependency{
+		{Name: "test-kept", URL: upstream, Path: "/ping", Critical: true},
+		{Name: "test-removed", URL: upstream, Path: "/ping"},
+	}, time.Second)
+	if err != nil {
+		t.Fatalf("NewDependencyChecker failed: %v", err)
+	}
+	checker.CheckAll(context.Background())
+
+	err = checker.SetDependencies([]Dependency{
+		{Name: "test-kept", URL: upstream, Path: "/ping", Critical: true},
+		{Name: "test-added", URL: upstream, Path: "/ping"},
+	})
+	if err != nil {
+		t.Fatalf("SetDependencies failed: %v", err)
+	}
+	report := checker.Report()
+	if len(report.Dependencies) != 2 || report.Status != DependencyDegraded || !checker.Ready() {
+		t.Fatalf("Expected the kept dependency up and the added one unknown, got %+v", report)
+	}
+	if kept, added := report.Dependencies[0], report.Dependencies[1]; kept.Name != "test-kept" || kept.Status != DependencyUp || kept.LastSuccess == nil ||
+		added.Name != "test-added" || added.Status != DependencyUnknown {
+		t.Errorf("Expected the kept dependency up and the added one unknown, got %+v", report.Dependencies)
+	}
+
+	if err := checker.SetDependencies([]Dependency{{Name: "test-invalid", URL: "invalid"}}); err == nil {
+		t.Error("Expected an error for an invalid URL")
+	}
+	if got := checker.Report(); len(got.Dependencies) != 2 {
+		t.Errorf("Expected the dependencies to be kept on errors, got %+v", got)
+	}
+}
+
+func TestRouteDependencies(t *testing.T) {
+	config := &RouteConfig{Routes: []Route{
+		{Prefix: "/users", Name: "user", Upstreams: []string{"http://user:8080"}},
+		{Prefix: "/roles", Name: "user", Upstreams: []string{"http://user:8080"}},
+		{Prefix: "/items", Upstreams: []string{"http://item-1:8080", "http://item-2:8080"}, HealthCheck: HealthCheck{Path: "/ready"}},
+	}}
+	expected := []Dependency{
+		{Name: "user", Service: "user", URL: "http://user:8080", Critical: true},
+		{Name: "item-1/item-1:8080", Service: "item-1", URL: "http://item-1:8080", Path: "/ready"},
+		{Name: "item-1/item-2:8080", Service: "item-1", URL: "http://item-2:8080", Path: "/ready"},
+	}
+	if got := RouteDependencies(config, []string{"user"}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected dependencies %+v, got %+v", expected, got)
+	}
+}
+
+func TestGateway_SetDependencyChecker(t *testing.T) {
+	gateway := NewGateway(DefaultRouteConfig(ServiceURLs{
+		User:             "http://user:8080",
+		Cart:             "http://cart:8080",
+		Item:             "http://item:8080",
+		Checkout:         "http://checkout:8080",
+		CartPresentation: "http://cart-presentation:8080",
+	}), NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	checker, err := NewDependencyChecker(nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewDependencyChecker failed: %v", err)
+	}
+	gateway.SetDependencyChecker(checker, []string{"user"})
+
+	names := func() []string {
+		var names []string
+		for _, status := range checker.Report().Dependencies {
+			names = append(names, status.Name)
+		}
+		return names
+	}
+	if got := names(); !reflect.DeepEqual(got, []string{"user", "cart", "item", "checkout", "cart-presentation"}) {
+		t.Errorf("Expected the services of the default routes, got %v", got)
+	}
+	if checker.Ready() {
+		t.Error("Expected the checker not to be ready before the critical service has been checked")
+	}
+
+	// the dependencies follow the route table
+	err = gateway.SetRoutes(&RouteConfig{Routes: []Route{
+		{Prefix: "/api/v1/core/users", Name: "user", Upstreams: []string{"http://user-1:8080", "http://user-2:8080"}},
+	}})
+	if err != nil {
+		t.Fatalf("SetRoutes failed: %v", err)
+	}
+	if got := names(); !reflect.DeepEqual(got, []string{"user/user-1:8080", "user/user-2:8080"}) {
+		t.Errorf("Expected the instances of the new route, got %v", got)
+	}
+}
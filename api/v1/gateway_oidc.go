@@ -0,0 +1,212 @@
+package v1
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/oidc"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+const (
+	// oidcLoginCookieName is the name of the cookie holding the state of a pending login at the provider
+	oidcLoginCookieName = "oidc_login"
+	// oidcLoginTimeout is the time users have to log in at the provider
+	oidcLoginTimeout = 10 * time.Minute
+)
+
+// oidcLogin is the state of a login at the OpenID Connect provider. It is kept in an encrypted
+// cookie between the redirect to the provider and the callback.
+type oidcLogin struct {
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	Redirect     string    `json:"redirect"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// SetOIDC enables the login with an OpenID Connect provider. Users logging in for the first
+// time are created by users, usually a client of the user service.
+func (g *Gateway) SetOIDC(provider *oidc.Provider, users UserProvisioner) {
+	g.oidc = provider
+	g.provisioner = users
+}
+
+// handleOIDCLogin redirects the user to the provider for the login. The redirect query
+// parameter is the local path the user returns to once logged in.
+func (g *Gateway) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if !g.oidcEnabled(w, r) {
+		return
+	}
+
+	login := oidcLogin{
+		State:        rand.Text(),
+		Nonce:        rand.Text(),
+		CodeVerifier: oidc.NewCodeVerifier(),
+		Redirect:     localRedirect(r.URL.Query().Get("redirect")),
+		ExpiresAt:    time.Now().Add(oidcLoginTimeout),
+	}
+	if err := g.setOIDCLoginCookie(w, &login); err != nil {
+		router.NewErrorResponse(r, "failed to start login", err).WriteTo(w)
+		return
+	}
+	http.Redirect(w, r, g.oidc.AuthCodeURL(login.State, login.Nonce, oidc.CodeChallenge(login.CodeVerifier)), http.StatusFound)
+}
+
+// handleOIDCCallback completes the login once the provider redirected the user back. The
+// authorization code is exchanged for the ID token, the user is provisioned and the session
+// is created like for a login with a password.
+func (g *Gateway) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if !g.oidcEnabled(w, r) {
+		return
+	}
+
+	// the login state is only valid for a single callback
+	login, err := g.getOIDCLogin(r)
+	g.clearOIDCLoginCookie(w)
+	if err != nil {
+		router.NewErrorResponse(r, "login expired or not started", err).WriteTo(w)
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		err := fmt.Errorf("%w: provider returned %s: %s", ErrUnauthorized, query.Get("error"), query.Get("error_description"))
+		router.NewErrorResponse(r, "login failed", err).WriteTo(w)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(login.State)) != 1 {
+		router.NewErrorResponse(r, "login failed", fmt.Errorf("%w: state mismatch", ErrUnauthorized)).WriteTo(w)
+		return
+	}
+
+	token, err := g.oidc.Exchange(r.Context(), query.Get("code"), login.CodeVerifier)
+	if errors.Is(err, oidc.ErrExchangeFailed) {
+		err = fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to exchange authorization code", "error", err)
+		err = fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	if err != nil {
+		router.NewErrorResponse(r, "login failed", err).WriteTo(w)
+		return
+	}
+	claims, err := g.oidc.VerifyIDToken(r.Context(), token.IDToken, login.Nonce)
+	if err != nil {
+		router.NewErrorResponse(r, "login failed", fmt.Errorf("%w: %w", ErrUnauthorized, err)).WriteTo(w)
+		return
+	}
+
+	user, err := g.provisioner.ProvisionUser(r.Context(), &FederatedIdentity{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		PreferredUsername: claims.PreferredUsername,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		GivenName:         claims.GivenName,
+		FamilyName:        claims.FamilyName,
+		Locale:            claims.Locale,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to provision user", "issuer", claims.Issuer, "subject", claims.Subject, "error", err)
+		router.NewErrorResponse(r, "failed to provision user", err).WriteTo(w)
+		return
+	}
+
+	if _, ok := g.beginSession(w, r, user); !ok {
+		return
+	}
+	http.Redirect(w, r, login.Redirect, http.StatusFound)
+}
+
+// oidcEnabled reports whether the login with an OpenID Connect provider has been configured,
+// otherwise the endpoints are reported as missing.
+func (g *Gateway) oidcEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if g.oidc == nil || g.provisioner == nil {
+		(&router.ErrorResponse{
+			Status:  http.StatusNotFound,
+			Path:    r.URL.Path,
+			Message: "login with an identity provider is not enabled",
+		}).WriteTo(w)
+		return false
+	}
+	return true
+}
+
+// localRedirect returns target if it is a local path and the root path otherwise, the login
+// must not redirect users to other sites.
+func localRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "/"
+	}
+	return target
+}
+
+// setOIDCLoginCookie stores the login state in an encrypted cookie
+func (g *Gateway) setOIDCLoginCookie(w http.ResponseWriter, login *oidcLogin) error {
+	value, err := json.Marshal(login)
+	if err != nil {
+		return err
+	}
+	encoded, err := g.cookies.Encode(oidcLoginCookieName, value)
+	if err != nil {
+		return err
+	}
+
+	// the callback is a top-level navigation from the provider, strict cookies would not be sent along
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookieName,
+		Value:    encoded,
+		Path:     "/",
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// clearOIDCLoginCookie tells the client to drop the login state
+func (g *Gateway) clearOIDCLoginCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// getOIDCLogin returns the login state of the request. Errors caused by a missing, invalid
+// or expired state wrap ErrUnauthorized.
+func (g *Gateway) getOIDCLogin(r *http.Request) (*oidcLogin, error) {
+	cookie, err := r.Cookie(oidcLoginCookieName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	value, err := g.cookies.Decode(oidcLoginCookieName, cookie.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	var login oidcLogin
+	if err := json.Unmarshal(value, &login); err != nil {
+		return nil, fmt.Errorf("%w: malformed login state: %w", ErrUnauthorized, err)
+	}
+	if time.Now().After(login.ExpiresAt) {
+		return nil, fmt.Errorf("%w: login has expired", ErrUnauthorized)
+	}
+	return &login, nil
+}
@@ -0,0 +1,229 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/oidc"
+	"github.com/leonsteinhaeuser/demo-shop/internal/oidc/oidctest"
+)
+
+const oidcRedirectURL = "https://shop.example.com/api/v1/auth/oidc/callback"
+
+// storeProvisioner provisions users in a store like the user service
+type storeProvisioner struct {
+	store UserStore
+}
+
+func (p storeProvisioner) ProvisionUser(ctx context.Context, identity *FederatedIdentity) (*User, error) {
+	return ProvisionUser(ctx, p.store, identity)
+}
+
+// newOIDCGateway returns a gateway logging in users with a mock provider
+func newOIDCGateway(t *testing.T, users UserStore, sessions SessionStore) (*Gateway, *oidctest.Provider) {
+	t.Helper()
+	idp := oidctest.NewProvider(t, "demo-shop", "client secret")
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "demo-shop",
+		ClientSecret: "client secret",
+		RedirectURL:  oidcRedirectURL,
+		Scopes:       []string{"email", "profile"},
+	})
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	gateway := NewGateway(
+		DefaultRouteConfig(ServiceURLs{
+			User:             "http://localhost:8084",
+			Cart:             newServiceServer(t, NewCartRouter(NewMockCartStore())),
+			Item:             "http://localhost:8081",
+			Checkout:         "http://localhost:8085",
+			CartPresentation: "http://localhost:8083",
+		}),
+		users,
+		sessions,
+		cookieEncryptionKey,
+	)
+	gateway.SetIdentityTokens(identityTokens)
+	gateway.SetOIDC(provider, storeProvisioner{store: users})
+	return gateway, idp
+}
+
+// startOIDCLogin starts the login at the gateway and returns the login cookie and the
+// callback URL the provider redirected back to
+func startOIDCLogin(t *testing.T, gateway *Gateway, redirect string) (*http.Cookie, *url.URL) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/oidc/login?redirect="+url.QueryEscape(redirect), nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect to the provider, got status %d: %s", rr.Code, rr.Body.String())
+	}
+	var loginCookie *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == oidcLoginCookieName {
+			loginCookie = cookie
+		}
+	}
+	if loginCookie == nil || loginCookie.SameSite != http.SameSiteLaxMode || !loginCookie.HttpOnly {
+		t.Fatalf("Expected an HTTP only login cookie with SameSite=Lax, got %v", loginCookie)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected a redirect back from the provider, got status %d: %v", resp.StatusCode, err)
+	}
+	return loginCookie, callback
+}
+
+// completeOIDCLogin calls the callback of the gateway with the query and the login cookie
+func completeOIDCLogin(gateway *Gateway, query string, loginCookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/oidc/callback?"+query, nil)
+	if loginCookie != nil {
+		req.AddCookie(loginCookie)
+	}
+	rr := httptest.NewRecorder()
+	gateway.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGateway_OIDCLogin(t *testing.T) {
+	users := NewMockUserStore()
+	sessions := NewMockSessionStore()
+	gateway, idp := newOIDCGateway(t, users, sessions)
+	idp.SetClaims(map[string]any{
+		"sub":                "248289761001",
+		"preferred_username": "jane",
+		"email":              "jane@example.com",
+		"email_verified":     true,
+		"given_name":         "Jane",
+		"family_name":        "Doe",
+		"locale":             "de-DE",
+	})
+
+	loginCookie, callback := startOIDCLogin(t, gateway, "/cart")
+	rr := completeOIDCLogin(gateway, callback.RawQuery, loginCookie)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/cart" {
+		t.Fatalf("Expected a redirect to /cart, got status %d to %q: %s", rr.Code, rr.Header().Get("Location"), rr.Body.String())
+	}
+
+	user, err := users.GetBySubject(context.Background(), idp.Issuer(), "248289761001")
+	if err != nil {
+		t.Fatalf("Expected the user to be provisioned: %v", err)
+	}
+	if *user.Username != "jane" || *user.Email != "jane@example.com" || !user.EmailVerified ||
+		*user.GivenName != "Jane" || *user.FamilyName != "Doe" || *user.Locale != "de-DE" {
+		t.Errorf("Expected the claims to be mapped to the user, got %+v", user)
+	}
+
+	var sessionCookie *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			sessionCookie = cookie
+		}
+	}
+	if sessionCookie == nil {
+		t.Fatal("Expected session cookie to be set")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+	req.AddCookie(sessionCookie)
+	session, err := gateway.getSession(req)
+	if err != nil || session.UserID != user.ID {
+		t.Errorf("Expected a session of user %s, got %v, %v", user.ID, session, err)
+	}
+
+	// the authorization code can only be used once
+	if rr := completeOIDCLogin(gateway, callback.RawQuery, loginCookie); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a replayed callback, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	// the second login finds the provisioned user
+	loginCookie, callback = startOIDCLogin(t, gateway, "/")
+	if rr := completeOIDCLogin(gateway, callback.RawQuery, loginCookie); rr.Code != http.StatusFound {
+		t.Fatalf("Expected the second login to succeed, got status %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(users.users) != 1 {
+		t.Errorf("Expected a single user, got %d", len(users.users))
+	}
+}
+
+func TestGateway_OIDCCallbackFailures(t *testing.T) {
+	gateway, _ := newOIDCGateway(t, NewMockUserStore(), NewMockSessionStore())
+	loginCookie, callback := startOIDCLogin(t, gateway, "/")
+	query := callback.Query()
+
+	withState := func(state string) string {
+		q := url.Values{"code": {query.Get("code")}, "state": {state}}
+		return q.Encode()
+	}
+	tamperedCookie := *loginCookie
+	tamperedCookie.Value = "tampered"
+
+	tests := []struct {
+		name           string
+		query          string
+		cookie         *http.Cookie
+		expectedStatus int
+	}{
+		{name: "missing login cookie", query: callback.RawQuery, expectedStatus: http.StatusUnauthorized},
+		{name: "tampered login cookie", query: callback.RawQuery, cookie: &tamperedCookie, expectedStatus: http.StatusUnauthorized},
+		{name: "state mismatch", query: withState("forged"), cookie: loginCookie, expectedStatus: http.StatusUnauthorized},
+		{name: "provider error", query: "error=access_denied&state=" + query.Get("state"), cookie: loginCookie, expectedStatus: http.StatusUnauthorized},
+		{name: "unknown code", query: url.Values{"code": {"unknown"}, "state": {query.Get("state")}}.Encode(), cookie: loginCookie, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := completeOIDCLogin(gateway, tt.query, tt.cookie)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			for _, cookie := range rr.Result().Cookies() {
+				if cookie.Name == sessionCookieName {
+					t.Error("Did not expect session cookie to be set")
+				}
+			}
+		})
+	}
+}
+
+func TestGateway_OIDCDisabled(t *testing.T) {
+	gateway := newTestGateway(NewMockSessionStore())
+	for _, path := range []string{"/oidc/login", "/oidc/callback"} {
+		rr := httptest.NewRecorder()
+		gateway.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusNotFound, path, rr.Code)
+		}
+	}
+}
+
+func TestLocalRedirect(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "/cart", want: "/cart"},
+		{target: "/items?page=2", want: "/items?page=2"},
+		{target: "", want: "/"},
+		{target: "https://evil.example.com", want: "/"},
+		{target: "//evil.example.com", want: "/"},
+		{target: "/\\evil.example.com", want: "/"},
+		{target: "cart", want: "/"},
+	}
+	for _, tt := range tests {
+		if got := localRedirect(tt.target); got != tt.want {
+			t.Errorf("localRedirect(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
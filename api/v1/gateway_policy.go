@@ -0,0 +1,385 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/patch"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+// maxPolicyBodySize limits the request bodies read by the gateway to check their ownership
+const maxPolicyBodySize = 1 << 20
+
+// routePolicy describes who may call a proxied route. Callers holding the permission of the
+// route may call it without further checks, others only if they pass the ownership checks.
+type routePolicy struct {
+	// public routes may be called without a session
+	public bool
+	// permission grants access to the route, routes without one are open to all callers
+	permission string
+	// resource is the kind of the resource addressed by the {id} path value. Its owner may access it.
+	resource *ownedResource
+	// body checks the object stored by a POST, PUT or PATCH request. For PUT and PATCH requests
+	// it also receives the current resource, for PATCH requests obj is the resource with the
+	// patch applied. The session is nil for anonymous callers.
+	body func(ctx context.Context, g *Gateway, session *Session, current, obj []byte) error
+}
+
+// ownedResource is a kind of resource that belongs to a user
+type ownedResource struct {
+	name string
+	// path returns the gateway path of the resource with the given ID
+	path func(id string) string
+	// ownerField is the JSON field holding the ID of the owning user
+	ownerField string
+}
+
+var (
+	ownedUser = &ownedResource{
+		name:       "user",
+		path:       func(id string) string { return "/api/v1/core/users/" + id },
+		ownerField: "id",
+	}
+	ownedCart = &ownedResource{
+		name:       "cart",
+		path:       func(id string) string { return "/api/v1/core/carts/" + id },
+		ownerField: "owner_id",
+	}
+	ownedCheckout = &ownedResource{
+		name:       "checkout",
+		path:       func(id string) string { return "/api/v1/core/checkouts/" + id },
+		ownerField: "user_id",
+	}
+)
+
+// routePolicies maps the patterns of the proxied routes to their policies. Requests matching
+// none of them are rejected, method specific patterns take precedence over the others.
+var routePolicies = map[string]routePolicy{
+	// the catalog is public
+	"GET /api/v1/core/items":      {public: true},
+	"GET /api/v1/core/items/{id}": {public: true},
+	"/api/v1/core/items":          {permission: PermissionItemsWrite},
+	"/api/v1/core/items/{id}":     {permission: PermissionItemsWrite},
+
+	// everyone may register, users manage their own profile
+	"POST /api/v1/core/users":       {public: true, permission: PermissionUsersWrite, body: checkUserBody},
+	"GET /api/v1/core/users":        {permission: PermissionUsersRead},
+	"/api/v1/core/users":            {permission: PermissionUsersWrite},
+	"GET /api/v1/core/users/{id}":   {permission: PermissionUsersRead, resource: ownedUser},
+	"PUT /api/v1/core/users/{id}":   {permission: PermissionUsersWrite, resource: ownedUser, body: checkUserBody},
+	"PATCH /api/v1/core/users/{id}": {permission: PermissionUsersWrite, resource: ownedUser, body: checkUserBody},
+	"/api/v1/core/users/{id}":       {permission: PermissionUsersWrite},
+
+	// users manage their own API keys
+	"GET /api/v1/core/users/{id}/apikeys":     {permission: PermissionUsersRead, resource: ownedUser},
+	"/api/v1/core/users/{id}/apikeys":         {permission: PermissionUsersWrite, resource: ownedUser},
+	"/api/v1/core/users/{id}/apikeys/{keyID}": {permission: PermissionUsersWrite, resource: ownedUser},
+
+	"GET /api/v1/core/roles":      {permission: PermissionRolesRead},
+	"GET /api/v1/core/roles/{id}": {permission: PermissionRolesRead},
+	"/api/v1/core/roles":          {permission: PermissionRolesWrite},
+	"/api/v1/core/roles/{id}":     {permission: PermissionRolesWrite},
+
+	// users access their own carts and checkouts
+	"POST /api/v1/core/carts":         {permission: PermissionCartsWrite, body: checkCartBody},
+	"GET /api/v1/core/carts":          {permission: PermissionCartsRead},
+	"/api/v1/core/carts":              {permission: PermissionCartsWrite},
+	"GET /api/v1/core/carts/{id}":     {permission: PermissionCartsRead, resource: ownedCart},
+	"/api/v1/core/carts/{id}":         {permission: PermissionCartsWrite, resource: ownedCart, body: checkCartBody},
+	"POST /api/v1/core/checkouts":     {permission: PermissionCheckoutsWrite, body: checkCheckoutBody},
+	"GET /api/v1/core/checkouts":      {permission: PermissionCheckoutsRead},
+	"/api/v1/core/checkouts":          {permission: PermissionCheckoutsWrite},
+	"GET /api/v1/core/checkouts/{id}": {permission: PermissionCheckoutsRead, resource: ownedCheckout},
+	"/api/v1/core/checkouts/{id}":     {permission: PermissionCheckoutsWrite, resource: ownedCheckout, body: checkCheckoutBody},
+	"/api/v1/presentation/cart/{id}":  {permission: PermissionCartsRead, resource: ownedCart},
+}
+
+// newPolicyHandler returns a handler serving every route of routePolicies with next, after
+// the caller has been authorized. Requests none of them covers are rejected.
+func (g *Gateway) newPolicyHandler(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	for pattern, policy := range routePolicies {
+		mux.Handle(pattern, g.enforce(policy, next))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" {
+			(&router.ErrorResponse{
+				Status:  http.StatusNotFound,
+				Path:    r.URL.Path,
+				Message: "endpoint not found",
+			}).WriteTo(w)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// enforce authorizes requests with policy before passing them to next. The session of the
+// caller is passed on in the request context. Invalid session cookies are ignored, invalid
+// API keys are rejected as clients sending them expect to act on behalf of a user.
+func (g *Gateway) enforce(policy routePolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// clients guessing API keys are locked out, the keys are not validated meanwhile
+		_, hasAPIKey := bearerToken(r)
+		apiKeyLockoutKey := g.clientIP(r)
+		if hasAPIKey {
+			if wait := g.apiKeyLockout.locked(apiKeyLockoutKey, time.Now()); wait > 0 {
+				writeTooManyRequests(w, r, wait, "too many invalid API keys")
+				return
+			}
+		}
+
+		session, err := g.authenticate(r)
+		// failed authentications count against the client IP
+		if route := routeFromContext(r.Context()); route != nil && route.limiter != nil {
+			if !g.limit(w, r, route.Prefix, route.limiter, g.rateLimitKey(r, session, route.RateLimit.Key)) {
+				return
+			}
+		}
+		switch {
+		case err == nil:
+			// valid keys do not reset the failures of the client, otherwise a client holding
+			// one could send it between its guesses and never be locked out
+		case hasAPIKey:
+			if errors.Is(err, ErrUnauthorized) {
+				if g.apiKeyLockout.fail(apiKeyLockoutKey, time.Now()) {
+					slog.WarnContext(r.Context(), "Locking out client after invalid API keys", "client_ip", apiKeyLockoutKey, "duration", g.apiKeyLockout.duration)
+					apiKeyLockouts.Inc()
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			} else {
+				slog.WarnContext(r.Context(), "Failed to validate API key", "error", err)
+			}
+			router.NewErrorResponse(r, "authentication failed", err).WriteTo(w)
+			return
+		case errors.Is(err, http.ErrNoCookie):
+		case errors.Is(err, ErrUnauthorized):
+			slog.DebugContext(r.Context(), "Ignoring invalid session cookie", "error", err)
+		default:
+			slog.WarnContext(r.Context(), "Failed to load session", "error", err)
+		}
+
+		// CORS preflight requests never carry credentials
+		if r.Method != http.MethodOptions {
+			if err := g.authorize(r, policy, session); err != nil {
+				router.NewErrorResponse(r, "access denied", err).WriteTo(w)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(withSession(r.Context(), session)))
+	})
+}
+
+// authorize checks whether the caller holding session may perform the request.
+// The errors wrap ErrUnauthorized if a session is required and ErrForbidden if the
+// session does not grant access.
+func (g *Gateway) authorize(r *http.Request, policy routePolicy, session *Session) error {
+	if session == nil && !policy.public {
+		return fmt.Errorf("%w: login required", ErrUnauthorized)
+	}
+	if policy.permission == "" || session.Can(policy.permission) {
+		return nil
+	}
+	if policy.resource == nil && policy.body == nil {
+		return fmt.Errorf("%w: missing permission %s", ErrForbidden, policy.permission)
+	}
+
+	var current []byte
+	if policy.resource != nil {
+		doc, err := g.fetchResource(r.Context(), policy.resource.path(r.PathValue("id")))
+		if errors.Is(err, ErrNotFound) {
+			// nothing to protect, the upstream service answers with 404 itself
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", policy.resource.name, err)
+		}
+		owner, err := uuidOf(doc, policy.resource.ownerField)
+		if err != nil {
+			return fmt.Errorf("failed to read owner of %s: %w", policy.resource.name, err)
+		}
+		if owner != session.UserID {
+			return fmt.Errorf("%w: the %s belongs to another user", ErrForbidden, policy.resource.name)
+		}
+		current = doc
+	}
+
+	if policy.body == nil || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch) {
+		return nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxPolicyBodySize))
+	if err != nil {
+		return fmt.Errorf("%w: failed to read request body: %w", ErrValidation, err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	obj := body
+	if r.Method == http.MethodPatch {
+		obj, err = applyPatch(r, current, body)
+		if errors.Is(err, ErrUnsupportedMediaType) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("%w: invalid patch: %w", ErrValidation, err)
+		}
+	}
+	return policy.body(r.Context(), g, session, current, obj)
+}
+
+// applyPatch applies the patch in body to doc like the upstream services do
+func applyPatch(r *http.Request, doc, body []byte) ([]byte, error) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	switch contentType {
+	case patch.MergePatchContentType:
+		return patch.Merge(doc, body)
+	case patch.JSONPatchContentType:
+		return patch.Apply(doc, body)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, contentType)
+	}
+}
+
+// fetchResource returns the JSON representation of the upstream resource at the gateway path p
+func (g *Gateway) fetchResource(ctx context.Context, p string) ([]byte, error) {
+	var doc []byte
+	if err := g.callService(ctx, http.MethodGet, p, nil, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// uuidOf returns the UUID held by field of the JSON object doc
+func uuidOf(doc []byte, field string) (uuid.UUID, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	if raw, ok := fields[field]; ok {
+		if err := json.Unmarshal(raw, &id); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return id, nil
+}
+
+// userPrivileges are the fields of a user that grant permissions
+type userPrivileges struct {
+	IsAdmin bool     `json:"is_admin"`
+	Roles   []string `json:"roles"`
+}
+
+// checkUserBody prevents users from granting themselves admin privileges or roles, giving them up is fine
+func checkUserBody(ctx context.Context, g *Gateway, session *Session, current, obj []byte) error {
+	var user, existing userPrivileges
+	if err := json.Unmarshal(obj, &user); err != nil {
+		return fmt.Errorf("%w: invalid user: %w", ErrValidation, err)
+	}
+	if current != nil {
+		if err := json.Unmarshal(current, &existing); err != nil {
+			return fmt.Errorf("failed to read user: %w", err)
+		}
+	}
+	if user.IsAdmin && !existing.IsAdmin {
+		return fmt.Errorf("%w: missing permission %s to grant admin privileges", ErrForbidden, PermissionUsersWrite)
+	}
+	for _, role := range user.Roles {
+		if !slices.Contains(existing.Roles, role) {
+			return fmt.Errorf("%w: missing permission %s to assign roles", ErrForbidden, PermissionUsersWrite)
+		}
+	}
+	return nil
+}
+
+// checkSameID ensures the object stored by a PUT or PATCH request keeps the ID of the current
+// resource. The upstream services store the object under the ID of the body, the ownership has
+// been checked for the resource in the path.
+func checkSameID(current, obj []byte) error {
+	if current == nil {
+		return nil
+	}
+	currentID, err := uuidOf(current, "id")
+	if err != nil {
+		return fmt.Errorf("failed to read ID: %w", err)
+	}
+	id, err := uuidOf(obj, "id")
+	if err != nil {
+		return NewValidationError(Violation{Field: "id", Message: err.Error()})
+	}
+	if id != currentID {
+		return NewValidationError(Violation{Field: "id", Message: "does not match the ID in the path"})
+	}
+	return nil
+}
+
+// checkCartBody ensures carts are stored for the calling user under the ID in the path
+func checkCartBody(ctx context.Context, g *Gateway, session *Session, current, obj []byte) error {
+	owner, err := uuidOf(obj, ownedCart.ownerField)
+	if err != nil {
+		return fmt.Errorf("%w: invalid cart: %w", ErrValidation, err)
+	}
+	if err := checkSameID(current, obj); err != nil {
+		return err
+	}
+	if owner != session.UserID {
+		return fmt.Errorf("%w: carts can only be stored for the own user", ErrForbidden)
+	}
+	return nil
+}
+
+// checkCheckoutBody ensures checkouts are stored for the calling user and one of their carts,
+// under the ID in the path
+func checkCheckoutBody(ctx context.Context, g *Gateway, session *Session, current, obj []byte) error {
+	var checkout struct {
+		UserID uuid.UUID `json:"user_id"`
+		CartID uuid.UUID `json:"cart_id"`
+	}
+	if err := json.Unmarshal(obj, &checkout); err != nil {
+		return fmt.Errorf("%w: invalid checkout: %w", ErrValidation, err)
+	}
+	if err := checkSameID(current, obj); err != nil {
+		return err
+	}
+	if checkout.UserID != session.UserID {
+		return fmt.Errorf("%w: checkouts can only be stored for the own user", ErrForbidden)
+	}
+
+	cart, err := g.fetchResource(ctx, ownedCart.path(checkout.CartID.String()))
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: cart %s does not exist", ErrValidation, checkout.CartID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch cart: %w", err)
+	}
+	if owner, err := uuidOf(cart, ownedCart.ownerField); err != nil || owner != session.UserID {
+		return fmt.Errorf("%w: the cart belongs to another user", ErrForbidden)
+	}
+	return nil
+}
+
+type sessionContextKey struct{}
+
+// withSession returns a copy of ctx carrying the session of the caller, which may be nil
+func withSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, session)
+}
+
+// sessionFromContext returns the session stored by withSession, or nil
+func sessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return session
+}
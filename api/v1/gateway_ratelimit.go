@@ -0,0 +1,360 @@
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Keys the requests of a client are counted by
+const (
+	// RateLimitKeyClient counts the requests of an API key or the user of a session together,
+	// anonymous requests by client IP. It is the default.
+	RateLimitKeyClient = "client"
+	// RateLimitKeyIP counts the requests by client IP
+	RateLimitKeyIP = "ip"
+)
+
+const (
+	// defaultRateLimitPeriod is the period of rate limits without one
+	defaultRateLimitPeriod = time.Minute
+	// defaultLoginMaxFailures is the number of consecutive failed logins locking a client out
+	defaultLoginMaxFailures = 5
+	// defaultLoginLockoutDuration is how long a client is locked out after failed logins
+	defaultLoginLockoutDuration = 15 * time.Minute
+	// sweepInterval is the interval idle entries are removed from limiters in
+	sweepInterval = time.Minute
+)
+
+// RateLimit limits the requests of every client with a token bucket. Clients may make Burst
+// requests at once, the bucket refills with Requests per Period.
+type RateLimit struct {
+	// Requests is the number of requests a client may make per Period, no limit if zero
+	Requests int `json:"requests,omitempty"`
+	// Period the requests are counted in, 1m if zero
+	Period Duration `json:"period,omitempty"`
+	// Burst is the size of the bucket, Requests if zero
+	Burst int `json:"burst,omitempty"`
+	// Key is what the requests are counted by, RateLimitKeyClient if empty
+	Key string `json:"key,omitempty"`
+}
+
+var (
+	rateLimitedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_rate_limited_requests_total",
+		Help: "Total number of requests of a route rejected by its rate limit",
+	}, []string{"route"})
+	loginLockouts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gateway_login_lockouts_total",
+		Help: "Total number of clients locked out after failed logins",
+	})
+	apiKeyLockouts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gateway_api_key_lockouts_total",
+		Help: "Total number of clients locked out after sending invalid API keys",
+	})
+)
+
+// rateLimiter holds the token buckets of the clients of a rate limit
+type rateLimiter struct {
+	limit RateLimit
+	// rate is the number of tokens added per second
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	// updated is the time tokens has been calculated at
+	updated time.Time
+}
+
+// newRateLimiter returns the limiter of limit, or nil if it does not limit requests
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Requests == 0 {
+		return nil
+	}
+	period := time.Duration(limit.Period)
+	if period == 0 {
+		period = defaultRateLimitPeriod
+	}
+	burst := limit.Burst
+	if burst == 0 {
+		burst = limit.Requests
+	}
+	return &rateLimiter{
+		limit:   limit,
+		rate:    float64(limit.Requests) / period.Seconds(),
+		burst:   float64(burst),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// keepRateLimiter returns previous if it enforces limit, so its buckets are kept, otherwise
+// the limiter of limit
+func keepRateLimiter(previous *rateLimiter, limit RateLimit) *rateLimiter {
+	if previous != nil && previous.limit == limit {
+		return previous
+	}
+	return newRateLimiter(limit)
+}
+
+// rateLimitResult is the state of a bucket after a request has been counted
+type rateLimitResult struct {
+	allowed   bool
+	remaining int
+	// reset is how long it takes until the bucket is full again
+	reset time.Duration
+	// retryAfter is how long it takes until the next request is allowed
+	retryAfter time.Duration
+}
+
+// allow takes a token from the bucket of key
+func (l *rateLimiter) allow(key string, now time.Time) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+
+	var result rateLimitResult
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = seconds((1 - bucket.tokens) / l.rate)
+	}
+	result.remaining = int(bucket.tokens)
+	result.reset = seconds((l.burst - bucket.tokens) / l.rate)
+	return result
+}
+
+// sweep removes the buckets that have been refilled completely, l.mu must be held
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// limit counts the request against limiter. It sets the RateLimit headers and answers
+// requests exceeding the limit with 429, ok is false then.
+func (g *Gateway) limit(w http.ResponseWriter, r *http.Request, route string, limiter *rateLimiter, key string) (ok bool) {
+	result := limiter.allow(key, time.Now())
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(int(limiter.burst)))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+	if result.allowed {
+		return true
+	}
+
+	slog.DebugContext(r.Context(), "Rate limit exceeded", "route", route, "key", key)
+	rateLimitedRequests.WithLabelValues(route).Inc()
+	writeTooManyRequests(w, r, result.retryAfter, "rate limit exceeded")
+	return false
+}
+
+// writeTooManyRequests answers the request with 429, the client may try again after retryAfter
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(retryAfter), 1)))
+	(&router.ErrorResponse{
+		Status:  http.StatusTooManyRequests,
+		Path:    r.URL.Path,
+		Message: message,
+	}).WriteTo(w)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// rateLimitKey returns the key the request is counted by. Requests authenticated with an
+// API key are counted by the key, requests with a session by its user, unless key is
+// RateLimitKeyIP.
+func (g *Gateway) rateLimitKey(r *http.Request, session *Session, key string) string {
+	if key != RateLimitKeyIP && session != nil {
+		if token, ok := bearerToken(r); ok {
+			// the key is a secret, only its hash is kept
+			sum := sha256.Sum256([]byte(token))
+			return "apikey:" + hex.EncodeToString(sum[:16])
+		}
+		return "user:" + session.UserID.String()
+	}
+	return "ip:" + g.clientIP(r)
+}
+
+// limitAuth applies the rate limit of the authentication routes, their requests are
+// counted by client IP
+func (g *Gateway) limitAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if table := g.routes.Load(); table != nil && table.authLimiter != nil {
+			if !g.limit(w, r, authRoute, table.authLimiter, "ip:"+g.clientIP(r)) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authRoute labels the metrics of the authentication routes
+const authRoute = "/api/v1/auth"
+
+// SetTrustedProxies configures the proxies in front of the gateway. The client IP of their
+// requests is taken from the X-Forwarded-For header, otherwise it is the remote address.
+func (g *Gateway) SetTrustedProxies(proxies []netip.Prefix) {
+	g.trustedProxies = proxies
+}
+
+// clientIP returns the IP address of the client making the request
+func (g *Gateway) clientIP(r *http.Request) string {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	ip := addrPort.Addr().Unmap()
+	if !g.isTrustedProxy(ip) {
+		return ip.String()
+	}
+
+	// every proxy appends the address it received the request from, the rightmost address
+	// not belonging to a trusted proxy is the client
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		ip = addr.Unmap()
+		if !g.isTrustedProxy(ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+func (g *Gateway) isTrustedProxy(ip netip.Addr) bool {
+	for _, proxy := range g.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginLockout locks clients out after consecutive failed logins or invalid API keys
+type loginLockout struct {
+	maxFailures int
+	duration    time.Duration
+
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempts
+	lastSweep time.Time
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func newLoginLockout(maxFailures int, duration time.Duration) *loginLockout {
+	return &loginLockout{maxFailures: maxFailures, duration: duration, attempts: map[string]*loginAttempts{}}
+}
+
+// SetLoginLockout configures the lockout of clients after failed logins. After maxFailures
+// consecutive failed logins for a username from a client IP, further logins are rejected
+// for duration. Failures older than duration are forgotten. Zero maxFailures disables it.
+// Client IPs sending maxFailures invalid API keys are locked out alike, so keys cannot be
+// guessed faster than logins. Valid keys do not reset their failures.
+func (g *Gateway) SetLoginLockout(maxFailures int, duration time.Duration) {
+	g.lockout = newLoginLockout(maxFailures, duration)
+	g.apiKeyLockout = newLoginLockout(maxFailures, duration)
+}
+
+// loginLockoutKey returns the key of the failed logins of the request for username
+func (g *Gateway) loginLockoutKey(r *http.Request, username string) string {
+	return strings.ToLower(username) + " " + g.clientIP(r)
+}
+
+// locked returns how long key is still locked out
+func (l *loginLockout) locked(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if attempts, ok := l.attempts[key]; ok {
+		return max(attempts.lockedUntil.Sub(now), 0)
+	}
+	return 0
+}
+
+// fail records a failed login, locked reports whether it locked key out
+func (l *loginLockout) fail(key string, now time.Time) (locked bool) {
+	if l.maxFailures == 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	attempts, ok := l.attempts[key]
+	if !ok || now.Sub(attempts.lastFailure) > l.duration {
+		attempts = &loginAttempts{}
+		l.attempts[key] = attempts
+	}
+	attempts.failures++
+	attempts.lastFailure = now
+	if attempts.failures < l.maxFailures {
+		return false
+	}
+	attempts.failures = 0
+	attempts.lockedUntil = now.Add(l.duration)
+	return true
+}
+
+// succeed forgets the failed logins of key
+func (l *loginLockout) succeed(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// sweep removes the attempts that have expired, l.mu must be held
+func (l *loginLockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, attempts := range l.attempts {
+		if now.Sub(attempts.lastFailure) > l.duration && !now.Before(attempts.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
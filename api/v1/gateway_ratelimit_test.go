@@ -0,0 +1,213 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{Requests: 60, Burst: 2})
+	now := time.Now()
+
+	for i, want := range []bool{true, true, false} {
+		if result := limiter.allow("client", now); result.allowed != want {
+			t.Fatalf("Expected request %d allowed %v, got %+v", i, want, result)
+		}
+	}
+	result := limiter.allow("client", now)
+	if result.retryAfter != time.Second || result.reset != 2*time.Second || result.remaining != 0 {
+		t.Errorf("Expected retry after 1s and reset after 2s, got %+v", result)
+	}
+	if !limiter.allow("other", now).allowed {
+		t.Error("Expected the buckets of clients to be independent")
+	}
+
+	// the bucket refills with a token per second
+	if result := limiter.allow("client", now.Add(time.Second)); !result.allowed || result.remaining != 0 {
+		t.Errorf("Expected a refilled token, got %+v", result)
+	}
+
+	// full buckets are removed
+	limiter.allow("client", now.Add(time.Hour))
+	if _, ok := limiter.buckets["other"]; ok {
+		t.Error("Expected the full bucket to be removed")
+	}
+
+	if newRateLimiter(RateLimit{}) != nil {
+		t.Error("Expected no limiter without requests")
+	}
+}
+
+func TestGateway_RateLimit(t *testing.T) {
+	upstream := newEchoUpstream(t, "limited")
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/limited", Upstreams: []string{upstream}, Auth: RouteAuthPublic, RateLimit: RateLimit{Requests: 2, Period: Duration(time.Hour)}},
+		{Prefix: "/by-ip", Upstreams: []string{upstream}, Auth: RouteAuthPublic, RateLimit: RateLimit{Requests: 1, Period: Duration(time.Hour), Key: RateLimitKeyIP}},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	gateway.SetIdentityTokens(identityTokens)
+	gateway.SetAPIKeys(apiKeyValidatorFunc(func(ctx context.Context, key string) (*APIKeyIdentity, error) {
+		return &APIKeyIdentity{KeyID: uuid.New(), UserID: uuid.New(), Username: "bot"}, nil
+	}))
+	_, cookie := startSession(t, gateway, uuid.New(), false)
+
+	serve := func(path, remoteAddr string, authenticate func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		if authenticate != nil {
+			authenticate(req)
+		}
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, req)
+		return rr
+	}
+	withCookie := func(r *http.Request) { r.AddCookie(cookie) }
+	withAPIKey := func(r *http.Request) { r.Header.Set("Authorization", "Bearer key") }
+
+	for i, remaining := range []string{"1", "0"} {
+		rr := serve("/limited", "192.0.2.1:1234", nil)
+		if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("Expected request %d to pass with %s remaining, got %d %v", i, remaining, rr.Code, rr.Header())
+		}
+	}
+	rr := serve("/limited", "192.0.2.1:1234", nil)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1800" || rr.Header().Get("RateLimit-Reset") != "3600" {
+		t.Errorf("Expected 429 with Retry-After, got %d %v", rr.Code, rr.Header())
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		remoteAddr     string
+		authenticate   func(*http.Request)
+		expectedStatus int
+	}{
+		{name: "other client IP", path: "/limited", remoteAddr: "192.0.2.2:1234", expectedStatus: http.StatusOK},
+		{name: "session counted by user", path: "/limited", remoteAddr: "192.0.2.1:1234", authenticate: withCookie, expectedStatus: http.StatusOK},
+		{name: "API key counted by key", path: "/limited", remoteAddr: "192.0.2.1:1234", authenticate: withAPIKey, expectedStatus: http.StatusOK},
+		{name: "counted by IP", path: "/by-ip", remoteAddr: "192.0.2.3:1234", authenticate: withCookie, expectedStatus: http.StatusOK},
+		{name: "counted by IP regardless of the session", path: "/by-ip", remoteAddr: "192.0.2.3:1234", authenticate: withAPIKey, expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := serve(tt.path, tt.remoteAddr, tt.authenticate); rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+
+	// the buckets are kept if the rate limit does not change on a reload
+	if err := gateway.SetRoutes(gateway.routes.Load().config); err != nil {
+		t.Fatalf("SetRoutes failed: %v", err)
+	}
+	if rr := serve("/limited", "192.0.2.1:1234", nil); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the bucket to be kept on reloads, got %d", rr.Code)
+	}
+}
+
+func TestGateway_ClientIP(t *testing.T) {
+	gateway := NewGateway(nil, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	gateway.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expectedIP   string
+	}{
+		{name: "direct", remoteAddr: "192.0.2.1:1234", expectedIP: "192.0.2.1"},
+		{name: "untrusted proxy", remoteAddr: "192.0.2.1:1234", forwardedFor: []string{"198.51.100.1"}, expectedIP: "192.0.2.1"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"198.51.100.1"}, expectedIP: "198.51.100.1"},
+		{name: "spoofed header", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"203.0.113.1, 198.51.100.1"}, expectedIP: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"198.51.100.1", "10.0.0.2"}, expectedIP: "198.51.100.1"},
+		{name: "invalid header", remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"unknown"}, expectedIP: "10.0.0.1"},
+		{name: "IPv6", remoteAddr: "[2001:db8::1]:1234", expectedIP: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if ip := gateway.clientIP(req); ip != tt.expectedIP {
+				t.Errorf("Expected client IP %s, got %s", tt.expectedIP, ip)
+			}
+		})
+	}
+}
+
+func TestGateway_LoginLockout(t *testing.T) {
+	users := NewMockUserStore()
+	username := "alice"
+	id := uuid.New()
+	users.users[id] = &User{ID: id, Username: &username}
+	users.passwords[id] = "secret"
+
+	gateway := NewGateway(nil, users, NewMockSessionStore(), cookieEncryptionKey)
+	gateway.SetLoginLockout(3, time.Hour)
+	login := func(password, remoteAddr string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(LoginRequest{Username: username, Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		gateway.handleLogin(rr, req)
+		return rr
+	}
+
+	for range 3 {
+		if rr := login("guess", "192.0.2.1:1234"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected failed login, got %d", rr.Code)
+		}
+	}
+	rr := login("secret", "192.0.2.1:1234")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "3600" {
+		t.Errorf("Expected the client to be locked out, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := login("guess", "192.0.2.2:1234"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected other clients not to be locked out, got %d", rr.Code)
+	}
+
+	// successful logins reset the failures
+	lockout := newLoginLockout(2, time.Hour)
+	now := time.Now()
+	lockout.fail("key", now)
+	lockout.succeed("key")
+	if lockout.fail("key", now) {
+		t.Error("Expected the failures to be reset by a successful login")
+	}
+	if lockout.fail("key", now.Add(2*time.Hour)) {
+		t.Error("Expected old failures to be forgotten")
+	}
+	if !lockout.fail("key", now.Add(2*time.Hour)) || lockout.locked("key", now.Add(2*time.Hour)) != time.Hour {
+		t.Error("Expected the key to be locked out for an hour")
+	}
+}
+
+func TestGateway_AuthRateLimit(t *testing.T) {
+	gateway := NewGateway(&RouteConfig{AuthRateLimit: RateLimit{Requests: 1, Period: Duration(time.Hour)}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	mux := http.NewServeMux()
+	gateway.RegisterRoutes(mux)
+
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader([]byte(`{"username":"alice","password":"guess"}`)))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := login(); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected the first login to be checked, got %d", rr.Code)
+	}
+	if rr := login(); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected the second login to be rate limited, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,523 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Auth policies of the routes
+const (
+	// RouteAuthPolicies authorizes requests with the route policies of the gateway, requests
+	// none of them covers are rejected. It is the default.
+	RouteAuthPolicies = "policies"
+	// RouteAuthPublic passes all requests on, with the identity of the caller if there is a session
+	RouteAuthPublic = "public"
+	// RouteAuthSession requires a session, and the permission of the route if it has one
+	RouteAuthSession = "session"
+)
+
+// RouteConfig is the route table of the gateway
+type RouteConfig struct {
+	Routes []Route `json:"routes"`
+	// AuthRateLimit limits the requests to the authentication routes by client IP
+	AuthRateLimit RateLimit `json:"auth_rate_limit,omitempty"`
+}
+
+// Route passes the requests below a path prefix on to an upstream service
+type Route struct {
+	// Prefix is the path prefix of the requests, the longest matching prefix wins
+	Prefix string `json:"prefix"`
+	// Name names the service of the route in the dependency report, the host name of the
+	// first upstream if empty
+	Name string `json:"name,omitempty"`
+	// Upstreams are the base URLs of the instances of the service
+	Upstreams []string `json:"upstreams"`
+	// Balancer selects the upstream of a request, BalancerRoundRobin if empty
+	Balancer string `json:"balancer,omitempty"`
+	// HealthCheck configures the ejection of failing upstreams and their circuit breakers
+	HealthCheck HealthCheck `json:"health_check,omitempty"`
+	// Retry configures the retries of requests with idempotent methods
+	Retry Retry `json:"retry,omitempty"`
+	// RateLimit limits the requests of every client
+	RateLimit RateLimit `json:"rate_limit,omitempty"`
+	// StripPrefix removes the prefix from the path passed on to the upstream
+	StripPrefix bool `json:"strip_prefix,omitempty"`
+	// Rewrite replaces the prefix in the path passed on to the upstream
+	Rewrite string `json:"rewrite,omitempty"`
+	// Auth is the auth policy of the route, RouteAuthPolicies if empty
+	Auth string `json:"auth,omitempty"`
+	// Permission is required by routes with the RouteAuthSession policy
+	Permission string `json:"permission,omitempty"`
+	// Timeout limits how long the upstreams may take to answer including all retries, requests
+	// taking longer are answered with 504. 15s if zero.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// defaultRouteTimeout is the timeout of routes without one, it ends requests well before
+// the write timeout of the server
+const defaultRouteTimeout = 15 * time.Second
+
+// Duration is a time.Duration written as string in JSON, e.g. "1m30s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// ServiceURLs are the base URLs of the demo-shop services
+type ServiceURLs struct {
+	User             string
+	Cart             string
+	Item             string
+	Checkout         string
+	CartPresentation string
+}
+
+// DefaultRouteConfig returns the routes of the demo-shop services, authorized by the route policies
+func DefaultRouteConfig(services ServiceURLs) *RouteConfig {
+	config := &RouteConfig{
+		Routes: []Route{
+			{Prefix: "/api/v1/core/users", Name: "user", Upstreams: []string{services.User}},
+			{Prefix: "/api/v1/core/roles", Name: "user", Upstreams: []string{services.User}},
+			{Prefix: "/api/v1/core/carts", Name: "cart", Upstreams: []string{services.Cart}},
+			{Prefix: "/api/v1/core/items", Name: "item", Upstreams: []string{services.Item}},
+			{Prefix: "/api/v1/core/checkouts", Name: "checkout", Upstreams: []string{services.Checkout}},
+			{Prefix: "/api/v1/presentation/cart", Name: "cart-presentation", Upstreams: []string{services.CartPresentation}},
+		},
+	}
+	for i := range config.Routes {
+		config.Routes[i].Retry = Retry{Attempts: 2}
+		config.Routes[i].RateLimit = RateLimit{Requests: 600, Burst: 100}
+	}
+	config.AuthRateLimit = RateLimit{Requests: 30, Burst: 10}
+	return config
+}
+
+// LoadRouteConfig reads the route table from the JSON file at path
+func LoadRouteConfig(path string) (*RouteConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read route config: %w", err)
+	}
+	config, err := ParseRouteConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseRouteConfig decodes and validates a route table in JSON
+func ParseRouteConfig(data []byte) (*RouteConfig, error) {
+	var config RouteConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *RouteConfig) Validate() error {
+	var v validation.Violations
+	prefixes := map[string]bool{}
+	for i, route := range c.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+		v.Check(strings.HasPrefix(route.Prefix, "/") && path.Clean(route.Prefix) == route.Prefix, field+".prefix", "must be a clean absolute path")
+		v.Check(!prefixes[route.Prefix], field+".prefix", "is routed twice")
+		prefixes[route.Prefix] = true
+
+		v.Check(len(route.Upstreams) > 0, field+".upstreams", "cannot be empty")
+		for j, upstream := range route.Upstreams {
+			u, err := url.Parse(upstream)
+			v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", fmt.Sprintf("%s.upstreams[%d]", field, j), "must be an absolute http or https URL")
+		}
+
+		v.Check(route.Rewrite == "" || (strings.HasPrefix(route.Rewrite, "/") && path.Clean(route.Rewrite) == route.Rewrite), field+".rewrite", "must be a clean absolute path")
+		v.Check(route.Rewrite == "" || !route.StripPrefix, field+".rewrite", "cannot be combined with strip_prefix")
+		if route.Auth != "" {
+			v.OneOf(field+".auth", route.Auth, RouteAuthPolicies, RouteAuthPublic, RouteAuthSession)
+		}
+		if route.Permission != "" {
+			v.OneOf(field+".permission", route.Permission, Permissions...)
+			v.Check(route.Auth == RouteAuthSession, field+".permission", "requires the session auth policy")
+		}
+		v.Check(route.Timeout >= 0, field+".timeout", "cannot be negative")
+
+		if route.Balancer != "" {
+			v.OneOf(field+".balancer", route.Balancer, BalancerRoundRobin, BalancerLeastConnections)
+		}
+		healthCheck := route.HealthCheck
+		v.Check(healthCheck.Path == "" || strings.HasPrefix(healthCheck.Path, "/"), field+".health_check.path", "must be an absolute path")
+		v.Check(healthCheck.Interval >= 0, field+".health_check.interval", "cannot be negative")
+		v.Check(healthCheck.MaxFailures >= 0, field+".health_check.max_failures", "cannot be negative")
+		v.Check(healthCheck.EjectionTime >= 0, field+".health_check.ejection_time", "cannot be negative")
+		v.Check(route.Retry.Attempts >= 0, field+".retry.attempts", "cannot be negative")
+		v.Check(route.Retry.Backoff >= 0, field+".retry.backoff", "cannot be negative")
+		validateRateLimit(&v, field+".rate_limit", route.RateLimit)
+	}
+	validateRateLimit(&v, "auth_rate_limit", c.AuthRateLimit)
+	return v.Err()
+}
+
+// validateRateLimit adds the violations of limit to v
+func validateRateLimit(v *validation.Violations, field string, limit RateLimit) {
+	v.Check(limit.Requests >= 0, field+".requests", "cannot be negative")
+	v.Check(limit.Period >= 0, field+".period", "cannot be negative")
+	v.Check(limit.Burst >= 0, field+".burst", "cannot be negative")
+	if limit.Key != "" {
+		v.OneOf(field+".key", limit.Key, RateLimitKeyClient, RateLimitKeyIP)
+	}
+}
+
+// routeTable is a validated RouteConfig prepared for serving. It is replaced as a whole on changes.
+type routeTable struct {
+	config *RouteConfig
+	// routes are sorted by descending prefix length, the first match is the longest one
+	routes []*proxyRoute
+	// stop ends the health checks of the routes
+	stop context.CancelFunc
+	// authLimiter limits the requests to the authentication routes, it is nil without a limit
+	authLimiter *rateLimiter
+}
+
+// proxyRoute is a Route prepared for serving
+type proxyRoute struct {
+	Route
+	pool *upstreamPool
+	// limiter is nil if the route has no rate limit
+	limiter *rateLimiter
+	// handler authorizes the requests and passes them on to the upstream
+	handler http.Handler
+}
+
+// newRouteTable validates config and prepares its routes for serving
+func (g *Gateway) newRouteTable(config *RouteConfig) (*routeTable, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the table keeps its own copy, the caller may modify config afterwards
+	config = &RouteConfig{Routes: slices.Clone(config.Routes), AuthRateLimit: config.AuthRateLimit}
+	for i := range config.Routes {
+		config.Routes[i].Upstreams = slices.Clone(config.Routes[i].Upstreams)
+	}
+
+	// the buckets of unchanged rate limits are kept on reloads
+	var previousAuth *rateLimiter
+	previous := map[string]*rateLimiter{}
+	if current := g.routes.Load(); current != nil {
+		previousAuth = current.authLimiter
+		for _, route := range current.routes {
+			previous[route.Prefix] = route.limiter
+		}
+	}
+
+	table := &routeTable{config: config, authLimiter: keepRateLimiter(previousAuth, config.AuthRateLimit)}
+	for _, route := range config.Routes {
+		pool, err := g.newUpstreamPool(route, g.transport)
+		if err != nil {
+			return nil, err
+		}
+		pr := &proxyRoute{Route: route, pool: pool, limiter: keepRateLimiter(previous[route.Prefix], route.RateLimit)}
+		switch route.Auth {
+		case "", RouteAuthPolicies:
+			pr.handler = g.policies
+		default:
+			pr.handler = g.enforce(routePolicy{public: route.Auth == RouteAuthPublic, permission: route.Permission}, http.HandlerFunc(g.proxyToService))
+		}
+		table.routes = append(table.routes, pr)
+	}
+	slices.SortStableFunc(table.routes, func(a, b *proxyRoute) int {
+		return len(b.Prefix) - len(a.Prefix)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	table.stop = cancel
+	for _, route := range table.routes {
+		if route.HealthCheck.Path != "" {
+			client := &http.Client{Transport: g.transport, Timeout: time.Duration(route.pool.healthCheck.Interval)}
+			go route.pool.runHealthChecks(ctx, client)
+		}
+	}
+	return table, nil
+}
+
+// close stops the health checks of the table after it has been replaced by next, and
+// removes the gauges of the upstreams next does not route to
+func (t *routeTable) close(next *routeTable) {
+	t.stop()
+	kept := map[string]bool{}
+	for _, route := range next.routes {
+		for _, endpoint := range route.pool.endpoints {
+			kept[route.Prefix+" "+endpoint.url.String()] = true
+		}
+	}
+	for _, route := range t.routes {
+		for _, endpoint := range route.pool.endpoints {
+			if !kept[route.Prefix+" "+endpoint.url.String()] {
+				route.pool.forget(endpoint)
+			}
+		}
+	}
+}
+
+// match returns the route of the request path, or nil
+func (t *routeTable) match(p string) *proxyRoute {
+	if t == nil {
+		return nil
+	}
+	for _, route := range t.routes {
+		if route.Prefix == "/" || p == route.Prefix || strings.HasPrefix(p, route.Prefix+"/") {
+			return route
+		}
+	}
+	return nil
+}
+
+// upstreamPath returns the path the upstream serves the request path at
+func (r *proxyRoute) upstreamPath(p string) string {
+	if !r.StripPrefix && r.Rewrite == "" {
+		return p
+	}
+	rest := strings.TrimPrefix(p, strings.TrimSuffix(r.Prefix, "/"))
+	if rewritten := strings.TrimSuffix(r.Rewrite, "/") + rest; rewritten != "" {
+		return rewritten
+	}
+	return "/"
+}
+
+// internal reports whether the request for the gateway path p is for one of the internalPaths,
+// either itself or after the route rewrote it. The user service rejects requests that are not
+// made by a service on these paths anyway.
+func (r *proxyRoute) internal(p string) bool {
+	return slices.Contains(internalPaths, path.Clean(p)) || slices.Contains(internalPaths, path.Clean(r.upstreamPath(p)))
+}
+
+// serviceName returns the name of the service of the route
+func (r *Route) serviceName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	if u, err := url.Parse(r.Upstreams[0]); err == nil {
+		return u.Hostname()
+	}
+	return r.Upstreams[0]
+}
+
+// timeout returns how long the upstreams of the route may take to answer
+func (r *proxyRoute) timeout() time.Duration {
+	if r.Timeout == 0 {
+		return defaultRouteTimeout
+	}
+	return time.Duration(r.Timeout)
+}
+
+// SetRoutes replaces the route table of the gateway. Requests in flight are finished with the
+// previous routes. It returns an error wrapping ErrValidation if the config is invalid.
+func (g *Gateway) SetRoutes(config *RouteConfig) error {
+	table, err := g.newRouteTable(config)
+	if err != nil {
+		return err
+	}
+	if previous := g.routes.Swap(table); previous != nil {
+		previous.close(table)
+	}
+	g.refreshDependencies()
+	return nil
+}
+
+// SetDependencyChecker makes checker check the upstreams of the route table, they are
+// refreshed whenever the routes change. The services named in critical are critical dependencies.
+func (g *Gateway) SetDependencyChecker(checker *DependencyChecker, critical []string) {
+	g.dependencies = checker
+	g.criticalDependencies = critical
+	g.refreshDependencies()
+}
+
+// refreshDependencies replaces the dependencies of the checker with the upstreams of the
+// current route table
+func (g *Gateway) refreshDependencies() {
+	table := g.routes.Load()
+	if g.dependencies == nil || table == nil {
+		return
+	}
+	// the upstream URLs have been validated with the routes
+	if err := g.dependencies.SetDependencies(RouteDependencies(table.config, g.criticalDependencies)); err != nil {
+		slog.Error("Failed to refresh dependencies", "error", err)
+	}
+}
+
+// WatchRouteConfig reloads the route table from the file at path whenever it changes, the
+// file is checked every interval until ctx is done. Invalid route tables are logged and
+// the current routes are kept.
+func (g *Gateway) WatchRouteConfig(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []byte
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to read route config", "path", path, "error", err)
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+
+		config, err := ParseRouteConfig(data)
+		if err != nil {
+			slog.ErrorContext(ctx, "Ignoring invalid route config", "path", path, "error", err)
+			continue
+		}
+		if current := g.routes.Load(); current != nil && reflect.DeepEqual(current.config, config) {
+			continue
+		}
+		if err := g.SetRoutes(config); err != nil {
+			slog.ErrorContext(ctx, "Ignoring invalid route config", "path", path, "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Reloaded route config", "path", path, "routes", len(config.Routes))
+	}
+}
+
+// serveRoute passes the request on to the handler of its route
+func (g *Gateway) serveRoute(w http.ResponseWriter, r *http.Request) {
+	route := g.routes.Load().match(r.URL.Path)
+	if route == nil || route.internal(r.URL.Path) {
+		(&router.ErrorResponse{
+			Status:  http.StatusNotFound,
+			Path:    r.URL.Path,
+			Message: "endpoint not found",
+		}).WriteTo(w)
+		return
+	}
+	route.handler.ServeHTTP(w, r.WithContext(withRoute(r.Context(), route)))
+}
+
+// callService sends a request of the gateway itself to the upstream service at the gateway path p.
+// It is sent through the upstream pool of the route of p within the timeout of the route and
+// authenticated with the identity token of the gateway. The request body is the JSON encoding of
+// in unless it is nil. The response is decoded into out, a *[]byte receives the raw response.
+func (g *Gateway) callService(ctx context.Context, method, p string, in, out any) error {
+	route := g.routes.Load().match(p)
+	if route == nil {
+		return fmt.Errorf("%w: no route for %s", ErrUnavailable, p)
+	}
+	ctx, cancel := context.WithTimeout(ctx, route.timeout())
+	defer cancel()
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	// the pool sets the scheme and host of the upstream it picks
+	req, err := http.NewRequestWithContext(ctx, method, route.upstreamPath(p), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	identityToken, err := g.signService()
+	if err != nil {
+		return err
+	}
+	if identityToken != "" {
+		req.Header.Set(router.HeaderIdentityToken, identityToken)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := route.pool.RoundTrip(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var problem router.ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&problem)
+		if err := router.ErrorFromResponse(resp.StatusCode, problem.Type); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: unexpected status code: %d", ErrUnavailable, resp.StatusCode)
+	}
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*out, err = io.ReadAll(io.LimitReader(resp.Body, maxPolicyBodySize))
+		return err
+	default:
+		return json.NewDecoder(io.LimitReader(resp.Body, maxPolicyBodySize)).Decode(out)
+	}
+}
+
+// upstreamServiceURLs returns the distinct URLs of the upstream services, one instance per route
+func (g *Gateway) upstreamServiceURLs() []string {
+	var urls []string
+	if table := g.routes.Load(); table != nil {
+		for _, route := range table.config.Routes {
+			urls = append(urls, route.Upstreams[0])
+		}
+	}
+	slices.Sort(urls)
+	return slices.Compact(urls)
+}
+
+type routeContextKey struct{}
+
+// withRoute returns a copy of ctx carrying the route of the request
+func withRoute(ctx context.Context, route *proxyRoute) context.Context {
+	return context.WithValue(ctx, routeContextKey{}, route)
+}
+
+// routeFromContext returns the route stored by withRoute, or nil
+func routeFromContext(ctx context.Context) *proxyRoute {
+	route, _ := ctx.Value(routeContextKey{}).(*proxyRoute)
+	return route
+}
@@ -0,0 +1,203 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newEchoUpstream returns the URL of an upstream answering with its name and the requested path
+func newEchoUpstream(t *testing.T, name string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestRouteConfig_Validate(t *testing.T) {
+	upstreams := []string{"http://item:8080"}
+
+	tests := []struct {
+		name    string
+		route   Route
+		wantErr bool
+	}{
+		{name: "valid", route: Route{Prefix: "/api/v1/core/items", Upstreams: upstreams, Timeout: Duration(time.Second)}},
+		{name: "root prefix", route: Route{Prefix: "/", Upstreams: upstreams, Auth: RouteAuthPublic}},
+		{name: "rewrite", route: Route{Prefix: "/items", Upstreams: upstreams, Rewrite: "/api/v1/core/items", Auth: RouteAuthPublic}},
+		{name: "session with permission", route: Route{Prefix: "/items", Upstreams: upstreams, Auth: RouteAuthSession, Permission: PermissionItemsWrite}},
+		{name: "relative prefix", route: Route{Prefix: "items", Upstreams: upstreams}, wantErr: true},
+		{name: "trailing slash", route: Route{Prefix: "/items/", Upstreams: upstreams}, wantErr: true},
+		{name: "no upstreams", route: Route{Prefix: "/items"}, wantErr: true},
+		{name: "relative upstream", route: Route{Prefix: "/items", Upstreams: []string{"item:8080"}}, wantErr: true},
+		{name: "rewrite and strip", route: Route{Prefix: "/items", Upstreams: upstreams, Rewrite: "/v1", StripPrefix: true}, wantErr: true},
+		{name: "unknown auth", route: Route{Prefix: "/items", Upstreams: upstreams, Auth: "none"}, wantErr: true},
+		{name: "permission without session", route: Route{Prefix: "/items", Upstreams: upstreams, Permission: PermissionItemsWrite}, wantErr: true},
+		{name: "unknown permission", route: Route{Prefix: "/items", Upstreams: upstreams, Auth: RouteAuthSession, Permission: "items:delete"}, wantErr: true},
+		{name: "negative timeout", route: Route{Prefix: "/items", Upstreams: upstreams, Timeout: Duration(-time.Second)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&RouteConfig{Routes: []Route{tt.route}}).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrValidation) {
+				t.Errorf("Expected error wrapping ErrValidation, got %v", err)
+			}
+		})
+	}
+
+	duplicate := &RouteConfig{Routes: []Route{{Prefix: "/items", Upstreams: upstreams}, {Prefix: "/items", Upstreams: upstreams}}}
+	if err := duplicate.Validate(); err == nil {
+		t.Error("Expected an error for a prefix routed twice")
+	}
+	if err := DefaultRouteConfig(ServiceURLs{}).Validate(); err == nil {
+		t.Error("Expected an error for default routes without service URLs")
+	}
+}
+
+func TestParseRouteConfig(t *testing.T) {
+	config, err := ParseRouteConfig([]byte(`{"routes":[{"prefix":"/items","upstreams":["http://item:8080"],"rewrite":"/api/v1/core/items","auth":"public","timeout":"1m30s"}]}`))
+	if err != nil {
+		t.Fatalf("ParseRouteConfig failed: %v", err)
+	}
+	if route := config.Routes[0]; route.Timeout != Duration(90*time.Second) || route.Rewrite != "/api/v1/core/items" || route.Auth != RouteAuthPublic {
+		t.Errorf("Unexpected route %+v", route)
+	}
+
+	for _, data := range []string{
+		`{"routes":[{"prefix":"/items","upstream":"http://item:8080"}]}`,
+		`{"routes":[{"prefix":"/items","upstreams":["http://item:8080"],"timeout":"soon"}]}`,
+		`{"routes":[{"prefix":"/items","upstreams":[]}]}`,
+		`routes: []`,
+	} {
+		if _, err := ParseRouteConfig([]byte(data)); !errors.Is(err, ErrValidation) {
+			t.Errorf("Expected ErrValidation for %s, got %v", data, err)
+		}
+	}
+}
+
+func TestGateway_RouteTable(t *testing.T) {
+	first, second, reviews := newEchoUpstream(t, "first"), newEchoUpstream(t, "second"), newEchoUpstream(t, "reviews")
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/api/v1/core/items", Upstreams: []string{first, second}},
+		{Prefix: "/reviews", Upstreams: []string{reviews}, StripPrefix: true, Auth: RouteAuthPublic},
+		{Prefix: "/reviews/moderation", Upstreams: []string{reviews}, Rewrite: "/api/v1/moderation", Auth: RouteAuthSession, Permission: PermissionItemsWrite},
+		{Prefix: "/slow", Upstreams: []string{slow.URL}, Auth: RouteAuthPublic, Timeout: Duration(20 * time.Millisecond)},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	gateway.SetIdentityTokens(identityTokens)
+	_, userCookie := startSession(t, gateway, uuid.New(), false)
+	_, moderatorCookie := startSession(t, gateway, uuid.New(), false, PermissionItemsWrite)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		cookie         *http.Cookie
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "first upstream", method: http.MethodGet, path: "/api/v1/core/items", expectedStatus: http.StatusOK, expectedBody: "first /api/v1/core/items"},
+		{name: "second upstream", method: http.MethodGet, path: "/api/v1/core/items", expectedStatus: http.StatusOK, expectedBody: "second /api/v1/core/items"},
+		{name: "route policies", method: http.MethodDelete, path: "/api/v1/core/items/" + uuid.NewString(), cookie: userCookie, expectedStatus: http.StatusForbidden},
+		{name: "not covered by the route policies", method: http.MethodGet, path: "/api/v1/core/items/" + uuid.NewString() + "/reviews", expectedStatus: http.StatusNotFound},
+		{name: "strip prefix", method: http.MethodGet, path: "/reviews/42", expectedStatus: http.StatusOK, expectedBody: "reviews /42"},
+		{name: "strip prefix of the prefix itself", method: http.MethodGet, path: "/reviews", expectedStatus: http.StatusOK, expectedBody: "reviews /"},
+		{name: "longest prefix without session", method: http.MethodGet, path: "/reviews/moderation/42", expectedStatus: http.StatusUnauthorized},
+		{name: "longest prefix without permission", method: http.MethodGet, path: "/reviews/moderation/42", cookie: userCookie, expectedStatus: http.StatusForbidden},
+		{name: "rewrite", method: http.MethodGet, path: "/reviews/moderation/42", cookie: moderatorCookie, expectedStatus: http.StatusOK, expectedBody: "reviews /api/v1/moderation/42"},
+		{name: "prefix is matched by path segments", method: http.MethodGet, path: "/reviewsx", expectedStatus: http.StatusNotFound},
+		{name: "timeout", method: http.MethodGet, path: "/slow", expectedStatus: http.StatusGatewayTimeout},
+		{name: "unknown route", method: http.MethodGet, path: "/api/v1/core/roles", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rr := httptest.NewRecorder()
+			gateway.proxy.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGateway_WatchRouteConfig(t *testing.T) {
+	first, second := newEchoUpstream(t, "first"), newEchoUpstream(t, "second")
+	path := filepath.Join(t.TempDir(), "routes.json")
+	writeConfig := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("Failed to write route config: %v", err)
+		}
+	}
+	writeConfig(`{"routes":[{"prefix":"/items","upstreams":["` + first + `"],"auth":"public"}]}`)
+
+	config, err := LoadRouteConfig(path)
+	if err != nil {
+		t.Fatalf("LoadRouteConfig failed: %v", err)
+	}
+	gateway := NewGateway(config, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	serve := func(path string) string {
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Body.String()
+	}
+	if body := serve("/items"); body != "first /items" {
+		t.Fatalf("Expected the loaded route to be served, got %q", body)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go gateway.WatchRouteConfig(ctx, path, 5*time.Millisecond)
+
+	waitFor := func(path, body string) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if serve(path) == body {
+				return
+			}
+		}
+		t.Fatalf("Expected %s to be answered with %q, got %q", path, body, serve(path))
+	}
+
+	writeConfig(`{"routes":[{"prefix":"/items","upstreams":["` + second + `"],"auth":"public","strip_prefix":true}]}`)
+	waitFor("/items/42", "second /42")
+
+	writeConfig(`{"routes":[{"prefix":"/items","upstreams":["not a url"]}]}`)
+	time.Sleep(50 * time.Millisecond)
+	if body := serve("/items/42"); body != "second /42" {
+		t.Errorf("Expected an invalid config to keep the current routes, got %q", body)
+	}
+
+	writeConfig(`{"routes":[{"prefix":"/catalog","upstreams":["` + first + `"],"auth":"public"}]}`)
+	waitFor("/catalog", "first /catalog")
+}
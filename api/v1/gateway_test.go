@@ -2,23 +2,49 @@ package v1
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/openapi"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
 )
 
 var (
 	cookieEncryptionKey []byte = []byte("a_random_secret_key")
+	// identityTokens are shared by the test gateways and the upstream services they proxy to
+	identityTokens = mustIdentityTokens([]byte("a_random_identity_key"))
 )
 
+func mustIdentityTokens(key []byte) *router.IdentityTokens {
+	tokens, err := router.NewIdentityTokens(key)
+	if err != nil {
+		panic(err)
+	}
+	return tokens
+}
+
 func TestGateway_HandleLogin(t *testing.T) {
 	gateway := NewGateway(
-		"http://localhost:8084", // userServiceURL
-		"http://localhost:8082", // cartServiceURL
-		"http://localhost:8081", // itemServiceURL
-		"http://localhost:8085", // checkoutServiceURL
-		"http://localhost:8083", // cartPresentationServiceURL
+		DefaultRouteConfig(ServiceURLs{
+			User:             "http://localhost:8084",
+			Cart:             "http://localhost:8082",
+			Item:             "http://localhost:8081",
+			Checkout:         "http://localhost:8085",
+			CartPresentation: "http://localhost:8083",
+		}),
+		NewMockUserStore(),
+		NewMockSessionStore(),
 		cookieEncryptionKey,
 	)
 
@@ -102,11 +128,15 @@ func TestGateway_HandleLogin(t *testing.T) {
 
 func TestGateway_HandleLogout(t *testing.T) {
 	gateway := NewGateway(
-		"http://localhost:8084", // userServiceURL
-		"http://localhost:8082", // cartServiceURL
-		"http://localhost:8081", // itemServiceURL
-		"http://localhost:8085", // checkoutServiceURL
-		"http://localhost:8083", // cartPresentationServiceURL
+		DefaultRouteConfig(ServiceURLs{
+			User:             "http://localhost:8084",
+			Cart:             "http://localhost:8082",
+			Item:             "http://localhost:8081",
+			Checkout:         "http://localhost:8085",
+			CartPresentation: "http://localhost:8083",
+		}),
+		NewMockUserStore(),
+		NewMockSessionStore(),
 		cookieEncryptionKey,
 	)
 
@@ -131,11 +161,15 @@ func TestGateway_HandleLogout(t *testing.T) {
 
 func TestGateway_ServeHTTP(t *testing.T) {
 	gateway := NewGateway(
-		"http://localhost:8084", // userServiceURL
-		"http://localhost:8082", // cartServiceURL
-		"http://localhost:8081", // itemServiceURL
-		"http://localhost:8085", // checkoutServiceURL
-		"http://localhost:8083", // cartPresentationServiceURL
+		DefaultRouteConfig(ServiceURLs{
+			User:             "http://localhost:8084",
+			Cart:             "http://localhost:8082",
+			Item:             "http://localhost:8081",
+			Checkout:         "http://localhost:8085",
+			CartPresentation: "http://localhost:8083",
+		}),
+		NewMockUserStore(),
+		NewMockSessionStore(),
 		cookieEncryptionKey,
 	)
 
@@ -185,48 +219,793 @@ func TestGateway_ServeHTTP(t *testing.T) {
 	}
 }
 
-func TestGateway_ValidatePassword(t *testing.T) {
+// MockSessionStore is a SessionStore keeping sessions in a map
+type MockSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMockSessionStore() *MockSessionStore {
+	return &MockSessionStore{sessions: map[string]Session{}}
+}
+
+func (m *MockSessionStore) Create(ctx context.Context, session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.sessions[session.ID]; exists {
+		return ErrAlreadyExists
+	}
+	m.sessions[session.ID] = *session
+	return nil
+}
+
+func (m *MockSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, exists := m.sessions[id]
+	if !exists || session.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (m *MockSessionStore) Touch(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, exists := m.sessions[id]
+	if !exists || session.Expired(time.Now()) {
+		return ErrNotFound
+	}
+	session.LastSeenAt, session.ExpiresAt = lastSeenAt, expiresAt
+	m.sessions[id] = session
+	return nil
+}
+
+func (m *MockSessionStore) ListByUser(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := []Session{}
+	for _, session := range m.sessions {
+		if session.UserID == userID && !session.Expired(time.Now()) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MockSessionStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.sessions[id]; !exists {
+		return ErrNotFound
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MockSessionStore) DeleteByUser(ctx context.Context, userID uuid.UUID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	revoked := 0
+	for id, session := range m.sessions {
+		if session.UserID == userID {
+			delete(m.sessions, id)
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+// newTestGateway returns a gateway whose upstream services are not reachable
+func newTestGateway(sessions SessionStore) *Gateway {
 	gateway := NewGateway(
-		"http://localhost:8084", // userServiceURL
-		"http://localhost:8082", // cartServiceURL
-		"http://localhost:8081", // itemServiceURL
-		"http://localhost:8085", // checkoutServiceURL
-		"http://localhost:8083", // cartPresentationServiceURL
+		DefaultRouteConfig(ServiceURLs{
+			User:             "http://localhost:8084",
+			Cart:             "http://localhost:8082",
+			Item:             "http://localhost:8081",
+			Checkout:         "http://localhost:8085",
+			CartPresentation: "http://localhost:8083",
+		}),
+		NewMockUserStore(),
+		sessions,
 		cookieEncryptionKey,
 	)
+	gateway.SetIdentityTokens(identityTokens)
+	return gateway
+}
+
+// startSession stores a new session of the user and returns the cookie referencing it
+func startSession(t *testing.T, g *Gateway, userID uuid.UUID, isAdmin bool, permissions ...string) (*Session, *http.Cookie) {
+	t.Helper()
+	now := time.Now()
+	session := &Session{
+		ID:          NewSessionID(),
+		UserID:      userID,
+		CartID:      uuid.New(),
+		Username:    "alice",
+		IsAdmin:     isAdmin,
+		Permissions: permissions,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   g.sessionExpiry(now, now),
+	}
+	if err := g.sessions.Create(context.Background(), session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	if err := g.setSessionCookie(rr, session); err != nil {
+		t.Fatalf("Failed to set session cookie: %v", err)
+	}
+	return session, rr.Result().Cookies()[0]
+}
+
+func TestGateway_SessionCookie(t *testing.T) {
+	sessions := NewMockSessionStore()
+	gateway := newTestGateway(sessions)
+	session, cookie := startSession(t, gateway, uuid.New(), false)
+
+	otherKey := NewGateway(nil, NewMockUserStore(), sessions, []byte("another_secret_key"))
+	_, otherKeyCookie := startSession(t, otherKey, uuid.New(), false)
+	rotated := NewGateway(nil, NewMockUserStore(), sessions, []byte("new_secret_key"), cookieEncryptionKey)
+
+	tests := []struct {
+		name    string
+		gateway *Gateway
+		cookie  *http.Cookie
+		valid   bool
+	}{
+		{name: "issued", gateway: gateway, cookie: cookie, valid: true},
+		{name: "forged", gateway: gateway, cookie: &http.Cookie{Name: sessionCookieName, Value: base64.RawURLEncoding.EncodeToString([]byte(session.ID))}},
+		{name: "other key", gateway: gateway, cookie: otherKeyCookie},
+		{name: "previous key", gateway: rotated, cookie: cookie, valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(tt.cookie)
+
+			got, err := tt.gateway.getSession(req)
+			if !tt.valid {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Errorf("Expected error wrapping %v, got %v", ErrUnauthorized, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected session to be accepted, got %v", err)
+			}
+			if got.ID != session.ID || got.UserID != session.UserID {
+				t.Errorf("Expected session %+v, got %+v", *session, *got)
+			}
+		})
+	}
+
+	t.Run("revoked", func(t *testing.T) {
+		_, cookie := startSession(t, gateway, uuid.New(), false)
+		id, _ := gateway.cookies.Decode(sessionCookieName, cookie.Value)
+		if err := sessions.Delete(context.Background(), string(id)); err != nil {
+			t.Fatalf("Failed to delete session: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		if _, err := gateway.getSession(req); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("Expected error wrapping %v, got %v", ErrUnauthorized, err)
+		}
+	})
+}
+
+func TestGateway_SessionSlidingExpiration(t *testing.T) {
+	sessions := NewMockSessionStore()
+	gateway := newTestGateway(sessions)
+	gateway.SetSessionTimeouts(time.Hour, 90*time.Minute)
+	session, cookie := startSession(t, gateway, uuid.New(), false)
+
+	// pretend the session has been created 45 minutes ago and last been used 30 minutes ago
+	created := time.Now().Add(-45 * time.Minute)
+	stored := sessions.sessions[session.ID]
+	stored.CreatedAt, stored.LastSeenAt, stored.ExpiresAt = created, time.Now().Add(-30*time.Minute), time.Now().Add(30*time.Minute)
+	sessions.sessions[session.ID] = stored
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	got, err := gateway.getSession(req)
+	if err != nil {
+		t.Fatalf("Expected session to be accepted, got %v", err)
+	}
+	// the idle timeout would allow another hour, the max lifetime only 45 minutes
+	if want := created.Add(90 * time.Minute); !got.ExpiresAt.Equal(want) {
+		t.Errorf("Expected expiry to be capped at %v, got %v", want, got.ExpiresAt)
+	}
+	if !sessions.sessions[session.ID].ExpiresAt.Equal(got.ExpiresAt) {
+		t.Error("Expected extended expiry to be stored")
+	}
+	if time.Since(sessions.sessions[session.ID].LastSeenAt) > time.Minute {
+		t.Error("Expected activity to be recorded")
+	}
+}
+
+func TestGateway_Sessions(t *testing.T) {
+	sessions := NewMockSessionStore()
+	gateway := newTestGateway(sessions)
+
+	alice := uuid.New()
+	current, cookie := startSession(t, gateway, alice, false)
+	other, _ := startSession(t, gateway, alice, false)
+	bob, bobCookie := startSession(t, gateway, uuid.New(), false)
+	_, adminCookie := startSession(t, gateway, uuid.New(), true)
+
+	do := func(method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		gateway.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodGet, "/sessions", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without session, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rr := do(http.MethodGet, "/sessions", cookie)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var list ListResponse[Session]
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if list.Total != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", list.Total)
+	}
+	for _, s := range list.Items {
+		if s.Current != (s.ID == current.ID) {
+			t.Errorf("Expected only the requesting session to be current, got %+v", s)
+		}
+	}
+
+	if rr := do(http.MethodGet, "/users/"+alice.String()+"/sessions", bobCookie); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d listing sessions of another user, got %d", http.StatusForbidden, rr.Code)
+	}
+	if rr := do(http.MethodGet, "/users/"+alice.String()+"/sessions", adminCookie); rr.Code != http.StatusOK {
+		t.Errorf("Expected admin to list sessions of other users, got %d", rr.Code)
+	}
+
+	if rr := do(http.MethodDelete, "/sessions/"+bob.ID, cookie); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d revoking a session of another user, got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/sessions/"+other.ID, cookie); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d revoking an own session, got %d", http.StatusNoContent, rr.Code)
+	}
+	if _, err := sessions.Get(context.Background(), other.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected revoked session to be gone, got %v", err)
+	}
+
+	// admins kick users by revoking all their sessions
+	rr = do(http.MethodDelete, "/api/v1/auth/users/"+bob.UserID.String()+"/sessions", adminCookie)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"revoked":1`) {
+		t.Errorf("Expected admin to revoke 1 session, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "/sessions", bobCookie); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked session to be rejected, got %d", rr.Code)
+	}
+
+	// log out everywhere
+	startSession(t, gateway, alice, false)
+	rr = do(http.MethodDelete, "/sessions", cookie)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"revoked":2`) {
+		t.Errorf("Expected 2 revoked sessions, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if cookies := rr.Result().Cookies(); len(cookies) == 0 || cookies[0].MaxAge != -1 {
+		t.Error("Expected session cookie to be cleared")
+	}
+	if remaining, _ := sessions.ListByUser(context.Background(), alice); len(remaining) != 0 {
+		t.Errorf("Expected no remaining sessions, got %d", len(remaining))
+	}
+}
+
+func TestGateway_LogoutRevokesSession(t *testing.T) {
+	sessions := NewMockSessionStore()
+	gateway := newTestGateway(sessions)
+	session, cookie := startSession(t, gateway, uuid.New(), false)
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	gateway.handleLogout(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if _, err := sessions.Get(context.Background(), session.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected session to be revoked, got %v", err)
+	}
+}
+
+func TestGateway_ProxyIdentityToken(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	t.Cleanup(upstream.Close)
+
+	gateway := NewGateway(
+		DefaultRouteConfig(ServiceURLs{
+			User:             "http://localhost:8084",
+			Cart:             "http://localhost:8082",
+			Item:             upstream.URL,
+			Checkout:         "http://localhost:8085",
+			CartPresentation: "http://localhost:8083",
+		}),
+		NewMockUserStore(),
+		NewMockSessionStore(),
+		cookieEncryptionKey,
+	)
+	session, cookie := startSession(t, gateway, uuid.New(), false, PermissionCartsRead, PermissionUsersRead)
+
+	forged, err := mustIdentityTokens([]byte("a_forged_key")).Sign(&router.Identity{UserID: uuid.New(), IsAdmin: true})
+	if err != nil {
+		t.Fatalf("Failed to sign identity: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/core/items", nil)
+	req.Header.Set(router.HeaderIdentityToken, forged)
+	gateway.proxy.ServeHTTP(httptest.NewRecorder(), req)
+	if got == nil {
+		t.Fatal("Expected request to be proxied")
+	}
+	if token := got.Get(router.HeaderIdentityToken); token != "" {
+		t.Errorf("Expected client supplied identity token to be stripped, got %q", token)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/core/items", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	gateway.proxy.ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d without identity tokens, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	gateway.SetIdentityTokens(identityTokens)
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/core/items", nil)
+	req.Header.Set(router.HeaderIdentityToken, forged)
+	req.AddCookie(cookie)
+	gateway.proxy.ServeHTTP(httptest.NewRecorder(), req)
+	identity, err := identityTokens.Verify(got.Get(router.HeaderIdentityToken))
+	if err != nil {
+		t.Fatalf("Expected a valid identity token, got %v", err)
+	}
+	want := session.Identity()
+	if identity.UserID != want.UserID || identity.Username != want.Username || identity.CartID != want.CartID ||
+		identity.IsAdmin || strings.Join(identity.Permissions, ",") != "carts:read,users:read" {
+		t.Errorf("Expected identity %+v from the session, got %+v", *want, *identity)
+	}
+
+	// requests without a session are passed on as anonymous, not as the gateway itself
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/core/items", nil)
+	req.Header.Set(router.HeaderIdentityToken, forged)
+	gateway.proxy.ServeHTTP(httptest.NewRecorder(), req)
+	identity, err = identityTokens.Verify(got.Get(router.HeaderIdentityToken))
+	if err != nil {
+		t.Fatalf("Expected a valid identity token, got %v", err)
+	}
+	if !identity.Anonymous || identity.Service != "" || identity.UserID != uuid.Nil || identity.IsAdmin {
+		t.Errorf("Expected an anonymous identity, got %+v", *identity)
+	}
+}
+
+// newServiceServer serves the given API object like an upstream service
+// and returns the base URL of the server.
+// serviceContext returns a context holding the identity of a service, which may access the
+// resources of all users
+func serviceContext() context.Context {
+	return router.ContextWithIdentity(context.Background(), &router.Identity{Service: "test"})
+}
+
+// userContext returns a context holding the identity of a user with the permissions
+func userContext(userID uuid.UUID, permissions ...string) context.Context {
+	return router.ContextWithIdentity(context.Background(), &router.Identity{UserID: userID, Permissions: permissions})
+}
+
+func newServiceServer(t *testing.T, obj router.ApiObject) string {
+	t.Helper()
+
+	r := router.NewRouter()
+	if err := r.Register(obj); err != nil {
+		t.Fatalf("Failed to register api object: %v", err)
+	}
+	mux := http.NewServeMux()
+	if err := r.Build(mux); err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+
+	server := httptest.NewServer(router.Authenticate(identityTokens)(mux))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestGateway_OpenAPI(t *testing.T) {
+	unavailable := httptest.NewServer(http.NotFoundHandler())
+	unavailable.Close()
+
+	gateway := NewGateway(
+		DefaultRouteConfig(ServiceURLs{
+			User:             newServiceServer(t, NewUserRouter(NewMockUserStore(), NewMockRoleStore(), NewMockAPIKeyStore())),
+			Cart:             unavailable.URL,
+			Item:             newServiceServer(t, NewItemRouter(NewMockItemStore())),
+			Checkout:         unavailable.URL,
+			CartPresentation: unavailable.URL,
+		}),
+		NewMockUserStore(),
+		NewMockSessionStore(),
+		cookieEncryptionKey,
+	)
+
+	r := router.NewRouter()
+	r.SetOpenAPIFunc(gateway.OpenAPI)
+	mux := http.NewServeMux()
+	if err := r.Build(mux); err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var doc openapi.Document
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode OpenAPI document: %v", err)
+	}
+
+	operations := map[string]string{
+		"/api/v1/auth/login":      "post",
+		"/api/v1/core/items":      "get",
+		"/api/v1/core/items/{id}": "put",
+		"/api/v1/core/users":      "post",
+		"/api/v1/core/users/{id}": "delete",
+	}
+	for path, method := range operations {
+		if doc.Paths[path][method] == nil {
+			t.Errorf("Expected operation %s %s in aggregated document", method, path)
+		}
+	}
+	if _, ok := doc.Paths["/api/v1/core/carts"]; ok {
+		t.Error("Expected unavailable services to be left out")
+	}
+	if _, ok := doc.Paths["/api/v1/core/users/validate"]; ok {
+		t.Error("Expected internal endpoints to be left out")
+	}
+
+	list := doc.Paths["/api/v1/core/items"]["get"]
+	if ref := list.Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/ListResponse_Item" {
+		t.Errorf("Expected list response to reference ListResponse_Item, got %q", ref)
+	}
+	for _, name := range []string{"Item", "ListResponse_Item", "UserModificationRequest", "LoginRequest", "ErrorResponse"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("Expected schema %s in aggregated document", name)
+		}
+	}
+	if _, ok := doc.Components.Schemas["UserModificationRequest"].Properties["username"]; !ok {
+		t.Error("Expected embedded User fields to be flattened into UserModificationRequest")
+	}
+}
+
+func TestGateway_LoginValidatesCredentials(t *testing.T) {
+	users := NewMockUserStore()
+	username, password := "alice", "correct horse battery staple"
+	alice := &UserModificationRequest{
+		User:     User{ID: uuid.New(), Username: &username},
+		Password: &password,
+	}
+	if err := users.Create(context.Background(), alice); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	sessions := NewMockSessionStore()
+	gateway := NewGateway(
+		DefaultRouteConfig(ServiceURLs{
+			User:             "http://localhost:8084",
+			Cart:             newServiceServer(t, NewCartRouter(NewMockCartStore())),
+			Item:             "http://localhost:8081",
+			Checkout:         "http://localhost:8085",
+			CartPresentation: "http://localhost:8083",
+		}),
+		users,
+		sessions,
+		cookieEncryptionKey,
+	)
+	gateway.SetIdentityTokens(identityTokens)
+	login := func(password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(LoginRequest{Username: username, Password: password})
+		rr := httptest.NewRecorder()
+		gateway.handleLogin(rr, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body)))
+		return rr
+	}
+
+	rr := login(password)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp LoginResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.User.ID != alice.ID {
+		t.Errorf("Expected user %s, got %s", alice.ID, resp.User.ID)
+	}
+	if list, _ := sessions.ListByUser(context.Background(), alice.ID); len(list) != 1 {
+		t.Errorf("Expected one session of the user, got %d", len(list))
+	}
+
+	rr = login("wrong password")
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong password, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if len(rr.Result().Cookies()) != 0 {
+		t.Error("Did not expect session cookie to be set")
+	}
+
+	users.SetFailure("validate")
+	if rr := login(password); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d if the user service fails, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
+
+func TestGateway_LoginCart(t *testing.T) {
+	users := NewMockUserStore()
+	username, password := "alice", "correct horse battery staple"
+	alice := &UserModificationRequest{
+		User:     User{ID: uuid.New(), Username: &username},
+		Password: &password,
+	}
+	if err := users.Create(context.Background(), alice); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	block := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	t.Cleanup(hanging.Close)
+	t.Cleanup(func() { close(block) })
+
+	carts := NewMockCartStore()
+	newGateway := func(cartURL string) *Gateway {
+		gateway := NewGateway(&RouteConfig{Routes: []Route{
+			{Prefix: "/api/v1/core/carts", Upstreams: []string{cartURL}, Timeout: Duration(50 * time.Millisecond)},
+		}}, users, NewMockSessionStore(), cookieEncryptionKey)
+		gateway.SetIdentityTokens(identityTokens)
+		return gateway
+	}
+	login := func(gateway *Gateway) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(LoginRequest{Username: username, Password: password})
+		rr := httptest.NewRecorder()
+		gateway.handleLogin(rr, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body)))
+		return rr
+	}
+
+	// the cart created on the first login is looked up on the next ones
+	gateway := newGateway(newServiceServer(t, NewCartRouter(carts)))
+	var cartIDs []string
+	for range 2 {
+		rr := login(gateway)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var resp LoginResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		cartIDs = append(cartIDs, resp.CartID)
+	}
+	if cartIDs[0] != cartIDs[1] {
+		t.Errorf("Expected both logins to use the same cart, got %v", cartIDs)
+	}
+	if len(carts.carts) != 1 {
+		t.Errorf("Expected one cart of the user, got %d", len(carts.carts))
+	}
+
+	// a hanging cart service fails the login within the timeout of the route
+	start := time.Now()
+	if rr := login(newGateway(hanging.URL)); rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the login to time out after the route timeout, took %s", elapsed)
+	}
+}
+
+func TestGateway_InternalPathsNotProxied(t *testing.T) {
+	proxied := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+	}))
+	t.Cleanup(upstream.Close)
+
+	gateway := NewGateway(DefaultRouteConfig(ServiceURLs{User: upstream.URL, Cart: upstream.URL, Item: upstream.URL, Checkout: upstream.URL, CartPresentation: upstream.URL}), NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	for _, path := range []string{"/api/v1/core/users/validate", "/api/v1/core/users/validate/", "/api/v1/core/users/lookup", "/api/v1/core/users/provision", "/api/v1/core/users/apikeys/validate", "/api/v1/core/carts/lookup"} {
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`)))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusNotFound, path, rr.Code)
+		}
+	}
+	if proxied {
+		t.Error("Expected internal endpoints not to be proxied")
+	}
+
+	// routes rewriting their prefix must not expose the internal endpoints either
+	gateway = NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/public", Upstreams: []string{upstream.URL}, Rewrite: "/api/v1/core/users", Auth: RouteAuthPublic},
+		{Prefix: "/stripped", Upstreams: []string{upstream.URL}, StripPrefix: true, Auth: RouteAuthPublic},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	for _, path := range []string{"/public/validate", "/public/apikeys/validate/", "/public/provision", "/stripped/api/v1/core/users/lookup"} {
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`)))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusNotFound, path, rr.Code)
+		}
+	}
+	if proxied {
+		t.Error("Expected internal endpoints not to be proxied by rewriting routes")
+	}
+	rr := httptest.NewRecorder()
+	gateway.proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/public", strings.NewReader(`{}`)))
+	if rr.Code != http.StatusOK || !proxied {
+		t.Errorf("Expected the other paths of the route to be proxied, got %d", rr.Code)
+	}
+}
+
+func TestGateway_FetchResource(t *testing.T) {
+	block := make(chan struct{})
+	var requests atomic.Int32
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-block
+	}))
+	t.Cleanup(hanging.Close)
+	t.Cleanup(func() { close(block) })
+
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/hanging", Upstreams: []string{hanging.URL}, Timeout: Duration(50 * time.Millisecond)},
+		{Prefix: "/echo", Upstreams: []string{newEchoUpstream(t, "echo")}, StripPrefix: true},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+
+	// the resource is fetched within the timeout of the route
+	start := time.Now()
+	if _, err := gateway.fetchResource(context.Background(), "/hanging/1"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected the fetch to fail, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the fetch to time out after the route timeout, took %s", elapsed)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected the upstream to be requested once, got %d", requests.Load())
+	}
+
+	// the path is rewritten like the proxied requests
+	doc, err := gateway.fetchResource(context.Background(), "/echo/items/1")
+	if err != nil {
+		t.Fatalf("fetchResource failed: %v", err)
+	}
+	if string(doc) != "echo /items/1" {
+		t.Errorf("Expected the upstream path /items/1, got %q", doc)
+	}
+}
+
+func TestGateway_RoutePolicies(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	carts := NewMockCartStore()
+	aliceCart := &Cart{ID: uuid.New(), OwnerID: alice, Version: 1}
+	bobCart := &Cart{ID: uuid.New(), OwnerID: bob, Version: 1}
+	carts.carts[aliceCart.ID] = aliceCart
+	carts.carts[bobCart.ID] = bobCart
+	checkouts := NewMockCheckoutStore()
+	aliceCheckout := &Checkout{ID: uuid.New(), UserID: alice, CartID: aliceCart.ID, Version: 1}
+	bobCheckout := &Checkout{ID: uuid.New(), UserID: bob, CartID: bobCart.ID, Version: 1}
+	checkouts.checkouts[aliceCheckout.ID] = aliceCheckout
+	checkouts.checkouts[bobCheckout.ID] = bobCheckout
+
+	users := NewMockUserStore()
+	username := "alice"
+	if err := users.Create(context.Background(), &UserModificationRequest{User: User{ID: alice, Username: &username}}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	var proxied bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+	}))
+	t.Cleanup(upstream.Close)
+
+	gateway := NewGateway(
+		DefaultRouteConfig(ServiceURLs{
+			User:             newServiceServer(t, NewUserRouter(users, NewMockRoleStore(), NewMockAPIKeyStore())),
+			Cart:             newServiceServer(t, NewCartRouter(carts)),
+			Item:             upstream.URL,
+			Checkout:         newServiceServer(t, NewCheckoutRouter(checkouts)),
+			CartPresentation: upstream.URL,
+		}),
+		NewMockUserStore(),
+		NewMockSessionStore(),
+		cookieEncryptionKey,
+	)
+	gateway.SetIdentityTokens(identityTokens)
+	_, aliceCookie := startSession(t, gateway, alice, false)
+	_, adminCookie := startSession(t, gateway, uuid.New(), true)
+	_, supportCookie := startSession(t, gateway, uuid.New(), false, PermissionUsersRead, PermissionCartsRead)
 
 	tests := []struct {
 		name           string
-		password       string
-		hashedPassword *string
-		expected       bool
+		method         string
+		path           string
+		body           string
+		contentType    string
+		cookie         *http.Cookie
+		expectedStatus int
 	}{
-		{
-			name:           "valid plain text password",
-			password:       "password123",
-			hashedPassword: &[]string{"password123"}[0],
-			expected:       true,
-		},
-		{
-			name:           "invalid password",
-			password:       "wrongpassword",
-			hashedPassword: &[]string{"password123"}[0],
-			expected:       false,
-		},
-		{
-			name:           "nil hashed password",
-			password:       "password123",
-			hashedPassword: nil,
-			expected:       false,
-		},
+		{name: "anonymous list items", method: http.MethodGet, path: "/api/v1/core/items", expectedStatus: http.StatusOK},
+		{name: "anonymous delete item", method: http.MethodDelete, path: "/api/v1/core/items/" + uuid.NewString(), expectedStatus: http.StatusUnauthorized},
+		{name: "user delete item", method: http.MethodDelete, path: "/api/v1/core/items/" + uuid.NewString(), cookie: aliceCookie, expectedStatus: http.StatusForbidden},
+		{name: "admin delete item", method: http.MethodDelete, path: "/api/v1/core/items/" + uuid.NewString(), cookie: adminCookie, expectedStatus: http.StatusOK},
+		{name: "anonymous preflight", method: http.MethodOptions, path: "/api/v1/core/items/" + uuid.NewString(), expectedStatus: http.StatusNoContent},
+		{name: "registration", method: http.MethodPost, path: "/api/v1/core/users", body: `{"username":"carol","email":"carol@example.com","password":"correct horse battery"}`, expectedStatus: http.StatusCreated},
+		{name: "registration as admin", method: http.MethodPost, path: "/api/v1/core/users", body: `{"username":"carol","email":"carol@example.com","password":"correct horse battery","is_admin":true}`, expectedStatus: http.StatusForbidden},
+		{name: "user list users", method: http.MethodGet, path: "/api/v1/core/users", cookie: aliceCookie, expectedStatus: http.StatusForbidden},
+		{name: "user get own profile", method: http.MethodGet, path: "/api/v1/core/users/" + alice.String(), cookie: aliceCookie, expectedStatus: http.StatusOK},
+		{name: "registration with malformed body", method: http.MethodPost, path: "/api/v1/core/users", body: `{"username":"carol","is_admin":"yes"}`, expectedStatus: http.StatusBadRequest},
+		{name: "user patch with malformed patch", method: http.MethodPatch, path: "/api/v1/core/users/" + alice.String(), body: `{"is_admin":`, contentType: "application/merge-patch+json", cookie: aliceCookie, expectedStatus: http.StatusBadRequest},
+		{name: "user create cart with malformed body", method: http.MethodPost, path: "/api/v1/core/carts", body: `["not", "a", "cart"]`, cookie: aliceCookie, expectedStatus: http.StatusBadRequest},
+		{name: "user patch own admin flag", method: http.MethodPatch, path: "/api/v1/core/users/" + alice.String(), body: `{"is_admin":true}`, contentType: "application/merge-patch+json", cookie: aliceCookie, expectedStatus: http.StatusForbidden},
+		{name: "user get own cart", method: http.MethodGet, path: "/api/v1/core/carts/" + aliceCart.ID.String(), cookie: aliceCookie, expectedStatus: http.StatusOK},
+		{name: "user get foreign cart", method: http.MethodGet, path: "/api/v1/core/carts/" + bobCart.ID.String(), cookie: aliceCookie, expectedStatus: http.StatusForbidden},
+		{name: "admin get foreign cart", method: http.MethodGet, path: "/api/v1/core/carts/" + bobCart.ID.String(), cookie: adminCookie, expectedStatus: http.StatusOK},
+		{name: "support get foreign cart", method: http.MethodGet, path: "/api/v1/core/carts/" + bobCart.ID.String(), cookie: supportCookie, expectedStatus: http.StatusOK},
+		{name: "support update foreign cart", method: http.MethodPut, path: "/api/v1/core/carts/" + bobCart.ID.String(), body: fmt.Sprintf(`{"id":%q,"owner_id":%q}`, bobCart.ID, bob), cookie: supportCookie, expectedStatus: http.StatusForbidden},
+		{name: "support list users", method: http.MethodGet, path: "/api/v1/core/users", cookie: supportCookie, expectedStatus: http.StatusOK},
+		{name: "support create role", method: http.MethodPost, path: "/api/v1/core/roles", body: `{"name":"support-lead","permissions":["users:write"]}`, cookie: supportCookie, expectedStatus: http.StatusForbidden},
+		{name: "user patch own roles", method: http.MethodPatch, path: "/api/v1/core/users/" + alice.String(), body: `{"roles":["support"]}`, contentType: "application/merge-patch+json", cookie: aliceCookie, expectedStatus: http.StatusForbidden},
+		{name: "anonymous get cart", method: http.MethodGet, path: "/api/v1/core/carts/" + aliceCart.ID.String(), expectedStatus: http.StatusUnauthorized},
+		{name: "user move own cart", method: http.MethodPut, path: "/api/v1/core/carts/" + aliceCart.ID.String(), body: fmt.Sprintf(`{"id":%q,"owner_id":%q}`, aliceCart.ID, bob), cookie: aliceCookie, expectedStatus: http.StatusForbidden},
+		{name: "user create foreign cart", method: http.MethodPost, path: "/api/v1/core/carts", body: fmt.Sprintf(`{"owner_id":%q}`, bob), cookie: aliceCookie, expectedStatus: http.StatusForbidden},
+		{name: "user checkout own cart", method: http.MethodPost, path: "/api/v1/core/checkouts", body: fmt.Sprintf(`{"user_id":%q,"cart_id":%q,"total":10,"status":"pending"}`, alice, aliceCart.ID), cookie: aliceCookie, expectedStatus: http.StatusCreated},
+		{name: "user checkout foreign cart", method: http.MethodPost, path: "/api/v1/core/checkouts", body: fmt.Sprintf(`{"user_id":%q,"cart_id":%q}`, alice, bobCart.ID), cookie: aliceCookie, expectedStatus: http.StatusForbidden},
+		{name: "user get foreign cart presentation", method: http.MethodGet, path: "/api/v1/presentation/cart/" + bobCart.ID.String(), cookie: aliceCookie, expectedStatus: http.StatusForbidden},
+		{name: "user update own cart with foreign ID", method: http.MethodPut, path: "/api/v1/core/carts/" + aliceCart.ID.String(), body: fmt.Sprintf(`{"id":%q,"owner_id":%q}`, bobCart.ID, alice), cookie: aliceCookie, expectedStatus: http.StatusBadRequest},
+		{name: "user patch own cart ID", method: http.MethodPatch, path: "/api/v1/core/carts/" + aliceCart.ID.String(), body: fmt.Sprintf(`[{"op":"replace","path":"/id","value":%q}]`, bobCart.ID), contentType: "application/json-patch+json", cookie: aliceCookie, expectedStatus: http.StatusBadRequest},
+		{name: "user delete own cart with foreign ID", method: http.MethodDelete, path: "/api/v1/core/carts/" + aliceCart.ID.String(), body: fmt.Sprintf(`{"id":%q}`, bobCart.ID), cookie: aliceCookie, expectedStatus: http.StatusBadRequest},
+		{name: "user update own checkout with foreign ID", method: http.MethodPut, path: "/api/v1/core/checkouts/" + aliceCheckout.ID.String(), body: fmt.Sprintf(`{"id":%q,"user_id":%q,"cart_id":%q,"total":10,"status":"pending"}`, bobCheckout.ID, alice, aliceCart.ID), cookie: aliceCookie, expectedStatus: http.StatusBadRequest},
+		{name: "user delete own checkout with foreign ID", method: http.MethodDelete, path: "/api/v1/core/checkouts/" + aliceCheckout.ID.String(), body: fmt.Sprintf(`{"id":%q}`, bobCheckout.ID), cookie: aliceCookie, expectedStatus: http.StatusBadRequest},
+		{name: "admin delete checkout with foreign ID", method: http.MethodDelete, path: "/api/v1/core/checkouts/" + aliceCheckout.ID.String(), body: fmt.Sprintf(`{"id":%q}`, bobCheckout.ID), cookie: adminCookie, expectedStatus: http.StatusBadRequest},
+		{name: "unknown route", method: http.MethodGet, path: "/api/v1/core/unknown", cookie: adminCookie, expectedStatus: http.StatusNotFound},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := gateway.validatePassword(tt.password, tt.hashedPassword)
-			if result != tt.expected {
-				t.Errorf("Expected %v, got %v", tt.expected, result)
+			proxied = false
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rr := httptest.NewRecorder()
+			gateway.proxy.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code >= http.StatusBadRequest && proxied {
+				t.Error("Did not expect rejected request to be proxied")
 			}
 		})
 	}
+
+	if carts.carts[bobCart.ID].OwnerID != bob || checkouts.checkouts[bobCheckout.ID] == nil {
+		t.Error("Expected the resources of bob to be left untouched")
+	}
 }
@@ -0,0 +1,694 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Balancers selecting the upstream of a request
+const (
+	// BalancerRoundRobin uses the upstreams in turn. It is the default.
+	BalancerRoundRobin = "round_robin"
+	// BalancerLeastConnections uses the upstream with the fewest requests in flight
+	BalancerLeastConnections = "least_connections"
+)
+
+// States of the circuit breaker of an upstream
+const (
+	// CircuitClosed passes all requests on to the upstream
+	CircuitClosed = "closed"
+	// CircuitOpen passes no requests on to the upstream
+	CircuitOpen = "open"
+	// CircuitHalfOpen passes a single trial request on to the upstream, its outcome closes the
+	// circuit or opens it again
+	CircuitHalfOpen = "half_open"
+)
+
+const (
+	// defaultHealthCheckInterval is the interval of the active health checks
+	defaultHealthCheckInterval = 10 * time.Second
+	// defaultMaxFailures is the number of consecutive failures opening the circuit of an upstream
+	defaultMaxFailures = 5
+	// defaultEjectionTime is how long the circuit of an upstream stays open
+	defaultEjectionTime = 30 * time.Second
+	// defaultRetryBackoff is the delay before the first retry of a request
+	defaultRetryBackoff = 50 * time.Millisecond
+	// maxRetryBodySize is the size up to which request bodies are buffered for retries
+	maxRetryBodySize = 1 << 20
+)
+
+// errCircuitOpen is returned by an upstreamPool if the circuits of all its upstreams are open
+var errCircuitOpen = errors.New("circuits of all upstreams are open")
+
+// HealthCheck configures the ejection of failing upstreams. Ejected upstreams receive no
+// requests. Upstreams failing their health check still receive requests if all upstreams
+// of the route fail it, requests are rejected if the circuits of all upstreams are open.
+type HealthCheck struct {
+	// Path is requested from every upstream each Interval, upstreams not answering with 2xx
+	// are ejected until they do. Active health checks are disabled if it is empty.
+	Path string `json:"path,omitempty"`
+	// Interval of the active health checks, 10s if zero
+	Interval Duration `json:"interval,omitempty"`
+	// MaxFailures consecutive 5xx responses or failed requests open the circuit of an
+	// upstream for EjectionTime, 5 if zero
+	MaxFailures int `json:"max_failures,omitempty"`
+	// EjectionTime is how long the circuit stays open before it passes a trial request on,
+	// 30s if zero
+	EjectionTime Duration `json:"ejection_time,omitempty"`
+}
+
+// Retry configures the retries of requests with idempotent methods. Requests are retried
+// after failing or being answered with 502, 503 or 504, on another upstream if possible.
+type Retry struct {
+	// Attempts is the number of retries after the first attempt, requests are not retried if zero
+	Attempts int `json:"attempts,omitempty"`
+	// Backoff is the delay before the first retry, it doubles with every retry and is
+	// shortened by up to half at random. 50ms if zero
+	Backoff Duration `json:"backoff,omitempty"`
+}
+
+var (
+	upstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_requests_total",
+		Help: "Total number of requests passed on to an upstream by outcome",
+	}, []string{"route", "upstream", "outcome"})
+	upstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_upstream_request_duration_seconds",
+		Help:    "Duration of the requests passed on to an upstream",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "upstream"})
+	upstreamInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_upstream_in_flight_requests",
+		Help: "Number of requests an upstream is currently serving",
+	}, []string{"route", "upstream"})
+	upstreamAvailable = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_upstream_available",
+		Help: "Whether an upstream receives requests (1) or has been ejected (0)",
+	}, []string{"route", "upstream"})
+	upstreamEjections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_ejections_total",
+		Help: "Total number of ejections of an upstream by reason",
+	}, []string{"route", "upstream", "reason"})
+	upstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_retries_total",
+		Help: "Total number of retries of the requests of a route",
+	}, []string{"route"})
+	upstreamRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_rejections_total",
+		Help: "Total number of requests of a route rejected because the circuits of all upstreams are open",
+	}, []string{"route"})
+)
+
+// Outcomes of the requests passed on to an upstream
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+	// outcomeCanceled requests have been given up on by the client, they say nothing about the upstream
+	outcomeCanceled = "canceled"
+)
+
+// newUpstreamTransport returns the transport shared by the proxies of all upstreams. It keeps
+// more idle connections per host than http.DefaultTransport, as all requests of the gateway
+// go to a few hosts.
+func newUpstreamTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 256
+	transport.MaxIdleConnsPerHost = 64
+	return transport
+}
+
+// upstreamPool balances the requests of a route over its upstreams. It is the transport of
+// the proxy of the route, every attempt of a request is sent to the upstream picked for it.
+type upstreamPool struct {
+	route       string
+	balancer    string
+	healthCheck HealthCheck
+	retry       Retry
+	endpoints   []*upstreamEndpoint
+	transport   http.RoundTripper
+	proxy       *httputil.ReverseProxy
+	// next is the position of the round robin
+	next atomic.Uint64
+}
+
+// upstreamEndpoint is an instance of an upstream service
+type upstreamEndpoint struct {
+	pool     *upstreamPool
+	url      *url.URL
+	inFlight atomic.Int64
+
+	mu sync.Mutex
+	// healthy is false while the active health checks fail
+	healthy bool
+	// circuit is the state of the circuit breaker
+	circuit string
+	// failures counts the consecutive failures of requests while the circuit is closed
+	failures int
+	// openUntil is the time an open circuit passes a trial request on
+	openUntil time.Time
+	// trial is set while the trial request of a half-open circuit is in flight
+	trial bool
+}
+
+// newUpstreamPool returns the pool of the upstreams of route, their requests are sent with transport
+func (g *Gateway) newUpstreamPool(route Route, transport http.RoundTripper) (*upstreamPool, error) {
+	pool := &upstreamPool{
+		route:       route.Prefix,
+		balancer:    route.Balancer,
+		healthCheck: route.HealthCheck,
+		retry:       route.Retry,
+		transport:   transport,
+	}
+	if pool.healthCheck.Interval == 0 {
+		pool.healthCheck.Interval = Duration(defaultHealthCheckInterval)
+	}
+	if pool.healthCheck.MaxFailures == 0 {
+		pool.healthCheck.MaxFailures = defaultMaxFailures
+	}
+	if pool.healthCheck.EjectionTime == 0 {
+		pool.healthCheck.EjectionTime = Duration(defaultEjectionTime)
+	}
+	if pool.retry.Backoff == 0 {
+		pool.retry.Backoff = Duration(defaultRetryBackoff)
+	}
+
+	for _, upstream := range route.Upstreams {
+		u, err := url.Parse(upstream)
+		if err != nil {
+			return nil, err
+		}
+		endpoint := &upstreamEndpoint{pool: pool, url: u, healthy: true, circuit: CircuitClosed}
+		upstreamAvailable.WithLabelValues(pool.route, u.String()).Set(1)
+		pool.endpoints = append(pool.endpoints, endpoint)
+	}
+	pool.proxy = g.newUpstreamProxy(pool)
+	return pool, nil
+}
+
+// candidates returns the endpoints whose circuits pass requests on. Endpoints failing their
+// health check are left out unless all endpoints fail it.
+func (p *upstreamPool) candidates(now time.Time) []*upstreamEndpoint {
+	var healthy, unhealthy []*upstreamEndpoint
+	for _, endpoint := range p.endpoints {
+		isHealthy, passes := endpoint.state(now)
+		switch {
+		case passes && isHealthy:
+			healthy = append(healthy, endpoint)
+		case passes:
+			unhealthy = append(unhealthy, endpoint)
+		}
+	}
+	if len(healthy) == 0 {
+		return unhealthy
+	}
+	return healthy
+}
+
+// pick returns the endpoint serving the next attempt of a request, or nil if the circuits
+// of all endpoints are open
+func (p *upstreamPool) pick() *upstreamEndpoint {
+	now := time.Now()
+	candidates := p.candidates(now)
+	for len(candidates) > 0 {
+		i := p.choose(candidates)
+		if candidates[i].admit(now) {
+			return candidates[i]
+		}
+		// another request has become the trial request of the half-open circuit
+		candidates = append(candidates[:i:i], candidates[i+1:]...)
+	}
+	return nil
+}
+
+// choose returns the index of the candidate picked by the balancer of the pool
+func (p *upstreamPool) choose(candidates []*upstreamEndpoint) int {
+	// the round robin position also breaks ties between endpoints with as many connections
+	start := int((p.next.Add(1) - 1) % uint64(len(candidates)))
+	if p.balancer != BalancerLeastConnections {
+		return start
+	}
+	picked := start
+	for i := 1; i < len(candidates); i++ {
+		if j := (start + i) % len(candidates); candidates[j].inFlight.Load() < candidates[picked].inFlight.Load() {
+			picked = j
+		}
+	}
+	return picked
+}
+
+// retryAfter returns how long it takes until the first open circuit passes a trial request on
+func (p *upstreamPool) retryAfter() time.Duration {
+	now := time.Now()
+	wait := time.Duration(math.MaxInt64)
+	for _, endpoint := range p.endpoints {
+		endpoint.mu.Lock()
+		wait = min(wait, endpoint.openUntil.Sub(now))
+		endpoint.mu.Unlock()
+	}
+	return max(wait, 0)
+}
+
+// RoundTrip sends the request to an upstream, requests with idempotent methods are retried
+// as configured. The error is errCircuitOpen if the circuits of all upstreams are open.
+func (p *upstreamPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if isIdempotent(req.Method) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) {
+		attempts += p.retry.Attempts
+	}
+
+	body := req.Body
+	for attempt := 1; ; attempt++ {
+		endpoint := p.pick()
+		if endpoint == nil {
+			upstreamRejections.WithLabelValues(p.route).Inc()
+			return nil, errCircuitOpen
+		}
+		resp, err := endpoint.roundTrip(req, body)
+		if attempt == attempts || !isRetryable(req.Context(), resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxRetryBodySize))
+			resp.Body.Close()
+		}
+
+		// the delay is randomized so the retries of concurrent requests are spread
+		delay := time.Duration(p.retry.Backoff) << (attempt - 1)
+		delay -= rand.N(delay/2 + 1)
+		slog.DebugContext(req.Context(), "Retrying upstream request", "route", p.route, "upstream", endpoint.url.String(), "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		upstreamRetries.WithLabelValues(p.route).Inc()
+
+		if req.GetBody != nil {
+			if body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// isIdempotent reports whether requests with the method may be sent more than once
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRetryable reports whether an attempt of a request may be repeated
+func isRetryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// runHealthChecks checks the health of the endpoints every interval until ctx is done
+func (p *upstreamPool) runHealthChecks(ctx context.Context, client *http.Client) {
+	ticker := time.NewTicker(time.Duration(p.healthCheck.Interval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, endpoint := range p.endpoints {
+			err := endpoint.checkHealth(ctx, client)
+			// checks interrupted by a reload say nothing about the endpoint
+			if ctx.Err() != nil {
+				return
+			}
+			endpoint.setHealthy(ctx, err)
+		}
+	}
+}
+
+// forget removes the gauges of an endpoint that is no longer routed to
+func (p *upstreamPool) forget(endpoint *upstreamEndpoint) {
+	upstreamInFlight.DeleteLabelValues(p.route, endpoint.url.String())
+	upstreamAvailable.DeleteLabelValues(p.route, endpoint.url.String())
+}
+
+// roundTrip sends the request with the given body to the endpoint
+func (e *upstreamEndpoint) roundTrip(req *http.Request, body io.ReadCloser) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = body
+	out.URL.Scheme, out.URL.Host = e.url.Scheme, e.url.Host
+	if basePath := strings.TrimSuffix(e.url.Path, "/"); basePath != "" {
+		out.URL.Path, out.URL.RawPath = basePath+out.URL.Path, ""
+	}
+
+	release := e.acquire()
+	start := time.Now()
+	resp, err := e.pool.transport.RoundTrip(out)
+	switch {
+	case errors.Is(err, context.Canceled):
+		e.record(req.Context(), outcomeCanceled, time.Since(start))
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		e.record(req.Context(), outcomeFailure, time.Since(start))
+	default:
+		e.record(req.Context(), outcomeSuccess, time.Since(start))
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// the request stays in flight until its response has been passed on
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: sync.OnceFunc(release)}
+	return resp, nil
+}
+
+// releasingBody calls release when the body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// checkHealth requests the health check path of the endpoint
+func (e *upstreamEndpoint) checkHealth(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.url.JoinPath(e.pool.healthCheck.Path).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// state reports whether the endpoint passes its health checks and whether its circuit
+// passes requests on
+func (e *upstreamEndpoint) state(now time.Time) (healthy, passes bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch e.circuit {
+	case CircuitOpen:
+		passes = !now.Before(e.openUntil)
+	case CircuitHalfOpen:
+		passes = !e.trial
+	default:
+		passes = true
+	}
+	return e.healthy, passes
+}
+
+// available reports whether the endpoint receives requests
+func (e *upstreamEndpoint) available(now time.Time) bool {
+	healthy, passes := e.state(now)
+	return healthy && passes
+}
+
+// admit reports whether the circuit passes a request on to the endpoint. The first request
+// after the circuit has been open for the ejection time becomes its trial request.
+func (e *upstreamEndpoint) admit(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch e.circuit {
+	case CircuitOpen:
+		if now.Before(e.openUntil) {
+			return false
+		}
+		e.circuit, e.trial = CircuitHalfOpen, true
+	case CircuitHalfOpen:
+		if e.trial {
+			return false
+		}
+		e.trial = true
+	}
+	return true
+}
+
+// setHealthy records the result of an active health check
+func (e *upstreamEndpoint) setHealthy(ctx context.Context, err error) {
+	e.mu.Lock()
+	changed := e.healthy != (err == nil)
+	e.healthy = err == nil
+	e.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	upstream := e.url.String()
+	if err != nil {
+		slog.WarnContext(ctx, "Ejecting upstream failing its health check", "route", e.pool.route, "upstream", upstream, "error", err)
+		upstreamEjections.WithLabelValues(e.pool.route, upstream, "health_check").Inc()
+		upstreamAvailable.WithLabelValues(e.pool.route, upstream).Set(0)
+		return
+	}
+	slog.InfoContext(ctx, "Upstream passed its health check", "route", e.pool.route, "upstream", upstream)
+	e.updateAvailable(time.Now())
+}
+
+// acquire counts a request in flight until release is called
+func (e *upstreamEndpoint) acquire() (release func()) {
+	e.inFlight.Add(1)
+	upstreamInFlight.WithLabelValues(e.pool.route, e.url.String()).Inc()
+	return func() {
+		e.inFlight.Add(-1)
+		upstreamInFlight.WithLabelValues(e.pool.route, e.url.String()).Dec()
+	}
+}
+
+// record records the outcome of a request. Consecutive failures open the circuit, the
+// outcome of the trial request of a half-open circuit closes it or opens it again.
+func (e *upstreamEndpoint) record(ctx context.Context, outcome string, duration time.Duration) {
+	upstream := e.url.String()
+	upstreamRequests.WithLabelValues(e.pool.route, upstream, outcome).Inc()
+	upstreamRequestDuration.WithLabelValues(e.pool.route, upstream).Observe(duration.Seconds())
+
+	ejectionTime := time.Duration(e.pool.healthCheck.EjectionTime)
+	e.mu.Lock()
+	halfOpen := e.circuit == CircuitHalfOpen
+	switch outcome {
+	case outcomeCanceled:
+		// the next request tries the half-open circuit instead
+		e.trial = false
+		e.mu.Unlock()
+		return
+	case outcomeSuccess:
+		e.failures = 0
+		e.circuit, e.trial = CircuitClosed, false
+		e.mu.Unlock()
+		if halfOpen {
+			slog.InfoContext(ctx, "Closing circuit of upstream after a successful trial request", "route", e.pool.route, "upstream", upstream)
+			e.updateAvailable(time.Now())
+		}
+		return
+	}
+	e.failures++
+	opened := halfOpen || (e.circuit == CircuitClosed && e.failures >= e.pool.healthCheck.MaxFailures)
+	if opened {
+		e.failures = 0
+		e.circuit, e.trial = CircuitOpen, false
+		e.openUntil = time.Now().Add(ejectionTime)
+	}
+	e.mu.Unlock()
+	if !opened {
+		return
+	}
+
+	slog.WarnContext(ctx, "Opening circuit of upstream after consecutive failures", "route", e.pool.route, "upstream", upstream, "duration", ejectionTime)
+	upstreamEjections.WithLabelValues(e.pool.route, upstream, "failures").Inc()
+	upstreamAvailable.WithLabelValues(e.pool.route, upstream).Set(0)
+	// the gauge is reset once the circuit passes a trial request on
+	time.AfterFunc(ejectionTime, func() { e.updateAvailable(time.Now()) })
+}
+
+// updateAvailable sets the availability gauge of the endpoint
+func (e *upstreamEndpoint) updateAvailable(now time.Time) {
+	available := 0.0
+	if e.available(now) {
+		available = 1
+	}
+	upstreamAvailable.WithLabelValues(e.pool.route, e.url.String()).Set(available)
+}
+
+// proxyRequest holds the values of a request the proxies need
+type proxyRequest struct {
+	// path is the path of the request at the gateway
+	path string
+	// identityToken is passed on to the upstream if it is set
+	identityToken string
+}
+
+type proxyRequestContextKey struct{}
+
+// newUpstreamProxy returns the reverse proxy passing the requests of a route on to the
+// upstreams of pool. The proxy is shared by all requests, their values are passed in the
+// request context.
+func (g *Gateway) newUpstreamProxy(pool *upstreamPool) *httputil.ReverseProxy {
+	proxy := &httputil.ReverseProxy{Transport: pool}
+
+	// Modify the request to add authentication context if needed, the pool sets the upstream
+	proxy.Director = func(req *http.Request) {
+		pr, _ := req.Context().Value(proxyRequestContextKey{}).(*proxyRequest)
+		if route := routeFromContext(req.Context()); route != nil {
+			req.URL.Path, req.URL.RawPath = route.upstreamPath(req.URL.Path), ""
+		}
+		if _, ok := req.Header["User-Agent"]; !ok {
+			// explicitly disable User-Agent so it's not set to default value
+			req.Header.Set("User-Agent", "")
+		}
+
+		// Propagate trace context to backend services
+		otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+
+		// the credentials of the client are consumed here, the services only see the identity
+		req.Header.Del("Authorization")
+		req.Header.Del(router.HeaderIdentityToken)
+		if pr != nil && pr.identityToken != "" {
+			req.Header.Set(router.HeaderIdentityToken, pr.identityToken)
+		}
+
+		// Add a header to indicate the request came through the gateway
+		req.Header.Set("X-Via-Gateway", "true")
+	}
+
+	// Modify the response to remove duplicate CORS headers from backend services
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		// Remove CORS headers from backend services to avoid conflicts
+		resp.Header.Del("Access-Control-Allow-Origin")
+		resp.Header.Del("Access-Control-Allow-Methods")
+		resp.Header.Del("Access-Control-Allow-Headers")
+		resp.Header.Del("Access-Control-Allow-Credentials")
+		resp.Header.Del("Access-Control-Max-Age")
+		resp.Header.Del("Access-Control-Expose-Headers")
+		return nil
+	}
+
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		path := req.URL.Path
+		if pr, ok := req.Context().Value(proxyRequestContextKey{}).(*proxyRequest); ok {
+			path = pr.path
+		}
+
+		if errors.Is(err, errCircuitOpen) {
+			// rejected without waiting for an upstream, clients may try again once a circuit passes a trial request on
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(pool.retryAfter().Seconds())), 1)))
+			(&router.ErrorResponse{
+				Status:  http.StatusServiceUnavailable,
+				Path:    path,
+				Message: "upstream service unavailable",
+				Error:   err.Error(),
+			}).WriteTo(w)
+			return
+		}
+
+		status, message := http.StatusBadGateway, "upstream service unavailable"
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			status, message = http.StatusGatewayTimeout, "upstream service timed out"
+		}
+		slog.WarnContext(req.Context(), "Failed to proxy request", "route", pool.route, "path", path, "error", err)
+		(&router.ErrorResponse{
+			Status:  status,
+			Path:    path,
+			Message: message,
+		}).WriteTo(w)
+	}
+	return proxy
+}
+
+// GatewayStatus is the state of the upstreams of all routes of the gateway
+type GatewayStatus struct {
+	Routes []RouteStatus `json:"routes"`
+}
+
+// RouteStatus is the state of the upstreams of a route
+type RouteStatus struct {
+	Prefix    string           `json:"prefix"`
+	Upstreams []UpstreamStatus `json:"upstreams"`
+}
+
+// UpstreamStatus is the state of an upstream of a route
+type UpstreamStatus struct {
+	URL string `json:"url"`
+	// Healthy is false while the upstream fails its health checks
+	Healthy bool `json:"healthy"`
+	// Circuit is the state of the circuit breaker, CircuitClosed, CircuitOpen or CircuitHalfOpen
+	Circuit string `json:"circuit"`
+	// Failures counts the consecutive failures of requests while the circuit is closed
+	Failures int `json:"failures"`
+	// OpenUntil is the time an open circuit passes a trial request on
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+	// InFlight is the number of requests the upstream is currently serving
+	InFlight int64 `json:"in_flight"`
+}
+
+// Status returns the state of the upstreams of all routes
+func (g *Gateway) Status() GatewayStatus {
+	status := GatewayStatus{Routes: []RouteStatus{}}
+	table := g.routes.Load()
+	if table == nil {
+		return status
+	}
+	for _, route := range table.routes {
+		rs := RouteStatus{Prefix: route.Prefix, Upstreams: []UpstreamStatus{}}
+		for _, endpoint := range route.pool.endpoints {
+			endpoint.mu.Lock()
+			us := UpstreamStatus{
+				URL:      endpoint.url.String(),
+				Healthy:  endpoint.healthy,
+				Circuit:  endpoint.circuit,
+				Failures: endpoint.failures,
+				InFlight: endpoint.inFlight.Load(),
+			}
+			if endpoint.circuit == CircuitOpen {
+				openUntil := endpoint.openUntil
+				us.OpenUntil = &openUntil
+			}
+			endpoint.mu.Unlock()
+			rs.Upstreams = append(rs.Upstreams, us)
+		}
+		status.Routes = append(status.Routes, rs)
+	}
+	return status
+}
+
+// handleStatus returns the state of the upstreams of all routes
+func (g *Gateway) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, g.Status())
+}
@@ -0,0 +1,367 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRouteConfig_ValidateUpstreams(t *testing.T) {
+	upstreams := []string{"http://item:8080"}
+
+	tests := []struct {
+		name    string
+		route   Route
+		wantErr bool
+	}{
+		{name: "least connections", route: Route{Prefix: "/items", Upstreams: upstreams, Balancer: BalancerLeastConnections}},
+		{name: "health check", route: Route{Prefix: "/items", Upstreams: upstreams, HealthCheck: HealthCheck{Path: "/health/readiness", Interval: Duration(time.Second), MaxFailures: 3, EjectionTime: Duration(time.Minute)}}},
+		{name: "unknown balancer", route: Route{Prefix: "/items", Upstreams: upstreams, Balancer: "random"}, wantErr: true},
+		{name: "relative health check path", route: Route{Prefix: "/items", Upstreams: upstreams, HealthCheck: HealthCheck{Path: "health"}}, wantErr: true},
+		{name: "negative interval", route: Route{Prefix: "/items", Upstreams: upstreams, HealthCheck: HealthCheck{Interval: Duration(-time.Second)}}, wantErr: true},
+		{name: "negative max failures", route: Route{Prefix: "/items", Upstreams: upstreams, HealthCheck: HealthCheck{MaxFailures: -1}}, wantErr: true},
+		{name: "negative ejection time", route: Route{Prefix: "/items", Upstreams: upstreams, HealthCheck: HealthCheck{EjectionTime: Duration(-time.Second)}}, wantErr: true},
+		{name: "retry", route: Route{Prefix: "/items", Upstreams: upstreams, Retry: Retry{Attempts: 2, Backoff: Duration(time.Second)}}},
+		{name: "negative retry attempts", route: Route{Prefix: "/items", Upstreams: upstreams, Retry: Retry{Attempts: -1}}, wantErr: true},
+		{name: "negative retry backoff", route: Route{Prefix: "/items", Upstreams: upstreams, Retry: Retry{Backoff: Duration(-time.Second)}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&RouteConfig{Routes: []Route{tt.route}}).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGateway_LeastConnections(t *testing.T) {
+	release := make(chan struct{})
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, "busy")
+	}))
+	t.Cleanup(busy.Close)
+	t.Cleanup(func() { close(release) })
+	idle := newEchoUpstream(t, "idle")
+
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/items", Upstreams: []string{busy.URL, idle}, Balancer: BalancerLeastConnections, Auth: RouteAuthPublic},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	pool := gateway.routes.Load().routes[0].pool
+
+	// the first request is held by the busy upstream
+	go gateway.proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+	for deadline := time.Now().Add(2 * time.Second); pool.endpoints[0].inFlight.Load() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a request in flight at the busy upstream")
+		}
+	}
+
+	for i := range 3 {
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items", nil))
+		if rr.Body.String() != "idle /items" {
+			t.Errorf("Expected request %d to be served by the idle upstream, got %q", i, rr.Body.String())
+		}
+	}
+}
+
+func TestGateway_EjectFailingUpstream(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "flaky")
+	}))
+	t.Cleanup(flaky.Close)
+	healthy := newEchoUpstream(t, "healthy")
+
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/eject", Upstreams: []string{flaky.URL, healthy}, Auth: RouteAuthPublic, HealthCheck: HealthCheck{MaxFailures: 2, EjectionTime: Duration(time.Hour)}},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/eject", nil))
+		return rr
+	}
+
+	// round robin alternates until the flaky upstream failed twice
+	failures := 0
+	for range 4 {
+		if serve().Code == http.StatusServiceUnavailable {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Fatalf("Expected 2 failed requests before the ejection, got %d", failures)
+	}
+	for i := range 4 {
+		if rr := serve(); rr.Body.String() != "healthy /eject" {
+			t.Errorf("Expected request %d to skip the ejected upstream, got %d %q", i, rr.Code, rr.Body.String())
+		}
+	}
+
+	if got := testutil.ToFloat64(upstreamAvailable.WithLabelValues("/eject", flaky.URL)); got != 0 {
+		t.Errorf("Expected the ejected upstream to be unavailable, got %v", got)
+	}
+	if got := testutil.ToFloat64(upstreamEjections.WithLabelValues("/eject", flaky.URL, "failures")); got != 1 {
+		t.Errorf("Expected 1 ejection, got %v", got)
+	}
+	if got := testutil.ToFloat64(upstreamRequests.WithLabelValues("/eject", flaky.URL, "failure")); got != 2 {
+		t.Errorf("Expected 2 failed requests, got %v", got)
+	}
+	if got := testutil.ToFloat64(upstreamRequests.WithLabelValues("/eject", healthy, "success")); got != 6 {
+		t.Errorf("Expected 6 successful requests, got %v", got)
+	}
+	if got := testutil.ToFloat64(upstreamInFlight.WithLabelValues("/eject", healthy)); got != 0 {
+		t.Errorf("Expected no requests in flight, got %v", got)
+	}
+}
+
+func TestGateway_CircuitBreaker(t *testing.T) {
+	var (
+		failing  atomic.Bool
+		requests atomic.Int64
+	)
+	failing.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "recovered")
+	}))
+	t.Cleanup(upstream.Close)
+
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/breaker", Upstreams: []string{upstream.URL}, Auth: RouteAuthPublic, HealthCheck: HealthCheck{MaxFailures: 2, EjectionTime: Duration(50 * time.Millisecond)}},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	endpoint := gateway.routes.Load().routes[0].pool.endpoints[0]
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/breaker", nil))
+		return rr
+	}
+
+	for range 2 {
+		if rr := serve(); rr.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected the response of the upstream, got %d", rr.Code)
+		}
+	}
+
+	// the open circuit rejects requests without passing them on
+	rr := serve()
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 503 with Retry-After, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if requests.Load() != 2 {
+		t.Errorf("Expected the upstream to receive 2 requests, got %d", requests.Load())
+	}
+
+	// a failed trial request opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	if rr := serve(); rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the trial request to be passed on, got %d", rr.Code)
+	}
+	if rr := serve(); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the circuit to be open again, got %d", rr.Code)
+	}
+
+	// a successful trial request closes it
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	for range 3 {
+		if rr := serve(); rr.Code != http.StatusOK {
+			t.Errorf("Expected the circuit to be closed, got %d", rr.Code)
+		}
+	}
+	if healthy, passes := endpoint.state(time.Now()); !healthy || !passes || endpoint.circuit != CircuitClosed {
+		t.Errorf("Expected a closed circuit, got %s", endpoint.circuit)
+	}
+	if got := testutil.ToFloat64(upstreamRejections.WithLabelValues("/breaker")); got != 2 {
+		t.Errorf("Expected 2 rejected requests, got %v", got)
+	}
+}
+
+func TestGateway_Retry(t *testing.T) {
+	var requests atomic.Int64
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", r.Method, body)
+	}))
+	t.Cleanup(echo.Close)
+
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/retry", Upstreams: []string{failing.URL, echo.URL}, Auth: RouteAuthPublic, Retry: Retry{Attempts: 1, Backoff: Duration(time.Millisecond)}},
+		{Prefix: "/exhausted", Upstreams: []string{failing.URL}, Auth: RouteAuthPublic, Retry: Retry{Attempts: 2, Backoff: Duration(time.Millisecond)}},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	// round robin sends the first attempt to the failing upstream, the retry to the other
+	if rr := serve(http.MethodPut, "/retry", "payload"); rr.Code != http.StatusOK || rr.Body.String() != "PUT payload" {
+		t.Errorf("Expected the retry to pass the body on, got %d %q", rr.Code, rr.Body.String())
+	}
+	requests.Store(0)
+	if rr := serve(http.MethodPost, "/retry", "payload"); rr.Code != http.StatusServiceUnavailable || requests.Load() != 1 {
+		t.Errorf("Expected POST requests not to be retried, got %d after %d requests", rr.Code, requests.Load())
+	}
+
+	requests.Store(0)
+	if rr := serve(http.MethodGet, "/exhausted", ""); rr.Code != http.StatusServiceUnavailable || requests.Load() != 3 {
+		t.Errorf("Expected the last response after 3 attempts, got %d after %d requests", rr.Code, requests.Load())
+	}
+	if got := testutil.ToFloat64(upstreamRetries.WithLabelValues("/exhausted")); got != 2 {
+		t.Errorf("Expected 2 retries, got %v", got)
+	}
+}
+
+func TestGateway_Status(t *testing.T) {
+	upstream := newEchoUpstream(t, "status")
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/status", Upstreams: []string{upstream}, Auth: RouteAuthPublic},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	mux := http.NewServeMux()
+	gateway.RegisterRoutes(mux)
+	_, userCookie := startSession(t, gateway, uuid.New(), false)
+	_, operatorCookie := startSession(t, gateway, uuid.New(), false, PermissionGatewayRead)
+
+	tests := []struct {
+		name           string
+		cookie         *http.Cookie
+		expectedStatus int
+	}{
+		{name: "anonymous", expectedStatus: http.StatusUnauthorized},
+		{name: "without permission", cookie: userCookie, expectedStatus: http.StatusForbidden},
+		{name: "with permission", cookie: operatorCookie, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/gateway/status", nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var status GatewayStatus
+			if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+				t.Fatalf("Failed to decode status: %v", err)
+			}
+			if len(status.Routes) != 1 || len(status.Routes[0].Upstreams) != 1 {
+				t.Fatalf("Unexpected status %+v", status)
+			}
+			if us := status.Routes[0].Upstreams[0]; us.URL != upstream || us.Circuit != CircuitClosed || !us.Healthy {
+				t.Errorf("Unexpected upstream status %+v", us)
+			}
+		})
+	}
+}
+
+func TestGateway_HealthCheck(t *testing.T) {
+	var unhealthy atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health/readiness" && unhealthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "flaky %s", r.URL.Path)
+	}))
+	t.Cleanup(flaky.Close)
+	healthy := newEchoUpstream(t, "healthy")
+
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/checked", Upstreams: []string{flaky.URL, healthy}, Auth: RouteAuthPublic, HealthCheck: HealthCheck{Path: "/health/readiness", Interval: Duration(5 * time.Millisecond)}},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	t.Cleanup(func() { gateway.routes.Load().stop() })
+	pool := gateway.routes.Load().routes[0].pool
+
+	waitFor := func(available bool) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if pool.endpoints[0].available(time.Now()) == available {
+				return
+			}
+		}
+		t.Fatalf("Expected the upstream to become available %v", available)
+	}
+
+	unhealthy.Store(true)
+	waitFor(false)
+	for range 4 {
+		rr := httptest.NewRecorder()
+		gateway.proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/checked", nil))
+		if rr.Body.String() != "healthy /checked" {
+			t.Errorf("Expected the unhealthy upstream to be skipped, got %q", rr.Body.String())
+		}
+	}
+	if got := testutil.ToFloat64(upstreamEjections.WithLabelValues("/checked", flaky.URL, "health_check")); got != 1 {
+		t.Errorf("Expected 1 ejection, got %v", got)
+	}
+
+	unhealthy.Store(false)
+	waitFor(true)
+}
+
+func TestGateway_ReloadStopsHealthChecks(t *testing.T) {
+	var checks atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks.Add(1)
+	}))
+	t.Cleanup(upstream.Close)
+
+	gateway := NewGateway(&RouteConfig{Routes: []Route{
+		{Prefix: "/reload", Upstreams: []string{upstream.URL}, HealthCheck: HealthCheck{Path: "/health", Interval: Duration(time.Millisecond)}},
+	}}, NewMockUserStore(), NewMockSessionStore(), cookieEncryptionKey)
+	for deadline := time.Now().Add(2 * time.Second); checks.Load() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the upstream to be checked")
+		}
+	}
+
+	if err := gateway.SetRoutes(&RouteConfig{Routes: []Route{{Prefix: "/other", Upstreams: []string{upstream.URL}}}}); err != nil {
+		t.Fatalf("SetRoutes failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	before := checks.Load()
+	time.Sleep(20 * time.Millisecond)
+	if after := checks.Load(); after != before {
+		t.Errorf("Expected the health checks of the replaced routes to stop, got %d more", after-before)
+	}
+	if upstreamAvailable.DeleteLabelValues("/reload", upstream.URL) {
+		t.Error("Expected the gauge of the removed route to be deleted")
+	}
+	if !upstreamAvailable.DeleteLabelValues("/other", upstream.URL) {
+		t.Error("Expected the gauge of the new route to be set")
+	}
+}
@@ -2,13 +2,14 @@ package v1
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
 	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -20,6 +21,7 @@ type Item struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"`
 
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
@@ -28,12 +30,27 @@ type Item struct {
 	Location    string  `json:"location"`
 }
 
+// Validate implements validation.Validatable.
+func (i Item) Validate(op validation.Operation) error {
+	var v validation.Violations
+	if op == validation.Create {
+		v.Check(i.ID == uuid.Nil, "id", "must be empty for creation")
+	}
+	v.NotEmpty("name", i.Name)
+	v.Check(i.Price > 0, "price", "must be greater than zero")
+	v.Check(i.Quantity >= 0, "quantity", "cannot be negative")
+	return v.Err()
+}
+
 type ItemStore interface {
 	Create(ctx context.Context, item *Item) error
-	List(ctx context.Context, page, limit int) ([]Item, error)
+	// List returns the requested page of items and the total number of items.
+	List(ctx context.Context, opts ListOptions) ([]Item, int, error)
 	Get(ctx context.Context, id uuid.UUID) (*Item, error)
+	// Update replaces the object and increments its version, a non-zero version must match the stored one.
 	Update(ctx context.Context, item *Item) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	// Delete deletes the object if its version matches, a version of 0 deletes it unconditionally.
+	Delete(ctx context.Context, id uuid.UUID, version int64) error
 }
 
 type ItemRouter struct {
@@ -111,29 +128,13 @@ func (i *ItemRouter) GetKind() string {
 
 func (i *ItemRouter) Routes() []router.PathObject {
 	return []router.PathObject{
-		{
-			Method: "POST",
-			Func:   handlers.HttpPost(i.createItem),
-		},
-		{
-			Method: "GET",
-			Func:   handlers.HttpList(i.listItems),
-		},
-		{
-			Path:   "/{id}",
-			Method: "GET",
-			Func:   handlers.HttpGet(i.getItem),
-		},
-		{
-			Path:   "/{id}",
-			Method: "PUT",
-			Func:   handlers.HttpUpdate(i.updateItem),
-		},
-		{
-			Path:   "/{id}",
-			Method: "DELETE",
-			Func:   handlers.HttpDelete(i.deleteItem),
-		},
+		handlers.Post("", i.createItem).WithPermission(PermissionItemsWrite),
+		// the catalog is public, but only served to requests passed on by the gateway and services
+		handlers.List("", i.listItems).WithCaller(router.CallerVerified),
+		handlers.Get("/{id}", i.getItem).WithCaller(router.CallerVerified),
+		handlers.Update("/{id}", i.updateItem).WithPermission(PermissionItemsWrite),
+		handlers.Patch("/{id}", i.getItem, i.updateItem).WithPermission(PermissionItemsWrite),
+		handlers.Delete("/{id}", i.deleteItem).WithPermission(PermissionItemsWrite),
 	}
 }
 
@@ -142,23 +143,11 @@ func (i *ItemRouter) createItem(ctx context.Context, r *http.Request, item *Item
 
 	if i.Store == nil {
 		i.processedCreateFailures.Inc()
-		return errors.New("item store is not initialized")
+		return fmt.Errorf("%w: item store is not initialized", ErrUnavailable)
 	}
 	if item == nil {
 		i.processedCreateFailures.Inc()
-		return errors.New("item cannot be nil")
-	}
-	if item.ID != uuid.Nil {
-		i.processedCreateFailures.Inc()
-		return errors.New("item ID must be empty for creation")
-	}
-	if item.Name == "" {
-		i.processedCreateFailures.Inc()
-		return errors.New("item name cannot be empty")
-	}
-	if item.Price <= 0 {
-		i.processedCreateFailures.Inc()
-		return errors.New("item price must be greater than zero")
+		return fmt.Errorf("%w: item cannot be nil", ErrValidation)
 	}
 	item.ID = uuid.New()
 	item.CreatedAt = time.Now()
@@ -172,20 +161,20 @@ func (i *ItemRouter) createItem(ctx context.Context, r *http.Request, item *Item
 	return nil
 }
 
-func (i *ItemRouter) listItems(ctx context.Context, r *http.Request, filters handlers.FilterObjectList) ([]Item, error) {
+func (i *ItemRouter) listItems(ctx context.Context, r *http.Request, filters handlers.FilterObjectList) ([]Item, int, error) {
 	i.processedListRequests.Inc()
 
 	if i.Store == nil {
 		i.processedListFailures.Inc()
-		return nil, errors.New("item store is not initialized")
+		return nil, 0, fmt.Errorf("%w: item store is not initialized", ErrUnavailable)
 	}
 
-	items, err := i.Store.List(ctx, filters.Page, filters.Limit)
+	items, total, err := i.Store.List(ctx, filters)
 	if err != nil {
 		i.processedListFailures.Inc()
-		return nil, err
+		return nil, 0, err
 	}
-	return items, nil
+	return items, total, nil
 }
 
 func (i *ItemRouter) getItem(ctx context.Context, r *http.Request) (*Item, error) {
@@ -193,7 +182,7 @@ func (i *ItemRouter) getItem(ctx context.Context, r *http.Request) (*Item, error
 
 	if i.Store == nil {
 		i.processedGetFailures.Inc()
-		return nil, errors.New("item store is not initialized")
+		return nil, fmt.Errorf("%w: item store is not initialized", ErrUnavailable)
 	}
 
 	id, err := handlers.GetUUIDFromPathValue(r, "id")
@@ -209,7 +198,7 @@ func (i *ItemRouter) getItem(ctx context.Context, r *http.Request) (*Item, error
 	}
 	if item == nil {
 		i.processedGetFailures.Inc()
-		return nil, errors.New("item not found")
+		return nil, fmt.Errorf("item %w", ErrNotFound)
 	}
 	return item, nil
 }
@@ -219,7 +208,7 @@ func (i *ItemRouter) updateItem(ctx context.Context, r *http.Request, item *Item
 
 	if i.Store == nil {
 		i.processedUpdateFailures.Inc()
-		return errors.New("item store is not initialized")
+		return fmt.Errorf("%w: item store is not initialized", ErrUnavailable)
 	}
 
 	// Extract ID from URL path
@@ -240,15 +229,6 @@ func (i *ItemRouter) updateItem(ctx context.Context, r *http.Request, item *Item
 	item.ID = id
 	item.CreatedAt = existingItem.CreatedAt
 
-	if item.Name == "" {
-		i.processedUpdateFailures.Inc()
-		return errors.New("item name cannot be empty")
-	}
-	if item.Price <= 0 {
-		i.processedUpdateFailures.Inc()
-		return errors.New("item price must be greater than zero")
-	}
-
 	// Set update timestamp
 	item.UpdatedAt = time.Now()
 
@@ -265,15 +245,15 @@ func (i *ItemRouter) deleteItem(ctx context.Context, r *http.Request, item *Item
 
 	if i.Store == nil {
 		i.processedDeleteFailures.Inc()
-		return errors.New("item store is not initialized")
+		return fmt.Errorf("%w: item store is not initialized", ErrUnavailable)
 	}
 
 	if item == nil {
 		i.processedDeleteFailures.Inc()
-		return errors.New("item is nil")
+		return fmt.Errorf("%w: item is nil", ErrValidation)
 	}
 
-	err := i.Store.Delete(ctx, item.ID)
+	err := i.Store.Delete(ctx, item.ID, item.Version)
 	if err != nil {
 		i.processedDeleteFailures.Inc()
 		return err
@@ -3,12 +3,14 @@ package v1
 import (
 	"context"
 	"errors"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
 )
 
 // MockItemStore implements ItemStore interface for testing
@@ -54,7 +56,7 @@ func (m *MockItemStore) Update(ctx context.Context, item *Item) error {
 	return nil
 }
 
-func (m *MockItemStore) Delete(ctx context.Context, id uuid.UUID) error {
+func (m *MockItemStore) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	if m.shouldError {
 		return errors.New("mock error")
 	}
@@ -62,15 +64,15 @@ func (m *MockItemStore) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (m *MockItemStore) List(ctx context.Context, page, limit int) ([]Item, error) {
+func (m *MockItemStore) List(ctx context.Context, opts ListOptions) ([]Item, int, error) {
 	if m.shouldError {
-		return nil, errors.New("mock error")
+		return nil, 0, errors.New("mock error")
 	}
 	items := make([]Item, 0, len(m.items))
 	for _, item := range m.items {
 		items = append(items, *item)
 	}
-	return items, nil
+	return items, len(items), nil
 }
 
 func TestNewItemRouter(t *testing.T) {
@@ -167,8 +169,8 @@ func TestItemRouter_createItem_NilStore(t *testing.T) {
 	req := httptest.NewRequest("POST", "/api/v1/core/items", nil)
 	err := router.createItem(context.Background(), req, item)
 
-	if err == nil {
-		t.Error("Expected error for nil store")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected error wrapping %v for nil store, got %v", ErrUnavailable, err)
 	}
 }
 
@@ -195,11 +197,10 @@ func TestItemRouter_createItem_NonEmptyID(t *testing.T) {
 		Price:       19.99,
 	}
 
-	req := httptest.NewRequest("POST", "/api/v1/core/items", nil)
-	err := router.createItem(context.Background(), req, item)
+	rec := serveJSON(t, handlers.HttpPost(router.createItem), "POST", "/api/v1/core/items", item)
 
-	if err == nil {
-		t.Error("Expected error for non-empty ID")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for non-empty ID, got %d", rec.Code)
 	}
 }
 
@@ -214,11 +215,10 @@ func TestItemRouter_createItem_EmptyName(t *testing.T) {
 		Price:       19.99,
 	}
 
-	req := httptest.NewRequest("POST", "/api/v1/core/items", nil)
-	err := router.createItem(context.Background(), req, item)
+	rec := serveJSON(t, handlers.HttpPost(router.createItem), "POST", "/api/v1/core/items", item)
 
-	if err == nil {
-		t.Error("Expected error for empty name")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for empty name, got %d", rec.Code)
 	}
 }
 
@@ -233,11 +233,10 @@ func TestItemRouter_createItem_ZeroPrice(t *testing.T) {
 		Price:       0, // Zero price should cause error
 	}
 
-	req := httptest.NewRequest("POST", "/api/v1/core/items", nil)
-	err := router.createItem(context.Background(), req, item)
+	rec := serveJSON(t, handlers.HttpPost(router.createItem), "POST", "/api/v1/core/items", item)
 
-	if err == nil {
-		t.Error("Expected error for zero price")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for zero price, got %d", rec.Code)
 	}
 }
 
@@ -252,11 +251,10 @@ func TestItemRouter_createItem_NegativePrice(t *testing.T) {
 		Price:       -10.0, // Negative price should cause error
 	}
 
-	req := httptest.NewRequest("POST", "/api/v1/core/items", nil)
-	err := router.createItem(context.Background(), req, item)
+	rec := serveJSON(t, handlers.HttpPost(router.createItem), "POST", "/api/v1/core/items", item)
 
-	if err == nil {
-		t.Error("Expected error for negative price")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for negative price, got %d", rec.Code)
 	}
 }
 
@@ -431,7 +429,7 @@ func TestItemRouter_listItems_Success(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/core/items", nil)
 	filters := handlers.FilterObjectList{Page: 0, Limit: 10}
 
-	items, err := router.listItems(context.Background(), req, filters)
+	items, total, err := router.listItems(context.Background(), req, filters)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -440,6 +438,9 @@ func TestItemRouter_listItems_Success(t *testing.T) {
 	if len(items) != 2 {
 		t.Errorf("Expected 2 items, got %d", len(items))
 	}
+	if total != 2 {
+		t.Errorf("Expected total of 2, got %d", total)
+	}
 }
 
 func TestItemRouter_listItems_Empty(t *testing.T) {
@@ -449,7 +450,7 @@ func TestItemRouter_listItems_Empty(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/core/items", nil)
 	filters := handlers.FilterObjectList{Page: 0, Limit: 10}
 
-	items, err := router.listItems(context.Background(), req, filters)
+	items, total, err := router.listItems(context.Background(), req, filters)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -458,4 +459,20 @@ func TestItemRouter_listItems_Empty(t *testing.T) {
 	if len(items) != 0 {
 		t.Errorf("Expected 0 items, got %d", len(items))
 	}
+	if total != 0 {
+		t.Errorf("Expected total of 0, got %d", total)
+	}
+}
+
+func TestItem_Validate(t *testing.T) {
+	valid := Item{Name: "Apple", Price: 1.5, Quantity: 3}
+	assertViolations(t, valid.Validate(validation.Create), nil)
+
+	// the ID is assigned by the server on creation but part of the body on updates
+	withID := Item{ID: uuid.New(), Name: "Apple", Price: 1.5}
+	assertViolations(t, withID.Validate(validation.Create), []string{"id"})
+	assertViolations(t, withID.Validate(validation.Update), nil)
+
+	invalid := Item{Price: -1, Quantity: -1}
+	assertViolations(t, invalid.Validate(validation.Update), []string{"name", "price", "quantity"})
 }
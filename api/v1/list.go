@@ -0,0 +1,12 @@
+package v1
+
+import "github.com/leonsteinhaeuser/demo-shop/internal/handlers"
+
+type (
+	// ListOptions controls pagination and ordering of List calls.
+	ListOptions = handlers.FilterObjectList
+	// SortField is a single field to order a list by.
+	SortField = handlers.SortField
+	// ListResponse is the envelope returned by the list endpoints.
+	ListResponse[T any] = handlers.ListResponse[T]
+)
@@ -0,0 +1,47 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveJSON sends obj as JSON request body to handler and returns the recorded response.
+func serveJSON(t *testing.T, handler http.HandlerFunc, method, path string, obj any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(method, path, bytes.NewReader(body)))
+	return rec
+}
+
+// assertViolations checks that err reports violations of exactly the given fields, in order.
+func assertViolations(t *testing.T, err error, fields []string) {
+	t.Helper()
+
+	if len(fields) == 0 {
+		if err != nil {
+			t.Fatalf("Expected no violations, got %v", err)
+		}
+		return
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	if len(verr.Violations) != len(fields) {
+		t.Fatalf("Expected violations of %v, got %+v", fields, verr.Violations)
+	}
+	for i, field := range fields {
+		if verr.Violations[i].Field != field {
+			t.Errorf("Expected violation %d to be of field %s, got %s", i, field, verr.Violations[i].Field)
+		}
+	}
+}
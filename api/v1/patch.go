@@ -0,0 +1,14 @@
+package v1
+
+import "github.com/leonsteinhaeuser/demo-shop/internal/patch"
+
+// The content types accepted by the PATCH endpoints.
+const (
+	// MergePatchContentType selects JSON Merge Patch (RFC 7386), the body is a partial object
+	MergePatchContentType = patch.MergePatchContentType
+	// JSONPatchContentType selects JSON Patch (RFC 6902), the body is a list of PatchOperations
+	JSONPatchContentType = patch.JSONPatchContentType
+)
+
+// PatchOperation is a single operation of a JSON Patch document.
+type PatchOperation = patch.Operation
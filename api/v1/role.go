@@ -0,0 +1,329 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	_ router.ApiObject = &RoleRouter{}
+)
+
+// Permissions grant access to groups of operations. Users hold the permissions of their roles,
+// admins (User.IsAdmin) hold all of them.
+const (
+	PermissionItemsWrite     = "items:write"
+	PermissionUsersRead      = "users:read"
+	PermissionUsersWrite     = "users:write"
+	PermissionRolesRead      = "roles:read"
+	PermissionRolesWrite     = "roles:write"
+	PermissionCartsRead      = "carts:read"
+	PermissionCartsWrite     = "carts:write"
+	PermissionCheckoutsRead  = "checkouts:read"
+	PermissionCheckoutsWrite = "checkouts:write"
+	PermissionSessionsRead   = "sessions:read"
+	PermissionSessionsWrite  = "sessions:write"
+	PermissionGatewayRead    = "gateway:read"
+)
+
+// Permissions lists the valid permissions of a role
+var Permissions = []string{
+	PermissionItemsWrite,
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionRolesRead,
+	PermissionRolesWrite,
+	PermissionCartsRead,
+	PermissionCartsWrite,
+	PermissionCheckoutsRead,
+	PermissionCheckoutsWrite,
+	PermissionSessionsRead,
+	PermissionSessionsWrite,
+	PermissionGatewayRead,
+}
+
+// checkOwner ensures the caller of a request may access a resource of the user owner. Users
+// access their own resources, other users need the permission. Services acting on their own
+// behalf, e.g. the gateway creating the cart of a user, access all of them. The caller is
+// identified by the identity of the request, so the check also holds for requests not passing
+// the gateway.
+func checkOwner(ctx context.Context, resource string, owner uuid.UUID, permission string) error {
+	identity := router.IdentityFromContext(ctx)
+	switch {
+	case identity == nil:
+		return fmt.Errorf("%w: missing identity", ErrUnauthorized)
+	case identity.Service != "" || identity.Can(permission):
+		return nil
+	case identity.Anonymous || identity.UserID != owner:
+		return fmt.Errorf("%w: the %s belongs to another user", ErrForbidden, resource)
+	}
+	return nil
+}
+
+// Role is a named set of permissions that can be assigned to users
+type Role struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"`
+
+	// Name identifies the role in the roles of a user
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// Validate implements validation.Validatable.
+func (r Role) Validate(op validation.Operation) error {
+	var v validation.Violations
+	if op == validation.Create {
+		v.Check(r.ID == uuid.Nil, "id", "must be empty for creation")
+	}
+	v.NotEmpty("name", r.Name)
+	for i, permission := range r.Permissions {
+		field := fmt.Sprintf("permissions.%d", i)
+		v.OneOf(field, permission, Permissions...)
+		v.Check(!slices.Contains(r.Permissions[:i], permission), field, "is listed more than once")
+	}
+	return v.Err()
+}
+
+type RoleStore interface {
+	// Create stores a new role, it fails with ErrAlreadyExists if the name is taken.
+	Create(ctx context.Context, role *Role) error
+	// List returns the requested page of roles and the total number of roles.
+	List(ctx context.Context, opts ListOptions) ([]Role, int, error)
+	Get(ctx context.Context, id uuid.UUID) (*Role, error)
+	// Update replaces the object and increments its version, a non-zero version must match the stored one.
+	Update(ctx context.Context, role *Role) error
+	// Delete deletes the object if its version matches, a version of 0 deletes it unconditionally.
+	Delete(ctx context.Context, id uuid.UUID, version int64) error
+}
+
+// ResolvePermissions returns the permissions granted by the named roles. Unknown roles grant nothing.
+func ResolvePermissions(ctx context.Context, store RoleStore, roles []string) ([]string, error) {
+	if len(roles) == 0 {
+		return nil, nil
+	}
+	all, _, err := store.List(ctx, ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	permissions := []string{}
+	for _, role := range all {
+		if !slices.Contains(roles, role.Name) {
+			continue
+		}
+		for _, permission := range role.Permissions {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	slices.Sort(permissions)
+	return permissions, nil
+}
+
+// RoleRouter implements the API router for role endpoints
+type RoleRouter struct {
+	processedCreateRequests prometheus.Counter
+	processedCreateFailures prometheus.Counter
+	processedUpdateRequests prometheus.Counter
+	processedUpdateFailures prometheus.Counter
+	processedDeleteRequests prometheus.Counter
+	processedDeleteFailures prometheus.Counter
+	processedGetRequests    prometheus.Counter
+	processedGetFailures    prometheus.Counter
+	processedListRequests   prometheus.Counter
+	processedListFailures   prometheus.Counter
+
+	Store RoleStore
+}
+
+func NewRoleRouter(store RoleStore) *RoleRouter {
+	return &RoleRouter{
+		processedCreateRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_create_requests_total",
+			Help: "Total number of role create requests",
+		}),
+		processedCreateFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_create_failures_total",
+			Help: "Total number of role create failures",
+		}),
+		processedUpdateRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_update_requests_total",
+			Help: "Total number of role update requests",
+		}),
+		processedUpdateFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_update_failures_total",
+			Help: "Total number of role update failures",
+		}),
+		processedDeleteRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_delete_requests_total",
+			Help: "Total number of role delete requests",
+		}),
+		processedDeleteFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_delete_failures_total",
+			Help: "Total number of role delete failures",
+		}),
+		processedGetRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_get_requests_total",
+			Help: "Total number of role get requests",
+		}),
+		processedGetFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_get_failures_total",
+			Help: "Total number of role get failures",
+		}),
+		processedListRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_list_requests_total",
+			Help: "Total number of role list requests",
+		}),
+		processedListFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "role_list_failures_total",
+			Help: "Total number of role list failures",
+		}),
+		Store: store,
+	}
+}
+
+func (ro *RoleRouter) GetApiVersion() string {
+	return version
+}
+
+func (ro *RoleRouter) GetGroup() string {
+	return group
+}
+
+func (ro *RoleRouter) GetKind() string {
+	return "roles"
+}
+
+func (ro *RoleRouter) Routes() []router.PathObject {
+	return []router.PathObject{
+		handlers.Post("", ro.createRole).WithPermission(PermissionRolesWrite),
+		handlers.List("", ro.listRoles).WithPermission(PermissionRolesRead),
+		handlers.Get("/{id}", ro.getRole).WithPermission(PermissionRolesRead),
+		handlers.Update("/{id}", ro.updateRole).WithPermission(PermissionRolesWrite),
+		handlers.Patch("/{id}", ro.getRole, ro.updateRole).WithPermission(PermissionRolesWrite),
+		handlers.Delete("/{id}", ro.deleteRole).WithPermission(PermissionRolesWrite),
+	}
+}
+
+func (ro *RoleRouter) createRole(ctx context.Context, r *http.Request, role *Role) error {
+	ro.processedCreateRequests.Inc()
+
+	if ro.Store == nil {
+		ro.processedCreateFailures.Inc()
+		return fmt.Errorf("%w: role store is not initialized", ErrUnavailable)
+	}
+	role.ID = uuid.New()
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = role.CreatedAt
+
+	err := ro.Store.Create(ctx, role)
+	if err != nil {
+		ro.processedCreateFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+func (ro *RoleRouter) listRoles(ctx context.Context, r *http.Request, filters handlers.FilterObjectList) ([]Role, int, error) {
+	ro.processedListRequests.Inc()
+
+	if ro.Store == nil {
+		ro.processedListFailures.Inc()
+		return nil, 0, fmt.Errorf("%w: role store is not initialized", ErrUnavailable)
+	}
+
+	roles, total, err := ro.Store.List(ctx, filters)
+	if err != nil {
+		ro.processedListFailures.Inc()
+		return nil, 0, err
+	}
+	return roles, total, nil
+}
+
+func (ro *RoleRouter) getRole(ctx context.Context, r *http.Request) (*Role, error) {
+	ro.processedGetRequests.Inc()
+
+	if ro.Store == nil {
+		ro.processedGetFailures.Inc()
+		return nil, fmt.Errorf("%w: role store is not initialized", ErrUnavailable)
+	}
+
+	id, err := handlers.GetUUIDFromPathValue(r, "id")
+	if err != nil {
+		ro.processedGetFailures.Inc()
+		return nil, err
+	}
+
+	role, err := ro.Store.Get(ctx, id)
+	if err != nil {
+		ro.processedGetFailures.Inc()
+		return nil, err
+	}
+	return role, nil
+}
+
+func (ro *RoleRouter) updateRole(ctx context.Context, r *http.Request, role *Role) error {
+	ro.processedUpdateRequests.Inc()
+
+	if ro.Store == nil {
+		ro.processedUpdateFailures.Inc()
+		return fmt.Errorf("%w: role store is not initialized", ErrUnavailable)
+	}
+
+	id, err := handlers.GetUUIDFromPathValue(r, "id")
+	if err != nil {
+		ro.processedUpdateFailures.Inc()
+		return err
+	}
+
+	existing, err := ro.Store.Get(ctx, id)
+	if err != nil {
+		ro.processedUpdateFailures.Inc()
+		return err
+	}
+	role.ID = id
+	role.CreatedAt = existing.CreatedAt
+	role.UpdatedAt = time.Now()
+
+	err = ro.Store.Update(ctx, role)
+	if err != nil {
+		ro.processedUpdateFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+func (ro *RoleRouter) deleteRole(ctx context.Context, r *http.Request, role *Role) error {
+	ro.processedDeleteRequests.Inc()
+
+	if ro.Store == nil {
+		ro.processedDeleteFailures.Inc()
+		return fmt.Errorf("%w: role store is not initialized", ErrUnavailable)
+	}
+
+	id, err := handlers.GetUUIDFromPathValue(r, "id")
+	if err != nil {
+		ro.processedDeleteFailures.Inc()
+		return err
+	}
+
+	err = ro.Store.Delete(ctx, id, role.Version)
+	if err != nil {
+		ro.processedDeleteFailures.Inc()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
+)
+
+// MockRoleStore implements RoleStore interface for testing
+type MockRoleStore struct {
+	roles       map[uuid.UUID]*Role
+	shouldError bool
+}
+
+func NewMockRoleStore(roles ...Role) *MockRoleStore {
+	m := &MockRoleStore{
+		roles: make(map[uuid.UUID]*Role),
+	}
+	for _, role := range roles {
+		m.roles[role.ID] = &role
+	}
+	return m
+}
+
+func (m *MockRoleStore) SetError(shouldError bool) {
+	m.shouldError = shouldError
+}
+
+func (m *MockRoleStore) Create(ctx context.Context, role *Role) error {
+	if m.shouldError {
+		return errors.New("mock error")
+	}
+	m.roles[role.ID] = role
+	return nil
+}
+
+func (m *MockRoleStore) Get(ctx context.Context, id uuid.UUID) (*Role, error) {
+	if m.shouldError {
+		return nil, errors.New("mock error")
+	}
+	role, exists := m.roles[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return role, nil
+}
+
+func (m *MockRoleStore) Update(ctx context.Context, role *Role) error {
+	if m.shouldError {
+		return errors.New("mock error")
+	}
+	m.roles[role.ID] = role
+	return nil
+}
+
+func (m *MockRoleStore) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	if m.shouldError {
+		return errors.New("mock error")
+	}
+	delete(m.roles, id)
+	return nil
+}
+
+func (m *MockRoleStore) List(ctx context.Context, opts ListOptions) ([]Role, int, error) {
+	if m.shouldError {
+		return nil, 0, errors.New("mock error")
+	}
+	roles := make([]Role, 0, len(m.roles))
+	for _, role := range m.roles {
+		roles = append(roles, *role)
+	}
+	return roles, len(roles), nil
+}
+
+func TestRole_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    Role
+		wantErr bool
+	}{
+		{name: "valid", role: Role{Name: "support", Permissions: []string{PermissionCheckoutsRead}}},
+		{name: "without permissions", role: Role{Name: "nobody"}},
+		{name: "missing name", role: Role{Permissions: []string{PermissionCheckoutsRead}}, wantErr: true},
+		{name: "unknown permission", role: Role{Name: "support", Permissions: []string{"checkouts:delete"}}, wantErr: true},
+		{name: "duplicate permission", role: Role{Name: "support", Permissions: []string{PermissionCartsRead, PermissionCartsRead}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.role.Validate(validation.Create)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrValidation) {
+				t.Errorf("Expected error wrapping %v, got %v", ErrValidation, err)
+			}
+		})
+	}
+}
+
+func TestResolvePermissions(t *testing.T) {
+	store := NewMockRoleStore(
+		Role{ID: uuid.New(), Name: "catalog-manager", Permissions: []string{PermissionItemsWrite}},
+		Role{ID: uuid.New(), Name: "support", Permissions: []string{PermissionUsersRead, PermissionCheckoutsRead}},
+		Role{ID: uuid.New(), Name: "auditor", Permissions: []string{PermissionCheckoutsRead, PermissionCartsRead}},
+	)
+
+	permissions, err := ResolvePermissions(context.Background(), store, []string{"support", "auditor", "deleted"})
+	if err != nil {
+		t.Fatalf("ResolvePermissions failed: %v", err)
+	}
+	want := []string{PermissionCartsRead, PermissionCheckoutsRead, PermissionUsersRead}
+	if !slices.Equal(permissions, want) {
+		t.Errorf("Expected permissions %v, got %v", want, permissions)
+	}
+
+	permissions, err = ResolvePermissions(context.Background(), store, nil)
+	if err != nil || len(permissions) != 0 {
+		t.Errorf("Expected no permissions without roles, got %v, %v", permissions, err)
+	}
+
+	store.SetError(true)
+	if _, err := ResolvePermissions(context.Background(), store, []string{"support"}); err == nil {
+		t.Error("Expected error if the roles cannot be listed")
+	}
+}
+
+func TestRoleRouter_RequiredPermissions(t *testing.T) {
+	serverURL := newServiceServer(t, NewRoleRouter(NewMockRoleStore()))
+
+	tests := []struct {
+		name           string
+		method         string
+		identity       *router.Identity
+		expectedStatus int
+	}{
+		{name: "list without identity", method: http.MethodGet, expectedStatus: http.StatusUnauthorized},
+		{name: "list without permission", method: http.MethodGet, identity: &router.Identity{UserID: uuid.New()}, expectedStatus: http.StatusForbidden},
+		{name: "list with permission", method: http.MethodGet, identity: &router.Identity{UserID: uuid.New(), Permissions: []string{PermissionRolesRead}}, expectedStatus: http.StatusOK},
+		{name: "create with read permission", method: http.MethodPost, identity: &router.Identity{UserID: uuid.New(), Permissions: []string{PermissionRolesRead}}, expectedStatus: http.StatusForbidden},
+		{name: "create with write permission", method: http.MethodPost, identity: &router.Identity{UserID: uuid.New(), Permissions: []string{PermissionRolesWrite}}, expectedStatus: http.StatusCreated},
+		{name: "create as admin", method: http.MethodPost, identity: &router.Identity{UserID: uuid.New(), IsAdmin: true}, expectedStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, serverURL+"/api/v1/core/roles", strings.NewReader(`{"name":"support","permissions":["checkouts:read"]}`))
+			req.RequestURI = ""
+			req.Header.Set("Content-Type", "application/json")
+			if tt.identity != nil {
+				token, err := identityTokens.Sign(tt.identity)
+				if err != nil {
+					t.Fatalf("Failed to sign identity: %v", err)
+				}
+				req.Header.Set(router.HeaderIdentityToken, token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"context"
+	"crypto/rand"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+// Session is a login session kept by the gateway. The session cookie only holds the
+// encrypted ID, everything else is looked up in the SessionStore on every request.
+type Session struct {
+	ID       string    `json:"id"`
+	UserID   uuid.UUID `json:"user_id"`
+	CartID   uuid.UUID `json:"cart_id"`
+	Username string    `json:"username"`
+	IsAdmin  bool      `json:"is_admin"`
+	// Roles and Permissions are taken from the user on login, changes apply to new sessions only
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// UserAgent is the User-Agent of the login request, it helps users to recognize their sessions
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// ExpiresAt is moved forward on activity, the session ends if it is not used until then
+	ExpiresAt time.Time `json:"expires_at"`
+	// Current is set in listings for the session of the requesting client, it is not stored
+	Current bool `json:"current,omitempty"`
+}
+
+// Expired reports whether the session has expired at the given time.
+func (s Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// Can reports whether the session holds the permission, admins hold all permissions.
+// A nil session holds none.
+func (s *Session) Can(permission string) bool {
+	return s != nil && (s.IsAdmin || slices.Contains(s.Permissions, permission))
+}
+
+// Identity returns the identity the gateway passes on to the upstream services
+func (s *Session) Identity() *router.Identity {
+	return &router.Identity{
+		UserID:      s.UserID,
+		Username:    s.Username,
+		CartID:      s.CartID,
+		IsAdmin:     s.IsAdmin,
+		Permissions: s.Permissions,
+	}
+}
+
+// NewSessionID returns a random session ID with at least 128 bits of entropy.
+func NewSessionID() string {
+	return rand.Text()
+}
+
+// SessionStore interface for session operations.
+// Expired sessions are treated as if they did not exist.
+type SessionStore interface {
+	// Create stores a new session, it fails with ErrAlreadyExists if the ID is taken.
+	Create(ctx context.Context, session *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	// Touch records activity on the session and moves its expiry to expiresAt.
+	Touch(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error
+	// ListByUser returns the sessions of a user ordered by creation time.
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]Session, error)
+	// Delete revokes a single session.
+	Delete(ctx context.Context, id string) error
+	// DeleteByUser revokes all sessions of a user and returns how many have been revoked.
+	DeleteByUser(ctx context.Context, userID uuid.UUID) (int, error)
+}
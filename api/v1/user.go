@@ -2,13 +2,16 @@ package v1
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
+	"github.com/leonsteinhaeuser/demo-shop/internal/password"
 	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -17,6 +20,7 @@ type User struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"`
 
 	Username      *string `json:"username"`
 	Email         *string `json:"email"`
@@ -27,7 +31,17 @@ type User struct {
 	FamilyName    *string `json:"family_name,omitempty"`
 	Locale        *string `json:"locale,omitempty"`
 
+	// Issuer and Subject link the user to an account at an OpenID Connect provider.
+	// Only user administrators can change them, see UserRouter.checkLink.
+	Issuer  *string `json:"issuer,omitempty"`
+	Subject *string `json:"subject,omitempty"`
+
 	IsAdmin bool `json:"is_admin"`
+	// Roles are the names of the roles assigned to the user
+	Roles []string `json:"roles,omitempty"`
+	// Permissions are granted by the roles of the user. They are resolved by the user service
+	// when the user is read and never stored.
+	Permissions []string `json:"permissions,omitempty"`
 }
 
 type UserModificationRequest struct {
@@ -35,33 +49,96 @@ type UserModificationRequest struct {
 	Password *string `json:"password,omitempty"`
 }
 
+// minPasswordLength is the minimum number of characters of a password
+const minPasswordLength = 12
+
+// Validate implements validation.Validatable.
+// The password is only required for new users, on updates it is kept if omitted.
+func (u UserModificationRequest) Validate(op validation.Operation) error {
+	var v validation.Violations
+	if op == validation.Create {
+		v.Required("username", u.Username)
+		v.Required("email", u.Email)
+		v.Required("password", u.Password)
+	} else {
+		v.NotEmptyIfSet("username", u.Username)
+		v.NotEmptyIfSet("email", u.Email)
+		v.NotEmptyIfSet("password", u.Password)
+	}
+	v.MinLength("password", u.Password, minPasswordLength)
+	v.Check(u.Password == nil || len(*u.Password) <= password.MaxLength, "password", fmt.Sprintf("must not be longer than %d bytes", password.MaxLength))
+	v.NotEmptyIfSet("preferred_name", u.PreferredName)
+	v.NotEmptyIfSet("given_name", u.GivenName)
+	v.NotEmptyIfSet("family_name", u.FamilyName)
+	v.NotEmptyIfSet("locale", u.Locale)
+	v.NotEmptyIfSet("issuer", u.Issuer)
+	v.NotEmptyIfSet("subject", u.Subject)
+	v.Check((u.Issuer == nil) == (u.Subject == nil), "subject", "must be set together with the issuer")
+	for i, role := range u.Roles {
+		field := fmt.Sprintf("roles.%d", i)
+		v.NotEmpty(field, role)
+		v.Check(!slices.Contains(u.Roles[:i], role), field, "is listed more than once")
+	}
+	return v.Err()
+}
+
 // UserStore interface for user operations
 type UserStore interface {
 	Create(ctx context.Context, item *UserModificationRequest) error
-	List(ctx context.Context, page, limit int) ([]User, error)
+	// List returns the requested page of users and the total number of users.
+	List(ctx context.Context, opts ListOptions) ([]User, int, error)
 	Get(ctx context.Context, id uuid.UUID) (*User, error)
+	// GetBySubject returns the user linked to the subject of an OpenID Connect provider,
+	// or an error wrapping ErrNotFound if no user is linked to it.
+	GetBySubject(ctx context.Context, issuer, subject string) (*User, error)
+	// Update replaces the object and increments its version, a non-zero version must match the stored one.
 	Update(ctx context.Context, item *UserModificationRequest) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	// Delete deletes the object if its version matches, a version of 0 deletes it unconditionally.
+	Delete(ctx context.Context, id uuid.UUID, version int64) error
+	// ValidateCredentials returns the user if the password matches the stored hash.
+	// Unknown usernames and wrong passwords both result in an error wrapping ErrUnauthorized.
+	ValidateCredentials(ctx context.Context, username, password string) (*User, error)
 }
 
 // UserRouter implements the API router for user endpoints
 type UserRouter struct {
-	UserStore               UserStore
-	processedCreateRequests prometheus.Counter
-	processedCreateFailures prometheus.Counter
-	processedListRequests   prometheus.Counter
-	processedListFailures   prometheus.Counter
-	processedGetRequests    prometheus.Counter
-	processedGetFailures    prometheus.Counter
-	processedUpdateRequests prometheus.Counter
-	processedUpdateFailures prometheus.Counter
-	processedDeleteRequests prometheus.Counter
-	processedDeleteFailures prometheus.Counter
+	UserStore UserStore
+	// RoleStore resolves the permissions of users and checks the roles assigned to them
+	RoleStore RoleStore
+	// APIKeyStore keeps the API keys of the users
+	APIKeyStore                APIKeyStore
+	processedCreateRequests    prometheus.Counter
+	processedCreateFailures    prometheus.Counter
+	processedListRequests      prometheus.Counter
+	processedListFailures      prometheus.Counter
+	processedGetRequests       prometheus.Counter
+	processedGetFailures       prometheus.Counter
+	processedUpdateRequests    prometheus.Counter
+	processedUpdateFailures    prometheus.Counter
+	processedDeleteRequests    prometheus.Counter
+	processedDeleteFailures    prometheus.Counter
+	processedValidateRequests  prometheus.Counter
+	processedValidateFailures  prometheus.Counter
+	processedLookupRequests    prometheus.Counter
+	processedLookupFailures    prometheus.Counter
+	processedProvisionRequests prometheus.Counter
+	processedProvisionFailures prometheus.Counter
+
+	processedAPIKeyCreateRequests   prometheus.Counter
+	processedAPIKeyCreateFailures   prometheus.Counter
+	processedAPIKeyListRequests     prometheus.Counter
+	processedAPIKeyListFailures     prometheus.Counter
+	processedAPIKeyRevokeRequests   prometheus.Counter
+	processedAPIKeyRevokeFailures   prometheus.Counter
+	processedAPIKeyValidateRequests prometheus.Counter
+	processedAPIKeyValidateFailures prometheus.Counter
 }
 
-func NewUserRouter(userStore UserStore) *UserRouter {
+func NewUserRouter(userStore UserStore, roleStore RoleStore, apiKeyStore APIKeyStore) *UserRouter {
 	return &UserRouter{
-		UserStore: userStore,
+		UserStore:   userStore,
+		RoleStore:   roleStore,
+		APIKeyStore: apiKeyStore,
 		processedCreateRequests: prometheus.NewCounter(
 			prometheus.CounterOpts{
 				Name: "user_create_processed_requests_total",
@@ -122,6 +199,90 @@ func NewUserRouter(userStore UserStore) *UserRouter {
 				Help: "Total number of user delete request failures",
 			},
 		),
+		processedValidateRequests: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_validate_processed_requests_total",
+				Help: "Total number of user credential validation requests",
+			},
+		),
+		processedValidateFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_validate_processed_failures_total",
+				Help: "Total number of user credential validation request failures",
+			},
+		),
+		processedLookupRequests: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_lookup_processed_requests_total",
+				Help: "Total number of user lookup requests",
+			},
+		),
+		processedLookupFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_lookup_processed_failures_total",
+				Help: "Total number of user lookup request failures",
+			},
+		),
+		processedProvisionRequests: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_provision_processed_requests_total",
+				Help: "Total number of user provisioning requests",
+			},
+		),
+		processedProvisionFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_provision_processed_failures_total",
+				Help: "Total number of user provisioning request failures",
+			},
+		),
+		processedAPIKeyCreateRequests: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_apikey_create_processed_requests_total",
+				Help: "Total number of API key create requests",
+			},
+		),
+		processedAPIKeyCreateFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_apikey_create_processed_failures_total",
+				Help: "Total number of API key create request failures",
+			},
+		),
+		processedAPIKeyListRequests: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_apikey_list_processed_requests_total",
+				Help: "Total number of API key list requests",
+			},
+		),
+		processedAPIKeyListFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_apikey_list_processed_failures_total",
+				Help: "Total number of API key list request failures",
+			},
+		),
+		processedAPIKeyRevokeRequests: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_apikey_revoke_processed_requests_total",
+				Help: "Total number of API key revoke requests",
+			},
+		),
+		processedAPIKeyRevokeFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_apikey_revoke_processed_failures_total",
+				Help: "Total number of API key revoke request failures",
+			},
+		),
+		processedAPIKeyValidateRequests: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_apikey_validate_processed_requests_total",
+				Help: "Total number of API key validation requests",
+			},
+		),
+		processedAPIKeyValidateFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "user_apikey_validate_processed_failures_total",
+				Help: "Total number of API key validation request failures",
+			},
+		),
 	}
 }
 
@@ -138,31 +299,20 @@ func (u *UserRouter) GetKind() string {
 }
 
 func (u *UserRouter) Routes() []router.PathObject {
-	return []router.PathObject{
-		{
-			Method: "POST",
-			Func:   handlers.HttpPost(u.createUser),
-		},
-		{
-			Method: "GET",
-			Func:   handlers.HttpList(u.listUsers),
-		},
-		{
-			Path:   "/{id}",
-			Method: "GET",
-			Func:   handlers.HttpGet(u.getUser),
-		},
-		{
-			Path:   "/{id}",
-			Method: "PUT",
-			Func:   handlers.HttpUpdate(u.updateUser),
-		},
-		{
-			Path:   "/{id}",
-			Method: "DELETE",
-			Func:   handlers.HttpDelete(u.deleteUser),
-		},
-	}
+	return append([]router.PathObject{
+		// registration and the profile of a user are open to requests passed on by the gateway,
+		// which restricts them to the user itself
+		handlers.Post("", u.createUser).WithCaller(router.CallerVerified),
+		handlers.List("", u.listUsers).WithPermission(PermissionUsersRead),
+		handlers.Get("/{id}", u.getUser).WithCaller(router.CallerVerified),
+		handlers.Update("/{id}", u.updateUser).WithCaller(router.CallerVerified),
+		handlers.Patch("/{id}", u.getUserModificationRequest, u.updateUser).WithCaller(router.CallerVerified),
+		handlers.Delete("/{id}", u.deleteUser).WithPermission(PermissionUsersWrite),
+		// logins are verified by the gateway itself
+		handlers.Action("/validate", "Validate user credentials", u.validateCredentials).WithCaller(router.CallerService),
+		handlers.Action("/lookup", "Look up the user linked to an identity provider account", u.lookupUser).WithCaller(router.CallerService),
+		handlers.Action("/provision", "Provision the user logging in with an identity provider", u.provisionUser).WithCaller(router.CallerService),
+	}, u.apiKeyRoutes()...)
 }
 
 // UserValidationRequest represents a request to validate user credentials
@@ -171,6 +321,15 @@ type UserValidationRequest struct {
 	Password string `json:"password"`
 }
 
+// Validate implements validation.Validatable.
+// The length of the password is not checked, passwords set before the rules were introduced remain valid.
+func (u UserValidationRequest) Validate(op validation.Operation) error {
+	var v validation.Violations
+	v.NotEmpty("username", u.Username)
+	v.NotEmpty("password", u.Password)
+	return v.Err()
+}
+
 func (u *UserRouter) createUser(ctx context.Context, r *http.Request, user *UserModificationRequest) error {
 	u.processedCreateRequests.Inc()
 
@@ -184,48 +343,44 @@ func (u *UserRouter) createUser(ctx context.Context, r *http.Request, user *User
 	}
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = user.CreatedAt
-
-	if user.Password == nil || *user.Password == "" {
+	if err := u.checkRoles(ctx, user.Roles); err != nil {
 		u.processedCreateFailures.Inc()
-		return errors.New("password is required")
-	}
-	// ensure password meets security requirements (e.g., length, complexity) here if needed
-	// For simplicity, let's say it must be at least 12 characters long
-	if len(*user.Password) < 12 {
-		u.processedCreateFailures.Inc()
-		return errors.New("password must be at least 12 characters long")
+		return err
 	}
-	if user.Username == nil || *user.Username == "" {
+	if err := u.checkLink(ctx, nil, user); err != nil {
 		u.processedCreateFailures.Inc()
-		return errors.New("username cannot be empty")
+		return err
 	}
-	if user.Email == nil || *user.Email == "" {
+	if err := u.checkPrivileges(ctx, nil, user); err != nil {
 		u.processedCreateFailures.Inc()
-		return errors.New("email cannot be empty")
+		return err
 	}
+	user.Permissions = nil
 
 	err := u.UserStore.Create(ctx, user)
 	if err != nil {
 		u.processedCreateFailures.Inc()
 		return err
 	}
+	// the password is never returned
+	user.Password = nil
 	return nil
 }
 
-func (u *UserRouter) listUsers(ctx context.Context, r *http.Request, filters handlers.FilterObjectList) ([]User, error) {
+func (u *UserRouter) listUsers(ctx context.Context, r *http.Request, filters handlers.FilterObjectList) ([]User, int, error) {
 	u.processedListRequests.Inc()
 
 	if u.UserStore == nil {
 		u.processedListFailures.Inc()
-		return nil, router.ErrObjectStorageNotImplemented
+		return nil, 0, router.ErrObjectStorageNotImplemented
 	}
 
-	users, err := u.UserStore.List(ctx, filters.Page, filters.Limit)
+	users, total, err := u.UserStore.List(ctx, filters)
 	if err != nil {
 		u.processedListFailures.Inc()
-		return nil, err
+		return nil, 0, err
 	}
-	return users, nil
+	return users, total, nil
 }
 
 func (u *UserRouter) getUser(ctx context.Context, r *http.Request) (*User, error) {
@@ -241,15 +396,118 @@ func (u *UserRouter) getUser(ctx context.Context, r *http.Request) (*User, error
 		u.processedGetFailures.Inc()
 		return nil, err
 	}
+	if err := checkOwner(ctx, "user", id, PermissionUsersRead); err != nil {
+		u.processedGetFailures.Inc()
+		return nil, err
+	}
 
 	user, err := u.UserStore.Get(ctx, id)
 	if err != nil {
 		u.processedGetFailures.Inc()
 		return nil, err
 	}
+	if err := u.resolvePermissions(ctx, user); err != nil {
+		u.processedGetFailures.Inc()
+		return nil, err
+	}
 	return user, nil
 }
 
+// resolvePermissions sets the permissions granted by the roles of the user
+func (u *UserRouter) resolvePermissions(ctx context.Context, user *User) error {
+	if u.RoleStore == nil || user == nil {
+		return nil
+	}
+	permissions, err := ResolvePermissions(ctx, u.RoleStore, user.Roles)
+	if err != nil {
+		return err
+	}
+	user.Permissions = permissions
+	return nil
+}
+
+// checkRoles rejects the assignment of roles that do not exist
+func (u *UserRouter) checkRoles(ctx context.Context, roles []string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	if u.RoleStore == nil {
+		return fmt.Errorf("%w: role store is not initialized", ErrUnavailable)
+	}
+	existing, _, err := u.RoleStore.List(ctx, ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list roles: %w", err)
+	}
+	var violations []Violation
+	for i, role := range roles {
+		if !slices.ContainsFunc(existing, func(r Role) bool { return r.Name == role }) {
+			violations = append(violations, Violation{Field: fmt.Sprintf("roles.%d", i), Message: "is not a known role"})
+		}
+	}
+	if len(violations) > 0 {
+		return NewValidationError(violations...)
+	}
+	return nil
+}
+
+// checkLink rejects changes of the identity provider account a user is linked to unless they
+// are made by a user administrator. Otherwise users could link their account to a foreign
+// identity provider account, or register one in advance, and log in as its owner.
+// existing is nil for new users.
+func (u *UserRouter) checkLink(ctx context.Context, existing *User, user *UserModificationRequest) error {
+	if identity := router.IdentityFromContext(ctx); identity != nil && identity.Can(PermissionUsersWrite) {
+		return nil
+	}
+	var issuer, subject *string
+	if existing != nil {
+		issuer, subject = existing.Issuer, existing.Subject
+	}
+	if !equalStringPtr(issuer, user.Issuer) || !equalStringPtr(subject, user.Subject) {
+		return fmt.Errorf("%w: changing the linked identity provider account requires the %s permission", ErrForbidden, PermissionUsersWrite)
+	}
+	return nil
+}
+
+// checkPrivileges rejects granting admin privileges or roles unless it is done by a user
+// administrator, giving them up is fine. The caller is identified by the identity of the
+// request, so the check also holds for requests not passing the gateway.
+// existing is nil for new users.
+func (u *UserRouter) checkPrivileges(ctx context.Context, existing *User, user *UserModificationRequest) error {
+	if identity := router.IdentityFromContext(ctx); identity != nil && identity.Can(PermissionUsersWrite) {
+		return nil
+	}
+	if existing == nil {
+		existing = &User{}
+	}
+	if user.IsAdmin && !existing.IsAdmin {
+		return fmt.Errorf("%w: granting admin privileges requires the %s permission", ErrForbidden, PermissionUsersWrite)
+	}
+	for _, role := range user.Roles {
+		if !slices.Contains(existing.Roles, role) {
+			return fmt.Errorf("%w: assigning roles requires the %s permission", ErrForbidden, PermissionUsersWrite)
+		}
+	}
+	return nil
+}
+
+// equalStringPtr reports whether both strings are unset or have the same value
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// getUserModificationRequest returns the user addressed by the path as base for patches.
+// The password is not part of it and only changed if the patch sets one.
+func (u *UserRouter) getUserModificationRequest(ctx context.Context, r *http.Request) (*UserModificationRequest, error) {
+	user, err := u.getUser(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return &UserModificationRequest{User: *user}, nil
+}
+
 func (u *UserRouter) updateUser(ctx context.Context, r *http.Request, user *UserModificationRequest) error {
 	u.processedUpdateRequests.Inc()
 
@@ -265,54 +523,39 @@ func (u *UserRouter) updateUser(ctx context.Context, r *http.Request, user *User
 	}
 	if user.ID != id {
 		u.processedUpdateFailures.Inc()
-		return errors.New("ID in path does not match user ID")
+		return NewValidationError(Violation{Field: "id", Message: "does not match the ID in the path"})
 	}
-
-	user.UpdatedAt = time.Now()
-
-	// if the password is not provided, we do not update it
-	if user.Password != nil {
-		if *user.Password == "" {
-			u.processedUpdateFailures.Inc()
-			return errors.New("password is required")
-		}
-		if len(*user.Password) < 12 {
-			u.processedUpdateFailures.Inc()
-			return errors.New("password must be at least 12 characters long")
-		}
-
-	}
-
-	if user.Username != nil && *user.Username == "" {
-		u.processedUpdateFailures.Inc()
-		return errors.New("username cannot be empty")
-	}
-	if user.Email != nil && *user.Email == "" {
+	if err := checkOwner(ctx, "user", id, PermissionUsersWrite); err != nil {
 		u.processedUpdateFailures.Inc()
-		return errors.New("email cannot be empty")
+		return err
 	}
-	if user.PreferredName != nil && *user.PreferredName == "" {
+
+	user.UpdatedAt = time.Now()
+	if err := u.checkRoles(ctx, user.Roles); err != nil {
 		u.processedUpdateFailures.Inc()
-		return errors.New("preferred_name cannot be empty")
+		return err
 	}
-	if user.GivenName != nil && *user.GivenName == "" {
+	existing, err := u.UserStore.Get(ctx, id)
+	if err != nil {
 		u.processedUpdateFailures.Inc()
-		return errors.New("given_name cannot be empty")
+		return err
 	}
-	if user.FamilyName != nil && *user.FamilyName == "" {
+	if err := u.checkLink(ctx, existing, user); err != nil {
 		u.processedUpdateFailures.Inc()
-		return errors.New("family_name cannot be empty")
+		return err
 	}
-	if user.Locale != nil && *user.Locale == "" {
+	if err := u.checkPrivileges(ctx, existing, user); err != nil {
 		u.processedUpdateFailures.Inc()
-		return errors.New("locale cannot be empty")
+		return err
 	}
+	user.Permissions = nil
 
 	err = u.UserStore.Update(ctx, user)
 	if err != nil {
 		u.processedUpdateFailures.Inc()
 		return err
 	}
+	user.Password = nil
 	return nil
 }
 
@@ -330,7 +573,7 @@ func (u *UserRouter) deleteUser(ctx context.Context, r *http.Request, deleteReq
 		return err
 	}
 
-	err = u.UserStore.Delete(ctx, id)
+	err = u.UserStore.Delete(ctx, id, deleteReq.Version)
 	if err != nil {
 		u.processedDeleteFailures.Inc()
 		return err
@@ -338,7 +581,89 @@ func (u *UserRouter) deleteUser(ctx context.Context, r *http.Request, deleteReq
 	return nil
 }
 
+// validateCredentials returns the user matching the credentials. The endpoint is meant for
+// the gateway and not exposed through it.
+func (u *UserRouter) validateCredentials(ctx context.Context, r *http.Request, req *UserValidationRequest) (*User, error) {
+	u.processedValidateRequests.Inc()
+
+	if u.UserStore == nil {
+		u.processedValidateFailures.Inc()
+		return nil, router.ErrObjectStorageNotImplemented
+	}
+
+	user, err := u.UserStore.ValidateCredentials(ctx, req.Username, req.Password)
+	if err != nil {
+		u.processedValidateFailures.Inc()
+		return nil, err
+	}
+	if err := u.resolvePermissions(ctx, user); err != nil {
+		u.processedValidateFailures.Inc()
+		return nil, err
+	}
+	return user, nil
+}
+
+// UserLookupRequest represents a request for the user linked to an identity provider account
+type UserLookupRequest struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
+// Validate implements validation.Validatable.
+func (u UserLookupRequest) Validate(op validation.Operation) error {
+	var v validation.Violations
+	v.NotEmpty("issuer", u.Issuer)
+	v.NotEmpty("subject", u.Subject)
+	return v.Err()
+}
+
+// lookupUser returns the user linked to an identity provider account. The endpoint is meant
+// for the gateway and not exposed through it.
+func (u *UserRouter) lookupUser(ctx context.Context, r *http.Request, req *UserLookupRequest) (*User, error) {
+	u.processedLookupRequests.Inc()
+
+	if u.UserStore == nil {
+		u.processedLookupFailures.Inc()
+		return nil, router.ErrObjectStorageNotImplemented
+	}
+
+	user, err := u.UserStore.GetBySubject(ctx, req.Issuer, req.Subject)
+	if err != nil {
+		u.processedLookupFailures.Inc()
+		return nil, err
+	}
+	if err := u.resolvePermissions(ctx, user); err != nil {
+		u.processedLookupFailures.Inc()
+		return nil, err
+	}
+	return user, nil
+}
+
+// provisionUser returns the user linked to the identity provider account, creating it on the
+// first login. The endpoint is meant for the gateway and not exposed through it.
+func (u *UserRouter) provisionUser(ctx context.Context, r *http.Request, identity *FederatedIdentity) (*User, error) {
+	u.processedProvisionRequests.Inc()
+
+	if u.UserStore == nil {
+		u.processedProvisionFailures.Inc()
+		return nil, router.ErrObjectStorageNotImplemented
+	}
+
+	user, err := ProvisionUser(ctx, u.UserStore, identity)
+	if err != nil {
+		u.processedProvisionFailures.Inc()
+		return nil, err
+	}
+	if err := u.resolvePermissions(ctx, user); err != nil {
+		u.processedProvisionFailures.Inc()
+		return nil, err
+	}
+	return user, nil
+}
+
 // UserDeleteRequest represents a request to delete a user (can be empty for path-based deletion)
 type UserDeleteRequest struct {
 	ID uuid.UUID `json:"id,omitempty"`
+	// Version is the expected version of the user, 0 deletes it unconditionally
+	Version int64 `json:"version,omitempty"`
 }
@@ -2,13 +2,17 @@ package v1
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/leonsteinhaeuser/demo-shop/internal/handlers"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
 )
 
 // Test constants
@@ -20,14 +24,16 @@ const (
 
 // MockUserStore implements UserStore interface for testing
 type MockUserStore struct {
-	users  map[uuid.UUID]*User
-	fail   bool
-	failOn string
+	users     map[uuid.UUID]*User
+	passwords map[uuid.UUID]string
+	fail      bool
+	failOn    string
 }
 
 func NewMockUserStore() *MockUserStore {
 	return &MockUserStore{
-		users: make(map[uuid.UUID]*User),
+		users:     make(map[uuid.UUID]*User),
+		passwords: make(map[uuid.UUID]string),
 	}
 }
 
@@ -40,6 +46,11 @@ func (m *MockUserStore) Create(ctx context.Context, user *UserModificationReques
 	if m.fail && m.failOn == "create" {
 		return errors.New("mock create error")
 	}
+	for _, existing := range m.users {
+		if existing.Username != nil && user.Username != nil && *existing.Username == *user.Username {
+			return ErrAlreadyExists
+		}
+	}
 	userObj := &User{
 		ID:            user.ID,
 		CreatedAt:     user.CreatedAt,
@@ -51,21 +62,27 @@ func (m *MockUserStore) Create(ctx context.Context, user *UserModificationReques
 		GivenName:     user.GivenName,
 		FamilyName:    user.FamilyName,
 		Locale:        user.Locale,
+		Issuer:        user.Issuer,
+		Subject:       user.Subject,
 		IsAdmin:       user.IsAdmin,
+		Roles:         user.Roles,
 	}
 	m.users[user.ID] = userObj
+	if user.Password != nil {
+		m.passwords[user.ID] = *user.Password
+	}
 	return nil
 }
 
-func (m *MockUserStore) List(ctx context.Context, page, limit int) ([]User, error) {
+func (m *MockUserStore) List(ctx context.Context, opts ListOptions) ([]User, int, error) {
 	if m.fail && m.failOn == "list" {
-		return nil, errors.New("mock list error")
+		return nil, 0, errors.New("mock list error")
 	}
 	users := make([]User, 0, len(m.users))
 	for _, user := range m.users {
 		users = append(users, *user)
 	}
-	return users, nil
+	return users, len(users), nil
 }
 
 func (m *MockUserStore) Get(ctx context.Context, id uuid.UUID) (*User, error) {
@@ -79,6 +96,18 @@ func (m *MockUserStore) Get(ctx context.Context, id uuid.UUID) (*User, error) {
 	return user, nil
 }
 
+func (m *MockUserStore) GetBySubject(ctx context.Context, issuer, subject string) (*User, error) {
+	if m.fail && m.failOn == "get" {
+		return nil, errors.New("mock get error")
+	}
+	for _, user := range m.users {
+		if user.Issuer != nil && *user.Issuer == issuer && user.Subject != nil && *user.Subject == subject {
+			return user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
 func (m *MockUserStore) Update(ctx context.Context, user *UserModificationRequest) error {
 	if m.fail && m.failOn == "update" {
 		return errors.New("mock update error")
@@ -96,7 +125,7 @@ func (m *MockUserStore) Update(ctx context.Context, user *UserModificationReques
 	return nil
 }
 
-func (m *MockUserStore) Delete(ctx context.Context, id uuid.UUID) error {
+func (m *MockUserStore) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	if m.fail && m.failOn == "delete" {
 		return errors.New("mock delete error")
 	}
@@ -104,9 +133,21 @@ func (m *MockUserStore) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+func (m *MockUserStore) ValidateCredentials(ctx context.Context, username, password string) (*User, error) {
+	if m.fail && m.failOn == "validate" {
+		return nil, errors.New("mock validate error")
+	}
+	for id, user := range m.users {
+		if user.Username != nil && *user.Username == username && m.passwords[id] == password {
+			return user, nil
+		}
+	}
+	return nil, ErrUnauthorized
+}
+
 func TestNewUserRouter(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	if router == nil {
 		t.Fatal("Expected router to be created")
@@ -118,21 +159,21 @@ func TestNewUserRouter(t *testing.T) {
 }
 
 func TestUserRouter_GetApiVersion(t *testing.T) {
-	router := NewUserRouter(NewMockUserStore())
+	router := NewUserRouter(NewMockUserStore(), NewMockRoleStore(), NewMockAPIKeyStore())
 	if router.GetApiVersion() != "v1" {
 		t.Errorf("Expected API version v1, got %s", router.GetApiVersion())
 	}
 }
 
 func TestUserRouter_GetGroup(t *testing.T) {
-	router := NewUserRouter(NewMockUserStore())
+	router := NewUserRouter(NewMockUserStore(), NewMockRoleStore(), NewMockAPIKeyStore())
 	if router.GetGroup() != "core" {
 		t.Errorf("Expected group core, got %s", router.GetGroup())
 	}
 }
 
 func TestUserRouter_GetKind(t *testing.T) {
-	router := NewUserRouter(NewMockUserStore())
+	router := NewUserRouter(NewMockUserStore(), NewMockRoleStore(), NewMockAPIKeyStore())
 	if router.GetKind() != "users" {
 		t.Errorf("Expected kind users, got %s", router.GetKind())
 	}
@@ -140,7 +181,7 @@ func TestUserRouter_GetKind(t *testing.T) {
 
 func TestUserRouter_createUser_Success(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	password := testPassword
 	username := testUsername
@@ -179,7 +220,7 @@ func TestUserRouter_createUser_Success(t *testing.T) {
 
 func TestUserRouter_createUser_ShortPassword(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	password := "short" // Too short password
 	username := testUsername
@@ -194,17 +235,16 @@ func TestUserRouter_createUser_ShortPassword(t *testing.T) {
 		Password: &password,
 	}
 
-	req := httptest.NewRequest("POST", "/api/v1/core/users", nil)
-	err := router.createUser(context.Background(), req, user)
+	rec := serveJSON(t, handlers.HttpPost(router.createUser), "POST", "/api/v1/core/users", user)
 
-	if err == nil {
-		t.Error("Expected error for short password")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for short password, got %d", rec.Code)
 	}
 }
 
 func TestUserRouter_createUser_EmptyUsername(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	password := testPassword
 	username := ""
@@ -219,17 +259,16 @@ func TestUserRouter_createUser_EmptyUsername(t *testing.T) {
 		Password: &password,
 	}
 
-	req := httptest.NewRequest("POST", "/api/v1/core/users", nil)
-	err := router.createUser(context.Background(), req, user)
+	rec := serveJSON(t, handlers.HttpPost(router.createUser), "POST", "/api/v1/core/users", user)
 
-	if err == nil {
-		t.Error("Expected error for empty username")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for empty username, got %d", rec.Code)
 	}
 }
 
 func TestUserRouter_createUser_EmptyEmail(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	password := testPassword
 	username := testUsername
@@ -244,17 +283,16 @@ func TestUserRouter_createUser_EmptyEmail(t *testing.T) {
 		Password: &password,
 	}
 
-	req := httptest.NewRequest("POST", "/api/v1/core/users", nil)
-	err := router.createUser(context.Background(), req, user)
+	rec := serveJSON(t, handlers.HttpPost(router.createUser), "POST", "/api/v1/core/users", user)
 
-	if err == nil {
-		t.Error("Expected error for empty email")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for empty email, got %d", rec.Code)
 	}
 }
 
 func TestUserRouter_listUsers_Success(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	// Add some test users
 	username1 := "user1"
@@ -270,7 +308,7 @@ func TestUserRouter_listUsers_Success(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/core/users", nil)
 	filters := handlers.FilterObjectList{Page: 1, Limit: 10}
 
-	users, err := router.listUsers(context.Background(), req, filters)
+	users, total, err := router.listUsers(context.Background(), req, filters)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -279,11 +317,14 @@ func TestUserRouter_listUsers_Success(t *testing.T) {
 	if len(users) != 2 {
 		t.Errorf("Expected 2 users, got %d", len(users))
 	}
+	if total != 2 {
+		t.Errorf("Expected total of 2, got %d", total)
+	}
 }
 
 func TestUserRouter_getUser_Success(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	userID := uuid.New()
 	username := testUsername
@@ -300,7 +341,7 @@ func TestUserRouter_getUser_Success(t *testing.T) {
 	req := httptest.NewRequest("GET", "/api/v1/core/users/"+userID.String(), nil)
 	req.SetPathValue("id", userID.String())
 
-	user, err := router.getUser(context.Background(), req)
+	user, err := router.getUser(serviceContext(), req)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -321,13 +362,13 @@ func TestUserRouter_getUser_Success(t *testing.T) {
 
 func TestUserRouter_getUser_NotFound(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	userID := uuid.New()
 	req := httptest.NewRequest("GET", "/api/v1/core/users/"+userID.String(), nil)
 	req.SetPathValue("id", userID.String())
 
-	user, err := router.getUser(context.Background(), req)
+	user, err := router.getUser(serviceContext(), req)
 
 	if err != nil {
 		t.Errorf("Expected no error for user not found, got %v", err)
@@ -340,7 +381,7 @@ func TestUserRouter_getUser_NotFound(t *testing.T) {
 
 func TestUserRouter_updateUser_Success(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	userID := uuid.New()
 	originalUsername := "original"
@@ -367,7 +408,7 @@ func TestUserRouter_updateUser_Success(t *testing.T) {
 	req := httptest.NewRequest("PUT", "/api/v1/core/users/"+userID.String(), nil)
 	req.SetPathValue("id", userID.String())
 
-	err := router.updateUser(context.Background(), req, updatedUser)
+	err := router.updateUser(serviceContext(), req, updatedUser)
 
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
@@ -382,7 +423,7 @@ func TestUserRouter_updateUser_Success(t *testing.T) {
 
 func TestUserRouter_deleteUser_Success(t *testing.T) {
 	store := NewMockUserStore()
-	router := NewUserRouter(store)
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
 
 	userID := uuid.New()
 	username := testUsername
@@ -410,3 +451,283 @@ func TestUserRouter_deleteUser_Success(t *testing.T) {
 		t.Error("Expected user to be deleted")
 	}
 }
+
+func TestUserRouter_createUser_OmitsPassword(t *testing.T) {
+	router := NewUserRouter(NewMockUserStore(), NewMockRoleStore(), NewMockAPIKeyStore())
+
+	password := testPassword
+	username := testUsername
+	email := testEmail
+	user := &UserModificationRequest{
+		User:     User{Username: &username, Email: &email},
+		Password: &password,
+	}
+
+	rec := serveJSON(t, handlers.HttpPost(router.createUser), "POST", "/api/v1/core/users", user)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "password") {
+		t.Errorf("Expected the password to be omitted from the response, got %s", rec.Body.String())
+	}
+}
+
+func TestUserRouter_createUser_LongPassword(t *testing.T) {
+	router := NewUserRouter(NewMockUserStore(), NewMockRoleStore(), NewMockAPIKeyStore())
+
+	password := strings.Repeat("p", 73)
+	username := testUsername
+	email := testEmail
+	user := &UserModificationRequest{
+		User:     User{Username: &username, Email: &email},
+		Password: &password,
+	}
+
+	rec := serveJSON(t, handlers.HttpPost(router.createUser), "POST", "/api/v1/core/users", user)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a password exceeding 72 bytes, got %d", rec.Code)
+	}
+}
+
+func TestUserRouter_validateCredentials(t *testing.T) {
+	store := NewMockUserStore()
+	router := NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore())
+
+	password := testPassword
+	username := testUsername
+	email := testEmail
+	user := &UserModificationRequest{
+		User:     User{ID: uuid.New(), Username: &username, Email: &email},
+		Password: &password,
+	}
+	if err := store.Create(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	handler := handlers.HttpAction(router.validateCredentials)
+
+	tests := []struct {
+		name    string
+		request UserValidationRequest
+		status  int
+	}{
+		{name: "valid credentials", request: UserValidationRequest{Username: testUsername, Password: testPassword}, status: http.StatusOK},
+		{name: "wrong password", request: UserValidationRequest{Username: testUsername, Password: "wrong"}, status: http.StatusUnauthorized},
+		{name: "unknown user", request: UserValidationRequest{Username: "unknown", Password: testPassword}, status: http.StatusUnauthorized},
+		{name: "missing password", request: UserValidationRequest{Username: testUsername}, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(t, handler, "POST", "/api/v1/core/users/validate", tt.request)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got User
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got.ID != user.ID {
+				t.Errorf("Expected user %s, got %s", user.ID, got.ID)
+			}
+		})
+	}
+}
+
+func TestUserRouter_checkPrivileges(t *testing.T) {
+	support := &User{ID: uuid.New(), Roles: []string{"support"}}
+	admin := &router.Identity{UserID: uuid.New(), Permissions: []string{PermissionUsersWrite}}
+	self := &router.Identity{UserID: support.ID, Permissions: []string{PermissionUsersRead}}
+
+	tests := []struct {
+		name     string
+		identity *router.Identity
+		existing *User
+		isAdmin  bool
+		roles    []string
+		wantErr  bool
+	}{
+		{name: "register", identity: nil},
+		{name: "register as admin", identity: nil, isAdmin: true, wantErr: true},
+		{name: "register with roles", identity: nil, roles: []string{"support"}, wantErr: true},
+		{name: "create admin as admin", identity: admin, isAdmin: true, roles: []string{"support"}},
+		{name: "keep roles", identity: self, existing: support, roles: []string{"support"}},
+		{name: "give up roles", identity: self, existing: support},
+		{name: "add role", identity: self, existing: support, roles: []string{"support", "catalog"}, wantErr: true},
+		{name: "grant own admin flag", identity: self, existing: support, roles: []string{"support"}, isAdmin: true, wantErr: true},
+		{name: "grant admin flag without identity", identity: nil, existing: support, isAdmin: true, wantErr: true},
+		{name: "add role as admin", identity: admin, existing: support, roles: []string{"support", "catalog"}},
+	}
+
+	u := NewUserRouter(NewMockUserStore(), NewMockRoleStore(), NewMockAPIKeyStore())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.identity != nil {
+				ctx = router.ContextWithIdentity(ctx, tt.identity)
+			}
+			user := &UserModificationRequest{User: User{IsAdmin: tt.isAdmin, Roles: tt.roles}}
+			err := u.checkPrivileges(ctx, tt.existing, user)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrForbidden) {
+				t.Errorf("Expected error wrapping %v, got %v", ErrForbidden, err)
+			}
+		})
+	}
+}
+
+func TestUserRouter_updateUser_NonAdminCaller(t *testing.T) {
+	store := NewMockUserStore()
+	roles := NewMockRoleStore()
+	if err := roles.Create(context.Background(), &Role{ID: uuid.New(), Name: "support", Permissions: []string{PermissionUsersRead}}); err != nil {
+		t.Fatalf("Failed to create role: %v", err)
+	}
+	u := NewUserRouter(store, roles, NewMockAPIKeyStore())
+
+	username := testUsername
+	userID := uuid.New()
+	store.users[userID] = &User{ID: userID, Username: &username}
+	ctx := router.ContextWithIdentity(context.Background(), &router.Identity{UserID: userID, Username: username})
+
+	for name, user := range map[string]*UserModificationRequest{
+		"admin flag": {User: User{ID: userID, Username: &username, IsAdmin: true}},
+		"roles":      {User: User{ID: userID, Username: &username, Roles: []string{"support"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/core/users/"+userID.String(), nil)
+			req.SetPathValue("id", userID.String())
+			if err := u.updateUser(ctx, req, user); !errors.Is(err, ErrForbidden) {
+				t.Fatalf("Expected error wrapping %v, got %v", ErrForbidden, err)
+			}
+			if stored := store.users[userID]; stored.IsAdmin || len(stored.Roles) > 0 {
+				t.Errorf("Expected the privileges not to be stored, got %+v", stored)
+			}
+		})
+	}
+
+	// registrations cannot grant privileges either
+	user := &UserModificationRequest{User: User{Username: &username, IsAdmin: true}}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/core/users", nil)
+	if err := u.createUser(ctx, req, user); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected error wrapping %v, got %v", ErrForbidden, err)
+	}
+}
+
+func TestUserRouter_Callers(t *testing.T) {
+	store := NewMockUserStore()
+	username := testUsername
+	userID := uuid.New()
+	store.users[userID] = &User{ID: userID, Username: &username}
+	serverURL := newServiceServer(t, NewUserRouter(store, NewMockRoleStore(), NewMockAPIKeyStore()))
+
+	as := func(identity *router.Identity) string {
+		token, err := identityTokens.Sign(identity)
+		if err != nil {
+			t.Fatalf("Failed to sign identity: %v", err)
+		}
+		return token
+	}
+	anonymous := as(&router.Identity{Anonymous: true})
+	user := as(&router.Identity{UserID: userID, Username: username})
+	other := as(&router.Identity{UserID: uuid.New(), Username: "mallory"})
+	gateway := as(&router.Identity{Service: "gateway"})
+	registration := `{"username":"jdoe","email":"jdoe@localhost","password":"` + testPassword + `"}`
+	credentials := `{"username":"` + testUsername + `","password":"wrong"}`
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{name: "register without token", method: http.MethodPost, body: registration, expectedStatus: http.StatusUnauthorized},
+		{name: "register through the gateway", method: http.MethodPost, token: anonymous, body: registration, expectedStatus: http.StatusCreated},
+		{name: "update without token", method: http.MethodPut, path: "/" + userID.String(), body: `{"username":"mallory"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "patch without token", method: http.MethodPatch, path: "/" + userID.String(), body: `{"username":"mallory"}`, expectedStatus: http.StatusUnauthorized},
+		{name: "get without token", method: http.MethodGet, path: "/" + userID.String(), expectedStatus: http.StatusUnauthorized},
+		{name: "get as anonymous", method: http.MethodGet, path: "/" + userID.String(), token: anonymous, expectedStatus: http.StatusForbidden},
+		{name: "get as another user", method: http.MethodGet, path: "/" + userID.String(), token: other, expectedStatus: http.StatusForbidden},
+		{name: "get own profile", method: http.MethodGet, path: "/" + userID.String(), token: user, expectedStatus: http.StatusOK},
+		{name: "update as another user", method: http.MethodPut, path: "/" + userID.String(), token: other, body: `{"id":"` + userID.String() + `","username":"mallory","email":"mallory@localhost"}`, expectedStatus: http.StatusForbidden},
+		{name: "validate without token", method: http.MethodPost, path: "/validate", body: credentials, expectedStatus: http.StatusUnauthorized},
+		{name: "validate as user", method: http.MethodPost, path: "/validate", token: user, body: credentials, expectedStatus: http.StatusForbidden},
+		{name: "validate as anonymous", method: http.MethodPost, path: "/validate", token: anonymous, body: credentials, expectedStatus: http.StatusForbidden},
+		{name: "validate as gateway", method: http.MethodPost, path: "/validate", token: gateway, body: credentials, expectedStatus: http.StatusUnauthorized},
+		{name: "lookup without token", method: http.MethodPost, path: "/lookup", body: `{}`, expectedStatus: http.StatusUnauthorized},
+		{name: "provision as user", method: http.MethodPost, path: "/provision", token: user, body: `{}`, expectedStatus: http.StatusForbidden},
+		{name: "validate api key without token", method: http.MethodPost, path: "/apikeys/validate", body: `{"key":"ds_unknown"}`, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, serverURL+"/api/v1/core/users"+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set(router.HeaderIdentityToken, tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+	if stored := store.users[userID]; *stored.Username != testUsername {
+		t.Errorf("Expected the user not to be changed, got %+v", stored)
+	}
+}
+
+func TestUserRouter_checkLink(t *testing.T) {
+	issuer := "https://idp.example.com"
+	subject := "248289761001"
+	other := "other-subject"
+	linked := &User{ID: uuid.New(), Issuer: &issuer, Subject: &subject}
+	admin := &router.Identity{UserID: uuid.New(), Permissions: []string{PermissionUsersWrite}}
+	self := &router.Identity{UserID: linked.ID}
+
+	tests := []struct {
+		name     string
+		identity *router.Identity
+		existing *User
+		issuer   *string
+		subject  *string
+		wantErr  bool
+	}{
+		{name: "register without link", identity: nil},
+		{name: "register with link", identity: nil, issuer: &issuer, subject: &subject, wantErr: true},
+		{name: "create with link as admin", identity: admin, issuer: &issuer, subject: &subject},
+		{name: "keep link", identity: self, existing: linked, issuer: &issuer, subject: &subject},
+		{name: "change link", identity: self, existing: linked, issuer: &issuer, subject: &other, wantErr: true},
+		{name: "remove link", identity: self, existing: linked, wantErr: true},
+		{name: "change link as admin", identity: admin, existing: linked, issuer: &issuer, subject: &other},
+	}
+
+	u := NewUserRouter(NewMockUserStore(), NewMockRoleStore(), NewMockAPIKeyStore())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.identity != nil {
+				ctx = router.ContextWithIdentity(ctx, tt.identity)
+			}
+			user := &UserModificationRequest{User: User{Issuer: tt.issuer, Subject: tt.subject}}
+			err := u.checkLink(ctx, tt.existing, user)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrForbidden) {
+				t.Errorf("Expected error wrapping %v, got %v", ErrForbidden, err)
+			}
+		})
+	}
+}
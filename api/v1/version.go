@@ -0,0 +1,62 @@
+package v1
+
+import "github.com/leonsteinhaeuser/demo-shop/internal/handlers"
+
+// Resources carry a version for optimistic concurrency control. The stores set it to 1 on
+// creation and increment it on every update. Update and Delete compare the version passed
+// to them with the stored one and fail with ErrPreconditionFailed if they differ, the
+// version 0 skips the comparison. The HTTP API returns the version as ETag and accepts it
+// in If-Match and If-None-Match headers, If-Match takes precedence over the version of a
+// request body.
+
+var (
+	_ handlers.Versioned     = Item{}
+	_ handlers.VersionSetter = &Item{}
+	_ handlers.Versioned     = User{}
+	_ handlers.VersionSetter = &User{}
+	_ handlers.Versioned     = Cart{}
+	_ handlers.VersionSetter = &Cart{}
+	_ handlers.Versioned     = Checkout{}
+	_ handlers.VersionSetter = &Checkout{}
+	_ handlers.Versioned     = Role{}
+	_ handlers.VersionSetter = &Role{}
+	_ handlers.VersionSetter = &UserDeleteRequest{}
+)
+
+// ResourceVersion implements handlers.Versioned.
+func (i Item) ResourceVersion() int64 { return i.Version }
+
+// SetResourceVersion implements handlers.VersionSetter.
+func (i *Item) SetResourceVersion(version int64) { i.Version = version }
+
+// ResourceVersion implements handlers.Versioned.
+func (u User) ResourceVersion() int64 { return u.Version }
+
+// SetResourceVersion implements handlers.VersionSetter.
+func (u *User) SetResourceVersion(version int64) { u.Version = version }
+
+// ResourceVersion implements handlers.Versioned.
+func (c Cart) ResourceVersion() int64 { return c.Version }
+
+// SetResourceVersion implements handlers.VersionSetter.
+func (c *Cart) SetResourceVersion(version int64) { c.Version = version }
+
+// ResourceVersion implements handlers.Versioned.
+func (c Checkout) ResourceVersion() int64 { return c.Version }
+
+// SetResourceVersion implements handlers.VersionSetter.
+func (c *Checkout) SetResourceVersion(version int64) { c.Version = version }
+
+// ResourceVersion implements handlers.Versioned.
+func (r Role) ResourceVersion() int64 { return r.Version }
+
+// SetResourceVersion implements handlers.VersionSetter.
+func (r *Role) SetResourceVersion(version int64) { r.Version = version }
+
+// SetResourceVersion implements handlers.VersionSetter.
+func (u *UserDeleteRequest) SetResourceVersion(version int64) { u.Version = version }
+
+// ETag returns the entity tag of a resource version as used in the ETag and If-Match headers.
+func ETag(version int64) string {
+	return handlers.ETag(version)
+}
@@ -0,0 +1,162 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
+)
+
+// CreateAPIKey creates an API key for the user. The secret is only returned once, in key.Key.
+func (u *UserClient) CreateAPIKey(ctx context.Context, userID uuid.UUID, key *apiv1.APIKey) error {
+	ctx, span := utils.SpanFromContext(ctx, "user.client.apikey.create")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/users/%s/apikeys", u.baseURL, userID.String())
+
+	jsonData, err := json.Marshal(key)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to marshal api key: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
+	}
+
+	var created apiv1.APIKey
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	*key = created
+	return nil
+}
+
+// ListAPIKeys returns the API keys of the user without their secrets
+func (u *UserClient) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]apiv1.APIKey, error) {
+	ctx, span := utils.SpanFromContext(ctx, "user.client.apikey.list")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/users/%s/apikeys", u.baseURL, userID.String())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var list apiv1.ListResponse[apiv1.APIKey]
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return list.Items, nil
+}
+
+// RevokeAPIKey revokes an API key of the user
+func (u *UserClient) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID) error {
+	ctx, span := utils.SpanFromContext(ctx, "user.client.apikey.revoke")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/users/%s/apikeys/%s", u.baseURL, userID.String(), keyID.String())
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, bytes.NewBufferString("{}"))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// ValidateAPIKey implements the apiv1.APIKeyValidator interface for the gateway
+func (u *UserClient) ValidateAPIKey(ctx context.Context, key string) (*apiv1.APIKeyIdentity, error) {
+	ctx, span := utils.SpanFromContext(ctx, "user.client.apikey.validate")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/users/apikeys/validate", u.baseURL)
+
+	jsonData, err := json.Marshal(apiv1.APIKeyValidationRequest{Key: key})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to marshal validation request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var identity apiv1.APIKeyIdentity
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &identity, nil
+}
+
+// Verify that UserClient implements the APIKeyValidator interface
+var _ apiv1.APIKeyValidator = (*UserClient)(nil)
@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/inmem"
+	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
+)
+
+func TestUserClient_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	users := inmem.NewUserInMemStorage()
+	client := NewUserClient(newTestServer(t, apiv1.NewUserRouter(users, inmem.NewRoleInMemStorage(), inmem.NewAPIKeyInMemStorage())))
+
+	user := &apiv1.UserModificationRequest{
+		User: apiv1.User{
+			Username: utils.StringPtr("jdoe"),
+			Email:    utils.StringPtr("jdoe@localhost"),
+			IsAdmin:  true,
+		},
+		Password: utils.StringPtr("supersecretpassword"),
+	}
+	if err := client.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	key := &apiv1.APIKey{Name: "ci", Scopes: []string{apiv1.PermissionItemsWrite}}
+	if err := client.CreateAPIKey(ctx, user.ID, key); err != nil {
+		t.Fatalf("Failed to create api key: %v", err)
+	}
+	if key.Key == "" || key.UserID != user.ID {
+		t.Fatalf("Expected the secret of a key of the user, got %+v", key)
+	}
+	if err := client.CreateAPIKey(ctx, uuid.New(), &apiv1.APIKey{Name: "ci"}); !errors.Is(err, apiv1.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown user, got %v", err)
+	}
+
+	keys, err := client.ListAPIKeys(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list api keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].ID != key.ID || keys[0].Key != "" {
+		t.Errorf("Expected the key without its secret, got %+v", keys)
+	}
+
+	identity, err := client.ValidateAPIKey(ctx, key.Key)
+	if err != nil {
+		t.Fatalf("Failed to validate api key: %v", err)
+	}
+	if identity.UserID != user.ID || identity.Username != "jdoe" || len(identity.Permissions) != 1 {
+		t.Errorf("Expected the identity of the user with the scope of the key, got %+v", identity)
+	}
+	if _, err := client.ValidateAPIKey(ctx, "ds_unknown"); !errors.Is(err, apiv1.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for an unknown key, got %v", err)
+	}
+
+	if err := client.RevokeAPIKey(ctx, user.ID, key.ID); err != nil {
+		t.Fatalf("Failed to revoke api key: %v", err)
+	}
+	if _, err := client.ValidateAPIKey(ctx, key.Key); !errors.Is(err, apiv1.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for a revoked key, got %v", err)
+	}
+
+	other := &apiv1.APIKey{Name: "other"}
+	if err := client.CreateAPIKey(ctx, user.ID, other); err != nil {
+		t.Fatalf("Failed to create api key: %v", err)
+	}
+	if err := users.Delete(ctx, user.ID, user.Version); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if _, err := client.ValidateAPIKey(ctx, other.Key); !errors.Is(err, apiv1.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for a key of a deleted user, got %v", err)
+	}
+}
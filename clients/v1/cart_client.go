@@ -70,7 +70,7 @@ func (c *CartClient) Create(ctx context.Context, cart *apiv1.Cart) error {
 	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusCreated {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
 		span.RecordError(err)
 		return err
 	}
@@ -113,11 +113,8 @@ func (c *CartClient) Get(ctx context.Context, id uuid.UUID) (*apiv1.Cart, error)
 
 	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
-	}
 	if resp.StatusCode != http.StatusOK {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
 		span.RecordError(err)
 		return nil, err
 	}
@@ -131,6 +128,52 @@ func (c *CartClient) Get(ctx context.Context, id uuid.UUID) (*apiv1.Cart, error)
 	return &cart, nil
 }
 
+// GetByOwner implements the CartStore.GetByOwner method
+func (c *CartClient) GetByOwner(ctx context.Context, ownerID uuid.UUID) (*apiv1.Cart, error) {
+	ctx, span := utils.SpanFromContext(ctx, "cart.client.lookup")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/carts/lookup", c.baseURL)
+
+	jsonData, err := json.Marshal(apiv1.CartLookupRequest{OwnerID: ownerID})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to marshal lookup request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Inject trace context into request headers
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var cart apiv1.Cart
+	if err := json.NewDecoder(resp.Body).Decode(&cart); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &cart, nil
+}
+
 // Update implements the CartStore.Update method
 func (c *CartClient) Update(ctx context.Context, cart *apiv1.Cart) error {
 	ctx, span := utils.SpanFromContext(ctx, "cart.client.update")
@@ -150,6 +193,7 @@ func (c *CartClient) Update(ctx context.Context, cart *apiv1.Cart) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, cart.Version)
 
 	// Inject trace context into request headers
 	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
@@ -164,7 +208,7 @@ func (c *CartClient) Update(ctx context.Context, cart *apiv1.Cart) error {
 	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
 		span.RecordError(err)
 		return err
 	}
@@ -181,8 +225,44 @@ func (c *CartClient) Update(ctx context.Context, cart *apiv1.Cart) error {
 	return nil
 }
 
+// Patch partially updates the cart with the given ID and returns the updated cart.
+// contentType selects the patch format, apiv1.MergePatchContentType or apiv1.JSONPatchContentType.
+func (c *CartClient) Patch(ctx context.Context, id uuid.UUID, contentType string, patch []byte) (*apiv1.Cart, error) {
+	ctx, span := utils.SpanFromContext(ctx, "cart.client.patch")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/carts/%s", c.baseURL, id.String())
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(patch))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var cart apiv1.Cart
+	if err := json.NewDecoder(resp.Body).Decode(&cart); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &cart, nil
+}
+
 // Delete implements the CartStore.Delete method
-func (c *CartClient) Delete(ctx context.Context, id uuid.UUID) error {
+func (c *CartClient) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	ctx, span := utils.SpanFromContext(ctx, "cart.client.delete")
 	defer span.End()
 
@@ -202,6 +282,7 @@ func (c *CartClient) Delete(ctx context.Context, id uuid.UUID) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, version)
 
 	// Inject trace context into request headers
 	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
@@ -216,7 +297,7 @@ func (c *CartClient) Delete(ctx context.Context, id uuid.UUID) error {
 	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
 		span.RecordError(err)
 		return err
 	}
@@ -61,11 +61,8 @@ func (c *CartPresentationClient) GetCartPresentation(ctx context.Context, cartID
 
 	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
-	}
 	if resp.StatusCode != http.StatusOK {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
 		span.RecordError(err)
 		return nil, err
 	}
@@ -62,8 +62,9 @@ func (c *CheckoutClient) Create(ctx context.Context, checkout *apiv1.Checkout) e
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
 	}
 
 	// Update the checkout with the response (which includes generated ID, timestamps, etc.)
@@ -98,13 +99,10 @@ func (c *CheckoutClient) Get(ctx context.Context, id uuid.UUID) (*apiv1.Checkout
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		span.RecordError(fmt.Errorf("checkout not found: %s", id.String()))
-		return nil, nil
-	}
 	if resp.StatusCode != http.StatusOK {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
 	}
 
 	var checkout apiv1.Checkout
@@ -135,6 +133,7 @@ func (c *CheckoutClient) Update(ctx context.Context, checkout *apiv1.Checkout) e
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, checkout.Version)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -144,8 +143,9 @@ func (c *CheckoutClient) Update(ctx context.Context, checkout *apiv1.Checkout) e
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
 	}
 
 	// Update the checkout with the response
@@ -160,8 +160,44 @@ func (c *CheckoutClient) Update(ctx context.Context, checkout *apiv1.Checkout) e
 	return nil
 }
 
+// Patch partially updates the checkout with the given ID and returns the updated checkout.
+// contentType selects the patch format, apiv1.MergePatchContentType or apiv1.JSONPatchContentType.
+func (c *CheckoutClient) Patch(ctx context.Context, id uuid.UUID, contentType string, patch []byte) (*apiv1.Checkout, error) {
+	ctx, span := utils.SpanFromContext(ctx, "checkout.client.patch")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/checkouts/%s", c.baseURL, id.String())
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(patch))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var checkout apiv1.Checkout
+	if err := json.NewDecoder(resp.Body).Decode(&checkout); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &checkout, nil
+}
+
 // Delete implements the CheckoutStore.Delete method
-func (c *CheckoutClient) Delete(ctx context.Context, id uuid.UUID) error {
+func (c *CheckoutClient) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	ctx, span := utils.SpanFromContext(ctx, "checkout.client.delete")
 	defer span.End()
 
@@ -181,6 +217,7 @@ func (c *CheckoutClient) Delete(ctx context.Context, id uuid.UUID) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, version)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -190,8 +227,9 @@ func (c *CheckoutClient) Delete(ctx context.Context, id uuid.UUID) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
 	}
 
 	return nil
@@ -2,15 +2,22 @@
 package v1
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
 )
 
 // Config holds configuration for all API clients
 type Config struct {
 	BaseURL    string
 	HTTPClient *http.Client
+	// APIKey authenticates the requests of the clients, it is sent as bearer token with every
+	// request. Keys are created for a user with UserClient.CreateAPIKey.
+	APIKey string
 }
 
 // Clients contains all available API clients
@@ -18,6 +25,7 @@ type Clients struct {
 	Cart             apiv1.CartStore
 	Item             apiv1.ItemStore
 	User             apiv1.UserStore
+	Role             apiv1.RoleStore
 	Checkout         apiv1.CheckoutStore
 	CartPresentation *CartPresentationClient
 }
@@ -28,11 +36,15 @@ func NewClients(config Config) *Clients {
 	if httpClient == nil {
 		httpClient = &http.Client{}
 	}
+	if config.APIKey != "" {
+		httpClient = withAPIKey(httpClient, config.APIKey)
+	}
 
 	return &Clients{
 		Cart:             NewCartClientWithHTTPClient(config.BaseURL, httpClient),
 		Item:             NewItemClientWithHTTPClient(config.BaseURL, httpClient),
 		User:             NewUserClientWithHTTPClient(config.BaseURL, httpClient),
+		Role:             NewRoleClientWithHTTPClient(config.BaseURL, httpClient),
 		Checkout:         NewCheckoutClientWithHTTPClient(config.BaseURL, httpClient),
 		CartPresentation: NewCartPresentationClientWithHTTPClient(config.BaseURL, httpClient),
 	}
@@ -45,3 +57,98 @@ func NewDefaultClients(baseURL string) *Clients {
 		HTTPClient: &http.Client{},
 	})
 }
+
+// withAPIKey returns a copy of client that sends key as bearer token with every request.
+// Requests that already carry an Authorization header are sent unchanged.
+func withAPIKey(client *http.Client, key string) *http.Client {
+	c := *client
+	c.Transport = &bearerTransport{key: key, base: client.Transport}
+	return &c
+}
+
+// bearerTransport adds the bearer token to the requests sent by base
+type bearerTransport struct {
+	key  string
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Header.Get("Authorization") != "" {
+		return base.RoundTrip(req)
+	}
+	// round trippers must not modify the request they are given
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.key)
+	return base.RoundTrip(req)
+}
+
+// ResponseError is returned by the clients if the server answered with an error.
+// It carries the RFC 7807 problem details reported by the server and wraps the domain
+// error of api/v1 matching the response, so callers can use errors.Is regardless of
+// whether they talk to a local store or a remote service. Validation errors wrap an
+// *apiv1.ValidationError holding the reported violations.
+type ResponseError struct {
+	StatusCode int
+	// Type is the problem type reported by the server
+	Type string
+	// Title is the short summary of the problem
+	Title string
+	// Detail explains the problem, it falls back to the message of servers not reporting problem details
+	Detail string
+	// Instance is the path of the failed request
+	Instance string
+	// TraceID is the ID of the trace the server recorded the request in
+	TraceID    string
+	Violations []apiv1.Violation
+	// Err is the matching domain error, e.g. apiv1.ErrNotFound, or nil for unexpected errors
+	Err error
+}
+
+func (e *ResponseError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code: %d: %s", e.StatusCode, e.Detail)
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// errorFromResponse translates a failed response into a ResponseError.
+func errorFromResponse(resp *http.Response) error {
+	var problem router.ErrorResponse
+	// the body is optional, e.g. proxies may answer with plain text
+	_ = json.NewDecoder(resp.Body).Decode(&problem)
+
+	detail := problem.Detail
+	if detail == "" {
+		detail = problem.Message
+	}
+	respErr := &ResponseError{
+		StatusCode: resp.StatusCode,
+		Type:       problem.Type,
+		Title:      problem.Title,
+		Detail:     detail,
+		Instance:   problem.Instance,
+		TraceID:    problem.TraceID,
+		Violations: problem.Violations,
+		Err:        router.ErrorFromResponse(resp.StatusCode, problem.Type),
+	}
+	if errors.Is(respErr.Err, apiv1.ErrValidation) && len(problem.Violations) > 0 {
+		respErr.Err = apiv1.NewValidationError(problem.Violations...)
+	}
+	return respErr
+}
+
+// setIfMatch makes the request conditional on the given resource version, 0 leaves it unconditional.
+func setIfMatch(req *http.Request, version int64) {
+	if version != 0 {
+		req.Header.Set("If-Match", apiv1.ETag(version))
+	}
+}
@@ -1,7 +1,12 @@
 package v1
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
 )
 
 func TestClientURLGeneration(t *testing.T) {
@@ -63,3 +68,28 @@ func TestClientsFactory(t *testing.T) {
 		t.Error("Expected CartPresentation client to be initialized")
 	}
 }
+
+func TestClientsAPIKey(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items":[],"total":0}`))
+	}))
+	t.Cleanup(server.Close)
+
+	clients := NewClients(Config{BaseURL: server.URL, APIKey: "ds_secret"})
+	if _, _, err := clients.Item.List(context.Background(), apiv1.ListOptions{}); err != nil {
+		t.Fatalf("Failed to list items: %v", err)
+	}
+	if authorization != "Bearer ds_secret" {
+		t.Errorf("Expected the API key as bearer token, got %q", authorization)
+	}
+
+	if _, _, err := NewDefaultClients(server.URL).Item.List(context.Background(), apiv1.ListOptions{}); err != nil {
+		t.Fatalf("Failed to list items: %v", err)
+	}
+	if authorization != "" {
+		t.Errorf("Expected no Authorization header without API key, got %q", authorization)
+	}
+}
@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/inmem"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/storagetest"
+)
+
+// newTestServer serves the given API object backed by an in-memory store
+// and returns the base URL of the server. Requests are served as if they had
+// been made on behalf of an admin.
+func newTestServer(t *testing.T, obj router.ApiObject) string {
+	t.Helper()
+
+	r := router.NewRouter()
+	if err := r.Register(obj); err != nil {
+		t.Fatalf("Failed to register api object: %v", err)
+	}
+	mux := http.NewServeMux()
+	if err := r.Build(mux); err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+
+	// the clients are served as an administrator, the internal routes require a service
+	admin := &router.Identity{Service: "test", UserID: uuid.New(), Username: "root", IsAdmin: true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(router.ContextWithIdentity(r.Context(), admin)))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestItemClient_Conformance(t *testing.T) {
+	storagetest.TestItemStore(t, func(t *testing.T) apiv1.ItemStore {
+		return NewItemClient(newTestServer(t, apiv1.NewItemRouter(inmem.NewItemInMemStorage())))
+	})
+}
+
+func TestUserClient_Conformance(t *testing.T) {
+	storagetest.TestUserStore(t, func(t *testing.T) apiv1.UserStore {
+		return NewUserClient(newTestServer(t, apiv1.NewUserRouter(inmem.NewUserInMemStorage(), inmem.NewRoleInMemStorage(), inmem.NewAPIKeyInMemStorage())))
+	})
+}
+
+func TestRoleClient_Conformance(t *testing.T) {
+	storagetest.TestRoleStore(t, func(t *testing.T) apiv1.RoleStore {
+		return NewRoleClient(newTestServer(t, apiv1.NewRoleRouter(inmem.NewRoleInMemStorage())))
+	})
+}
+
+func TestCartClient_Conformance(t *testing.T) {
+	storagetest.TestCartStore(t, func(t *testing.T) apiv1.CartStore {
+		return NewCartClient(newTestServer(t, apiv1.NewCartRouter(inmem.NewCartInMemStorage())))
+	})
+}
+
+func TestCheckoutClient_Conformance(t *testing.T) {
+	storagetest.TestCheckoutStore(t, func(t *testing.T) apiv1.CheckoutStore {
+		return NewCheckoutClient(newTestServer(t, apiv1.NewCheckoutRouter(inmem.NewCheckoutInMemStorage())))
+	})
+}
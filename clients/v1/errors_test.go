@@ -0,0 +1,109 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/inmem"
+)
+
+func TestErrorFromResponse_DomainErrors(t *testing.T) {
+	domainErrors := []error{
+		apiv1.ErrNotFound,
+		apiv1.ErrConflict,
+		apiv1.ErrAlreadyExists,
+		apiv1.ErrPreconditionFailed,
+		apiv1.ErrValidation,
+		apiv1.ErrUnauthorized,
+		apiv1.ErrForbidden,
+		apiv1.ErrUnavailable,
+		apiv1.ErrUnsupportedMediaType,
+	}
+
+	for _, domainErr := range domainErrors {
+		t.Run(domainErr.Error(), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				router.NewErrorResponse(r, "Failed", fmt.Errorf("item %w", domainErr)).WriteTo(w)
+			}))
+			defer server.Close()
+
+			_, err := NewItemClient(server.URL).Get(t.Context(), uuid.New())
+			if !errors.Is(err, domainErr) {
+				t.Fatalf("Expected error wrapping %v, got %v", domainErr, err)
+			}
+			var respErr *ResponseError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("Expected a ResponseError, got %T", err)
+			}
+			if respErr.StatusCode != router.StatusFromError(domainErr, 0) {
+				t.Errorf("Expected status code %d, got %d", router.StatusFromError(domainErr, 0), respErr.StatusCode)
+			}
+		})
+	}
+}
+
+func TestErrorFromResponse_StatusOnly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "conflict", http.StatusConflict)
+	}))
+	defer server.Close()
+
+	_, err := NewItemClient(server.URL).Get(t.Context(), uuid.New())
+	if !errors.Is(err, apiv1.ErrConflict) {
+		t.Errorf("Expected error wrapping %v, got %v", apiv1.ErrConflict, err)
+	}
+	if errors.Is(err, apiv1.ErrAlreadyExists) {
+		t.Errorf("Expected a bare status code not to be reported as %v", apiv1.ErrAlreadyExists)
+	}
+}
+
+func TestErrorFromResponse_Unexpected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.NewErrorResponse(r, "Failed", errors.New("boom")).WriteTo(w)
+	}))
+	defer server.Close()
+
+	_, err := NewItemClient(server.URL).Get(t.Context(), uuid.New())
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, domainErr := range []error{apiv1.ErrNotFound, apiv1.ErrValidation, apiv1.ErrUnavailable} {
+		if errors.Is(err, domainErr) {
+			t.Errorf("Expected unexpected error not to wrap %v", domainErr)
+		}
+	}
+}
+
+func TestErrorFromResponse_ProblemDetails(t *testing.T) {
+	client := NewItemClient(newTestServer(t, apiv1.NewItemRouter(inmem.NewItemInMemStorage())))
+
+	err := client.Create(t.Context(), &apiv1.Item{Price: 1})
+
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) {
+		t.Fatalf("Expected a ResponseError, got %v", err)
+	}
+	if respErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, respErr.StatusCode)
+	}
+	if respErr.Type != router.ProblemTypeFromError(apiv1.ErrValidation) {
+		t.Errorf("Expected problem type %s, got %s", router.ProblemTypeFromError(apiv1.ErrValidation), respErr.Type)
+	}
+	if respErr.Instance != "/api/v1/core/items" {
+		t.Errorf("Expected instance /api/v1/core/items, got %s", respErr.Instance)
+	}
+
+	var verr *apiv1.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected error wrapping a ValidationError, got %v", err)
+	}
+	if len(verr.Violations) != 1 || verr.Violations[0].Field != "name" {
+		t.Errorf("Expected a single violation of field name, got %+v", verr.Violations)
+	}
+}
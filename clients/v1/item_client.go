@@ -65,8 +65,9 @@ func (i *ItemClient) Create(ctx context.Context, item *apiv1.Item) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
 	}
 
 	// Update the item with the response (which includes generated ID, timestamps, etc.)
@@ -82,37 +83,38 @@ func (i *ItemClient) Create(ctx context.Context, item *apiv1.Item) error {
 }
 
 // List implements the ItemStore.List method
-func (i *ItemClient) List(ctx context.Context, page, limit int) ([]apiv1.Item, error) {
+func (i *ItemClient) List(ctx context.Context, opts apiv1.ListOptions) ([]apiv1.Item, int, error) {
 	ctx, span := utils.SpanFromContext(ctx, "item.client.list")
 	defer span.End()
 
-	url := fmt.Sprintf("%s/api/v1/core/items?page=%d&limit=%d", i.baseURL, page, limit)
+	url := fmt.Sprintf("%s/api/v1/core/items?%s", i.baseURL, opts.Query().Encode())
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	resp, err := i.httpClient.Do(req)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, 0, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, 0, err
 	}
 
-	var items []apiv1.Item
-	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+	var list apiv1.ListResponse[apiv1.Item]
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return items, nil
+	return list.Items, list.Total, nil
 }
 
 // Get implements the ItemStore.Get method
@@ -140,11 +142,8 @@ func (i *ItemClient) Get(ctx context.Context, id uuid.UUID) (*apiv1.Item, error)
 
 	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
-	}
 	if resp.StatusCode != http.StatusOK {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
 		span.RecordError(err)
 		return nil, err
 	}
@@ -182,6 +181,7 @@ func (i *ItemClient) Update(ctx context.Context, item *apiv1.Item) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, item.Version)
 
 	resp, err := i.httpClient.Do(req)
 	if err != nil {
@@ -191,8 +191,9 @@ func (i *ItemClient) Update(ctx context.Context, item *apiv1.Item) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
 	}
 
 	// Update the item with the response
@@ -207,8 +208,44 @@ func (i *ItemClient) Update(ctx context.Context, item *apiv1.Item) error {
 	return nil
 }
 
+// Patch partially updates the item with the given ID and returns the updated item.
+// contentType selects the patch format, apiv1.MergePatchContentType or apiv1.JSONPatchContentType.
+func (i *ItemClient) Patch(ctx context.Context, id uuid.UUID, contentType string, patch []byte) (*apiv1.Item, error) {
+	ctx, span := utils.SpanFromContext(ctx, "item.client.patch")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/items/%s", i.baseURL, id.String())
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(patch))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var item apiv1.Item
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &item, nil
+}
+
 // Delete implements the ItemStore.Delete method
-func (i *ItemClient) Delete(ctx context.Context, id uuid.UUID) error {
+func (i *ItemClient) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	ctx, span := utils.SpanFromContext(ctx, "item.client.delete")
 	defer span.End()
 
@@ -228,6 +265,7 @@ func (i *ItemClient) Delete(ctx context.Context, id uuid.UUID) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, version)
 
 	resp, err := i.httpClient.Do(req)
 	if err != nil {
@@ -237,8 +275,9 @@ func (i *ItemClient) Delete(ctx context.Context, id uuid.UUID) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
 	}
 
 	return nil
@@ -0,0 +1,140 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/inmem"
+	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
+)
+
+func TestItemClient_Patch(t *testing.T) {
+	ctx := context.Background()
+	client := NewItemClient(newTestServer(t, apiv1.NewItemRouter(inmem.NewItemInMemStorage())))
+
+	item := &apiv1.Item{Name: "Apple", Description: "Red", Price: 1.5, Quantity: 10}
+	if err := client.Create(ctx, item); err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+
+	patched, err := client.Patch(ctx, item.ID, apiv1.MergePatchContentType, []byte(`{"price":2.25}`))
+	if err != nil {
+		t.Fatalf("Failed to merge patch item: %v", err)
+	}
+	if patched.Price != 2.25 || patched.Name != "Apple" || patched.Description != "Red" || patched.Quantity != 10 {
+		t.Errorf("Expected only the price to change, got %+v", patched)
+	}
+
+	patched, err = client.Patch(ctx, item.ID, apiv1.JSONPatchContentType, []byte(`[
+		{"op":"test","path":"/quantity","value":10},
+		{"op":"replace","path":"/quantity","value":9}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to JSON patch item: %v", err)
+	}
+	if patched.Quantity != 9 || patched.Price != 2.25 {
+		t.Errorf("Expected quantity 9 and price 2.25, got %+v", patched)
+	}
+
+	got, err := client.Get(ctx, item.ID)
+	if err != nil {
+		t.Fatalf("Failed to get item: %v", err)
+	}
+	if got.Quantity != 9 || got.Price != 2.25 || !got.CreatedAt.Equal(item.CreatedAt) {
+		t.Errorf("Expected patch to be stored, got %+v", got)
+	}
+
+	_, err = client.Patch(ctx, item.ID, apiv1.JSONPatchContentType, []byte(`[{"op":"test","path":"/quantity","value":10}]`))
+	if !errors.Is(err, apiv1.ErrConflict) {
+		t.Errorf("Expected ErrConflict for a failed test operation, got %v", err)
+	}
+	_, err = client.Patch(ctx, item.ID, apiv1.MergePatchContentType, []byte(`{"price":0}`))
+	if !errors.Is(err, apiv1.ErrValidation) {
+		t.Errorf("Expected ErrValidation for an invalid patch result, got %v", err)
+	}
+	_, err = client.Patch(ctx, item.ID, "application/json", []byte(`{"price":3}`))
+	if !errors.Is(err, apiv1.ErrUnsupportedMediaType) {
+		t.Errorf("Expected ErrUnsupportedMediaType for a plain JSON body, got %v", err)
+	}
+	_, err = client.Patch(ctx, uuid.New(), apiv1.MergePatchContentType, []byte(`{"price":3}`))
+	if !errors.Is(err, apiv1.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown item, got %v", err)
+	}
+}
+
+func TestUserClient_Patch(t *testing.T) {
+	ctx := context.Background()
+	client := NewUserClient(newTestServer(t, apiv1.NewUserRouter(inmem.NewUserInMemStorage(), inmem.NewRoleInMemStorage(), inmem.NewAPIKeyInMemStorage())))
+
+	user := &apiv1.UserModificationRequest{
+		User: apiv1.User{
+			Username: utils.StringPtr("jdoe"),
+			Email:    utils.StringPtr("jdoe@localhost"),
+		},
+		Password: utils.StringPtr("supersecretpassword"),
+	}
+	if err := client.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	patched, err := client.Patch(ctx, user.ID, apiv1.MergePatchContentType, []byte(`{"given_name":"John"}`))
+	if err != nil {
+		t.Fatalf("Failed to patch user: %v", err)
+	}
+	if patched.GivenName == nil || *patched.GivenName != "John" || *patched.Username != "jdoe" {
+		t.Errorf("Expected given name John and unchanged username, got %+v", patched)
+	}
+
+	_, err = client.Patch(ctx, user.ID, apiv1.MergePatchContentType, []byte(`{"password":"short"}`))
+	if !errors.Is(err, apiv1.ErrValidation) {
+		t.Errorf("Expected ErrValidation for a short password, got %v", err)
+	}
+}
+
+func TestCartClient_Patch(t *testing.T) {
+	ctx := context.Background()
+	client := NewCartClient(newTestServer(t, apiv1.NewCartRouter(inmem.NewCartInMemStorage())))
+
+	cart := &apiv1.Cart{OwnerID: uuid.New(), Items: []apiv1.CartItem{{ItemID: uuid.New(), Quantity: 1}}}
+	if err := client.Create(ctx, cart); err != nil {
+		t.Fatalf("Failed to create cart: %v", err)
+	}
+
+	itemID := uuid.New()
+	patched, err := client.Patch(ctx, cart.ID, apiv1.JSONPatchContentType, []byte(`[
+		{"op":"add","path":"/items/-","value":{"item_id":"`+itemID.String()+`","quantity":2}},
+		{"op":"replace","path":"/items/0/quantity","value":3}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to patch cart: %v", err)
+	}
+	if len(patched.Items) != 2 || patched.Items[0].Quantity != 3 || patched.Items[1].ItemID != itemID {
+		t.Errorf("Expected two items with updated quantity, got %+v", patched.Items)
+	}
+}
+
+func TestCheckoutClient_Patch(t *testing.T) {
+	ctx := context.Background()
+	client := NewCheckoutClient(newTestServer(t, apiv1.NewCheckoutRouter(inmem.NewCheckoutInMemStorage())))
+
+	checkout := &apiv1.Checkout{UserID: uuid.New(), CartID: uuid.New(), Total: 12.5, Status: "pending"}
+	if err := client.Create(ctx, checkout); err != nil {
+		t.Fatalf("Failed to create checkout: %v", err)
+	}
+
+	patched, err := client.Patch(ctx, checkout.ID, apiv1.MergePatchContentType, []byte(`{"status":"completed"}`))
+	if err != nil {
+		t.Fatalf("Failed to patch checkout: %v", err)
+	}
+	if patched.Status != "completed" || patched.Total != 12.5 {
+		t.Errorf("Expected status completed and unchanged total, got %+v", patched)
+	}
+
+	_, err = client.Patch(ctx, checkout.ID, apiv1.MergePatchContentType, []byte(`{"status":"shipped"}`))
+	if !errors.Is(err, apiv1.ErrValidation) {
+		t.Errorf("Expected ErrValidation for an unknown status, got %v", err)
+	}
+}
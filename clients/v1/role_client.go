@@ -0,0 +1,284 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// RoleClient implements the RoleStore interface by making HTTP requests to the API server
+type RoleClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewRoleClient creates a new RoleClient with the given base URL
+func NewRoleClient(baseURL string) *RoleClient {
+	return &RoleClient{
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+	}
+}
+
+// NewRoleClientWithHTTPClient creates a new RoleClient with a custom HTTP client
+func NewRoleClientWithHTTPClient(baseURL string, httpClient *http.Client) *RoleClient {
+	return &RoleClient{
+		baseURL:    baseURL,
+		httpClient: httpClient,
+	}
+}
+
+// Create implements the RoleStore.Create method
+func (c *RoleClient) Create(ctx context.Context, role *apiv1.Role) error {
+	ctx, span := utils.SpanFromContext(ctx, "role.client.create")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/roles", c.baseURL)
+
+	jsonData, err := json.Marshal(role)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to marshal role: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
+	}
+
+	// Update the role with the response (which includes generated ID, timestamps, etc.)
+	var updatedRole apiv1.Role
+	if err := json.NewDecoder(resp.Body).Decode(&updatedRole); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Update the original role object
+	*role = updatedRole
+	return nil
+}
+
+// List implements the RoleStore.List method
+func (c *RoleClient) List(ctx context.Context, opts apiv1.ListOptions) ([]apiv1.Role, int, error) {
+	ctx, span := utils.SpanFromContext(ctx, "role.client.list")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/roles?%s", c.baseURL, opts.Query().Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, 0, err
+	}
+
+	var list apiv1.ListResponse[apiv1.Role]
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		span.RecordError(err)
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return list.Items, list.Total, nil
+}
+
+// Get implements the RoleStore.Get method
+func (c *RoleClient) Get(ctx context.Context, id uuid.UUID) (*apiv1.Role, error) {
+	ctx, span := utils.SpanFromContext(ctx, "role.client.get")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/roles/%s", c.baseURL, id.String())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Inject trace context into request headers
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var role apiv1.Role
+	if err := json.NewDecoder(resp.Body).Decode(&role); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	span.SetAttributes(attribute.String("role.name", role.Name))
+
+	return &role, nil
+}
+
+// Update implements the RoleStore.Update method
+func (c *RoleClient) Update(ctx context.Context, role *apiv1.Role) error {
+	ctx, span := utils.SpanFromContext(ctx, "role.client.update")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/roles/%s", c.baseURL, role.ID.String())
+
+	jsonData, err := json.Marshal(role)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to marshal role: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, role.Version)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
+	}
+
+	// Update the role with the response
+	var updatedRole apiv1.Role
+	if err := json.NewDecoder(resp.Body).Decode(&updatedRole); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Update the original role object
+	*role = updatedRole
+	return nil
+}
+
+// Patch partially updates the role with the given ID and returns the updated role.
+// contentType selects the patch format, apiv1.MergePatchContentType or apiv1.JSONPatchContentType.
+func (c *RoleClient) Patch(ctx context.Context, id uuid.UUID, contentType string, patch []byte) (*apiv1.Role, error) {
+	ctx, span := utils.SpanFromContext(ctx, "role.client.patch")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/roles/%s", c.baseURL, id.String())
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(patch))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var role apiv1.Role
+	if err := json.NewDecoder(resp.Body).Decode(&role); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &role, nil
+}
+
+// Delete implements the RoleStore.Delete method
+func (c *RoleClient) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	ctx, span := utils.SpanFromContext(ctx, "role.client.delete")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/roles/%s", c.baseURL, id.String())
+
+	// Create a minimal role object for the delete request
+	deleteRole := apiv1.Role{ID: id}
+	jsonData, err := json.Marshal(deleteRole)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to marshal role: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, version)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// Verify that RoleClient implements the RoleStore interface
+var _ apiv1.RoleStore = (*RoleClient)(nil)
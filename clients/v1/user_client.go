@@ -62,8 +62,9 @@ func (u *UserClient) Create(ctx context.Context, user *apiv1.UserModificationReq
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
 	}
 
 	// Update the user with the response (which includes generated ID, timestamps, etc.)
@@ -79,37 +80,38 @@ func (u *UserClient) Create(ctx context.Context, user *apiv1.UserModificationReq
 }
 
 // List implements the UserStore.List method
-func (u *UserClient) List(ctx context.Context, page, limit int) ([]apiv1.User, error) {
+func (u *UserClient) List(ctx context.Context, opts apiv1.ListOptions) ([]apiv1.User, int, error) {
 	ctx, span := utils.SpanFromContext(ctx, "user.client.list")
 	defer span.End()
 
-	url := fmt.Sprintf("%s/api/v1/core/users?page=%d&limit=%d", u.baseURL, page, limit)
+	url := fmt.Sprintf("%s/api/v1/core/users?%s", u.baseURL, opts.Query().Encode())
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	resp, err := u.httpClient.Do(req)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, 0, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, 0, err
 	}
 
-	var users []apiv1.User
-	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+	var list apiv1.ListResponse[apiv1.User]
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		return nil, 0, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return users, nil
+	return list.Items, list.Total, nil
 }
 
 // Get implements the UserStore.Get method
@@ -132,13 +134,10 @@ func (u *UserClient) Get(ctx context.Context, id uuid.UUID) (*apiv1.User, error)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		span.RecordError(fmt.Errorf("user not found: %s", id.String()))
-		return nil, nil
-	}
 	if resp.StatusCode != http.StatusOK {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
 	}
 
 	var user apiv1.User
@@ -169,6 +168,7 @@ func (u *UserClient) Update(ctx context.Context, user *apiv1.UserModificationReq
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, user.Version)
 
 	resp, err := u.httpClient.Do(req)
 	if err != nil {
@@ -178,8 +178,9 @@ func (u *UserClient) Update(ctx context.Context, user *apiv1.UserModificationReq
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
 	}
 
 	// Update the user with the response
@@ -194,8 +195,44 @@ func (u *UserClient) Update(ctx context.Context, user *apiv1.UserModificationReq
 	return nil
 }
 
+// Patch partially updates the user with the given ID and returns the updated user.
+// contentType selects the patch format, apiv1.MergePatchContentType or apiv1.JSONPatchContentType.
+func (u *UserClient) Patch(ctx context.Context, id uuid.UUID, contentType string, patch []byte) (*apiv1.User, error) {
+	ctx, span := utils.SpanFromContext(ctx, "user.client.patch")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/users/%s", u.baseURL, id.String())
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(patch))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var user apiv1.User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &user, nil
+}
+
 // Delete implements the UserStore.Delete method
-func (u *UserClient) Delete(ctx context.Context, id uuid.UUID) error {
+func (u *UserClient) Delete(ctx context.Context, id uuid.UUID, version int64) error {
 	ctx, span := utils.SpanFromContext(ctx, "user.client.delete")
 	defer span.End()
 
@@ -215,6 +252,7 @@ func (u *UserClient) Delete(ctx context.Context, id uuid.UUID) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setIfMatch(req, version)
 
 	resp, err := u.httpClient.Do(req)
 	if err != nil {
@@ -224,12 +262,139 @@ func (u *UserClient) Delete(ctx context.Context, id uuid.UUID) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		span.RecordError(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return err
 	}
 
 	return nil
 }
 
-// Verify that UserClient implements the UserStore interface
-var _ apiv1.UserStore = (*UserClient)(nil)
+// ValidateCredentials implements the UserStore.ValidateCredentials method
+func (u *UserClient) ValidateCredentials(ctx context.Context, username, password string) (*apiv1.User, error) {
+	ctx, span := utils.SpanFromContext(ctx, "user.client.validate")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/users/validate", u.baseURL)
+
+	jsonData, err := json.Marshal(apiv1.UserValidationRequest{Username: username, Password: password})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to marshal validation request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var user apiv1.User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &user, nil
+}
+
+// GetBySubject implements the UserStore.GetBySubject method
+func (u *UserClient) GetBySubject(ctx context.Context, issuer, subject string) (*apiv1.User, error) {
+	ctx, span := utils.SpanFromContext(ctx, "user.client.lookup")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/users/lookup", u.baseURL)
+
+	jsonData, err := json.Marshal(apiv1.UserLookupRequest{Issuer: issuer, Subject: subject})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to marshal lookup request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var user apiv1.User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &user, nil
+}
+
+// ProvisionUser implements the apiv1.UserProvisioner interface for the gateway
+func (u *UserClient) ProvisionUser(ctx context.Context, identity *apiv1.FederatedIdentity) (*apiv1.User, error) {
+	ctx, span := utils.SpanFromContext(ctx, "user.client.provision")
+	defer span.End()
+
+	url := fmt.Sprintf("%s/api/v1/core/users/provision", u.baseURL)
+
+	jsonData, err := json.Marshal(identity)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to marshal provisioning request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := errorFromResponse(resp)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var user apiv1.User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &user, nil
+}
+
+// Verify that UserClient implements the UserStore and UserProvisioner interfaces
+var (
+	_ apiv1.UserStore       = (*UserClient)(nil)
+	_ apiv1.UserProvisioner = (*UserClient)(nil)
+)
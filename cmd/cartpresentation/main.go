@@ -23,10 +23,19 @@ var (
 	cartServiceURL = env.StringEnvOrDefault("CART_SERVICE_URL", "http://localhost:8080")
 	itemServiceURL = env.StringEnvOrDefault("ITEM_SERVICE_URL", "http://localhost:8080")
 
+	envIdentityTokenKey          = env.BytesEnvOrDefault("IDENTITY_TOKEN_KEY", nil)
+	envPreviousIdentityTokenKeys = env.BytesSliceEnvOrDefault("IDENTITY_TOKEN_PREVIOUS_KEYS", nil)
+
 	traceConfig = utils.TraceConfigFromEnv()
 )
 
 func main() {
+	// the keys are shared secrets, there is no default anyone could sign tokens with
+	if len(envIdentityTokenKey) == 0 {
+		slog.Error("IDENTITY_TOKEN_KEY is required")
+		os.Exit(1)
+	}
+
 	ctx, cf := context.WithCancel(context.Background())
 	defer cf()
 
@@ -47,11 +56,33 @@ func main() {
 
 	mux := http.NewServeMux()
 
+	// the identity of users is passed on by the gateway in signed tokens
+	identityTokens, err := router.NewIdentityTokens(envIdentityTokenKey, envPreviousIdentityTokenKeys...)
+	if err != nil {
+		slog.Error("Failed to create identity token verifier", "error", err)
+		os.Exit(1)
+	}
+
+	// the cart and item services are called with the identity of this service, the router
+	// checks the ownership of the cart itself
+	serviceClient := &http.Client{Transport: identityTokens.Transport("cart-presentation", nil)}
 	var (
-		cartStore v1.CartStore = clientv1.NewCartClient(cartServiceURL)
-		itemStore v1.ItemStore = clientv1.NewItemClient(itemServiceURL)
+		cartStore v1.CartStore = clientv1.NewCartClientWithHTTPClient(cartServiceURL, serviceClient)
+		itemStore v1.ItemStore = clientv1.NewItemClientWithHTTPClient(itemServiceURL, serviceClient)
 	)
 
+	// the presentation cannot be served without the cart and item services
+	for name, serviceURL := range map[string]string{"cart-service": cartServiceURL, "item-service": itemServiceURL} {
+		err = router.DefaultRouter.RegisterHealthCheck(router.HealthCheck{
+			Name:    name,
+			Checker: router.HTTPHealthCheck(serviceURL + "/health/readiness"),
+		})
+		if err != nil {
+			slog.Error("Failed to register health check", "check", name, "error", err)
+			os.Exit(1)
+		}
+	}
+
 	err = router.DefaultRouter.Register(v1.NewCartPresentationRouter(itemStore, cartStore))
 	if err != nil {
 		slog.Error("Failed to register cart presentation router", "error", err)
@@ -63,11 +94,12 @@ func main() {
 		slog.Error("Failed to build router", "error", err)
 		os.Exit(1)
 	}
+
 	slog.Info("Starting server on :8080")
 
 	server := &http.Server{
 		Addr:           ":8080",
-		Handler:        utils.LogMiddleware(router.EnableCorsHeader(utils.TracingMiddleware("cart-presentation")(mux))),
+		Handler:        utils.LogMiddleware(router.EnableCorsHeader(utils.TracingMiddleware("cart-presentation")(router.Authenticate(identityTokens)(mux)))),
 		ReadTimeout:    15 * time.Second,
 		WriteTimeout:   15 * time.Second,
 		IdleTimeout:    60 * time.Second,
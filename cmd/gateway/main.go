@@ -4,13 +4,18 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"strings"
 	"time"
 
 	v1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
-	"github.com/leonsteinhaeuser/demo-shop/cmd/gateway/check"
+	clientv1 "github.com/leonsteinhaeuser/demo-shop/clients/v1"
 	"github.com/leonsteinhaeuser/demo-shop/internal/env"
+	"github.com/leonsteinhaeuser/demo-shop/internal/oidc"
 	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/inmem"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/redis"
 	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
 )
 
@@ -27,24 +32,42 @@ var (
 	envItemServiceURL             = env.StringEnvOrDefault("ITEM_SERVICE_URL", "http://localhost:8081")
 	envCheckoutServiceURL         = env.StringEnvOrDefault("CHECKOUT_SERVICE_URL", "http://localhost:8085")
 	envCartPresentationServiceURL = env.StringEnvOrDefault("CART_PRESENTATION_SERVICE_URL", "http://localhost:8083")
-	envCookieEncryptionKey        = env.BytesEnvOrDefault("COOKIE_ENCRYPTION_KEY", []byte("a_random_secret_key"))
+	envRoutesConfig               = env.StringEnvOrDefault("ROUTES_CONFIG", "")
+	envRoutesReloadInterval       = env.DurationEnvOrDefault("ROUTES_RELOAD_INTERVAL", 10*time.Second)
+	envCookieEncryptionKey        = env.BytesEnvOrDefault("COOKIE_ENCRYPTION_KEY", nil)
+	envPreviousCookieKeys         = env.BytesSliceEnvOrDefault("COOKIE_PREVIOUS_ENCRYPTION_KEYS", nil)
+	envIdentityTokenKey           = env.BytesEnvOrDefault("IDENTITY_TOKEN_KEY", nil)
+	envPreviousIdentityTokenKeys  = env.BytesSliceEnvOrDefault("IDENTITY_TOKEN_PREVIOUS_KEYS", nil)
+	envIdentityTokenTTL           = env.DurationEnvOrDefault("IDENTITY_TOKEN_TTL", router.DefaultIdentityTokenTTL)
+	envSessionStore               = env.StringEnvOrDefault("SESSION_STORE", "inmem")
+	envRedisURL                   = env.StringEnvOrDefault("REDIS_URL", "redis://localhost:6379/0")
+	envSessionIdleTimeout         = env.DurationEnvOrDefault("SESSION_IDLE_TIMEOUT", 24*time.Hour)
+	envSessionMaxLifetime         = env.DurationEnvOrDefault("SESSION_MAX_LIFETIME", 7*24*time.Hour)
+	envOIDCIssuerURL              = env.StringEnvOrDefault("OIDC_ISSUER_URL", "")
+	envOIDCClientID               = env.StringEnvOrDefault("OIDC_CLIENT_ID", "demo-shop")
+	envOIDCClientSecret           = env.StringEnvOrDefault("OIDC_CLIENT_SECRET", "")
+	envOIDCRedirectURL            = env.StringEnvOrDefault("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback")
+	envOIDCScopes                 = env.StringEnvOrDefault("OIDC_SCOPES", "openid email profile")
+	envTrustedProxies             = env.StringEnvOrDefault("TRUSTED_PROXIES", "")
+	envLoginMaxFailures           = env.IntEnvOrDefault("LOGIN_MAX_FAILURES", 5)
+	envLoginLockoutDuration       = env.DurationEnvOrDefault("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+	envDependencyCheckInterval    = env.DurationEnvOrDefault("DEPENDENCY_CHECK_INTERVAL", 10*time.Second)
+	envDependencyCheckTimeout     = env.DurationEnvOrDefault("DEPENDENCY_CHECK_TIMEOUT", 2*time.Second)
+	envCriticalDependencies       = env.StringEnvOrDefault("CRITICAL_DEPENDENCIES", "user")
 
 	traceConfig = utils.TraceConfigFromEnv()
 )
 
 func main() {
+	// the keys are secrets, there is no default anyone could sign tokens or forge cookies with
+	if len(envIdentityTokenKey) == 0 || len(envCookieEncryptionKey) == 0 {
+		slog.Error("IDENTITY_TOKEN_KEY and COOKIE_ENCRYPTION_KEY are required")
+		os.Exit(1)
+	}
+
 	ctx, cf := context.WithCancel(context.Background())
 	defer cf()
 
-	// ping upstream services
-	check.Check(ctx,
-		envUserServiceURL,
-		envCartServiceURL,
-		envItemServiceURL,
-		envCheckoutServiceURL,
-		envCartPresentationServiceURL,
-	)
-
 	tracer, shutdown, err := utils.NewTracer(ctx, traceConfig)
 	if err != nil {
 		slog.Error("Failed to create tracer", "error", err)
@@ -64,15 +87,137 @@ func main() {
 	// Create multiplexer and register routes
 	mux := http.NewServeMux()
 
-	// Initialize gateway
-	v1.NewGateway(
-		envUserServiceURL,
-		envCartServiceURL,
-		envItemServiceURL,
-		envCheckoutServiceURL,
-		envCartPresentationServiceURL,
+	var sessionStore v1.SessionStore
+	switch envSessionStore {
+	case "inmem":
+		sessionStore = inmem.NewSessionInMemStorage()
+	case "redis":
+		client, err := redis.Open(ctx, envRedisURL)
+		if err != nil {
+			slog.Error("Failed to open redis session store", "error", err)
+			os.Exit(1)
+		}
+		defer client.Close()
+		sessionStore = redis.NewSessionRedisStorage(client)
+		err = router.DefaultRouter.RegisterHealthCheck(router.HealthCheck{
+			Name:    "redis",
+			Checker: router.HealthCheckFunc(client.Ping),
+			Probes:  []string{router.ProbeReadiness, router.ProbeStartup},
+		})
+		if err != nil {
+			slog.Error("Failed to register health check", "check", "redis", "error", err)
+			os.Exit(1)
+		}
+	default:
+		slog.Error("Unsupported session store", "store", envSessionStore)
+		os.Exit(1)
+	}
+	slog.Info("Using session store", "store", envSessionStore)
+
+	// the routes are read from the config file if there is one, otherwise the default routes
+	// pass the requests on to the services at the URLs given in the environment
+	serviceURLs := v1.ServiceURLs{
+		User:             envUserServiceURL,
+		Cart:             envCartServiceURL,
+		Item:             envItemServiceURL,
+		Checkout:         envCheckoutServiceURL,
+		CartPresentation: envCartPresentationServiceURL,
+	}
+	routes := v1.DefaultRouteConfig(serviceURLs)
+	if envRoutesConfig != "" {
+		routes, err = v1.LoadRouteConfig(envRoutesConfig)
+		if err != nil {
+			slog.Error("Failed to load route config", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Using route config", "path", envRoutesConfig, "routes", len(routes.Routes))
+	}
+
+	// the identity of users is passed on to the upstream services in signed tokens
+	identityTokens, err := router.NewIdentityTokens(envIdentityTokenKey, envPreviousIdentityTokenKeys...)
+	if err != nil {
+		slog.Error("Failed to create identity token signer", "error", err)
+		os.Exit(1)
+	}
+	identityTokens.SetTTL(envIdentityTokenTTL)
+
+	// Initialize gateway. The internal routes of the user service are reserved for services,
+	// its client authenticates as the gateway.
+	userClient := clientv1.NewUserClientWithHTTPClient(envUserServiceURL, &http.Client{
+		Transport: identityTokens.Transport("gateway", nil),
+	})
+	gateway := v1.NewGateway(
+		routes,
+		userClient,
+		sessionStore,
 		envCookieEncryptionKey,
-	).RegisterRoutes(mux)
+		envPreviousCookieKeys...,
+	)
+	gateway.SetSessionTimeouts(envSessionIdleTimeout, envSessionMaxLifetime)
+	gateway.SetLoginLockout(envLoginMaxFailures, envLoginLockoutDuration)
+	// the client IP of requests forwarded by the proxies is taken from X-Forwarded-For, rate limits rely on it
+	var trustedProxies []netip.Prefix
+	for entry := range strings.SplitSeq(envTrustedProxies, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			slog.Error("Invalid trusted proxy, expected a CIDR", "value", entry, "error", err)
+			os.Exit(1)
+		}
+		trustedProxies = append(trustedProxies, prefix)
+	}
+	gateway.SetTrustedProxies(trustedProxies)
+
+	gateway.SetIdentityTokens(identityTokens)
+	// API keys are validated by the user service
+	gateway.SetAPIKeys(userClient)
+
+	// the login with an OpenID Connect provider is optional, users are provisioned by the user service
+	if envOIDCIssuerURL != "" {
+		provider, err := oidc.Discover(ctx, oidc.Config{
+			IssuerURL:    envOIDCIssuerURL,
+			ClientID:     envOIDCClientID,
+			ClientSecret: envOIDCClientSecret,
+			RedirectURL:  envOIDCRedirectURL,
+			Scopes:       strings.Fields(envOIDCScopes),
+		})
+		if err != nil {
+			slog.Error("Failed to discover OpenID Connect provider", "issuer", envOIDCIssuerURL, "error", err)
+			os.Exit(1)
+		}
+		gateway.SetOIDC(provider, userClient)
+		slog.Info("Enabled login with OpenID Connect provider", "issuer", envOIDCIssuerURL)
+	}
+
+	gateway.RegisterRoutes(mux)
+
+	// the upstreams of the routes are checked periodically, the gateway is ready while the
+	// critical services are up. The gateway keeps them in line with the route table.
+	dependencies, err := v1.NewDependencyChecker(nil, envDependencyCheckTimeout)
+	if err != nil {
+		slog.Error("Failed to create dependency checker", "error", err)
+		os.Exit(1)
+	}
+	gateway.SetDependencyChecker(dependencies, strings.FieldsFunc(envCriticalDependencies, func(r rune) bool { return r == ',' || r == ' ' }))
+	if envRoutesConfig != "" {
+		// changes of the route config are applied without a restart, including the dependencies
+		go gateway.WatchRouteConfig(ctx, envRoutesConfig, envRoutesReloadInterval)
+	}
+	mux.Handle("GET /health/dependencies", dependencies)
+	err = router.DefaultRouter.RegisterHealthCheck(router.HealthCheck{
+		Name:    "dependencies",
+		Checker: dependencies,
+		// the checker keeps the state of its periodic checks, there is nothing to cache
+		CacheTTL: -1,
+	})
+	if err != nil {
+		slog.Error("Failed to register health check", "check", "dependencies", "error", err)
+		os.Exit(1)
+	}
+	// serve the aggregated OpenAPI document of all services
+	router.DefaultRouter.SetOpenAPIFunc(gateway.OpenAPI)
 
 	err = router.DefaultRouter.Build(mux)
 	if err != nil {
@@ -92,6 +237,7 @@ func main() {
 
 	router.DefaultRouter.SetLiveness(true)
 	router.DefaultRouter.SetReady(true)
+	go dependencies.Run(ctx, envDependencyCheckInterval)
 
 	utils.StopSignalHandler(
 		func(ctx context.Context) {
@@ -53,6 +53,40 @@ const API_SERVICES = {
     }
 };
 
+// ApiError carries the RFC 7807 problem details of a failed request.
+// violations lists the invalid fields as { field, message } objects, e.g. to highlight form inputs.
+class ApiError extends Error {
+    constructor(status, problem = {}) {
+        super(problem.detail || problem.title || `HTTP error! status: ${status}`);
+        this.name = 'ApiError';
+        this.status = status;
+        this.type = problem.type || 'about:blank';
+        this.title = problem.title;
+        this.detail = problem.detail;
+        this.instance = problem.instance;
+        this.traceId = problem.trace_id;
+        this.violations = problem.violations || [];
+    }
+
+    static async fromResponse(response) {
+        const contentType = response.headers.get('content-type') || '';
+        if (contentType.includes('json')) {
+            try {
+                return new ApiError(response.status, await response.json());
+            } catch (e) {
+                // fall through to an error without details
+            }
+        }
+        return new ApiError(response.status);
+    }
+
+    // violationFor returns the message of the violation reported for the given field, if any
+    violationFor(field) {
+        const violation = this.violations.find(v => v.field === field);
+        return violation ? violation.message : null;
+    }
+}
+
 class ApiClient {
     async request(url, options = {}) {
         const config = {
@@ -72,7 +106,7 @@ class ApiClient {
             const response = await fetch(url, config);
 
             if (!response.ok) {
-                throw new Error(`HTTP error! status: ${response.status}`);
+                throw await ApiError.fromResponse(response);
             }
 
             const contentType = response.headers.get('content-type');
@@ -102,8 +136,14 @@ class ApiClient {
     }
 
     // Items API
-    async getItems(page = 1, limit = 100) {
-        return this.request(`${API_SERVICES.items}?page=${page}&limit=${limit}`);
+    async getItems(page = 1, limit = 100, sort = '') {
+        const query = new URLSearchParams({ page, limit });
+        if (sort) {
+            query.set('sort', sort);
+        }
+        // list endpoints wrap the objects in an envelope with the total count and next page link
+        const list = await this.request(`${API_SERVICES.items}?${query}`);
+        return list?.items || [];
     }
 
     async getItem(id) {
@@ -133,8 +173,14 @@ class ApiClient {
     }
 
     // Users API
-    async getUsers(page = 1, limit = 100) {
-        return this.request(`${API_SERVICES.users}?page=${page}&limit=${limit}`);
+    async getUsers(page = 1, limit = 100, sort = '') {
+        const query = new URLSearchParams({ page, limit });
+        if (sort) {
+            query.set('sort', sort);
+        }
+        // list endpoints wrap the objects in an envelope with the total count and next page link
+        const list = await this.request(`${API_SERVICES.users}?${query}`);
+        return list?.items || [];
     }
 
     async getUser(id) {
@@ -243,3 +289,4 @@ class ApiClient {
 
 // Create global API client instance
 window.apiClient = new ApiClient();
+window.ApiError = ApiError;
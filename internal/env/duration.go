@@ -0,0 +1,21 @@
+package env
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+// DurationEnvOrDefault parses a duration like "30m" or "24h", invalid values fall back to the default.
+func DurationEnvOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid duration", "key", key, "value", value, "error", err)
+		return defaultValue
+	}
+	return d
+}
@@ -0,0 +1,21 @@
+package env
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// IntEnvOrDefault parses an integer, invalid values fall back to the default.
+func IntEnvOrDefault(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid integer", "key", key, "value", value, "error", err)
+		return defaultValue
+	}
+	return i
+}
@@ -1,6 +1,9 @@
 package env
 
-import "os"
+import (
+	"os"
+	"strings"
+)
 
 func StringEnvOrDefault(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -17,3 +20,18 @@ func BytesEnvOrDefault(key string, defaultValue []byte) []byte {
 	}
 	return []byte(value)
 }
+
+// BytesSliceEnvOrDefault splits a comma separated value, empty entries are skipped.
+func BytesSliceEnvOrDefault(key string, defaultValue [][]byte) [][]byte {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var result [][]byte
+	for entry := range strings.SplitSeq(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			result = append(result, []byte(entry))
+		}
+	}
+	return result
+}
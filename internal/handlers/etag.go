@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+// Versioned is implemented by resources carrying a version for optimistic concurrency control.
+// The generic handlers return it as ETag and evaluate the conditional request headers against it.
+type Versioned interface {
+	ResourceVersion() int64
+}
+
+// VersionSetter is implemented by pointers to versioned resources.
+// HttpUpdate, HttpPatch and HttpDelete use it to pass the version of an If-Match header to the stores.
+type VersionSetter interface {
+	SetResourceVersion(version int64)
+}
+
+// ETag returns the strong entity tag of a resource version.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// weakETag returns a weak entity tag for an arbitrary response body, e.g. a list.
+func weakETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagList splits the value of an If-Match or If-None-Match header into its entity tags.
+func etagList(header string) []string {
+	var etags []string
+	for etag := range strings.SplitSeq(header, ",") {
+		if etag = strings.TrimSpace(etag); etag != "" {
+			etags = append(etags, etag)
+		}
+	}
+	return etags
+}
+
+// matchETag reports whether etag is listed in header, "*" matches any etag.
+// Weak entity tags only match if weak is set, as done by the weak comparison of RFC 9110.
+func matchETag(header, etag string, weak bool) bool {
+	for _, candidate := range etagList(header) {
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if !strings.HasPrefix(candidate, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRead evaluates the conditional headers of a GET request against the etag of the response.
+// It reports whether the client's copy is still current and a 304 Not Modified should be sent instead.
+func checkRead(r *http.Request, etag string) (bool, error) {
+	if header := r.Header.Get("If-Match"); header != "" && !matchETag(header, etag, false) {
+		return false, fmt.Errorf("%w: resource has been modified, its current ETag is %s", router.ErrPreconditionFailed, etag)
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" && matchETag(header, etag, true) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// checkWrite evaluates the conditional headers of an update or delete request against the current etag.
+func checkWrite(r *http.Request, etag string) error {
+	if header := r.Header.Get("If-Match"); header != "" && !matchETag(header, etag, false) {
+		return fmt.Errorf("%w: resource has been modified, its current ETag is %s", router.ErrPreconditionFailed, etag)
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" && matchETag(header, etag, true) {
+		return fmt.Errorf("%w: resource has not been modified, its current ETag is %s", router.ErrPreconditionFailed, etag)
+	}
+	return nil
+}
+
+// applyIfMatch passes the version of the If-Match header to obj, the stores reject the
+// modification if it does not match the stored version. Without a current representation
+// of the resource only "*" is supported in If-None-Match, which fails as the update and
+// delete endpoints never create resources.
+func applyIfMatch(r *http.Request, obj any) error {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		if slices.Equal(etagList(header), []string{"*"}) {
+			return fmt.Errorf("%w: resource exists", router.ErrPreconditionFailed)
+		}
+		return router.NewValidationError(router.Violation{Field: "If-None-Match", Message: "only * is supported for modifications"})
+	}
+
+	header := r.Header.Get("If-Match")
+	if header == "" || header == "*" {
+		return nil
+	}
+	etags := etagList(header)
+	if len(etags) != 1 {
+		return router.NewValidationError(router.Violation{Field: "If-Match", Message: "must contain a single entity tag"})
+	}
+	if strings.HasPrefix(etags[0], "W/") {
+		// weak entity tags never match in If-Match
+		return fmt.Errorf("%w: weak entity tag %s", router.ErrPreconditionFailed, etags[0])
+	}
+	version, err := strconv.ParseInt(strings.Trim(etags[0], `"`), 10, 64)
+	if err != nil || version < 1 {
+		return fmt.Errorf("%w: resource has been modified, entity tag %s is unknown", router.ErrPreconditionFailed, etags[0])
+	}
+
+	setter, ok := obj.(VersionSetter)
+	if !ok {
+		return fmt.Errorf("%w: resource is not versioned", router.ErrPreconditionFailed)
+	}
+	setter.SetResourceVersion(version)
+	return nil
+}
+
+// setETag sets the ETag header if obj is versioned.
+func setETag(w http.ResponseWriter, obj any) {
+	if v, ok := obj.(Versioned); ok {
+		w.Header().Set("ETag", ETag(v.ResourceVersion()))
+	}
+}
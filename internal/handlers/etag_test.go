@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+type versionedObject struct {
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+}
+
+func (o versionedObject) ResourceVersion() int64 { return o.Version }
+
+func (o *versionedObject) SetResourceVersion(version int64) { o.Version = version }
+
+func TestHttpGet_ETag(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{name: "unconditional", status: http.StatusOK},
+		{name: "if-none-match current", header: "If-None-Match", value: `"3"`, status: http.StatusNotModified},
+		{name: "if-none-match weak", header: "If-None-Match", value: `W/"3"`, status: http.StatusNotModified},
+		{name: "if-none-match list", header: "If-None-Match", value: `"1", "3"`, status: http.StatusNotModified},
+		{name: "if-none-match stale", header: "If-None-Match", value: `"2"`, status: http.StatusOK},
+		{name: "if-match current", header: "If-Match", value: `"3"`, status: http.StatusOK},
+		{name: "if-match stale", header: "If-Match", value: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "if-match weak", header: "If-Match", value: `W/"3"`, status: http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := HttpGet(func(ctx context.Context, r *http.Request) (*versionedObject, error) {
+				return &versionedObject{Name: "apple", Version: 3}, nil
+			})
+			req := httptest.NewRequest(http.MethodGet, "/objects/1", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if etag := rec.Header().Get("ETag"); etag != `"3"` {
+				t.Errorf("Expected ETag %q, got %q", `"3"`, etag)
+			}
+			if tt.status == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("Expected empty body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHttpList_ETag(t *testing.T) {
+	handler := HttpList(func(ctx context.Context, r *http.Request, opts FilterObjectList) ([]versionedObject, int, error) {
+		return []versionedObject{{Name: "apple", Version: 1}}, 1, nil
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/objects", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Expected status 200 with weak ETag, got %d and %q", rec.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/objects", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/objects?limit=1", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a different page, got %d", rec.Code)
+	}
+}
+
+func TestHttpUpdate_IfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		status  int
+		version int64
+	}{
+		{name: "unconditional", status: http.StatusOK, version: 2},
+		{name: "if-match", header: "If-Match", value: `"5"`, status: http.StatusOK, version: 5},
+		{name: "if-match any", header: "If-Match", value: "*", status: http.StatusOK, version: 2},
+		{name: "if-match stale", header: "If-Match", value: `"1"`, status: http.StatusPreconditionFailed},
+		{name: "if-match weak", header: "If-Match", value: `W/"5"`, status: http.StatusPreconditionFailed},
+		{name: "if-match list", header: "If-Match", value: `"4", "5"`, status: http.StatusBadRequest},
+		{name: "if-none-match any", header: "If-None-Match", value: "*", status: http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got int64
+			handler := HttpUpdate(func(ctx context.Context, r *http.Request, obj *versionedObject) error {
+				got = obj.Version
+				// mimic a store holding version 5, the body carries the stale version 2
+				if obj.Version != 2 && obj.Version != 5 {
+					return fmt.Errorf("%w: stale version %d", router.ErrPreconditionFailed, obj.Version)
+				}
+				obj.Version = 6
+				return nil
+			})
+			req := httptest.NewRequest(http.MethodPut, "/objects/1", strings.NewReader(`{"name":"apple","version":2}`))
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if got != tt.version {
+				t.Errorf("Expected update with version %d, got %d", tt.version, got)
+			}
+			if etag := rec.Header().Get("ETag"); etag != `"6"` {
+				t.Errorf("Expected ETag %q, got %q", `"6"`, etag)
+			}
+		})
+	}
+}
+
+func TestHttpDelete_IfMatch(t *testing.T) {
+	var got int64
+	handler := HttpDelete(func(ctx context.Context, r *http.Request, obj *versionedObject) error {
+		got = obj.Version
+		return nil
+	})
+	req := httptest.NewRequest(http.MethodDelete, "/objects/1", strings.NewReader(`{}`))
+	req.Header.Set("If-Match", `"7"`)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got != 7 {
+		t.Errorf("Expected delete with version 7, got %d", got)
+	}
+}
+
+func TestHttpPatch_IfMatch(t *testing.T) {
+	fetch := func(ctx context.Context, r *http.Request) (*versionedObject, error) {
+		return &versionedObject{Name: "apple", Version: 3}, nil
+	}
+	var got int64
+	update := func(ctx context.Context, r *http.Request, obj *versionedObject) error {
+		got = obj.Version
+		obj.Version++
+		return nil
+	}
+
+	for value, status := range map[string]int{`"3"`: http.StatusOK, `"2"`: http.StatusPreconditionFailed} {
+		req := httptest.NewRequest(http.MethodPatch, "/objects/1", strings.NewReader(`{"name":"pear"}`))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req.Header.Set("If-Match", value)
+		rec := httptest.NewRecorder()
+		HttpPatch(fetch, update)(rec, req)
+
+		if rec.Code != status {
+			t.Fatalf("If-Match %s: expected status %d, got %d: %s", value, status, rec.Code, rec.Body.String())
+		}
+	}
+	if got != 3 {
+		t.Errorf("Expected the update to be guarded by the fetched version 3, got %d", got)
+	}
+}
@@ -3,12 +3,25 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strings"
 
+	"github.com/leonsteinhaeuser/demo-shop/internal/patch"
 	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
 )
 
+// patchFuncs maps the content types accepted by HttpPatch to the functions applying them.
+var patchFuncs = map[string]func(doc, patch []byte) ([]byte, error){
+	patch.MergePatchContentType: patch.Merge,
+	patch.JSONPatchContentType:  patch.Apply,
+}
+
 // HttpPost handles HTTP POST requests.
+// Request bodies implementing validation.Validatable are validated before storeFunc is called.
 func HttpPost[T any](storeFunc func(context.Context, *http.Request, *T) error) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -16,125 +29,170 @@ func HttpPost[T any](storeFunc func(context.Context, *http.Request, *T) error) f
 		obj := new(T)
 		err := json.NewDecoder(r.Body).Decode(obj)
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusBadRequest,
-				Path:    r.URL.Path,
-				Message: "Invalid request body",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Invalid request body", fmt.Errorf("%w: invalid request body: %w", router.ErrValidation, err)).WriteTo(w)
+			return
+		}
+
+		if err := validation.Validate(obj, validation.Create); err != nil {
+			router.NewErrorResponse(r, "Invalid request body", err).WriteTo(w)
+			return
 		}
 
 		err = storeFunc(ctx, r, obj)
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusInternalServerError,
-				Path:    r.URL.Path,
-				Message: "Failed to store resource",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Failed to store resource", err).WriteTo(w)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		if err := json.NewEncoder(w).Encode(obj); err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusInternalServerError,
-				Path:    r.URL.Path,
-				Message: "Failed to encode response",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Failed to encode response", err).WriteTo(w)
 			return
 		}
 	}
 
 }
 
-type FilterObjectList struct {
-	Limit int
-	Page  int
+// HttpAction handles HTTP POST requests that perform an operation instead of creating a resource.
+// Request bodies implementing validation.Validatable are validated like creations before actionFunc
+// is called, its result is returned with 200 OK.
+func HttpAction[T, R any](actionFunc func(context.Context, *http.Request, *T) (*R, error)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		obj := new(T)
+		err := json.NewDecoder(r.Body).Decode(obj)
+		if err != nil {
+			router.NewErrorResponse(r, "Invalid request body", fmt.Errorf("%w: invalid request body: %w", router.ErrValidation, err)).WriteTo(w)
+			return
+		}
+		if err := validation.Validate(obj, validation.Create); err != nil {
+			router.NewErrorResponse(r, "Invalid request body", err).WriteTo(w)
+			return
+		}
+
+		result, err := actionFunc(ctx, r, obj)
+		if err != nil {
+			router.NewErrorResponse(r, "Failed to perform action", err).WriteTo(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			router.NewErrorResponse(r, "Failed to encode response", err).WriteTo(w)
+			return
+		}
+	}
 }
 
-func HttpList[T any](fetchFunc func(context.Context, *http.Request, FilterObjectList) ([]T, error)) func(w http.ResponseWriter, r *http.Request) {
+// HttpList handles HTTP GET requests for collections.
+// fetchFunc returns the requested page and the total number of objects, which are wrapped in a ListResponse.
+// The response carries a weak ETag of the page, a matching If-None-Match header results in 304 Not Modified.
+func HttpList[T any](fetchFunc func(context.Context, *http.Request, FilterObjectList) ([]T, int, error)) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
 		limit, err := QueryIntValue(r, "limit")
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusBadRequest,
-				Path:    r.URL.Path,
-				Message: "Invalid limit query parameter",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Invalid limit query parameter", queryParameterError("limit", err)).WriteTo(w)
 			return
 		}
 
 		page, err := QueryIntValue(r, "page")
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusBadRequest,
-				Path:    r.URL.Path,
-				Message: "Invalid page query parameter",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Invalid page query parameter", queryParameterError("page", err)).WriteTo(w)
 			return
 		}
 
+		sort, err := ParseSort(QueryStringValue(r, "sort"))
+		if err != nil {
+			router.NewErrorResponse(r, "Invalid sort query parameter", queryParameterError("sort", err)).WriteTo(w)
+			return
+		}
+
+		if page < 1 {
+			page = 1
+		}
 		fobj := FilterObjectList{
 			Limit: limit,
 			Page:  page,
+			Sort:  sort,
+		}
+		if fobj.Offset() > MaxListOffset {
+			router.NewErrorResponse(r, "Invalid page query parameter", queryParameterError("page", fmt.Errorf("the page must not skip more than %d objects", MaxListOffset))).WriteTo(w)
+			return
 		}
 
-		result, err := fetchFunc(ctx, r, fobj)
+		objects, total, err := fetchFunc(ctx, r, fobj)
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusBadRequest,
-				Path:    r.URL.Path,
-				Message: "Failed to fetch resources",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Failed to fetch resources", err).WriteTo(w)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(result); err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusInternalServerError,
-				Path:    r.URL.Path,
-				Message: "Failed to encode response",
-				Error:   err.Error(),
-			}).WriteTo(w)
+		if objects == nil {
+			objects = []T{}
+		}
+		result := ListResponse[T]{
+			Items: objects,
+			Total: total,
+			Page:  fobj.Page,
+			Limit: fobj.Limit,
+			Next:  nextPageLink(r, fobj, total),
+		}
+		body, err := json.Marshal(result)
+		if err != nil {
+			router.NewErrorResponse(r, "Failed to encode response", err).WriteTo(w)
 			return
 		}
+		etag := weakETag(body)
+		w.Header().Set("ETag", etag)
+		if header := r.Header.Get("If-None-Match"); header != "" && matchETag(header, etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(body, '\n'))
 	}
 }
 
+// HttpGet handles HTTP GET requests for single objects.
+// Objects implementing Versioned are returned with an ETag, If-None-Match results in 304 Not Modified
+// if the object did not change and If-Match in 412 Precondition Failed if it did.
 func HttpGet[T any](fetchFunc func(context.Context, *http.Request) (*T, error)) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		result, err := fetchFunc(ctx, r)
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusNotFound,
-				Path:    r.URL.Path,
-				Message: "Resource not found",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Failed to fetch resource", err).WriteTo(w)
 			return
 		}
+		if v, ok := any(result).(Versioned); ok {
+			etag := ETag(v.ResourceVersion())
+			w.Header().Set("ETag", etag)
+			notModified, err := checkRead(r, etag)
+			if err != nil {
+				router.NewErrorResponse(r, "Precondition failed", err).WriteTo(w)
+				return
+			}
+			if notModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(result); err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusBadRequest,
-				Path:    r.URL.Path,
-				Message: "Failed to encode response",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Failed to encode response", err).WriteTo(w)
 			return
 		}
 	}
 }
 
+// HttpUpdate handles HTTP PUT requests.
+// Request bodies implementing validation.Validatable are validated before updateFunc is called.
+// The version of an If-Match header is passed to updateFunc as expected version of objects
+// implementing VersionSetter, the stores reject the update if the object has been modified since.
+// If-None-Match: * fails as PUT never creates objects.
 func HttpUpdate[T any](updateFunc func(context.Context, *http.Request, *T) error) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -142,38 +200,104 @@ func HttpUpdate[T any](updateFunc func(context.Context, *http.Request, *T) error
 		obj := new(T)
 		err := json.NewDecoder(r.Body).Decode(obj)
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusBadRequest,
-				Path:    r.URL.Path,
-				Message: "Invalid request body",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Invalid request body", fmt.Errorf("%w: invalid request body: %w", router.ErrValidation, err)).WriteTo(w)
+			return
+		}
+		if err := validation.Validate(obj, validation.Update); err != nil {
+			router.NewErrorResponse(r, "Invalid request body", err).WriteTo(w)
+			return
+		}
+		if err := applyIfMatch(r, obj); err != nil {
+			router.NewErrorResponse(r, "Precondition failed", err).WriteTo(w)
+			return
+		}
+		err = updateFunc(ctx, r, obj)
+		if err != nil {
+			router.NewErrorResponse(r, "Failed to update resource", err).WriteTo(w)
+			return
+		}
+		setETag(w, obj)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(obj); err != nil {
+			router.NewErrorResponse(r, "Failed to encode response", err).WriteTo(w)
+			return
+		}
+	}
+}
+
+// HttpPatch handles HTTP PATCH requests.
+// The request body is either a JSON Merge Patch or a JSON Patch, selected by the content type.
+// It is applied to the JSON encoding of the object returned by fetchFunc, the patched object
+// is validated like an update and passed to updateFunc.
+// If-Match and If-None-Match are evaluated against the fetched object. Its version is kept
+// in the patched object, so the stores reject the update if the object has been modified since.
+func HttpPatch[T any](fetchFunc func(context.Context, *http.Request) (*T, error), updateFunc func(context.Context, *http.Request, *T) error) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		apply, ok := patchFuncs[mediaType]
+		if !ok {
+			w.Header().Set("Accept-Patch", strings.Join([]string{patch.MergePatchContentType, patch.JSONPatchContentType}, ", "))
+			router.NewErrorResponse(r, "Unsupported patch format", fmt.Errorf("%w: %q, use %s or %s", router.ErrUnsupportedMediaType, mediaType, patch.MergePatchContentType, patch.JSONPatchContentType)).WriteTo(w)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			router.NewErrorResponse(r, "Invalid request body", fmt.Errorf("%w: invalid request body: %w", router.ErrValidation, err)).WriteTo(w)
+			return
+		}
+
+		current, err := fetchFunc(ctx, r)
+		if err != nil {
+			router.NewErrorResponse(r, "Failed to fetch resource", err).WriteTo(w)
+			return
+		}
+		if v, ok := any(current).(Versioned); ok {
+			if err := checkWrite(r, ETag(v.ResourceVersion())); err != nil {
+				router.NewErrorResponse(r, "Precondition failed", err).WriteTo(w)
+				return
+			}
+		}
+		doc, err := json.Marshal(current)
+		if err != nil {
+			router.NewErrorResponse(r, "Failed to encode resource", err).WriteTo(w)
+			return
+		}
+		patched, err := apply(doc, body)
+		if err != nil {
+			router.NewErrorResponse(r, "Failed to apply patch", err).WriteTo(w)
+			return
+		}
+
+		obj := new(T)
+		if err := json.Unmarshal(patched, obj); err != nil {
+			router.NewErrorResponse(r, "Invalid patch", fmt.Errorf("%w: patched resource is invalid: %w", router.ErrValidation, err)).WriteTo(w)
+			return
+		}
+		if err := validation.Validate(obj, validation.Update); err != nil {
+			router.NewErrorResponse(r, "Invalid patch", err).WriteTo(w)
 			return
 		}
 		err = updateFunc(ctx, r, obj)
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusBadRequest,
-				Path:    r.URL.Path,
-				Message: "Failed to update resource",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Failed to update resource", err).WriteTo(w)
 			return
 		}
+		setETag(w, obj)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(w).Encode(obj); err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusInternalServerError,
-				Path:    r.URL.Path,
-				Message: "Failed to encode response",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Failed to encode response", err).WriteTo(w)
 			return
 		}
 	}
 }
 
+// HttpDelete handles HTTP DELETE requests.
+// Like HttpUpdate the version of an If-Match header is passed to deleteFunc as expected version.
 func HttpDelete[T any](deleteFunc func(context.Context, *http.Request, *T) error) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -181,33 +305,27 @@ func HttpDelete[T any](deleteFunc func(context.Context, *http.Request, *T) error
 		obj := new(T)
 		err := json.NewDecoder(r.Body).Decode(obj)
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusBadRequest,
-				Path:    r.URL.Path,
-				Message: "Invalid request body",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Invalid request body", fmt.Errorf("%w: invalid request body: %w", router.ErrValidation, err)).WriteTo(w)
+			return
+		}
+		if err := applyIfMatch(r, obj); err != nil {
+			router.NewErrorResponse(r, "Precondition failed", err).WriteTo(w)
 			return
 		}
 		err = deleteFunc(ctx, r, obj)
 		if err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusBadRequest,
-				Path:    r.URL.Path,
-				Message: "Failed to delete resource",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Failed to delete resource", err).WriteTo(w)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 		if err := json.NewEncoder(w).Encode(nil); err != nil {
-			(&router.ErrorResponse{
-				Status:  http.StatusInternalServerError,
-				Path:    r.URL.Path,
-				Message: "Failed to encode response",
-				Error:   err.Error(),
-			}).WriteTo(w)
+			router.NewErrorResponse(r, "Failed to encode response", err).WriteTo(w)
 			return
 		}
 	}
 }
+
+// queryParameterError reports an invalid query parameter as validation error.
+func queryParameterError(name string, err error) error {
+	return router.NewValidationError(router.Violation{Field: name, Message: err.Error()})
+}
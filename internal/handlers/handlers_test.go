@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/patch"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/validation"
+)
+
+type testObject struct {
+	Name     string   `json:"name"`
+	Quantity int      `json:"quantity"`
+	Tags     []string `json:"tags"`
+}
+
+func (o testObject) Validate(op validation.Operation) error {
+	var v validation.Violations
+	v.NotEmpty("name", o.Name)
+	v.Check(o.Quantity >= 0, "quantity", "cannot be negative")
+	return v.Err()
+}
+
+func TestHttpPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		want        testObject
+	}{
+		{
+			name:        "merge patch",
+			contentType: patch.MergePatchContentType,
+			body:        `{"quantity":3}`,
+			status:      http.StatusOK,
+			want:        testObject{Name: "apple", Quantity: 3, Tags: []string{"fruit"}},
+		},
+		{
+			name:        "merge patch with charset",
+			contentType: patch.MergePatchContentType + "; charset=utf-8",
+			body:        `{"tags":null}`,
+			status:      http.StatusOK,
+			want:        testObject{Name: "apple", Quantity: 1},
+		},
+		{
+			name:        "json patch",
+			contentType: patch.JSONPatchContentType,
+			body:        `[{"op":"test","path":"/quantity","value":1},{"op":"add","path":"/tags/-","value":"red"}]`,
+			status:      http.StatusOK,
+			want:        testObject{Name: "apple", Quantity: 1, Tags: []string{"fruit", "red"}},
+		},
+		{
+			name:        "failed json patch test",
+			contentType: patch.JSONPatchContentType,
+			body:        `[{"op":"test","path":"/quantity","value":2},{"op":"replace","path":"/quantity","value":3}]`,
+			status:      http.StatusConflict,
+		},
+		{
+			name:        "invalid result",
+			contentType: patch.MergePatchContentType,
+			body:        `{"name":"","quantity":-1}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "result of wrong type",
+			contentType: patch.MergePatchContentType,
+			body:        `{"quantity":"many"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "full object",
+			contentType: "application/json",
+			body:        `{"name":"pear"}`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated *testObject
+			handler := HttpPatch(
+				func(ctx context.Context, r *http.Request) (*testObject, error) {
+					return &testObject{Name: "apple", Quantity: 1, Tags: []string{"fruit"}}, nil
+				},
+				func(ctx context.Context, r *http.Request, obj *testObject) error {
+					updated = obj
+					return nil
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodPatch, "/objects/1", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				if updated != nil {
+					t.Error("Expected update not to be called")
+				}
+				if tt.status == http.StatusUnsupportedMediaType && rec.Header().Get("Accept-Patch") == "" {
+					t.Error("Expected Accept-Patch header")
+				}
+				return
+			}
+
+			var got testObject
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got.Name != tt.want.Name || got.Quantity != tt.want.Quantity || strings.Join(got.Tags, ",") != strings.Join(tt.want.Tags, ",") {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+			if updated == nil || updated.Quantity != tt.want.Quantity {
+				t.Errorf("Expected update to be called with %+v, got %+v", tt.want, updated)
+			}
+		})
+	}
+}
+
+func TestHttpPatch_FetchError(t *testing.T) {
+	handler := HttpPatch(
+		func(ctx context.Context, r *http.Request) (*testObject, error) {
+			return nil, router.ErrNotFound
+		},
+		func(ctx context.Context, r *http.Request, obj *testObject) error {
+			t.Error("Expected update not to be called")
+			return nil
+		},
+	)
+
+	req := httptest.NewRequest(http.MethodPatch, "/objects/1", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", patch.MergePatchContentType)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestHttpAction(t *testing.T) {
+	handler := HttpAction(func(ctx context.Context, r *http.Request, obj *testObject) (*testObject, error) {
+		if obj.Name == "unknown" {
+			return nil, router.ErrUnauthorized
+		}
+		return &testObject{Name: obj.Name, Quantity: obj.Quantity * 2}, nil
+	})
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "success", body: `{"name":"apple","quantity":2}`, status: http.StatusOK},
+		{name: "invalid body", body: `{"name":""}`, status: http.StatusBadRequest},
+		{name: "malformed body", body: `{`, status: http.StatusBadRequest},
+		{name: "action error", body: `{"name":"unknown"}`, status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/objects/double", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got testObject
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got.Name != "apple" || got.Quantity != 4 {
+				t.Errorf("Expected the result of the action, got %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// FilterObjectList contains the pagination and sort options of a list request.
+type FilterObjectList struct {
+	// Page is the requested page, starting at 1. Values below 1 are treated as 1.
+	Page int
+	// Limit is the maximum number of objects per page. Values below 1 disable pagination.
+	Limit int
+	// Sort lists the fields to order by, in order of precedence.
+	// Objects are always ordered by creation time and ID last to keep pages stable.
+	Sort []SortField
+}
+
+// MaxListOffset is the largest number of objects a list request may skip, requests for pages
+// beyond it are rejected by HttpList.
+const MaxListOffset = math.MaxInt32
+
+// Offset returns the number of objects to skip for the requested page.
+// It is capped at math.MaxInt for pages whose offset does not fit into an int.
+func (f FilterObjectList) Offset() int {
+	if f.Limit <= 0 || f.Page <= 1 {
+		return 0
+	}
+	if f.Page-1 > math.MaxInt/f.Limit {
+		return math.MaxInt
+	}
+	return (f.Page - 1) * f.Limit
+}
+
+// SortField is a single field of the sort query parameter.
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// ParseSort parses a sort query parameter like "name,-price".
+// A leading "-" sorts the field in descending order, a leading "+" or none in ascending order.
+func ParseSort(value string) ([]SortField, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	fields := []SortField{}
+	for _, raw := range strings.Split(value, ",") {
+		raw = strings.TrimSpace(raw)
+		field := SortField{Field: raw}
+		switch {
+		case strings.HasPrefix(raw, "-"):
+			field = SortField{Field: raw[1:], Descending: true}
+		case strings.HasPrefix(raw, "+"):
+			field = SortField{Field: raw[1:]}
+		}
+		if field.Field == "" {
+			return nil, fmt.Errorf("invalid sort field %q", raw)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Query encodes the options as query parameters understood by HttpList.
+func (f FilterObjectList) Query() url.Values {
+	query := url.Values{}
+	if f.Page > 0 {
+		query.Set("page", strconv.Itoa(f.Page))
+	}
+	if f.Limit > 0 {
+		query.Set("limit", strconv.Itoa(f.Limit))
+	}
+	if len(f.Sort) > 0 {
+		fields := make([]string, 0, len(f.Sort))
+		for _, field := range f.Sort {
+			if field.Descending {
+				fields = append(fields, "-"+field.Field)
+				continue
+			}
+			fields = append(fields, field.Field)
+		}
+		query.Set("sort", strings.Join(fields, ","))
+	}
+	return query
+}
+
+// ListResponse is the envelope returned by list endpoints.
+type ListResponse[T any] struct {
+	Items []T `json:"items"`
+	// Total is the number of objects across all pages.
+	Total int `json:"total"`
+	Page  int `json:"page"`
+	Limit int `json:"limit,omitempty"`
+	// Next links to the following page and is empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// nextPageLink returns the link to the page following the one requested by r,
+// or an empty string if there is none.
+func nextPageLink(r *http.Request, filters FilterObjectList, total int) string {
+	// compared by subtraction, multiplying the page could overflow
+	if filters.Limit <= 0 || total-filters.Offset() <= filters.Limit {
+		return ""
+	}
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(filters.Page+1))
+	query.Set("limit", strconv.Itoa(filters.Limit))
+	return r.URL.Path + "?" + query.Encode()
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	fields, err := ParseSort("name, -price,+quantity")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []SortField{{Field: "name"}, {Field: "price", Descending: true}, {Field: "quantity"}}
+	if len(fields) != len(want) {
+		t.Fatalf("Expected %d fields, got %d", len(want), len(fields))
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("Expected field %d to be %+v, got %+v", i, want[i], fields[i])
+		}
+	}
+
+	if _, err := ParseSort("name,,price"); err == nil {
+		t.Error("Expected error for empty sort field")
+	}
+}
+
+func TestHttpList_Envelope(t *testing.T) {
+	objects := []string{"a", "b", "c", "d", "e"}
+	handler := HttpList(func(ctx context.Context, r *http.Request, filters FilterObjectList) ([]string, int, error) {
+		end := min(filters.Offset()+filters.Limit, len(objects))
+		return objects[filters.Offset():end], len(objects), nil
+	})
+
+	tests := []struct {
+		name string
+		url  string
+		want ListResponse[string]
+	}{
+		{
+			name: "first page",
+			url:  "/api/v1/core/letters?limit=2&sort=-name",
+			want: ListResponse[string]{Items: []string{"a", "b"}, Total: 5, Page: 1, Limit: 2, Next: "/api/v1/core/letters?limit=2&page=2&sort=-name"},
+		},
+		{
+			name: "last page",
+			url:  "/api/v1/core/letters?page=3&limit=2",
+			want: ListResponse[string]{Items: []string{"e"}, Total: 5, Page: 3, Limit: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rec.Code)
+			}
+			var got ListResponse[string]
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got.Total != tt.want.Total || got.Page != tt.want.Page || got.Limit != tt.want.Limit || got.Next != tt.want.Next {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+			if len(got.Items) != len(tt.want.Items) {
+				t.Errorf("Expected items %v, got %v", tt.want.Items, got.Items)
+			}
+		})
+	}
+}
+
+func TestHttpList_HugePage(t *testing.T) {
+	called := false
+	handler := HttpList(func(ctx context.Context, r *http.Request, filters FilterObjectList) ([]string, int, error) {
+		called = true
+		return nil, 0, nil
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/core/letters?page=4611686018427387904&limit=4", nil))
+	if rec.Code != http.StatusBadRequest || called {
+		t.Errorf("Expected status 400 without fetching the objects, got %d", rec.Code)
+	}
+	if offset := (FilterObjectList{Page: 4611686018427387904, Limit: 4}).Offset(); offset != math.MaxInt {
+		t.Errorf("Expected the offset to be capped, got %d", offset)
+	}
+}
+
+func TestHttpList_InvalidSort(t *testing.T) {
+	handler := HttpList(func(ctx context.Context, r *http.Request, filters FilterObjectList) ([]string, int, error) {
+		return nil, 0, nil
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/core/letters?sort=-", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
@@ -5,17 +5,18 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
 )
 
 // GetUUIDFromPathValue retrieves a UUID from the request path value.
 func GetUUIDFromPathValue(r *http.Request, name string) (uuid.UUID, error) {
 	sid := r.PathValue(name)
 	if sid == "" {
-		return uuid.Nil, fmt.Errorf("missing path value for property: %s", name)
+		return uuid.Nil, fmt.Errorf("%w: missing path value for property: %s", router.ErrValidation, name)
 	}
 	id, err := uuid.Parse(sid)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, fmt.Errorf("%w: invalid %s: %w", router.ErrValidation, name, err)
 	}
 	return id, nil
 }
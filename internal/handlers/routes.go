@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/openapi"
+	"github.com/leonsteinhaeuser/demo-shop/internal/patch"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+// The route constructors wrap the generic handlers into router.PathObjects
+// whose OpenAPI spec is derived from the type parameters of the handlers.
+
+// listQueryParameters are the query parameters supported by HttpList.
+var listQueryParameters = []openapi.Parameter{
+	{Name: "page", In: "query", Description: "Page to return, starting at 1", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+	{Name: "limit", In: "query", Description: "Maximum number of items per page, all items are returned if omitted", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+	{Name: "sort", In: "query", Description: "Comma separated fields to sort by, prefixed with - for descending order", Schema: &openapi.Schema{Type: "string"}},
+}
+
+// Post returns a route serving storeFunc with HttpPost.
+func Post[T any](path string, storeFunc func(context.Context, *http.Request, *T) error) router.PathObject {
+	t := reflect.TypeFor[T]()
+	return router.PathObject{
+		Path:   path,
+		Method: http.MethodPost,
+		Func:   HttpPost(storeFunc),
+		Spec: &openapi.Spec{
+			Summary:  "Create " + t.Name(),
+			Request:  t,
+			Response: t,
+			Status:   http.StatusCreated,
+		},
+	}
+}
+
+// Action returns a POST route serving actionFunc with HttpAction.
+// Actions are not derived from a resource, summary describes the operation in the OpenAPI document.
+func Action[T, R any](path, summary string, actionFunc func(context.Context, *http.Request, *T) (*R, error)) router.PathObject {
+	return router.PathObject{
+		Path:   path,
+		Method: http.MethodPost,
+		Func:   HttpAction(actionFunc),
+		Spec: &openapi.Spec{
+			Summary:  summary,
+			Request:  reflect.TypeFor[T](),
+			Response: reflect.TypeFor[R](),
+		},
+	}
+}
+
+// List returns a route serving fetchFunc with HttpList.
+func List[T any](path string, fetchFunc func(context.Context, *http.Request, FilterObjectList) ([]T, int, error)) router.PathObject {
+	return router.PathObject{
+		Path:   path,
+		Method: http.MethodGet,
+		Func:   HttpList(fetchFunc),
+		Spec: &openapi.Spec{
+			Summary:  "List " + reflect.TypeFor[T]().Name() + " objects",
+			Query:    listQueryParameters,
+			Response: reflect.TypeFor[ListResponse[T]](),
+		},
+	}
+}
+
+// Get returns a route serving fetchFunc with HttpGet.
+func Get[T any](path string, fetchFunc func(context.Context, *http.Request) (*T, error)) router.PathObject {
+	t := reflect.TypeFor[T]()
+	return router.PathObject{
+		Path:   path,
+		Method: http.MethodGet,
+		Func:   HttpGet(fetchFunc),
+		Spec: &openapi.Spec{
+			Summary:  "Get " + t.Name(),
+			Response: t,
+		},
+	}
+}
+
+// Update returns a route serving updateFunc with HttpUpdate.
+func Update[T any](path string, updateFunc func(context.Context, *http.Request, *T) error) router.PathObject {
+	t := reflect.TypeFor[T]()
+	return router.PathObject{
+		Path:   path,
+		Method: http.MethodPut,
+		Func:   HttpUpdate(updateFunc),
+		Spec: &openapi.Spec{
+			Summary:  "Update " + t.Name(),
+			Request:  t,
+			Response: t,
+		},
+	}
+}
+
+// Patch returns a route serving fetchFunc and updateFunc with HttpPatch.
+func Patch[T any](path string, fetchFunc func(context.Context, *http.Request) (*T, error), updateFunc func(context.Context, *http.Request, *T) error) router.PathObject {
+	t := reflect.TypeFor[T]()
+	return router.PathObject{
+		Path:   path,
+		Method: http.MethodPatch,
+		Func:   HttpPatch(fetchFunc, updateFunc),
+		Spec: &openapi.Spec{
+			Summary: "Partially update " + t.Name(),
+			RequestContent: map[string]reflect.Type{
+				patch.MergePatchContentType: t,
+				patch.JSONPatchContentType:  reflect.TypeFor[[]patch.Operation](),
+			},
+			Response: t,
+		},
+	}
+}
+
+// Delete returns a route serving deleteFunc with HttpDelete.
+func Delete[T any](path string, deleteFunc func(context.Context, *http.Request, *T) error) router.PathObject {
+	t := reflect.TypeFor[T]()
+	return router.PathObject{
+		Path:   path,
+		Method: http.MethodDelete,
+		Func:   HttpDelete(deleteFunc),
+		Spec: &openapi.Spec{
+			Summary: "Delete " + t.Name(),
+			Request: t,
+			Status:  http.StatusNoContent,
+		},
+	}
+}
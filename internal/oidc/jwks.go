@@ -0,0 +1,198 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval limits how often the key set is fetched because of unknown key IDs,
+// tokens with made up key IDs must not make the relying party flood the provider.
+const minRefreshInterval = 30 * time.Second
+
+// keySet caches the JSON Web Key Set of a provider
+type keySet struct {
+	client          *http.Client
+	url             string
+	refreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newKeySet(client *http.Client, url string) *keySet {
+	return &keySet{
+		client:          client,
+		url:             url,
+		refreshInterval: minRefreshInterval,
+	}
+}
+
+// jsonWebKey is a public key of a JSON Web Key Set, RFC 7517
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// key returns the key with the ID. Tokens without a key ID are accepted if the provider
+// publishes a single key. Unknown keys cause the key set to be fetched again.
+func (s *keySet) key(ctx context.Context, id string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.lookup(id); ok {
+		return key, nil
+	}
+	if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < s.refreshInterval {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	if err := s.fetch(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := s.lookup(id); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", id)
+}
+
+func (s *keySet) lookup(id string) (crypto.PublicKey, bool) {
+	if id == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[id]
+	return key, ok
+}
+
+// fetch replaces the cached keys by the keys published by the provider
+func (s *keySet) fetch(ctx context.Context) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, s.client, s.url, &set); err != nil {
+		return fmt.Errorf("failed to fetch key set: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// keys of unsupported types are skipped, the provider may publish them for other clients
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeSegmentBytes(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegmentBytes(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("unsupported RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeSegmentBytes(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegmentBytes(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("malformed EC key")
+		}
+		// crypto/ecdh rejects points that are not on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// verifySignature verifies the signature of the signed part of a token. The algorithm has to
+// match the type of the key, tokens cannot choose a weaker algorithm or none at all.
+func verifySignature(key crypto.PublicKey, algorithm, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch algorithm {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 token signed with a non-RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("ES256 token signed with a non-EC key")
+		}
+		if len(signature) != 64 {
+			return errors.New("malformed signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+}
+
+func decodeSegmentBytes(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
+
+func decodeSegment(segment string, v any) error {
+	raw, err := decodeSegmentBytes(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
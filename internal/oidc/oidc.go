@@ -0,0 +1,308 @@
+// Package oidc implements the relying party of the OpenID Connect authorization code flow
+// with Proof Key for Code Exchange (PKCE, RFC 7636).
+//
+// A Provider is configured from the discovery document of the identity provider. ID tokens
+// are verified against the JSON Web Key Set of the provider, which is cached and fetched
+// again when a token has been signed with an unknown key, e.g. after the provider rotated
+// its keys. RS256 and ES256 signatures are supported.
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// clockSkew tolerates clock differences between the provider and the relying party
+	clockSkew = time.Minute
+	// maxResponseSize limits the size of the documents read from the provider
+	maxResponseSize = 1 << 20
+	// defaultTimeout is the timeout of requests to the provider if no HTTP client is configured
+	defaultTimeout = 10 * time.Second
+)
+
+var (
+	// ErrInvalidToken is returned for ID tokens that are malformed, have an invalid signature
+	// or claims that do not match the expectations of the relying party.
+	ErrInvalidToken = errors.New("invalid ID token")
+	// ErrExchangeFailed is returned if the provider rejected the exchange of an authorization code.
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+)
+
+// Config configures the client registered at the provider.
+type Config struct {
+	// IssuerURL identifies the provider, the discovery document is served below it
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback the provider redirects to after the login
+	RedirectURL string
+	// Scopes are requested during the login, openid is added if missing
+	Scopes []string
+	// HTTPClient is used for requests to the provider, defaults to a client with a timeout
+	HTTPClient *http.Client
+}
+
+// metadata is the part of the discovery document used by the relying party
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider the relying party has been registered at.
+// It is safe for concurrent use.
+type Provider struct {
+	config   Config
+	metadata metadata
+	keys     *keySet
+	now      func() time.Time
+}
+
+// Discover fetches the discovery document of the provider and returns the provider.
+func Discover(ctx context.Context, config Config) (*Provider, error) {
+	if config.IssuerURL == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("issuer URL, client ID and redirect URL are required")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: defaultTimeout}
+	}
+	if !slices.Contains(config.Scopes, "openid") {
+		config.Scopes = append([]string{"openid"}, config.Scopes...)
+	}
+
+	var md metadata
+	discoveryURL := strings.TrimSuffix(config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, config.HTTPClient, discoveryURL, &md); err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	// the issuer has to match exactly, otherwise a provider could impersonate another one
+	if md.Issuer != config.IssuerURL {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", md.Issuer, config.IssuerURL)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.New("discovery document lacks the authorization, token or JWKS endpoint")
+	}
+
+	return &Provider{
+		config:   config,
+		metadata: md,
+		keys:     newKeySet(config.HTTPClient, md.JWKSURI),
+		now:      time.Now,
+	}, nil
+}
+
+// Issuer returns the issuer identifier of the provider.
+func (p *Provider) Issuer() string {
+	return p.metadata.Issuer
+}
+
+// AuthCodeURL returns the URL of the provider the user is redirected to for the login.
+// state and nonce are checked once the user returns, the code challenge is derived from the
+// code verifier passed to Exchange with CodeChallenge.
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	u, err := url.Parse(p.metadata.AuthorizationEndpoint)
+	if err != nil {
+		// the endpoint is taken from the discovery document as is, the request will fail at the provider
+		return p.metadata.AuthorizationEndpoint
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", strings.Join(p.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Token is the response of the token endpoint
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+	IDToken     string `json:"id_token"`
+}
+
+// tokenError is the error response of the token endpoint
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// Exchange exchanges the authorization code for the tokens of the user. It fails with an
+// error wrapping ErrExchangeFailed if the provider rejected the code or the code verifier.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.config.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		// client_secret_basic requires the credentials to be form encoded, RFC 6749 section 2.3.1
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var tokenErr tokenError
+		if json.Unmarshal(body, &tokenErr) == nil && tokenErr.Error != "" {
+			return nil, fmt.Errorf("%w: %s: %s", ErrExchangeFailed, tokenErr.Error, tokenErr.Description)
+		}
+		return nil, fmt.Errorf("%w: token endpoint returned status %d", ErrExchangeFailed, resp.StatusCode)
+	}
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response lacks the ID token", ErrExchangeFailed)
+	}
+	return &token, nil
+}
+
+// Audience is the aud claim, a single string or an array of strings
+type Audience []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings: %w", err)
+	}
+	*a = list
+	return nil
+}
+
+// Claims are the claims of an ID token used by the relying party
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        Audience `json:"aud"`
+	AuthorizedParty string   `json:"azp,omitempty"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce,omitempty"`
+
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	Locale            string `json:"locale,omitempty"`
+}
+
+// joseHeader is the header of a JSON Web Token
+type joseHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// VerifyIDToken verifies the signature and the claims of the ID token and returns the claims.
+// The token has to be issued by the provider for the client, must not have expired and has
+// to carry the nonce sent with the login. It fails with an error wrapping ErrInvalidToken.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	var header joseHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %w", ErrInvalidToken, err)
+	}
+	signature, err := decodeSegmentBytes(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %w", ErrInvalidToken, err)
+	}
+	key, err := p.keys.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if err := verifySignature(key, header.Algorithm, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %w", ErrInvalidToken, err)
+	}
+	if err := p.checkClaims(&claims, nonce); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return &claims, nil
+}
+
+// checkClaims validates the claims of an ID token as required by OpenID Connect Core 1.0 section 3.1.3.7
+func (p *Provider) checkClaims(claims *Claims, nonce string) error {
+	now := p.now()
+	switch {
+	case claims.Issuer != p.metadata.Issuer:
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case !slices.Contains(claims.Audience, p.config.ClientID):
+		return fmt.Errorf("token has not been issued for client %q", p.config.ClientID)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != "" && claims.AuthorizedParty != p.config.ClientID:
+		return fmt.Errorf("token has been issued for party %q", claims.AuthorizedParty)
+	case now.Add(-clockSkew).Unix() >= claims.ExpiresAt:
+		return errors.New("token has expired")
+	case claims.IssuedAt > now.Add(clockSkew).Unix():
+		return errors.New("token has been issued in the future")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return errors.New("nonce mismatch")
+	case claims.Subject == "":
+		return errors.New("missing subject")
+	}
+	return nil
+}
+
+// getJSON fetches the JSON document from the URL and decodes it into v
+func getJSON(ctx context.Context, client *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
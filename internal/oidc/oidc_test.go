@@ -0,0 +1,249 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/oidc/oidctest"
+)
+
+const (
+	testClientID     = "demo-shop"
+	testClientSecret = "client secret"
+	testRedirectURL  = "https://shop.example.com/api/v1/auth/oidc/callback"
+)
+
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+	idp := oidctest.NewProvider(t, testClientID, testClientSecret)
+	provider, err := Discover(context.Background(), Config{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"email", "profile"},
+	})
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	return idp, provider
+}
+
+// authorize follows the login at the provider and returns the code and state it redirected back with
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected a redirect from the provider, got status %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURL) {
+		t.Fatalf("Expected a redirect to %s, got %s", testRedirectURL, location)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// test vector of RFC 7636 appendix B
+	if got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("Expected the challenge of the RFC test vector, got %s", got)
+	}
+	verifier := NewCodeVerifier()
+	if len(verifier) != 43 || verifier == NewCodeVerifier() {
+		t.Errorf("Expected random verifiers of 43 characters, got %q", verifier)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	idp := oidctest.NewProvider(t, testClientID, testClientSecret)
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "valid", config: Config{IssuerURL: idp.Issuer(), ClientID: testClientID, RedirectURL: testRedirectURL}},
+		{name: "issuer mismatch", config: Config{IssuerURL: idp.Issuer() + "/", ClientID: testClientID, RedirectURL: testRedirectURL}, wantErr: true},
+		{name: "missing client ID", config: Config{IssuerURL: idp.Issuer(), RedirectURL: testRedirectURL}, wantErr: true},
+		{name: "unreachable", config: Config{IssuerURL: "http://127.0.0.1:1", ClientID: testClientID, RedirectURL: testRedirectURL}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := Discover(context.Background(), tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && provider.Issuer() != idp.Issuer() {
+				t.Errorf("Expected issuer %s, got %s", idp.Issuer(), provider.Issuer())
+			}
+		})
+	}
+}
+
+func TestProvider_AuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	idp, provider := newTestProvider(t)
+	idp.SetClaims(map[string]any{"sub": "248289761001", "email": "jane@example.com", "email_verified": true, "given_name": "Jane"})
+
+	verifier := NewCodeVerifier()
+	authURL := provider.AuthCodeURL("state", "nonce", CodeChallenge(verifier))
+	if scope := mustParseURL(t, authURL).Query().Get("scope"); scope != "openid email profile" {
+		t.Errorf("Expected the openid scope to be requested, got %q", scope)
+	}
+	code, state := authorize(t, authURL)
+	if state != "state" {
+		t.Errorf("Expected the state to be returned, got %q", state)
+	}
+
+	token, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, "nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken failed: %v", err)
+	}
+	if claims.Subject != "248289761001" || claims.Email != "jane@example.com" || !claims.EmailVerified || claims.GivenName != "Jane" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier); !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("Expected a code to be exchanged once, got %v", err)
+	}
+	code, _ = authorize(t, provider.AuthCodeURL("state", "nonce", CodeChallenge(verifier)))
+	if _, err := provider.Exchange(ctx, code, NewCodeVerifier()); !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("Expected the exchange to fail with another code verifier, got %v", err)
+	}
+}
+
+func TestProvider_VerifyIDToken(t *testing.T) {
+	idp, provider := newTestProvider(t)
+	other := oidctest.NewProvider(t, testClientID, testClientSecret)
+
+	with := func(claims map[string]any, key string, value any) map[string]any {
+		claims[key] = value
+		return claims
+	}
+	without := func(claims map[string]any, key string) map[string]any {
+		delete(claims, key)
+		return claims
+	}
+	now := time.Now()
+	valid := idp.SignToken(t, idp.IDTokenClaims("nonce"))
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: valid},
+		{name: "audience list", token: idp.SignToken(t, with(idp.IDTokenClaims("nonce"), "aud", []string{"other", testClientID}))},
+		{name: "other audience", token: idp.SignToken(t, with(idp.IDTokenClaims("nonce"), "aud", "other")), wantErr: true},
+		{name: "other authorized party", token: idp.SignToken(t, with(with(idp.IDTokenClaims("nonce"), "aud", []string{"other", testClientID}), "azp", "other")), wantErr: true},
+		{name: "other issuer", token: idp.SignToken(t, with(idp.IDTokenClaims("nonce"), "iss", other.Issuer())), wantErr: true},
+		{name: "expired", token: idp.SignToken(t, with(idp.IDTokenClaims("nonce"), "exp", now.Add(-2*clockSkew).Unix())), wantErr: true},
+		{name: "issued in the future", token: idp.SignToken(t, with(idp.IDTokenClaims("nonce"), "iat", now.Add(2*clockSkew).Unix())), wantErr: true},
+		{name: "other nonce", token: idp.SignToken(t, idp.IDTokenClaims("other")), wantErr: true},
+		{name: "missing nonce", token: idp.SignToken(t, idp.IDTokenClaims("")), wantErr: true},
+		{name: "missing subject", token: idp.SignToken(t, without(idp.IDTokenClaims("nonce"), "sub")), wantErr: true},
+		{name: "signed by other provider", token: other.SignToken(t, idp.IDTokenClaims("nonce")), wantErr: true},
+		{name: "tampered claims", token: parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2], wantErr: true},
+		{name: "unsigned", token: base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + ".", wantErr: true},
+		{name: "malformed", token: "not-a-token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), tt.token, "nonce")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Expected error wrapping %v, got %v", ErrInvalidToken, err)
+			}
+		})
+	}
+}
+
+func TestProvider_VerifyIDToken_KeyRotation(t *testing.T) {
+	ctx := context.Background()
+	idp, provider := newTestProvider(t)
+
+	if _, err := provider.VerifyIDToken(ctx, idp.SignToken(t, idp.IDTokenClaims("nonce")), "nonce"); err != nil {
+		t.Fatalf("VerifyIDToken failed: %v", err)
+	}
+	idp.RotateKey(t)
+	rotated := idp.SignToken(t, idp.IDTokenClaims("nonce"))
+
+	// the key set has just been fetched, unknown keys do not cause another request right away
+	if _, err := provider.VerifyIDToken(ctx, rotated, "nonce"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Expected the key set not to be fetched again right away, got %v", err)
+	}
+	provider.keys.refreshInterval = 0
+	if _, err := provider.VerifyIDToken(ctx, rotated, "nonce"); err != nil {
+		t.Errorf("Expected the rotated key to be fetched, got %v", err)
+	}
+}
+
+func TestVerifySignature_ES256(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	jwk := jsonWebKey{
+		KeyType: "EC",
+		Curve:   "P-256",
+		X:       base64.RawURLEncoding.EncodeToString(private.X.FillBytes(make([]byte, 32))),
+		Y:       base64.RawURLEncoding.EncodeToString(private.Y.FillBytes(make([]byte, 32))),
+	}
+	key, err := jwk.publicKey()
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+
+	digest := sha256.Sum256([]byte("header.claims"))
+	r, s, err := ecdsa.Sign(rand.Reader, private, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	if err := verifySignature(key, "ES256", "header.claims", signature); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+	if err := verifySignature(key, "ES256", "header.tampered", signature); err == nil {
+		t.Error("Expected the signature of other content to be rejected")
+	}
+	if err := verifySignature(key, "RS256", "header.claims", signature); err == nil {
+		t.Error("Expected an EC key to be rejected for RS256")
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	return u
+}
@@ -0,0 +1,260 @@
+// Package oidctest provides an OpenID Connect provider for tests of relying parties.
+//
+// The provider implements discovery, the authorization code flow with PKCE and a JSON Web
+// Key Set. The authorization endpoint does not ask for credentials, it logs in the user
+// configured with SetClaims and redirects back to the client right away.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Provider is an OpenID Connect provider running on a local test server. It signs ID tokens
+// with RS256 and is safe for concurrent use.
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+
+	server *httptest.Server
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	keyID  string
+	claims map[string]any
+	// grants are the issued authorization codes, each can be exchanged once
+	grants map[string]grant
+}
+
+type grant struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	claims        map[string]any
+}
+
+// NewProvider starts a provider for the client that is stopped at the end of the test.
+// The user logging in has the subject "test-subject" unless configured otherwise.
+func NewProvider(t testing.TB, clientID, clientSecret string) *Provider {
+	t.Helper()
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		claims:       map[string]any{"sub": "test-subject"},
+		grants:       make(map[string]grant),
+	}
+	p.RotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("GET /authorize", p.handleAuthorize)
+	mux.HandleFunc("POST /token", p.handleToken)
+	mux.HandleFunc("GET /jwks", p.handleJWKS)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// Issuer returns the issuer identifier of the provider, the URL of the test server.
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// SetClaims configures the claims of the user logging in, e.g. sub and email.
+func (p *Provider) SetClaims(claims map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = maps.Clone(claims)
+}
+
+// RotateKey replaces the signing key, the previous key is no longer published.
+func (p *Provider) RotateKey(t testing.TB) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+	p.keyID = rand.Text()
+}
+
+// SignToken signs the claims as they are, which allows tests to forge invalid ID tokens.
+func (p *Provider) SignToken(t testing.TB, claims map[string]any) string {
+	t.Helper()
+	token, err := p.sign(claims)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+func (p *Provider) sign(claims map[string]any) (string, error) {
+	p.mu.Lock()
+	key, keyID := p.key, p.keyID
+	p.mu.Unlock()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// IDTokenClaims returns the claims of an ID token for the client issued now, merged with
+// the claims of the user.
+func (p *Provider) IDTokenClaims(nonce string) map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	claims := maps.Clone(p.claims)
+	claims["iss"] = p.server.URL
+	claims["aud"] = p.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(5 * time.Minute).Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return claims
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case q.Get("client_id") != p.ClientID:
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	case q.Get("response_type") != "code":
+		http.Error(w, "unsupported response type", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirect.IsAbs() {
+		http.Error(w, "invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+	p.mu.Lock()
+	p.grants[code] = grant{
+		redirectURI:   q.Get("redirect_uri"),
+		codeChallenge: q.Get("code_challenge"),
+		nonce:         q.Get("nonce"),
+		claims:        maps.Clone(p.claims),
+	}
+	p.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	}
+	if clientID != p.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.ClientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+	p.mu.Lock()
+	g, exists := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+	if !exists || g.redirectURI != r.PostFormValue("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code verifier mismatch"})
+		return
+	}
+
+	claims := p.IDTokenClaims(g.nonce)
+	maps.Copy(claims, g.claims)
+	idToken, err := p.sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	key, keyID := p.key.PublicKey, p.keyID
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
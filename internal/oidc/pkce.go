@@ -0,0 +1,21 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// NewCodeVerifier returns a random PKCE code verifier of 43 characters, 256 bits of entropy.
+func NewCodeVerifier() string {
+	b := make([]byte, 32)
+	// crypto/rand.Read never returns an error
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// CodeChallenge returns the S256 code challenge of the code verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,171 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Spec describes the parameters and bodies of an operation.
+// Path parameters are derived from the path the operation is added for.
+type Spec struct {
+	// Summary is a short description of the operation
+	Summary string
+	// Query lists the supported query parameters
+	Query []Parameter
+	// Request is the type of the JSON request body, nil if the operation does not accept a body
+	Request reflect.Type
+	// RequestContent lists the request body types by content type for operations
+	// that accept other content types than application/json, it overrides Request
+	RequestContent map[string]reflect.Type
+	// Response is the type of the JSON response body, nil if the operation does not return a body
+	Response reflect.Type
+	// Status is the status code of a successful response, defaults to 200
+	Status int
+	// Permission is the permission required to call the operation, if any
+	Permission string
+}
+
+// Builder collects operations and the schemas of their bodies into a Document.
+// It is not safe for concurrent use.
+type Builder struct {
+	doc *Document
+
+	errorContentType string
+	errorSchema      *Schema
+}
+
+// NewBuilder returns a builder for an empty document.
+func NewBuilder(info Info) *Builder {
+	return &Builder{
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   map[string]PathItem{},
+			Components: Components{
+				Schemas: map[string]*Schema{},
+			},
+		},
+	}
+}
+
+// SetErrorResponse documents the body returned by all operations in case of an error.
+func (b *Builder) SetErrorResponse(contentType string, t reflect.Type) {
+	b.errorContentType = contentType
+	b.errorSchema = b.Schema(t)
+}
+
+// Add adds an operation for the given method and http.ServeMux path pattern.
+// The tags group related operations, typically by the kind of the resource.
+func (b *Builder) Add(method, path string, spec Spec, tags ...string) {
+	path, params := pathParameters(path)
+	op := &Operation{
+		OperationID: operationID(method, path),
+		Summary:     spec.Summary,
+		Tags:        tags,
+		Responses:   map[string]*Response{},
+		Permission:  spec.Permission,
+	}
+	for _, name := range params {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	op.Parameters = append(op.Parameters, spec.Query...)
+
+	requestContent := spec.RequestContent
+	if requestContent == nil && spec.Request != nil {
+		requestContent = map[string]reflect.Type{"application/json": spec.Request}
+	}
+	if len(requestContent) > 0 {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{},
+		}
+		for contentType, t := range requestContent {
+			op.RequestBody.Content[contentType] = MediaType{Schema: b.Schema(t)}
+		}
+	}
+
+	status := spec.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := &Response{Description: http.StatusText(status)}
+	if spec.Response != nil {
+		response.Content = map[string]MediaType{
+			"application/json": {Schema: b.Schema(spec.Response)},
+		}
+	}
+	op.Responses[strconv.Itoa(status)] = response
+	if b.errorSchema != nil {
+		op.Responses["default"] = &Response{
+			Description: "Error",
+			Content: map[string]MediaType{
+				b.errorContentType: {Schema: b.errorSchema},
+			},
+		}
+	}
+
+	if b.doc.Paths[path] == nil {
+		b.doc.Paths[path] = PathItem{}
+	}
+	b.doc.Paths[path][strings.ToLower(method)] = op
+}
+
+// Document returns the document built so far.
+func (b *Builder) Document() *Document {
+	return b.doc
+}
+
+// pathParameters converts a http.ServeMux pattern into an OpenAPI path
+// and returns the names of its wildcards.
+func pathParameters(pattern string) (string, []string) {
+	var params []string
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(segment[1:len(segment)-1], "...")
+		if name == "$" {
+			segments[i] = ""
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		params = append(params, name)
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derives a unique camel case operation id from the method and path,
+// e.g. GET /api/v1/core/items/{id} becomes getV1CoreItemsById.
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for segment := range strings.SplitSeq(strings.TrimPrefix(path, "/api"), "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, "{") {
+			segment = "By" + upperFirst(strings.Trim(segment, "{}"))
+		}
+		for part := range strings.FieldsFuncSeq(segment, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			id += upperFirst(part)
+		}
+	}
+	return id
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
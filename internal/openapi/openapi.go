@@ -0,0 +1,120 @@
+// Package openapi builds OpenAPI 3 documents describing the HTTP APIs of the services.
+//
+// The schemas of request and response bodies are derived from the Go types
+// with reflection, following the rules of encoding/json:
+//
+//	b := openapi.NewBuilder(openapi.Info{Title: "demo-shop", Version: "v1"})
+//	b.Add(http.MethodGet, "/api/v1/core/items/{id}", openapi.Spec{Response: reflect.TypeFor[Item]()}, "items")
+//	doc := b.Document()
+package openapi
+
+import (
+	"maps"
+	"strings"
+)
+
+// Version is the OpenAPI specification version of the generated documents.
+const Version = "3.0.3"
+
+// Document is the root object of an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info provides metadata about the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem maps the lower case HTTP methods of a path to their operations.
+type PathItem map[string]*Operation
+
+// Operation describes a single API operation on a path.
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	// Permission is the permission callers need, it is an extension of the specification
+	Permission string `json:"x-required-permission,omitempty"`
+}
+
+// Parameter describes a path or query parameter of an operation.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes the body accepted by an operation.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a single response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes the schema of a body for a single content type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds the reusable schemas referenced by the operations.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema is the subset of the OpenAPI schema object required to describe JSON encoded Go types.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Merge combines the paths and schemas of several documents into a single one.
+// Operations and schemas of later documents replace those with the same path and method or name.
+// Nil documents are skipped.
+func Merge(info Info, docs ...*Document) *Document {
+	merged := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+		},
+	}
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		for path, item := range doc.Paths {
+			if merged.Paths[path] == nil {
+				merged.Paths[path] = PathItem{}
+			}
+			for method, op := range item {
+				merged.Paths[path][strings.ToLower(method)] = op
+			}
+		}
+		maps.Copy(merged.Components.Schemas, doc.Components.Schemas)
+	}
+	return merged
+}
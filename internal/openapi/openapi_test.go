@@ -0,0 +1,150 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type testBase struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type testNode struct {
+	testBase
+	Name     *string           `json:"name,omitempty"`
+	Secret   string            `json:"-"`
+	Labels   map[string]string `json:"labels"`
+	Children []testNode        `json:"children"`
+	Data     []byte            `json:"data"`
+	internal int
+}
+
+type testPage[T any] struct {
+	Items []T `json:"items"`
+}
+
+func TestBuilder_Schema(t *testing.T) {
+	b := NewBuilder(Info{Title: "test", Version: "v1"})
+
+	ref := b.Schema(reflect.TypeFor[testPage[testNode]]())
+	if ref.Ref != "#/components/schemas/testPage_testNode" {
+		t.Fatalf("Expected reference to testPage_testNode, got %q", ref.Ref)
+	}
+
+	node, ok := b.Document().Components.Schemas["testNode"]
+	if !ok {
+		t.Fatal("Expected testNode to be added to the components")
+	}
+	tests := map[string]Schema{
+		"id":         {Type: "string", Format: "uuid"},
+		"created_at": {Type: "string", Format: "date-time"},
+		"name":       {Type: "string", Nullable: true},
+		"data":       {Type: "string", Format: "byte"},
+	}
+	for name, want := range tests {
+		got, ok := node.Properties[name]
+		if !ok {
+			t.Errorf("Expected property %s", name)
+			continue
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("Expected property %s to be %+v, got %+v", name, want, *got)
+		}
+	}
+	if got := node.Properties["children"]; got == nil || got.Items == nil || got.Items.Ref != "#/components/schemas/testNode" {
+		t.Errorf("Expected children to reference testNode, got %+v", got)
+	}
+	if got := node.Properties["labels"]; got == nil || got.AdditionalProperties == nil || got.AdditionalProperties.Type != "string" {
+		t.Errorf("Expected labels to be a string map, got %+v", got)
+	}
+	for _, name := range []string{"Secret", "internal", "testBase"} {
+		if _, ok := node.Properties[name]; ok {
+			t.Errorf("Expected property %s to be omitted", name)
+		}
+	}
+}
+
+func TestBuilder_Add(t *testing.T) {
+	b := NewBuilder(Info{Title: "test", Version: "v1"})
+	b.SetErrorResponse("application/problem+json", reflect.TypeFor[struct {
+		Title string `json:"title"`
+	}]())
+	b.Add(http.MethodPut, "/api/v1/core/nodes/{id}", Spec{
+		Request:  reflect.TypeFor[testNode](),
+		Response: reflect.TypeFor[testNode](),
+	}, "nodes")
+	b.Add(http.MethodDelete, "/api/v1/core/nodes/{id}", Spec{Status: http.StatusNoContent}, "nodes")
+
+	item := b.Document().Paths["/api/v1/core/nodes/{id}"]
+	if len(item) != 2 {
+		t.Fatalf("Expected two operations, got %d", len(item))
+	}
+
+	op := item["put"]
+	if op.OperationID != "putV1CoreNodesById" {
+		t.Errorf("Expected operation id putV1CoreNodesById, got %s", op.OperationID)
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "id" || op.Parameters[0].In != "path" || !op.Parameters[0].Required {
+		t.Errorf("Expected required path parameter id, got %+v", op.Parameters)
+	}
+	if op.RequestBody == nil || op.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/testNode" {
+		t.Errorf("Expected request body to reference testNode, got %+v", op.RequestBody)
+	}
+	if resp := op.Responses["200"]; resp == nil || resp.Content["application/json"].Schema.Ref != "#/components/schemas/testNode" {
+		t.Errorf("Expected 200 response to reference testNode, got %+v", resp)
+	}
+	if resp := op.Responses["default"]; resp == nil || resp.Content["application/problem+json"].Schema == nil {
+		t.Errorf("Expected default problem response, got %+v", resp)
+	}
+
+	del := item["delete"]
+	if resp := del.Responses["204"]; resp == nil || resp.Content != nil {
+		t.Errorf("Expected 204 response without content, got %+v", resp)
+	}
+}
+
+func TestPathParameters(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		params  []string
+	}{
+		{pattern: "/api/v1/core/items", path: "/api/v1/core/items"},
+		{pattern: "/api/v1/core/items/{id}", path: "/api/v1/core/items/{id}", params: []string{"id"}},
+		{pattern: "/static/{file...}", path: "/static/{file}", params: []string{"file"}},
+		{pattern: "/{$}", path: "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			path, params := pathParameters(tt.pattern)
+			if path != tt.path || !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("Expected %s %v, got %s %v", tt.path, tt.params, path, params)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	items := NewBuilder(Info{Title: "items", Version: "v1"})
+	items.Add(http.MethodGet, "/api/v1/core/nodes", Spec{Response: reflect.TypeFor[testNode]()})
+	users := NewBuilder(Info{Title: "users", Version: "v1"})
+	users.Add(http.MethodPost, "/api/v1/core/nodes", Spec{Request: reflect.TypeFor[testBase]()})
+
+	merged := Merge(Info{Title: "all", Version: "v1"}, items.Document(), nil, users.Document())
+	if merged.Info.Title != "all" || merged.OpenAPI != Version {
+		t.Errorf("Expected merged document info, got %+v", merged.Info)
+	}
+	if item := merged.Paths["/api/v1/core/nodes"]; item["get"] == nil || item["post"] == nil {
+		t.Errorf("Expected operations of both documents, got %+v", item)
+	}
+	for _, name := range []string{"testNode", "testBase"} {
+		if _, ok := merged.Components.Schemas[name]; !ok {
+			t.Errorf("Expected schema %s", name)
+		}
+	}
+}
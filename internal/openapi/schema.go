@@ -0,0 +1,127 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	uuidType          = reflect.TypeFor[uuid.UUID]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+
+	// qualifiedTypeName matches the package path of type arguments in the name of generic types
+	qualifiedTypeName = regexp.MustCompile(`[\w./-]+\.`)
+)
+
+// Schema returns the schema of the JSON encoding of t.
+// Named struct types are added to the components of the document and referenced,
+// types of different packages with the same name therefore share a schema.
+func (b *Builder) Schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// the encoding is up to the type, allow any value
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.Schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.Schema(t.Elem())}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: b.Schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.Schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := b.doc.Components.Schemas[name]; !ok {
+			// register the name before descending into the fields to support recursive types
+			b.doc.Components.Schemas[name] = &Schema{}
+			b.doc.Components.Schemas[name] = b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema returns the inline object schema of a struct type.
+func (b *Builder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.addFields(s, t)
+	return s
+}
+
+// addFields adds the JSON encoded fields of t to the properties of s.
+// Embedded structs without a JSON name are flattened as done by encoding/json.
+func (b *Builder) addFields(s *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		ft := field.Type
+		if field.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addFields(s, ft)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		s.Properties[name] = b.Schema(ft)
+	}
+}
+
+// schemaName returns the component name of a named type,
+// e.g. ListResponse[github.com/.../api/v1.Item] becomes ListResponse_Item.
+func schemaName(t reflect.Type) string {
+	name := qualifiedTypeName.ReplaceAllString(t.Name(), "")
+	return strings.NewReplacer("[", "_", ",", "_", "]", "", "*", "").Replace(name)
+}
@@ -0,0 +1,61 @@
+// Package password hashes user passwords with bcrypt and verifies them.
+package password
+
+import (
+	"crypto/subtle"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxLength is the maximum length of a password in bytes, bcrypt does not accept longer ones
+const MaxLength = 72
+
+// Cost is the bcrypt cost of new hashes. Hashes of a different cost are reported
+// by Verify as in need of a rehash, so raising it upgrades passwords on the next login.
+var Cost = bcrypt.DefaultCost
+
+// dummyHash is verified against if no hash is stored, see Fail
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), Cost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// Hash returns a salted bcrypt hash of password.
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether password matches hash. If it matches and needsRehash is true,
+// the caller should replace the stored hash by a new one, because it has been created
+// with a different cost or because it is a plaintext password stored before passwords
+// were hashed.
+func Verify(hash, password string) (ok, needsRehash bool) {
+	if hash == "" {
+		return Fail(password), false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		ok = subtle.ConstantTimeCompare([]byte(hash), []byte(password)) == 1
+		return ok, ok
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false, false
+	}
+	return true, cost != Cost
+}
+
+// Fail verifies password against a dummy hash and returns false. Stores call it for
+// unknown usernames, so they can not be told apart from wrong passwords by the time
+// the verification takes.
+func Fail(password string) bool {
+	_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+	return false
+}
@@ -0,0 +1,67 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hash, err := Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if hash == "correct horse battery staple" {
+		t.Fatal("Expected the password to be hashed")
+	}
+	other, err := Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if hash == other {
+		t.Error("Expected hashes of the same password to be salted")
+	}
+
+	if ok, needsRehash := Verify(hash, "correct horse battery staple"); !ok || needsRehash {
+		t.Errorf("Expected password to match without rehash, got ok=%v needsRehash=%v", ok, needsRehash)
+	}
+	if ok, _ := Verify(hash, "wrong password"); ok {
+		t.Error("Expected wrong password to be rejected")
+	}
+}
+
+func TestVerify_Rehash(t *testing.T) {
+	weak, err := bcrypt.GenerateFromPassword([]byte("secret password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if ok, needsRehash := Verify(string(weak), "secret password"); !ok || !needsRehash {
+		t.Errorf("Expected hash of a different cost to need a rehash, got ok=%v needsRehash=%v", ok, needsRehash)
+	}
+
+	if ok, needsRehash := Verify("plaintext password", "plaintext password"); !ok || !needsRehash {
+		t.Errorf("Expected plaintext password to match and need a rehash, got ok=%v needsRehash=%v", ok, needsRehash)
+	}
+	if ok, needsRehash := Verify("plaintext password", "other password"); ok || needsRehash {
+		t.Errorf("Expected wrong plaintext password to be rejected, got ok=%v needsRehash=%v", ok, needsRehash)
+	}
+}
+
+func TestVerify_NoHash(t *testing.T) {
+	if ok, _ := Verify("", ""); ok {
+		t.Error("Expected empty password to be rejected without a stored hash")
+	}
+	if Fail("any password") {
+		t.Error("Expected Fail to return false")
+	}
+}
+
+func TestHash_TooLong(t *testing.T) {
+	if _, err := Hash(strings.Repeat("a", MaxLength)); err != nil {
+		t.Errorf("Expected password of %d bytes to be accepted, got %v", MaxLength, err)
+	}
+	if _, err := Hash(strings.Repeat("a", MaxLength+1)); err == nil {
+		t.Error("Expected password exceeding the maximum length to be rejected")
+	}
+}
@@ -0,0 +1,295 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+// Operation is a single operation of a JSON Patch document.
+type Operation struct {
+	// Op is one of add, remove, replace, move, copy or test
+	Op string `json:"op"`
+	// Path is the JSON pointer to the target location, e.g. /items/0/quantity
+	Path string `json:"path"`
+	// From is the JSON pointer to the source location of move and copy operations
+	From string `json:"from,omitempty"`
+	// Value is the value used by add, replace and test operations
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies the JSON Patch to doc and returns the patched document.
+// The operations are applied in order, if one of them fails the document is not modified.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON patch: %w", router.ErrValidation, err)
+	}
+	for i, op := range ops {
+		target, err = applyOperation(target, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOperation(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: %s operation requires a value", router.ErrValidation, op.Op)
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid value: %w", router.ErrValidation, err)
+		}
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if doc, _, err = remove(doc, path); err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, fmt.Errorf("%w: test failed for path %q", router.ErrConflict, op.Path)
+			}
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("%w: cannot move %q into one of its children", router.ErrValidation, op.From)
+			}
+			doc, value, err = remove(doc, from)
+		} else {
+			value, err = get(doc, from)
+			if err == nil {
+				value, err = deepCopy(value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unsupported operation %q", router.ErrValidation, op.Op)
+	}
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid JSON pointer %q", router.ErrValidation, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// index parses an array index token, it must be lower than size.
+func index(token string, size int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", router.ErrValidation, token)
+	}
+	if i >= size {
+		return 0, fmt.Errorf("%w: array index %d out of bounds", router.ErrConflict, i)
+	}
+	return i, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: location %q does not exist", router.ErrConflict, token)
+			}
+			doc = value
+		case []any:
+			i, err := index(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%w: location %q does not exist", router.ErrConflict, token)
+		}
+	}
+	return doc, nil
+}
+
+// add adds value at path and returns the modified document.
+// Values of existing object members are replaced, values inserted into arrays shift the following elements.
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: location %q does not exist", router.ErrConflict, token)
+		}
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []any:
+		if len(path) == 1 {
+			if token == "-" {
+				return append(node, value), nil
+			}
+			i, err := index(token, len(node)+1)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		i, err := index(token, len(node))
+		if err != nil {
+			return nil, err
+		}
+		child, err := add(node[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("%w: location %q does not exist", router.ErrConflict, token)
+	}
+}
+
+// remove removes the value at path and returns the modified document and the removed value.
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	token := path[0]
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: location %q does not exist", router.ErrConflict, token)
+		}
+		if len(path) == 1 {
+			delete(node, token)
+			return node, child, nil
+		}
+		child, removed, err := remove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = child
+		return node, removed, nil
+	case []any:
+		i, err := index(token, len(node))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := node[i]
+			return append(node[:i], node[i+1:]...), removed, nil
+		}
+		child, removed, err := remove(node[i], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		node[i] = child
+		return node, removed, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: location %q does not exist", router.ErrConflict, token)
+	}
+}
+
+// equal compares two decoded JSON values, numbers are compared by value.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, value := range a {
+			other, ok := b[name]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okA := new(big.Float).SetString(a.String())
+		y, okB := new(big.Float).SetString(b.String())
+		return okA && okB && x.Cmp(y) == 0
+	default:
+		return a == b
+	}
+}
+
+func deepCopy(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
@@ -0,0 +1,70 @@
+// Package patch applies partial modifications to JSON documents, either as
+// JSON Merge Patch (RFC 7386) or as JSON Patch (RFC 6902).
+//
+// Malformed patches result in errors wrapping router.ErrValidation, patches that
+// cannot be applied to the document, e.g. because a path does not exist or a
+// test operation failed, in errors wrapping router.ErrConflict.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+const (
+	// MergePatchContentType is the media type of JSON Merge Patch documents
+	MergePatchContentType = "application/merge-patch+json"
+	// JSONPatchContentType is the media type of JSON Patch documents
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// Merge applies the JSON Merge Patch to doc and returns the patched document.
+// Members of the patch replace those of doc, null values remove them.
+func Merge(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid merge patch: %w", router.ErrValidation, err)
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+// mergeValue implements the MergePatch function of RFC 7386.
+func mergeValue(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = mergeValue(t[name], value)
+	}
+	return t
+}
+
+// decode decodes a JSON document keeping numbers as json.Number to not lose precision.
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return v, nil
+}
@@ -0,0 +1,113 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+// assertJSONEqual compares two JSON documents semantically.
+func assertJSONEqual(t *testing.T, want string, got []byte) {
+	t.Helper()
+
+	var w, g any
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("Failed to decode expected document: %v", err)
+	}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("Failed to decode patched document: %v", err)
+	}
+	if !reflect.DeepEqual(w, g) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	// examples of RFC 7386, appendix A
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{doc: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{doc: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{doc: `["a","b"]`, patch: `["c","d"]`, want: `["c","d"]`},
+		{doc: `{"a":"b"}`, patch: `["c"]`, want: `["c"]`},
+		{doc: `{"e":null}`, patch: `{"a":1}`, want: `{"e":null,"a":1}`},
+		{doc: `[1,2]`, patch: `{"a":"b","c":null}`, want: `{"a":"b"}`},
+		{doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+		{doc: `{"price":12345678901234567890}`, patch: `{"name":"x"}`, want: `{"price":12345678901234567890,"name":"x"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.patch, func(t *testing.T) {
+			got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			assertJSONEqual(t, tt.want, got)
+		})
+	}
+
+	if _, err := Merge([]byte(`{}`), []byte(`{`)); !errors.Is(err, router.ErrValidation) {
+		t.Errorf("Expected ErrValidation for a malformed patch, got %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	// mostly examples of RFC 6902, appendix A
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		{name: "add member", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":"qux"}]`, want: `{"baz":"qux","foo":"bar"}`},
+		{name: "add array element", doc: `{"foo":["bar","baz"]}`, patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`, want: `{"foo":["bar","qux","baz"]}`},
+		{name: "append array element", doc: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/-","value":["abc"]}]`, want: `{"foo":["bar",["abc"]]}`},
+		{name: "add null value", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":null}]`, want: `{"baz":null,"foo":"bar"}`},
+		{name: "remove member", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, want: `{"foo":"bar"}`},
+		{name: "remove array element", doc: `{"foo":["bar","qux","baz"]}`, patch: `[{"op":"remove","path":"/foo/1"}]`, want: `{"foo":["bar","baz"]}`},
+		{name: "replace value", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":"boo"}]`, want: `{"baz":"boo","foo":"bar"}`},
+		{name: "replace document", doc: `{"foo":"bar"}`, patch: `[{"op":"replace","path":"","value":{"baz":"qux"}}]`, want: `{"baz":"qux"}`},
+		{name: "move value", doc: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, want: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{name: "move array element", doc: `{"foo":["all","grass","cows","eat"]}`, patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, want: `{"foo":["all","cows","eat","grass"]}`},
+		{name: "copy value", doc: `{"foo":{"bar":1}}`, patch: `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`, want: `{"foo":{"bar":1},"baz":{"bar":2}}`},
+		{name: "test success", doc: `{"baz":"qux","foo":["a",2,"c"]}`, patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, want: `{"baz":"qux","foo":["a",2,"c"]}`},
+		{name: "escaped pointer", doc: `{"/":9,"~1":10}`, patch: `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, want: `{"~1":10}`},
+		{name: "test failure", doc: `{"baz":"qux"}`, patch: `[{"op":"test","path":"/baz","value":"bar"}]`, err: router.ErrConflict},
+		{name: "missing target", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, err: router.ErrConflict},
+		{name: "remove missing member", doc: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, err: router.ErrConflict},
+		{name: "index out of bounds", doc: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/2","value":"qux"}]`, err: router.ErrConflict},
+		{name: "invalid index", doc: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/01","value":"qux"}]`, err: router.ErrValidation},
+		{name: "missing value", doc: `{"foo":"bar"}`, patch: `[{"op":"replace","path":"/foo"}]`, err: router.ErrValidation},
+		{name: "unknown operation", doc: `{"foo":"bar"}`, patch: `[{"op":"merge","path":"/foo","value":1}]`, err: router.ErrValidation},
+		{name: "invalid pointer", doc: `{"foo":"bar"}`, patch: `[{"op":"remove","path":"foo"}]`, err: router.ErrValidation},
+		{name: "move into child", doc: `{"foo":{"bar":1}}`, patch: `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, err: router.ErrValidation},
+		{name: "malformed patch", doc: `{"foo":"bar"}`, patch: `{"op":"remove","path":"/foo"}`, err: router.ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Expected error %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			assertJSONEqual(t, tt.want, got)
+		})
+	}
+}
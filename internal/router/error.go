@@ -2,23 +2,176 @@ package router
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The domain errors returned by stores and routers. Wrap them to add context,
+// e.g. fmt.Errorf("item %w", ErrNotFound), the handlers translate them into
+// the matching HTTP status code and problem type.
+var (
+	// ErrNotFound is returned if the requested resource does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned if the request conflicts with the current state of a resource
+	ErrConflict = errors.New("conflict")
+	// ErrAlreadyExists is returned by stores if a resource with the same identity already exists.
+	// It is a more specific ErrConflict.
+	ErrAlreadyExists error = &refinedError{message: "already exists", parent: ErrConflict}
+	// ErrPreconditionFailed is returned if the expected version of a resource does not match the stored one.
+	// It is a more specific ErrConflict.
+	ErrPreconditionFailed error = &refinedError{message: "precondition failed", parent: ErrConflict}
+	// ErrValidation is returned if the request contains invalid data.
+	// Use NewValidationError to report the offending fields.
+	ErrValidation = errors.New("validation failed")
+	// ErrUnauthorized is returned if the request lacks valid authentication
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is returned if the authenticated caller is not allowed to perform the request
+	ErrForbidden = errors.New("forbidden")
+	// ErrUnavailable is returned if a required backend, e.g. the store, is not available
+	ErrUnavailable = errors.New("service unavailable")
+	// ErrUnsupportedMediaType is returned if the content type of the request body is not supported
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
 )
 
+// refinedError is a sentinel error that is a more specific variant of another one.
+type refinedError struct {
+	message string
+	parent  error
+}
+
+func (e *refinedError) Error() string {
+	return e.message
+}
+
+func (e *refinedError) Unwrap() error {
+	return e.parent
+}
+
+// Violation describes why the value of a single request field is invalid.
+type Violation struct {
+	// Field is the JSON name of the offending field, nested fields are separated by dots, e.g. items.0.quantity
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError reports all invalid fields of a request. It wraps ErrValidation.
+type ValidationError struct {
+	Violations []Violation
+}
+
+// NewValidationError returns a ValidationError for the given violations.
+func NewValidationError(violations ...Violation) error {
+	return &ValidationError{Violations: violations}
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		if v.Field == "" {
+			msgs = append(msgs, v.Message)
+			continue
+		}
+		msgs = append(msgs, v.Field+": "+v.Message)
+	}
+	return fmt.Sprintf("%s: %s", ErrValidation, strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// problemTypePrefix is the prefix of the problem type URIs identifying the domain errors.
+const problemTypePrefix = "urn:demo-shop:problem:"
+
+// domainErrors maps the domain errors to their status code and problem type.
+// More specific errors have to be listed before the errors they wrap.
+var domainErrors = []struct {
+	err         error
+	problemType string
+	status      int
+}{
+	{err: ErrAlreadyExists, problemType: problemTypePrefix + "already-exists", status: http.StatusConflict},
+	{err: ErrPreconditionFailed, problemType: problemTypePrefix + "precondition-failed", status: http.StatusPreconditionFailed},
+	{err: ErrConflict, problemType: problemTypePrefix + "conflict", status: http.StatusConflict},
+	{err: ErrNotFound, problemType: problemTypePrefix + "not-found", status: http.StatusNotFound},
+	{err: ErrValidation, problemType: problemTypePrefix + "validation", status: http.StatusBadRequest},
+	{err: ErrUnauthorized, problemType: problemTypePrefix + "unauthorized", status: http.StatusUnauthorized},
+	{err: ErrForbidden, problemType: problemTypePrefix + "forbidden", status: http.StatusForbidden},
+	{err: ErrUnavailable, problemType: problemTypePrefix + "unavailable", status: http.StatusServiceUnavailable},
+	{err: ErrUnsupportedMediaType, problemType: problemTypePrefix + "unsupported-media-type", status: http.StatusUnsupportedMediaType},
+}
+
+// problemContentType is the media type of problem details objects
+const problemContentType = "application/problem+json"
+
+// ErrorResponse is the body of all error responses, an RFC 7807 problem details object
+// served as application/problem+json.
+//
+// Path, Message and Error are extension members kept for clients that predate the
+// problem details format, they duplicate Instance, Title and Detail.
 type ErrorResponse struct {
-	Status  int    `json:"status"`
+	// Type identifies the kind of problem, "about:blank" for unexpected errors
+	Type string `json:"type"`
+	// Title is a short summary of the problem, it defaults to the status text
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Detail explains this occurrence of the problem, it defaults to Error
+	Detail string `json:"detail,omitempty"`
+	// Instance is the request path, it defaults to Path
+	Instance string `json:"instance,omitempty"`
+	// TraceID is the ID of the trace the request was part of, if it was traced
+	TraceID    string      `json:"trace_id,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+
 	Path    string `json:"path"`
 	Message string `json:"message"`
 	Error   string `json:"error,omitempty"`
 }
 
+// NewErrorResponse creates an ErrorResponse for err. The status code and problem type are derived
+// from the domain error wrapped by err, unexpected errors result in an internal server error.
+func NewErrorResponse(r *http.Request, message string, err error) *ErrorResponse {
+	resp := &ErrorResponse{
+		Type:    ProblemTypeFromError(err),
+		Status:  StatusFromError(err, http.StatusInternalServerError),
+		Path:    r.URL.Path,
+		Message: message,
+		Error:   err.Error(),
+	}
+	if spanCtx := trace.SpanContextFromContext(r.Context()); spanCtx.HasTraceID() {
+		resp.TraceID = spanCtx.TraceID().String()
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		resp.Violations = verr.Violations
+	}
+	return resp
+}
+
 func (e *ErrorResponse) WriteTo(w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(e.Status)
-	if e.Error != "" {
-		e.Message = e.Error
+	if e.Type == "" {
+		e.Type = "about:blank"
+	}
+	if e.Title == "" {
+		e.Title = http.StatusText(e.Status)
+	}
+	if e.Detail == "" {
+		e.Detail = e.Error
+	}
+	if e.Detail == "" {
+		e.Detail = e.Message
+	}
+	if e.Instance == "" {
+		e.Instance = e.Path
 	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(e.Status)
 	response, _ := json.Marshal(e)
 	_, err := w.Write(response)
 	if err != nil {
@@ -26,3 +179,46 @@ func (e *ErrorResponse) WriteTo(w http.ResponseWriter) {
 		return
 	}
 }
+
+// StatusFromError returns the HTTP status code matching the domain error wrapped by err.
+// If err does not wrap one of them, fallback is returned.
+func StatusFromError(err error, fallback int) int {
+	for _, de := range domainErrors {
+		if errors.Is(err, de.err) {
+			return de.status
+		}
+	}
+	return fallback
+}
+
+// ProblemTypeFromError returns the problem type of the domain error wrapped by err,
+// or "about:blank" if err does not wrap one of them.
+func ProblemTypeFromError(err error) string {
+	for _, de := range domainErrors {
+		if errors.Is(err, de.err) {
+			return de.problemType
+		}
+	}
+	return "about:blank"
+}
+
+// ErrorFromResponse returns the domain error matching a failed response.
+// The problem type takes precedence over the status code, as some status codes are shared
+// by several errors. Nil is returned if neither matches a domain error.
+func ErrorFromResponse(status int, problemType string) error {
+	for _, de := range domainErrors {
+		if de.problemType == problemType {
+			return de.err
+		}
+	}
+	for _, de := range domainErrors {
+		// a bare status code only identifies the general error if the refined one shares its status
+		if refined, ok := de.err.(*refinedError); ok && StatusFromError(refined.parent, 0) == de.status {
+			continue
+		}
+		if de.status == status {
+			return de.err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Probes a health check is part of
+const (
+	// ProbeReadiness checks decide whether the service receives requests
+	ProbeReadiness = "readiness"
+	// ProbeLiveness checks decide whether the service is restarted
+	ProbeLiveness = "liveness"
+	// ProbeStartup checks decide whether the service has started, the other probes are not
+	// run by Kubernetes before
+	ProbeStartup = "startup"
+)
+
+// States of a health check and of a probe
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+)
+
+const (
+	// DefaultHealthCheckTimeout is how long a check may take unless configured otherwise
+	DefaultHealthCheckTimeout = 2 * time.Second
+	// DefaultHealthCheckCacheTTL is how long the result of a check is reused unless configured otherwise
+	DefaultHealthCheckCacheTTL = time.Second
+)
+
+var (
+	ErrHealthCheckAlreadyExists = errors.New("health check already exists")
+	ErrHealthCheckInvalid       = errors.New("invalid health check")
+)
+
+// HealthChecker checks a dependency of a service, e.g. its store or an upstream service
+type HealthChecker interface {
+	// Check returns an error if the dependency is unhealthy
+	Check(ctx context.Context) error
+}
+
+// HealthCheckFunc adapts a function to a HealthChecker, e.g. HealthCheckFunc(db.PingContext)
+type HealthCheckFunc func(ctx context.Context) error
+
+func (f HealthCheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// HealthCheck is a named check registered with a router
+type HealthCheck struct {
+	// Name identifies the check in the reports of the probes
+	Name    string
+	Checker HealthChecker
+	// Probes the check is part of, ProbeReadiness if empty
+	Probes []string
+	// Timeout is how long the check may take, DefaultHealthCheckTimeout if zero
+	Timeout time.Duration
+	// CacheTTL is how long the result of the check is reused, so probes arriving at once
+	// do not run it several times. DefaultHealthCheckCacheTTL if zero, never reused if negative.
+	CacheTTL time.Duration
+}
+
+// HealthReport is the state of the checks of a probe
+type HealthReport struct {
+	// Status is HealthUp if the service and all checks of the probe are up, otherwise HealthDown
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// HealthCheckResult is the result of the last run of a check
+type HealthCheckResult struct {
+	Name string `json:"name"`
+	// Status is HealthUp or HealthDown
+	Status string `json:"status"`
+	// Error is the error of the check if it is down
+	Error string `json:"error,omitempty"`
+	// Duration is how long the check took
+	Duration string `json:"duration"`
+	// CheckedAt is the time the check ran at
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// healthRegistry holds the health checks of a router
+type healthRegistry struct {
+	mu     sync.RWMutex
+	checks []*registeredHealthCheck
+}
+
+type registeredHealthCheck struct {
+	HealthCheck
+
+	// mu is held while the check runs, so concurrent probes wait for its result
+	mu     sync.Mutex
+	result *HealthCheckResult
+}
+
+// RegisterHealthCheck adds a named check to the probes of the router. Checks are run when
+// their probes are requested.
+func (r *Router) RegisterHealthCheck(check HealthCheck) error {
+	if check.Name == "" || check.Checker == nil {
+		return fmt.Errorf("%w: name and checker are required", ErrHealthCheckInvalid)
+	}
+	if len(check.Probes) == 0 {
+		check.Probes = []string{ProbeReadiness}
+	}
+	for _, probe := range check.Probes {
+		if probe != ProbeReadiness && probe != ProbeLiveness && probe != ProbeStartup {
+			return fmt.Errorf("%w: unknown probe %q", ErrHealthCheckInvalid, probe)
+		}
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = DefaultHealthCheckTimeout
+	}
+	if check.CacheTTL == 0 {
+		check.CacheTTL = DefaultHealthCheckCacheTTL
+	}
+
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+	for _, registered := range r.health.checks {
+		if registered.Name == check.Name {
+			return fmt.Errorf("%w: %s", ErrHealthCheckAlreadyExists, check.Name)
+		}
+	}
+	r.health.checks = append(r.health.checks, &registeredHealthCheck{HealthCheck: check})
+	return nil
+}
+
+// Health runs the checks of probe concurrently and returns their results
+func (r *Router) Health(ctx context.Context, probe string) HealthReport {
+	r.health.mu.RLock()
+	var checks []*registeredHealthCheck
+	for _, check := range r.health.checks {
+		if slices.Contains(check.Probes, probe) {
+			checks = append(checks, check)
+		}
+	}
+	r.health.mu.RUnlock()
+
+	report := HealthReport{Status: HealthUp, Checks: make([]HealthCheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = check.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if up, message := r.serviceState(probe); !up {
+		report.Checks = append(report.Checks, HealthCheckResult{
+			Name:      "service",
+			Status:    HealthDown,
+			Error:     message,
+			Duration:  time.Duration(0).String(),
+			CheckedAt: time.Now(),
+		})
+	}
+	for _, result := range report.Checks {
+		if result.Status != HealthUp {
+			report.Status = HealthDown
+		}
+	}
+	return report
+}
+
+// serviceState reports whether the service itself passes probe, as set by SetReady and
+// SetLiveness. Services have started once they are live.
+func (r *Router) serviceState(probe string) (up bool, message string) {
+	if probe == ProbeReadiness {
+		return r.ready.Load(), "service is not ready"
+	}
+	return r.live.Load(), "service is not live"
+}
+
+// run returns the cached result of the check or runs it
+func (c *registeredHealthCheck) run(ctx context.Context) HealthCheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.result != nil && time.Since(c.result.CheckedAt) < c.CacheTTL {
+		return *c.result
+	}
+
+	// the result is cached, it must not depend on the probe that happened to run the check
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.Timeout)
+	defer cancel()
+	start := time.Now()
+	// the check runs in its own goroutine, so checks ignoring ctx cannot block the probe
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Checker.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out after %s", c.Timeout)
+	}
+
+	result := HealthCheckResult{Name: c.Name, Status: HealthUp, Duration: time.Since(start).String(), CheckedAt: start}
+	if err != nil {
+		result.Status = HealthDown
+		result.Error = err.Error()
+		slog.WarnContext(ctx, "Health check failed", "check", c.Name, "error", err)
+	}
+	c.result = &result
+	return result
+}
+
+// httpHealth serves the report of probe, with 503 if it is down
+func (r *Router) httpHealth(probe string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		report := r.Health(req.Context(), probe)
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != HealthUp {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			slog.ErrorContext(req.Context(), "Failed to encode health report", "error", err)
+		}
+	}
+}
+
+// HTTPHealthCheck checks a service by requesting url, it is up if it answers with 2xx
+func HTTPHealthCheck(url string) HealthChecker {
+	return HealthCheckFunc(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// DirWritableHealthCheck checks that files can be written to dir, e.g. the directory of a
+// SQLite database
+func DirWritableHealthCheck(dir string) HealthChecker {
+	return HealthCheckFunc(func(ctx context.Context) error {
+		file, err := os.CreateTemp(dir, ".healthcheck-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(file.Name())
+		if _, err := file.WriteString("ok"); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	})
+}
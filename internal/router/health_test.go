@@ -0,0 +1,177 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRouter_HealthEndpoints(t *testing.T) {
+	r := NewRouter()
+	var storeDown atomic.Bool
+	checks := []HealthCheck{
+		{Name: "store", Checker: HealthCheckFunc(func(ctx context.Context) error {
+			if storeDown.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		}), Probes: []string{ProbeReadiness, ProbeStartup}, CacheTTL: -1},
+		{Name: "disk", Checker: DirWritableHealthCheck(t.TempDir()), Probes: []string{ProbeLiveness}},
+	}
+	for _, check := range checks {
+		if err := r.RegisterHealthCheck(check); err != nil {
+			t.Fatalf("RegisterHealthCheck failed: %v", err)
+		}
+	}
+	mux := http.NewServeMux()
+	if err := r.Build(mux); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	probe := func(path string) (int, HealthReport) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		var report HealthReport
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatalf("Failed to decode report of %s: %v", path, err)
+		}
+		return rr.Code, report
+	}
+
+	// the service itself is not ready before it says so
+	code, report := probe("/health/readiness")
+	if code != http.StatusServiceUnavailable || len(report.Checks) != 2 || report.Checks[1].Name != "service" {
+		t.Errorf("Expected the service not to be ready, got %d %+v", code, report)
+	}
+	if code, _ := probe("/health/startup"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the service not to be started, got %d", code)
+	}
+
+	r.SetReady(true)
+	r.SetLiveness(true)
+	tests := []struct {
+		name           string
+		path           string
+		storeDown      bool
+		expectedStatus int
+		expectedChecks []string
+	}{
+		{name: "ready", path: "/health/readiness", expectedStatus: http.StatusOK, expectedChecks: []string{"store"}},
+		{name: "started", path: "/health/startup", expectedStatus: http.StatusOK, expectedChecks: []string{"store"}},
+		{name: "live", path: "/health/liveness", expectedStatus: http.StatusOK, expectedChecks: []string{"disk"}},
+		{name: "store down", path: "/health/readiness", storeDown: true, expectedStatus: http.StatusServiceUnavailable, expectedChecks: []string{"store"}},
+		{name: "live while store down", path: "/health/liveness", storeDown: true, expectedStatus: http.StatusOK, expectedChecks: []string{"disk"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storeDown.Store(tt.storeDown)
+			code, report := probe(tt.path)
+			if code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, code)
+			}
+			if len(report.Checks) != len(tt.expectedChecks) {
+				t.Fatalf("Expected checks %v, got %+v", tt.expectedChecks, report.Checks)
+			}
+			for i, name := range tt.expectedChecks {
+				result := report.Checks[i]
+				if result.Name != name || (result.Status == HealthUp) != (code == http.StatusOK) || result.CheckedAt.IsZero() {
+					t.Errorf("Unexpected result of check %s: %+v", name, result)
+				}
+				if result.Status == HealthDown && result.Error != "connection refused" {
+					t.Errorf("Expected the error of the check, got %q", result.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestRouter_HealthCheckTimeoutAndCache(t *testing.T) {
+	r := NewRouter()
+	r.SetReady(true)
+	var runs atomic.Int32
+	block := make(chan struct{})
+	defer close(block)
+	checks := []HealthCheck{
+		{Name: "cached", Checker: HealthCheckFunc(func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}), CacheTTL: time.Hour},
+		// the check ignores its context, the probe must not wait for it
+		{Name: "hanging", Checker: HealthCheckFunc(func(ctx context.Context) error {
+			<-block
+			return nil
+		}), Timeout: 10 * time.Millisecond},
+	}
+	for _, check := range checks {
+		if err := r.RegisterHealthCheck(check); err != nil {
+			t.Fatalf("RegisterHealthCheck failed: %v", err)
+		}
+	}
+
+	for range 3 {
+		report := r.Health(context.Background(), ProbeReadiness)
+		if report.Status != HealthDown || report.Checks[0].Status != HealthUp {
+			t.Fatalf("Expected only the hanging check to fail, got %+v", report)
+		}
+		if !strings.Contains(report.Checks[1].Error, "timed out") {
+			t.Errorf("Expected the hanging check to time out, got %q", report.Checks[1].Error)
+		}
+	}
+	if got := runs.Load(); got != 1 {
+		t.Errorf("Expected the cached check to run once, ran %d times", got)
+	}
+}
+
+func TestRouter_RegisterHealthCheck(t *testing.T) {
+	r := NewRouter()
+	checker := HealthCheckFunc(func(ctx context.Context) error { return nil })
+	if err := r.RegisterHealthCheck(HealthCheck{Name: "store", Checker: checker}); err != nil {
+		t.Fatalf("RegisterHealthCheck failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		check   HealthCheck
+		wantErr error
+	}{
+		{name: "duplicate name", check: HealthCheck{Name: "store", Checker: checker}, wantErr: ErrHealthCheckAlreadyExists},
+		{name: "missing name", check: HealthCheck{Checker: checker}, wantErr: ErrHealthCheckInvalid},
+		{name: "missing checker", check: HealthCheck{Name: "disk"}, wantErr: ErrHealthCheckInvalid},
+		{name: "unknown probe", check: HealthCheck{Name: "disk", Checker: checker, Probes: []string{"shutdown"}}, wantErr: ErrHealthCheckInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.RegisterHealthCheck(tt.check); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHTTPHealthCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health/readiness" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	if err := HTTPHealthCheck(server.URL + "/health/readiness").Check(context.Background()); err != nil {
+		t.Errorf("Expected the check to pass, got %v", err)
+	}
+	if err := HTTPHealthCheck(server.URL + "/health/liveness").Check(context.Background()); err == nil {
+		t.Error("Expected the check to fail for 503")
+	}
+	if err := DirWritableHealthCheck("/nonexistent").Check(context.Background()); err == nil {
+		t.Error("Expected the check to fail for a missing directory")
+	}
+}
@@ -0,0 +1,122 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Identity is the user a request has been made for, the authenticated principal of the request
+type Identity struct {
+	// Service names the service that made the request on its own behalf, e.g. the gateway
+	// validating credentials. UserID is not set for services.
+	Service string
+	// Anonymous is set for requests the gateway passed on for clients that are not logged in,
+	// e.g. registrations. UserID is not set for them.
+	Anonymous bool
+	UserID    uuid.UUID
+	Username  string
+	// CartID is the cart of the session the request has been made in
+	CartID uuid.UUID
+	// IsAdmin grants all permissions
+	IsAdmin     bool
+	Permissions []string
+}
+
+// Can reports whether the identity holds the permission
+func (i *Identity) Can(permission string) bool {
+	return i.IsAdmin || slices.Contains(i.Permissions, permission)
+}
+
+type identityContextKey struct{}
+
+// ContextWithIdentity returns a copy of ctx holding the identity
+func ContextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity verified by Authenticate, or nil if the request
+// has not been made on behalf of a user.
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityContextKey{}).(*Identity)
+	return identity
+}
+
+// Authenticate returns a middleware that verifies the identity token set by the gateway and
+// stores the identity in the request context. Requests with an invalid token are rejected,
+// requests without a token are passed on without an identity, routes requiring one reject
+// them, see RequireCaller and RequirePermission.
+func Authenticate(tokens *IdentityTokens) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(HeaderIdentityToken)
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			identity, err := tokens.Verify(token)
+			if err != nil {
+				NewErrorResponse(r, "Authentication failed", err).WriteTo(w)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// Callers a route can be restricted to, see RequireCaller
+const (
+	// CallerAny routes are served to every caller, including requests without an identity
+	CallerAny Caller = iota
+	// CallerVerified routes are served to requests with a verified identity, i.e. requests
+	// passed on by the gateway, including anonymous ones, and requests of services
+	CallerVerified
+	// CallerService routes are only served to services acting on their own behalf
+	CallerService
+)
+
+// Caller restricts the callers a route is served to
+type Caller int
+
+// RequireCaller serves requests with next only if they have been made by the caller.
+// Requests without an identity are rejected as unauthenticated.
+func RequireCaller(caller Caller, next http.Handler) http.Handler {
+	if caller == CallerAny {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := IdentityFromContext(r.Context())
+		if identity == nil {
+			NewErrorResponse(r, "Authentication required", fmt.Errorf("%w: missing identity", ErrUnauthorized)).WriteTo(w)
+			return
+		}
+		if caller == CallerService && identity.Service == "" {
+			NewErrorResponse(r, "Access denied", fmt.Errorf("%w: the route is reserved for services", ErrForbidden)).WriteTo(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission serves requests with next only if they have been made on behalf of a
+// user holding the permission. Requests without an identity are rejected as unauthenticated.
+func RequirePermission(permission string, next http.HandlerFunc) http.Handler {
+	if permission == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := IdentityFromContext(r.Context())
+		if identity == nil {
+			NewErrorResponse(r, "Authentication required", fmt.Errorf("%w: missing identity", ErrUnauthorized)).WriteTo(w)
+			return
+		}
+		if !identity.Can(permission) {
+			NewErrorResponse(r, "Access denied", fmt.Errorf("%w: missing permission %s", ErrForbidden, permission)).WriteTo(w)
+			return
+		}
+		next(w, r)
+	})
+}
@@ -1,12 +1,16 @@
 package router
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"path"
+	"reflect"
+	"sync/atomic"
 
+	"github.com/leonsteinhaeuser/demo-shop/internal/openapi"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -33,6 +37,26 @@ type PathObject struct {
 	Path   string
 	Method string
 	Func   http.HandlerFunc
+	// Spec documents the route in the OpenAPI document.
+	// Routes without a spec are listed with their path parameters only.
+	Spec *openapi.Spec
+	// Permission is required from the caller identified by the gateway, see RequirePermission.
+	// Routes without a permission are served to every caller.
+	Permission string
+	// Caller restricts the callers the route is served to, see RequireCaller.
+	Caller Caller
+}
+
+// WithPermission returns a copy of the route that requires the given permission.
+func (p PathObject) WithPermission(permission string) PathObject {
+	p.Permission = permission
+	return p
+}
+
+// WithCaller returns a copy of the route that is only served to the given caller.
+func (p PathObject) WithCaller(caller Caller) PathObject {
+	p.Caller = caller
+	return p
 }
 
 type ApiSpec interface {
@@ -46,15 +70,19 @@ type ApiObject interface {
 
 var (
 	ErrUnableToRegisterAlreadyExists = fmt.Errorf("unable to register: object already exists")
-	ErrObjectStorageNotImplemented   = fmt.Errorf("object storage interface not implemented")
+	ErrObjectStorageNotImplemented   = fmt.Errorf("%w: object storage interface not implemented", ErrUnavailable)
 
-	DefaultRouter = &Router{
+	DefaultRouter = NewRouter()
+)
+
+// NewRouter creates a new, empty router.
+// Services typically use the DefaultRouter, separate routers are mainly useful in tests.
+func NewRouter() *Router {
+	return &Router{
 		apiObjects: make(map[string]ApiObject),
 		apiSpec:    []ApiObjectMeta{},
-		readyCh:    make(chan bool, 1),
-		livenessCh: make(chan bool, 2),
 	}
-)
+}
 
 type Router struct {
 	// apiObjects is a map of API route objects
@@ -66,25 +94,56 @@ type Router struct {
 	// apiSpec is a map of API paths and their methods
 	apiSpec []ApiObjectMeta
 
-	readyCh    chan bool
-	livenessCh chan bool
+	// openAPI is the document of the registered API objects, generated by Build
+	openAPI *openapi.Document
+	// openAPIFunc replaces openAPI at /api/openapi.json if set
+	openAPIFunc OpenAPIFunc
+
+	// ready and live are the state of the service itself, the probes check them along with
+	// the registered health checks
+	ready  atomic.Bool
+	live   atomic.Bool
+	health healthRegistry
 }
 
+// OpenAPIFunc returns the OpenAPI document served at /api/openapi.json.
+type OpenAPIFunc func(ctx context.Context) (*openapi.Document, error)
+
 type ApiObjectMeta struct {
 	Path   string `json:"path"`
 	Method string `json:"method"`
 }
 
+// SetReady sets whether the service is ready to receive requests. It is not ready before.
 func (r *Router) SetReady(prop bool) {
-	go func() {
-		r.readyCh <- prop
-	}()
+	r.ready.Store(prop)
 }
 
+// SetLiveness sets whether the service is live. It has not started before.
 func (r *Router) SetLiveness(prop bool) {
-	go func() {
-		r.livenessCh <- prop
-	}()
+	r.live.Store(prop)
+}
+
+// SetOpenAPIFunc replaces the OpenAPI document served at /api/openapi.json,
+// e.g. by one that aggregates the documents of several services.
+func (r *Router) SetOpenAPIFunc(fn OpenAPIFunc) {
+	r.openAPIFunc = fn
+}
+
+// OpenAPI returns the OpenAPI document of the registered API objects.
+// It is generated by Build and nil before.
+func (r *Router) OpenAPI() *openapi.Document {
+	return r.openAPI
+}
+
+// NewOpenAPIBuilder returns an OpenAPI builder that documents ErrorResponse as error body of all operations.
+func NewOpenAPIBuilder() *openapi.Builder {
+	b := openapi.NewBuilder(openapi.Info{
+		Title:   "demo-shop",
+		Version: "v1",
+	})
+	b.SetErrorResponse(problemContentType, reflect.TypeFor[ErrorResponse]())
+	return b
 }
 
 // RegisterPath registers a raw HTTP route with the router.
@@ -119,6 +178,7 @@ func (r *Router) Register(obj ApiObject) error {
 }
 
 func (r *Router) Build(mux *http.ServeMux) error {
+	spec := NewOpenAPIBuilder()
 	// iterate over all registered API objects
 	for fqp, obj := range r.apiObjects {
 		slog.Info("Registering API object", "path", fqp)
@@ -129,9 +189,16 @@ func (r *Router) Build(mux *http.ServeMux) error {
 				Path:   fpath,
 				Method: pobj.Method,
 			})
-			mux.HandleFunc(pobj.Method+" "+fpath, pobj.Func)
+			ospec := openapi.Spec{}
+			if pobj.Spec != nil {
+				ospec = *pobj.Spec
+			}
+			ospec.Permission = pobj.Permission
+			spec.Add(pobj.Method, fpath, ospec, obj.GetKind())
+			mux.Handle(pobj.Method+" "+fpath, RequireCaller(pobj.Caller, RequirePermission(pobj.Permission, pobj.Func)))
 		}
 	}
+	r.openAPI = spec.Document()
 	r.apiSpec = append(r.apiSpec,
 		ApiObjectMeta{
 			Path:   "/metrics",
@@ -142,11 +209,19 @@ func (r *Router) Build(mux *http.ServeMux) error {
 		}, ApiObjectMeta{
 			Path:   "/health/readiness",
 			Method: "GET",
+		}, ApiObjectMeta{
+			Path:   "/health/startup",
+			Method: "GET",
+		}, ApiObjectMeta{
+			Path:   "/api/openapi.json",
+			Method: "GET",
 		},
 	)
 	mux.Handle("/metrics", promhttp.Handler())
-	mux.HandleFunc("GET /health/readiness", httpHealthz(r.readyCh))
-	mux.HandleFunc("GET /health/liveness", httpHealthz(r.livenessCh))
+	mux.HandleFunc("GET /health/readiness", r.httpHealth(ProbeReadiness))
+	mux.HandleFunc("GET /health/liveness", r.httpHealth(ProbeLiveness))
+	mux.HandleFunc("GET /health/startup", r.httpHealth(ProbeStartup))
+	mux.HandleFunc("GET /api/openapi.json", r.httpOpenAPI)
 	mux.HandleFunc("/api/metadata", func(wrt http.ResponseWriter, req *http.Request) {
 		wrt.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(wrt).Encode(r.apiSpec); err != nil {
@@ -162,6 +237,24 @@ func (r *Router) Build(mux *http.ServeMux) error {
 	return nil
 }
 
+// httpOpenAPI serves the OpenAPI document of the router.
+func (r *Router) httpOpenAPI(w http.ResponseWriter, req *http.Request) {
+	doc := r.openAPI
+	if r.openAPIFunc != nil {
+		var err error
+		doc, err = r.openAPIFunc(req.Context())
+		if err != nil {
+			NewErrorResponse(req, "Failed to generate OpenAPI document", err).WriteTo(w)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		NewErrorResponse(req, "Failed to encode OpenAPI document", err).WriteTo(w)
+		return
+	}
+}
+
 func EnableCorsHeader(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Allow requests from frontend origin
@@ -192,20 +285,3 @@ func EnableCorsHeader(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
-
-func httpHealthz(readyCh <-chan bool) func(w http.ResponseWriter, r *http.Request) {
-	isReady := false
-	go func() {
-		for {
-			isReady = <-readyCh
-		}
-	}()
-	return func(w http.ResponseWriter, r *http.Request) {
-		if !isReady {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
-	}
-}
@@ -0,0 +1,224 @@
+package router
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HeaderIdentityToken carries the identity token the gateway signs for every request it
+// proxies on behalf of a logged in user.
+const HeaderIdentityToken = "X-Identity-Token"
+
+const (
+	// DefaultIdentityTokenTTL is the lifetime of identity tokens. They are signed per request,
+	// so it only has to cover the time a request takes to reach the upstream service.
+	DefaultIdentityTokenTTL = time.Minute
+	// identityTokenLeeway tolerates clock skew between the gateway and the upstream services
+	identityTokenLeeway = 5 * time.Second
+	// identityTokenIssuer identifies the gateway as the issuer of the tokens
+	identityTokenIssuer = "demo-shop-gateway"
+)
+
+// ErrInvalidIdentityToken is returned for identity tokens that have been tampered with,
+// are malformed, have expired or have been signed with an unknown key.
+var ErrInvalidIdentityToken = fmt.Errorf("%w: invalid identity token", ErrUnauthorized)
+
+// IdentityTokens signs and verifies identity tokens, JSON Web Tokens signed with HMAC-SHA256
+// by the gateway and verified by the upstream services. It holds one active key used for
+// signing and any number of previous keys that are still accepted while the key is rotated.
+// It is safe for concurrent use.
+type IdentityTokens struct {
+	// keys holds the active key first, followed by the previous keys
+	keys []identityKey
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+type identityKey struct {
+	id     string
+	secret []byte
+}
+
+// identityTokenHeader is the JOSE header of an identity token
+type identityTokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// identityTokenClaims are the claims of an identity token
+type identityTokenClaims struct {
+	Issuer      string    `json:"iss"`
+	Subject     uuid.UUID `json:"sub,omitzero"`
+	Service     string    `json:"svc,omitempty"`
+	Anonymous   bool      `json:"anon,omitempty"`
+	Username    string    `json:"preferred_username,omitempty"`
+	CartID      uuid.UUID `json:"cart_id,omitzero"`
+	IsAdmin     bool      `json:"admin,omitempty"`
+	Permissions []string  `json:"permissions,omitempty"`
+	IssuedAt    int64     `json:"iat"`
+	ExpiresAt   int64     `json:"exp"`
+}
+
+// NewIdentityTokens returns identity tokens signed with active and verified with active and
+// all previous keys. Secrets of any length are accepted, the signing keys are derived from
+// them with HKDF-SHA256.
+func NewIdentityTokens(active []byte, previous ...[]byte) (*IdentityTokens, error) {
+	t := &IdentityTokens{
+		ttl: DefaultIdentityTokenTTL,
+		now: time.Now,
+	}
+	for _, secret := range append([][]byte{active}, previous...) {
+		if len(secret) == 0 {
+			return nil, errors.New("identity token keys must not be empty")
+		}
+		derived, err := hkdf.Key(sha256.New, secret, nil, "demo-shop identity token", 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive identity token key: %w", err)
+		}
+		sum := sha256.Sum256(derived)
+		t.keys = append(t.keys, identityKey{id: hex.EncodeToString(sum[:4]), secret: derived})
+	}
+	return t, nil
+}
+
+// SetTTL configures the lifetime of the tokens signed from now on.
+func (t *IdentityTokens) SetTTL(ttl time.Duration) {
+	t.ttl = ttl
+}
+
+// Sign returns a token holding the identity that expires after the configured lifetime.
+func (t *IdentityTokens) Sign(identity *Identity) (string, error) {
+	now := t.now()
+	key := t.keys[0]
+	header, err := json.Marshal(identityTokenHeader{Algorithm: "HS256", Type: "JWT", KeyID: key.id})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(identityTokenClaims{
+		Issuer:      identityTokenIssuer,
+		Subject:     identity.UserID,
+		Service:     identity.Service,
+		Anonymous:   identity.Anonymous,
+		Username:    identity.Username,
+		CartID:      identity.CartID,
+		IsAdmin:     identity.IsAdmin,
+		Permissions: identity.Permissions,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(t.ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(key.sign(signed)), nil
+}
+
+// Verify returns the identity held by the token. It fails with an error wrapping
+// ErrInvalidIdentityToken unless the token has been signed with one of the keys and has not expired.
+func (t *IdentityTokens) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIdentityToken)
+	}
+
+	var header identityTokenHeader
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %w", ErrInvalidIdentityToken, err)
+	}
+	if header.Algorithm != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIdentityToken, header.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %w", ErrInvalidIdentityToken, err)
+	}
+	valid := false
+	for _, key := range t.keys {
+		if key.id == header.KeyID {
+			valid = hmac.Equal(signature, key.sign(parts[0]+"."+parts[1]))
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidIdentityToken)
+	}
+
+	var claims identityTokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %w", ErrInvalidIdentityToken, err)
+	}
+	if claims.Issuer != identityTokenIssuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIdentityToken, claims.Issuer)
+	}
+	if t.now().Add(-identityTokenLeeway).Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: token has expired", ErrInvalidIdentityToken)
+	}
+	if claims.Subject == uuid.Nil && claims.Service == "" && !claims.Anonymous {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIdentityToken)
+	}
+
+	return &Identity{
+		Service:     claims.Service,
+		Anonymous:   claims.Anonymous,
+		UserID:      claims.Subject,
+		Username:    claims.Username,
+		CartID:      claims.CartID,
+		IsAdmin:     claims.IsAdmin,
+		Permissions: claims.Permissions,
+	}, nil
+}
+
+// Transport returns a round tripper that authenticates the requests it sends with an identity
+// token of the service, e.g. the requests of the gateway to the user service. Requests are
+// sent with base, http.DefaultTransport if nil.
+func (t *IdentityTokens) Transport(service string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &serviceTransport{tokens: t, identity: &Identity{Service: service}, base: base}
+}
+
+// serviceTransport sets a freshly signed identity token of a service on every request
+type serviceTransport struct {
+	tokens   *IdentityTokens
+	identity *Identity
+	base     http.RoundTripper
+}
+
+func (s *serviceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := s.tokens.Sign(s.identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign identity token: %w", err)
+	}
+	// round trippers must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(HeaderIdentityToken, token)
+	return s.base.RoundTrip(req)
+}
+
+func (k identityKey) sign(signed string) []byte {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+func decodeTokenPart(part string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,206 @@
+package router
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestIdentityTokens(t *testing.T, active string, previous ...string) *IdentityTokens {
+	t.Helper()
+	var previousKeys [][]byte
+	for _, key := range previous {
+		previousKeys = append(previousKeys, []byte(key))
+	}
+	tokens, err := NewIdentityTokens([]byte(active), previousKeys...)
+	if err != nil {
+		t.Fatalf("Failed to create identity tokens: %v", err)
+	}
+	return tokens
+}
+
+func TestIdentityTokens_SignAndVerify(t *testing.T) {
+	tokens := newTestIdentityTokens(t, "active")
+	identity := &Identity{
+		UserID:      uuid.New(),
+		Username:    "alice",
+		CartID:      uuid.New(),
+		Permissions: []string{"carts:read", "users:read"},
+	}
+
+	token, err := tokens.Sign(identity)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	got, err := tokens.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if got.UserID != identity.UserID || got.Username != identity.Username || got.CartID != identity.CartID ||
+		got.IsAdmin != identity.IsAdmin || !slices.Equal(got.Permissions, identity.Permissions) {
+		t.Errorf("Expected identity %+v, got %+v", *identity, *got)
+	}
+}
+
+func TestIdentityTokens_Verify(t *testing.T) {
+	tokens := newTestIdentityTokens(t, "active", "previous")
+	identity := &Identity{UserID: uuid.New(), Username: "alice"}
+
+	valid, err := tokens.Sign(identity)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	sign := func(tokens *IdentityTokens) string {
+		token, err := tokens.Sign(identity)
+		if err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		return token
+	}
+	parts := strings.Split(valid, ".")
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("Failed to decode claims: %v", err)
+	}
+	escalated := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(claims), `"iss"`, `"admin":true,"iss"`, 1)))
+
+	expired := newTestIdentityTokens(t, "active")
+	expired.now = func() time.Time { return time.Now().Add(-time.Hour) }
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: valid},
+		{name: "signed with previous key", token: sign(newTestIdentityTokens(t, "previous"))},
+		{name: "signed with unknown key", token: sign(newTestIdentityTokens(t, "unknown")), wantErr: true},
+		{name: "expired", token: sign(expired), wantErr: true},
+		{name: "tampered claims", token: parts[0] + "." + escalated + "." + parts[2], wantErr: true},
+		{name: "missing signature", token: parts[0] + "." + parts[1] + ".", wantErr: true},
+		{name: "unsigned", token: "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + ".", wantErr: true},
+		{name: "malformed", token: "not-a-token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tokens.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("Expected error wrapping %v, got %v", ErrUnauthorized, err)
+			}
+			if err == nil && got.UserID != identity.UserID {
+				t.Errorf("Expected user %s, got %s", identity.UserID, got.UserID)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tokens := newTestIdentityTokens(t, "active")
+	readers, err := tokens.Sign(&Identity{UserID: uuid.New(), Permissions: []string{"items:read"}})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	admins, err := tokens.Sign(&Identity{UserID: uuid.New(), IsAdmin: true})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	forged, err := newTestIdentityTokens(t, "forged").Sign(&Identity{UserID: uuid.New(), IsAdmin: true})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	service, err := tokens.Sign(&Identity{Service: "gateway"})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	anonymous, err := tokens.Sign(&Identity{Anonymous: true})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	forgedService, err := newTestIdentityTokens(t, "forged").Sign(&Identity{Service: "gateway"})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /open", RequirePermission("", func(w http.ResponseWriter, r *http.Request) {}))
+	mux.Handle("GET /restricted", RequirePermission("items:write", func(w http.ResponseWriter, r *http.Request) {
+		if IdentityFromContext(r.Context()) == nil {
+			t.Error("Expected the identity in the request context")
+		}
+	}))
+	mux.Handle("GET /verified", RequireCaller(CallerVerified, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	mux.Handle("GET /internal", RequireCaller(CallerService, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	handler := Authenticate(tokens)(mux)
+
+	tests := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "open without token", path: "/open", expectedStatus: http.StatusOK},
+		{name: "open with forged token", path: "/open", token: forged, expectedStatus: http.StatusUnauthorized},
+		{name: "restricted without token", path: "/restricted", expectedStatus: http.StatusUnauthorized},
+		{name: "restricted without permission", path: "/restricted", token: readers, expectedStatus: http.StatusForbidden},
+		{name: "restricted as admin", path: "/restricted", token: admins, expectedStatus: http.StatusOK},
+		{name: "restricted with forged token", path: "/restricted", token: forged, expectedStatus: http.StatusUnauthorized},
+		{name: "restricted as service", path: "/restricted", token: service, expectedStatus: http.StatusForbidden},
+		{name: "verified without token", path: "/verified", expectedStatus: http.StatusUnauthorized},
+		{name: "verified as user", path: "/verified", token: readers, expectedStatus: http.StatusOK},
+		{name: "verified as anonymous", path: "/verified", token: anonymous, expectedStatus: http.StatusOK},
+		{name: "verified as service", path: "/verified", token: service, expectedStatus: http.StatusOK},
+		{name: "internal without token", path: "/internal", expectedStatus: http.StatusUnauthorized},
+		{name: "internal as admin", path: "/internal", token: admins, expectedStatus: http.StatusForbidden},
+		{name: "internal as anonymous", path: "/internal", token: anonymous, expectedStatus: http.StatusForbidden},
+		{name: "internal as service", path: "/internal", token: service, expectedStatus: http.StatusOK},
+		{name: "internal with forged service token", path: "/internal", token: forgedService, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set(HeaderIdentityToken, tt.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdentityTokens_Transport(t *testing.T) {
+	tokens := newTestIdentityTokens(t, "active")
+	var got *Identity
+	server := httptest.NewServer(Authenticate(tokens)(RequireCaller(CallerService, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = IdentityFromContext(r.Context())
+	}))))
+	defer server.Close()
+
+	client := &http.Client{Transport: tokens.Transport("gateway", nil)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if got == nil || got.Service != "gateway" || got.UserID != uuid.Nil || got.Can("items:read") {
+		t.Errorf("Expected the unprivileged identity of the gateway, got %+v", got)
+	}
+}
@@ -0,0 +1,132 @@
+// Package securecookie encrypts and authenticates cookie values with AES-256-GCM.
+//
+// A Codec holds one active key, used to encode new values, and any number of previous
+// keys that are still accepted when decoding. Rotating a key therefore means making the
+// new key active and keeping the old one as previous key until all cookies encoded with
+// it have expired.
+package securecookie
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// formatVersion is the first byte of every encoded value and allows changing the format later on.
+const formatVersion byte = 1
+
+// keyIDLength is the number of bytes identifying the key a value has been encoded with.
+const keyIDLength = 4
+
+// ErrInvalidValue is returned for values that have been tampered with, are malformed
+// or have been encoded with an unknown key.
+var ErrInvalidValue = errors.New("invalid cookie value")
+
+// Codec encodes and decodes cookie values. It is safe for concurrent use.
+type Codec struct {
+	// keys holds the active key first, followed by the previous keys
+	keys []key
+}
+
+type key struct {
+	id   [keyIDLength]byte
+	aead cipher.AEAD
+}
+
+// New returns a codec encrypting with active and decrypting with active and all previous keys.
+// Secrets of any length are accepted, the AES keys are derived from them with HKDF-SHA256.
+func New(active []byte, previous ...[]byte) (*Codec, error) {
+	c := &Codec{}
+	for _, secret := range append([][]byte{active}, previous...) {
+		if len(secret) == 0 {
+			return nil, errors.New("cookie keys must not be empty")
+		}
+		k, err := newKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, k)
+	}
+	return c, nil
+}
+
+func newKey(secret []byte) (key, error) {
+	derived, err := hkdf.Key(sha256.New, secret, nil, "demo-shop securecookie", 32)
+	if err != nil {
+		return key{}, fmt.Errorf("failed to derive cookie key: %w", err)
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return key{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return key{}, err
+	}
+	k := key{aead: aead}
+	sum := sha256.Sum256(derived)
+	copy(k.id[:], sum[:])
+	return k, nil
+}
+
+// Encode encrypts value with the active key. The cookie name is authenticated as well,
+// so a value cannot be moved to a cookie of another name.
+func (c *Codec) Encode(name string, value []byte) (string, error) {
+	k := c.keys[0]
+	header := append([]byte{formatVersion}, k.id[:]...)
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append(header, nonce...)
+	out = k.aead.Seal(out, nonce, value, additionalData(name, header))
+	return base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+// Decode decrypts a value returned by Encode for the same cookie name.
+// It returns an error wrapping ErrInvalidValue if the value cannot be authenticated.
+func (c *Codec) Decode(name, value string) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidValue, err)
+	}
+	if len(raw) < 1+keyIDLength || raw[0] != formatVersion {
+		return nil, fmt.Errorf("%w: unsupported format", ErrInvalidValue)
+	}
+	header, rest := raw[:1+keyIDLength], raw[1+keyIDLength:]
+
+	for _, k := range c.keys {
+		if !bytes.Equal(k.id[:], header[1:]) {
+			continue
+		}
+		if len(rest) < k.aead.NonceSize() {
+			return nil, fmt.Errorf("%w: value too short", ErrInvalidValue)
+		}
+		nonce, ciphertext := rest[:k.aead.NonceSize()], rest[k.aead.NonceSize():]
+		plaintext, err := k.aead.Open(nil, nonce, ciphertext, additionalData(name, header))
+		if err != nil {
+			return nil, fmt.Errorf("%w: authentication failed", ErrInvalidValue)
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key", ErrInvalidValue)
+}
+
+func additionalData(name string, header []byte) []byte {
+	return append(append([]byte(name), 0), header...)
+}
+
+// Must returns c if err is nil and panics otherwise, it is intended for keys that are known to be valid.
+func Must(c *Codec, err error) *Codec {
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,94 @@
+package securecookie
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	c, err := New([]byte("secret"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	encoded, err := c.Encode("session", []byte(`{"user_id":"1"}`))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	decoded, err := c.Decode("session", encoded)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if string(decoded) != `{"user_id":"1"}` {
+		t.Errorf("Expected decoded value %q, got %q", `{"user_id":"1"}`, decoded)
+	}
+
+	again, _ := c.Encode("session", []byte(`{"user_id":"1"}`))
+	if again == encoded {
+		t.Error("Expected encoding the same value twice to use different nonces")
+	}
+}
+
+func TestCodec_Rejects(t *testing.T) {
+	c := Must(New([]byte("secret")))
+	encoded, err := c.Encode("session", []byte("value"))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(encoded)
+	raw[len(raw)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name  string
+		codec *Codec
+		cname string
+		value string
+	}{
+		{name: "tampered", codec: c, cname: "session", value: tampered},
+		{name: "other cookie name", codec: c, cname: "other", value: encoded},
+		{name: "unknown key", codec: Must(New([]byte("other secret"))), cname: "session", value: encoded},
+		{name: "plain base64", codec: c, cname: "session", value: base64.RawURLEncoding.EncodeToString([]byte(`{"user_id":"1"}`))},
+		{name: "not base64", codec: c, cname: "session", value: "%%%"},
+		{name: "empty", codec: c, cname: "session", value: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.codec.Decode(tt.cname, tt.value)
+			if !errors.Is(err, ErrInvalidValue) {
+				t.Errorf("Expected %v, got %v", ErrInvalidValue, err)
+			}
+		})
+	}
+}
+
+func TestCodec_KeyRotation(t *testing.T) {
+	old := Must(New([]byte("old secret")))
+	rotated := Must(New([]byte("new secret"), []byte("old secret")))
+
+	encoded, err := old.Encode("session", []byte("value"))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if _, err := rotated.Decode("session", encoded); err != nil {
+		t.Errorf("Expected value encoded with a previous key to be accepted, got %v", err)
+	}
+
+	encoded, err = rotated.Encode("session", []byte("value"))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if _, err := old.Decode("session", encoded); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected new values to be encoded with the active key, got %v", err)
+	}
+}
+
+func TestNew_EmptyKey(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Error("Expected an error for an empty key")
+	}
+	if _, err := New([]byte("secret"), []byte{}); err == nil {
+		t.Error("Expected an error for an empty previous key")
+	}
+}
@@ -0,0 +1,108 @@
+package inmem
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+var (
+	_ apiv1.APIKeyStore = (*APIKeyInMemStorage)(nil)
+)
+
+// APIKeyInMemStorage keeps API keys in memory, the keys themselves are only kept as hash.
+type APIKeyInMemStorage struct {
+	mu   sync.RWMutex
+	keys map[uuid.UUID]*apiv1.APIKey
+	// hashes maps the hashes of the keys to their IDs
+	hashes map[string]uuid.UUID
+}
+
+func NewAPIKeyInMemStorage() *APIKeyInMemStorage {
+	return &APIKeyInMemStorage{
+		keys:   map[uuid.UUID]*apiv1.APIKey{},
+		hashes: map[string]uuid.UUID{},
+	}
+}
+
+func (s *APIKeyInMemStorage) Create(ctx context.Context, key *apiv1.APIKey) error {
+	if key.Key == "" {
+		return apiv1.NewValidationError(apiv1.Violation{Field: "key", Message: "must not be empty"})
+	}
+	if key.ID == uuid.Nil {
+		key.ID = uuid.New()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := apiv1.HashAPIKey(key.Key)
+	if _, exists := s.keys[key.ID]; exists {
+		return fmt.Errorf("api key with this ID %w", apiv1.ErrAlreadyExists)
+	}
+	if _, exists := s.hashes[hash]; exists {
+		return fmt.Errorf("api key %w", apiv1.ErrAlreadyExists)
+	}
+	s.keys[key.ID] = cloneAPIKey(key)
+	s.hashes[hash] = key.ID
+	return nil
+}
+
+func (s *APIKeyInMemStorage) ListByUser(ctx context.Context, userID uuid.UUID) ([]apiv1.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []apiv1.APIKey{}
+	for _, key := range s.keys {
+		if key.UserID == userID {
+			keys = append(keys, *cloneAPIKey(key))
+		}
+	}
+	slices.SortFunc(keys, func(a, b apiv1.APIKey) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), slices.Compare(a.ID[:], b.ID[:]))
+	})
+	return keys, nil
+}
+
+func (s *APIKeyInMemStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, exists := s.keys[id]
+	if !exists {
+		return nil, fmt.Errorf("api key %w", apiv1.ErrNotFound)
+	}
+	return cloneAPIKey(key), nil
+}
+
+func (s *APIKeyInMemStorage) GetByKey(ctx context.Context, key string) (*apiv1.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.hashes[apiv1.HashAPIKey(key)]
+	if !exists {
+		return nil, fmt.Errorf("api key %w", apiv1.ErrNotFound)
+	}
+	return cloneAPIKey(s.keys[id]), nil
+}
+
+func (s *APIKeyInMemStorage) Delete(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.keys[id]; !exists {
+		return fmt.Errorf("api key %w", apiv1.ErrNotFound)
+	}
+	delete(s.keys, id)
+	for hash, keyID := range s.hashes {
+		if keyID == id {
+			delete(s.hashes, hash)
+		}
+	}
+	return nil
+}
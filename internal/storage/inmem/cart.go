@@ -2,7 +2,8 @@ package inmem
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +15,7 @@ var (
 )
 
 type CartInMemStorage struct {
+	mu    sync.RWMutex
 	carts map[string]*apiv1.Cart
 }
 
@@ -26,6 +28,7 @@ func NewCartInMemStorage() *CartInMemStorage {
 				ID:        defaultCart,
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
+				Version:   1,
 				OwnerID:   defaultUser,
 				Items:     []apiv1.CartItem{},
 			},
@@ -34,6 +37,9 @@ func NewCartInMemStorage() *CartInMemStorage {
 }
 
 func (c *CartInMemStorage) Create(ctx context.Context, cart *apiv1.Cart) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// If cart ID is not provided, generate a new one
 	if cart.ID == uuid.Nil {
 		for {
@@ -48,32 +54,73 @@ func (c *CartInMemStorage) Create(ctx context.Context, cart *apiv1.Cart) error {
 
 	// Check if cart with the provided ID already exists
 	if _, exists := c.carts[cart.ID.String()]; exists {
-		return errors.New("cart with this ID already exists")
+		return fmt.Errorf("cart with this ID %w", apiv1.ErrAlreadyExists)
 	}
 
-	c.carts[cart.ID.String()] = cart
+	cart.Version = 1
+	c.carts[cart.ID.String()] = cloneCart(cart)
 	return nil
 }
 
 func (c *CartInMemStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.Cart, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	cart, exists := c.carts[id.String()]
 	if !exists {
-		return nil, errors.New("cart not found")
+		return nil, fmt.Errorf("cart %w", apiv1.ErrNotFound)
+	}
+	return cloneCart(cart), nil
+}
+
+func (c *CartInMemStorage) GetByOwner(ctx context.Context, ownerID uuid.UUID) (*apiv1.Cart, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var oldest *apiv1.Cart
+	for _, cart := range c.carts {
+		if cart.OwnerID != ownerID {
+			continue
+		}
+		if oldest == nil || cart.CreatedAt.Before(oldest.CreatedAt) ||
+			cart.CreatedAt.Equal(oldest.CreatedAt) && cart.ID.String() < oldest.ID.String() {
+			oldest = cart
+		}
 	}
-	return cart, nil
+	if oldest == nil {
+		return nil, fmt.Errorf("cart %w", apiv1.ErrNotFound)
+	}
+	return cloneCart(oldest), nil
 }
 
 func (c *CartInMemStorage) Update(ctx context.Context, cart *apiv1.Cart) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Check if cart exists before updating
-	if _, exists := c.carts[cart.ID.String()]; !exists {
-		// If cart doesn't exist, create it
-		return c.Create(ctx, cart)
+	existing, exists := c.carts[cart.ID.String()]
+	if !exists {
+		return fmt.Errorf("cart %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("cart", existing.Version, cart.Version); err != nil {
+		return err
 	}
-	c.carts[cart.ID.String()] = cart
+	cart.Version = existing.Version + 1
+	c.carts[cart.ID.String()] = cloneCart(cart)
 	return nil
 }
 
-func (c *CartInMemStorage) Delete(ctx context.Context, id uuid.UUID) error {
+func (c *CartInMemStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, exists := c.carts[id.String()]
+	if !exists {
+		return fmt.Errorf("cart %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("cart", existing.Version, version); err != nil {
+		return err
+	}
 	delete(c.carts, id.String())
 	return nil
 }
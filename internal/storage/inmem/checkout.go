@@ -2,7 +2,8 @@ package inmem
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"sync"
 
 	"github.com/google/uuid"
 	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
@@ -14,6 +15,7 @@ var (
 )
 
 type CheckoutInMemStorage struct {
+	mu        sync.RWMutex
 	checkouts map[string]*apiv1.Checkout
 }
 
@@ -24,32 +26,66 @@ func NewCheckoutInMemStorage() *CheckoutInMemStorage {
 }
 
 func (c *CheckoutInMemStorage) Create(ctx context.Context, checkout *apiv1.Checkout) error {
-	for {
-		id := uuid.New()
-		if _, exists := c.checkouts[id.String()]; exists {
-			continue
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if checkout.ID == uuid.Nil {
+		for {
+			id := uuid.New()
+			if _, exists := c.checkouts[id.String()]; exists {
+				continue
+			}
+			checkout.ID = id
+			break
 		}
-		checkout.ID = id
-		break
 	}
-	c.checkouts[checkout.ID.String()] = checkout
+
+	if _, exists := c.checkouts[checkout.ID.String()]; exists {
+		return fmt.Errorf("checkout with this ID %w", apiv1.ErrAlreadyExists)
+	}
+	checkout.Version = 1
+	c.checkouts[checkout.ID.String()] = cloneCheckout(checkout)
 	return nil
 }
 
 func (c *CheckoutInMemStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.Checkout, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	checkout, exists := c.checkouts[id.String()]
 	if !exists {
-		return nil, errors.New("checkout not found")
+		return nil, fmt.Errorf("checkout %w", apiv1.ErrNotFound)
 	}
-	return checkout, nil
+	return cloneCheckout(checkout), nil
 }
 
 func (c *CheckoutInMemStorage) Update(ctx context.Context, checkout *apiv1.Checkout) error {
-	c.checkouts[checkout.ID.String()] = checkout
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, exists := c.checkouts[checkout.ID.String()]
+	if !exists {
+		return fmt.Errorf("checkout %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("checkout", existing.Version, checkout.Version); err != nil {
+		return err
+	}
+	checkout.Version = existing.Version + 1
+	c.checkouts[checkout.ID.String()] = cloneCheckout(checkout)
 	return nil
 }
 
-func (c *CheckoutInMemStorage) Delete(ctx context.Context, id uuid.UUID) error {
+func (c *CheckoutInMemStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, exists := c.checkouts[id.String()]
+	if !exists {
+		return fmt.Errorf("checkout %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("checkout", existing.Version, version); err != nil {
+		return err
+	}
 	delete(c.checkouts, id.String())
 	return nil
 }
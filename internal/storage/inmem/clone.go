@@ -0,0 +1,85 @@
+package inmem
+
+import (
+	"slices"
+
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+// The in-memory stores never hand out pointers to their internal state.
+// Objects are copied when they are stored and again when they are read,
+// so callers can freely modify the objects they pass in or get back.
+
+func cloneItem(item *apiv1.Item) *apiv1.Item {
+	c := *item
+	return &c
+}
+
+func cloneCart(cart *apiv1.Cart) *apiv1.Cart {
+	c := *cart
+	if cart.Items != nil {
+		c.Items = make([]apiv1.CartItem, len(cart.Items))
+		copy(c.Items, cart.Items)
+	}
+	return &c
+}
+
+func cloneCheckout(checkout *apiv1.Checkout) *apiv1.Checkout {
+	c := *checkout
+	return &c
+}
+
+func cloneUser(user *apiv1.User) *apiv1.User {
+	c := *user
+	c.Username = cloneStringPtr(user.Username)
+	c.Email = cloneStringPtr(user.Email)
+	c.PreferredName = cloneStringPtr(user.PreferredName)
+	c.GivenName = cloneStringPtr(user.GivenName)
+	c.FamilyName = cloneStringPtr(user.FamilyName)
+	c.Locale = cloneStringPtr(user.Locale)
+	c.Issuer = cloneStringPtr(user.Issuer)
+	c.Subject = cloneStringPtr(user.Subject)
+	c.Roles = slices.Clone(user.Roles)
+	c.Permissions = slices.Clone(user.Permissions)
+	return &c
+}
+
+func cloneUserModificationRequest(user *apiv1.UserModificationRequest) *apiv1.UserModificationRequest {
+	return &apiv1.UserModificationRequest{
+		User:     *cloneUser(&user.User),
+		Password: cloneStringPtr(user.Password),
+	}
+}
+
+func cloneRole(role *apiv1.Role) *apiv1.Role {
+	c := *role
+	c.Permissions = slices.Clone(role.Permissions)
+	return &c
+}
+
+func cloneSession(session *apiv1.Session) *apiv1.Session {
+	c := *session
+	c.Roles = slices.Clone(session.Roles)
+	c.Permissions = slices.Clone(session.Permissions)
+	return &c
+}
+
+// cloneAPIKey copies the key without its secret, the stores never return it
+func cloneAPIKey(key *apiv1.APIKey) *apiv1.APIKey {
+	c := *key
+	c.Key = ""
+	c.Scopes = slices.Clone(key.Scopes)
+	if key.ExpiresAt != nil {
+		expiresAt := *key.ExpiresAt
+		c.ExpiresAt = &expiresAt
+	}
+	return &c
+}
+
+func cloneStringPtr(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	return &c
+}
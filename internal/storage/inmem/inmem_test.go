@@ -0,0 +1,337 @@
+package inmem
+
+import (
+	"context"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/password"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/storagetest"
+	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	// the concurrency tests create hundreds of users, hashing their passwords at the default cost takes minutes
+	password.Cost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+func TestItemInMemStorage_Conformance(t *testing.T) {
+	storagetest.TestItemStore(t, func(t *testing.T) apiv1.ItemStore {
+		return NewItemInMemStorage()
+	})
+}
+
+func TestUserInMemStorage_Conformance(t *testing.T) {
+	storagetest.TestUserStore(t, func(t *testing.T) apiv1.UserStore {
+		return NewUserInMemStorage()
+	})
+}
+
+func TestRoleInMemStorage_Conformance(t *testing.T) {
+	storagetest.TestRoleStore(t, func(t *testing.T) apiv1.RoleStore {
+		return NewRoleInMemStorage()
+	})
+}
+
+func TestCartInMemStorage_Conformance(t *testing.T) {
+	storagetest.TestCartStore(t, func(t *testing.T) apiv1.CartStore {
+		return NewCartInMemStorage()
+	})
+}
+
+func TestCheckoutInMemStorage_Conformance(t *testing.T) {
+	storagetest.TestCheckoutStore(t, func(t *testing.T) apiv1.CheckoutStore {
+		return NewCheckoutInMemStorage()
+	})
+}
+
+func TestSessionInMemStorage_Conformance(t *testing.T) {
+	storagetest.TestSessionStore(t, func(t *testing.T) apiv1.SessionStore {
+		return NewSessionInMemStorage()
+	})
+}
+
+func TestAPIKeyInMemStorage_Conformance(t *testing.T) {
+	storagetest.TestAPIKeyStore(t, func(t *testing.T) apiv1.APIKeyStore {
+		return NewAPIKeyInMemStorage()
+	})
+}
+
+// concurrencyWorkers is the number of goroutines hammering a store at once.
+// Run with -race to let the race detector verify the locking.
+const concurrencyWorkers = 16
+
+func TestItemInMemStorage_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	store := NewItemInMemStorage()
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrencyWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				item := &apiv1.Item{Name: "stress", Price: 1, Quantity: n}
+				if err := store.Create(ctx, item); err != nil {
+					t.Errorf("Failed to create item: %v", err)
+					return
+				}
+				got, err := store.Get(ctx, item.ID)
+				if err != nil {
+					t.Errorf("Failed to get item: %v", err)
+					return
+				}
+				got.Quantity++
+				if err := store.Update(ctx, got); err != nil {
+					t.Errorf("Failed to update item: %v", err)
+					return
+				}
+				if _, _, err := store.List(ctx, apiv1.ListOptions{Page: 1, Limit: 10}); err != nil {
+					t.Errorf("Failed to list items: %v", err)
+					return
+				}
+				if err := store.Delete(ctx, item.ID, 0); err != nil {
+					t.Errorf("Failed to delete item: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestUserInMemStorage_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	store := NewUserInMemStorage()
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrencyWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				user := &apiv1.UserModificationRequest{
+					User:     apiv1.User{Username: utils.StringPtr(uuid.NewString())},
+					Password: utils.StringPtr("stress"),
+				}
+				if err := store.Create(ctx, user); err != nil {
+					t.Errorf("Failed to create user: %v", err)
+					return
+				}
+				got, err := store.Get(ctx, user.ID)
+				if err != nil {
+					t.Errorf("Failed to get user: %v", err)
+					return
+				}
+				got.GivenName = utils.StringPtr("Stress")
+				if err := store.Update(ctx, &apiv1.UserModificationRequest{User: *got}); err != nil {
+					t.Errorf("Failed to update user: %v", err)
+					return
+				}
+				if _, _, err := store.List(ctx, apiv1.ListOptions{Page: 1, Limit: 10}); err != nil {
+					t.Errorf("Failed to list users: %v", err)
+					return
+				}
+				if err := store.Delete(ctx, user.ID, 0); err != nil {
+					t.Errorf("Failed to delete user: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCartInMemStorage_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	store := NewCartInMemStorage()
+
+	// all workers modify the same cart to provoke conflicting writes
+	shared := &apiv1.Cart{OwnerID: uuid.New()}
+	if err := store.Create(ctx, shared); err != nil {
+		t.Fatalf("Failed to create cart: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrencyWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				got, err := store.Get(ctx, shared.ID)
+				if err != nil {
+					t.Errorf("Failed to get cart: %v", err)
+					return
+				}
+				got.Items = append(got.Items, apiv1.CartItem{ItemID: uuid.New(), Quantity: 1})
+				if err := store.Update(ctx, got); err != nil {
+					t.Errorf("Failed to update cart: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCheckoutInMemStorage_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	store := NewCheckoutInMemStorage()
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrencyWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				checkout := &apiv1.Checkout{UserID: uuid.New(), CartID: uuid.New(), Status: "pending"}
+				if err := store.Create(ctx, checkout); err != nil {
+					t.Errorf("Failed to create checkout: %v", err)
+					return
+				}
+				got, err := store.Get(ctx, checkout.ID)
+				if err != nil {
+					t.Errorf("Failed to get checkout: %v", err)
+					return
+				}
+				got.Status = "completed"
+				if err := store.Update(ctx, got); err != nil {
+					t.Errorf("Failed to update checkout: %v", err)
+					return
+				}
+				if err := store.Delete(ctx, checkout.ID, 0); err != nil {
+					t.Errorf("Failed to delete checkout: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestItemInMemStorage_CopyOnRead(t *testing.T) {
+	ctx := context.Background()
+	store := NewItemInMemStorage()
+
+	item := &apiv1.Item{Name: "Original"}
+	if err := store.Create(ctx, item); err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+	item.Name = "Modified after create"
+
+	got, err := store.Get(ctx, item.ID)
+	if err != nil {
+		t.Fatalf("Failed to get item: %v", err)
+	}
+	got.Name = "Modified after get"
+
+	got, err = store.Get(ctx, item.ID)
+	if err != nil {
+		t.Fatalf("Failed to get item: %v", err)
+	}
+	if got.Name != "Original" {
+		t.Errorf("Expected stored item to be unchanged, got name %q", got.Name)
+	}
+}
+
+func TestUserInMemStorage_CopyOnRead(t *testing.T) {
+	ctx := context.Background()
+	store := NewUserInMemStorage()
+
+	user := &apiv1.UserModificationRequest{
+		User:     apiv1.User{Username: utils.StringPtr("copy-on-read")},
+		Password: utils.StringPtr("secret"),
+	}
+	if err := store.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	*user.Username = "modified-after-create"
+
+	got, err := store.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	*got.Username = "modified-after-get"
+
+	got, err = store.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if *got.Username != "copy-on-read" {
+		t.Errorf("Expected stored username to be unchanged, got %q", *got.Username)
+	}
+}
+
+func TestCartInMemStorage_CopyOnRead(t *testing.T) {
+	ctx := context.Background()
+	store := NewCartInMemStorage()
+
+	cart := &apiv1.Cart{OwnerID: uuid.New(), Items: []apiv1.CartItem{{ItemID: uuid.New(), Quantity: 1}}}
+	if err := store.Create(ctx, cart); err != nil {
+		t.Fatalf("Failed to create cart: %v", err)
+	}
+	cart.Items[0].Quantity = 2
+
+	got, err := store.Get(ctx, cart.ID)
+	if err != nil {
+		t.Fatalf("Failed to get cart: %v", err)
+	}
+	got.Items[0].Quantity = 3
+
+	got, err = store.Get(ctx, cart.ID)
+	if err != nil {
+		t.Fatalf("Failed to get cart: %v", err)
+	}
+	if got.Items[0].Quantity != 1 {
+		t.Errorf("Expected stored cart item quantity to be unchanged, got %d", got.Items[0].Quantity)
+	}
+}
+
+func TestUserInMemStorage_DefaultUsers(t *testing.T) {
+	ctx := context.Background()
+	store := NewUserInMemStorage()
+
+	root, err := store.ValidateCredentials(ctx, "root", "root")
+	if err != nil {
+		t.Fatalf("Expected the default admin to log in, got %v", err)
+	}
+	if !root.IsAdmin {
+		t.Error("Expected the default admin to be an admin")
+	}
+	if _, err := store.ValidateCredentials(ctx, "user", "userpassword"); err != nil {
+		t.Errorf("Expected the default user to log in, got %v", err)
+	}
+	if stored := store.users[root.ID.String()].Password; stored == nil || *stored == "root" {
+		t.Error("Expected the password of the default admin to be hashed")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	objects := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		name        string
+		page, limit int
+		want        []int
+	}{
+		{name: "first page", page: 1, limit: 2, want: []int{1, 2}},
+		{name: "last page", page: 3, limit: 2, want: []int{5}},
+		{name: "beyond the last page", page: 4, limit: 2, want: []int{}},
+		{name: "all objects", page: 2, limit: 0, want: objects},
+		{name: "huge page", page: 4611686018427387904, limit: 4, want: []int{}},
+		{name: "huge limit", page: 1, limit: math.MaxInt, want: objects},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paginate(objects, tt.page, tt.limit); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
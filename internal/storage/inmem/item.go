@@ -1,8 +1,10 @@
 package inmem
 
 import (
+	"cmp"
 	"context"
-	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +16,7 @@ var (
 )
 
 type ItemInMemStorage struct {
+	mu    sync.RWMutex
 	items map[string]*apiv1.Item
 }
 
@@ -29,6 +32,7 @@ func NewItemInMemStorage() *ItemInMemStorage {
 				ID:        itemApple,
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
+				Version:   1,
 
 				Name:        "Apple",
 				Description: "A juicy red apple",
@@ -40,6 +44,7 @@ func NewItemInMemStorage() *ItemInMemStorage {
 				ID:        itemBanana,
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
+				Version:   1,
 
 				Name:        "Banana",
 				Description: "A ripe yellow banana",
@@ -51,6 +56,7 @@ func NewItemInMemStorage() *ItemInMemStorage {
 				ID:        itemOrange,
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
+				Version:   1,
 
 				Name:        "Orange",
 				Description: "A sweet orange",
@@ -62,6 +68,7 @@ func NewItemInMemStorage() *ItemInMemStorage {
 				ID:        itemMango,
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
+				Version:   1,
 
 				Name:        "Mango",
 				Description: "A ripe mango",
@@ -74,41 +81,95 @@ func NewItemInMemStorage() *ItemInMemStorage {
 }
 
 func (i *ItemInMemStorage) Create(ctx context.Context, item *apiv1.Item) error {
-	// create unique item id
-	for {
-		id := uuid.New()
-		if _, exists := i.items[id.String()]; exists {
-			continue
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// create unique item id if none is provided
+	if item.ID == uuid.Nil {
+		for {
+			id := uuid.New()
+			if _, exists := i.items[id.String()]; exists {
+				continue
+			}
+			item.ID = id
+			break
 		}
-		item.ID = id
-		break
 	}
-	i.items[item.ID.String()] = item
+
+	if _, exists := i.items[item.ID.String()]; exists {
+		return fmt.Errorf("item with this ID %w", apiv1.ErrAlreadyExists)
+	}
+	item.Version = 1
+	i.items[item.ID.String()] = cloneItem(item)
 	return nil
 }
 
-func (i *ItemInMemStorage) List(ctx context.Context, page, limit int) ([]apiv1.Item, error) {
-	var items []apiv1.Item
+// itemComparators defines the fields items can be sorted by
+var itemComparators = comparators[apiv1.Item]{
+	"name":        func(a, b *apiv1.Item) int { return cmp.Compare(a.Name, b.Name) },
+	"description": func(a, b *apiv1.Item) int { return cmp.Compare(a.Description, b.Description) },
+	"price":       func(a, b *apiv1.Item) int { return cmp.Compare(a.Price, b.Price) },
+	"quantity":    func(a, b *apiv1.Item) int { return cmp.Compare(a.Quantity, b.Quantity) },
+	"location":    func(a, b *apiv1.Item) int { return cmp.Compare(a.Location, b.Location) },
+	"created_at":  func(a, b *apiv1.Item) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated_at":  func(a, b *apiv1.Item) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+}
+
+func (i *ItemInMemStorage) List(ctx context.Context, opts apiv1.ListOptions) ([]apiv1.Item, int, error) {
+	i.mu.RLock()
+	items := make([]apiv1.Item, 0, len(i.items))
 	for _, item := range i.items {
 		items = append(items, *item)
 	}
-	return items, nil
+	i.mu.RUnlock()
+
+	err := orderBy(items, opts.Sort, itemComparators, func(item *apiv1.Item) (time.Time, uuid.UUID) {
+		return item.CreatedAt, item.ID
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return paginate(items, opts.Page, opts.Limit), len(items), nil
 }
 
 func (i *ItemInMemStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.Item, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	item, exists := i.items[id.String()]
 	if !exists {
-		return nil, errors.New("item not found")
+		return nil, fmt.Errorf("item %w", apiv1.ErrNotFound)
 	}
-	return item, nil
+	return cloneItem(item), nil
 }
 
 func (i *ItemInMemStorage) Update(ctx context.Context, item *apiv1.Item) error {
-	i.items[item.ID.String()] = item
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	existing, exists := i.items[item.ID.String()]
+	if !exists {
+		return fmt.Errorf("item %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("item", existing.Version, item.Version); err != nil {
+		return err
+	}
+	item.Version = existing.Version + 1
+	i.items[item.ID.String()] = cloneItem(item)
 	return nil
 }
 
-func (i *ItemInMemStorage) Delete(ctx context.Context, id uuid.UUID) error {
+func (i *ItemInMemStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	existing, exists := i.items[id.String()]
+	if !exists {
+		return fmt.Errorf("item %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("item", existing.Version, version); err != nil {
+		return err
+	}
 	delete(i.items, id.String())
 	return nil
 }
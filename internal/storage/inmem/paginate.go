@@ -0,0 +1,78 @@
+package inmem
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+// comparators maps the sortable fields of an object to functions comparing them.
+type comparators[T any] map[string]func(a, b *T) int
+
+// orderBy sorts objects by the given fields. Objects that are equal in all fields
+// are ordered by creation time and ID, resulting in a stable list order.
+func orderBy[T any](objects []T, fields []apiv1.SortField, fieldComparators comparators[T], creation func(*T) (time.Time, uuid.UUID)) error {
+	for _, field := range fields {
+		if _, ok := fieldComparators[field.Field]; !ok {
+			return fmt.Errorf("%w: unsupported sort field %q", apiv1.ErrValidation, field.Field)
+		}
+	}
+
+	slices.SortFunc(objects, func(a, b T) int {
+		for _, field := range fields {
+			c := fieldComparators[field.Field](&a, &b)
+			if field.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		aCreated, aID := creation(&a)
+		bCreated, bID := creation(&b)
+		if c := aCreated.Compare(bCreated); c != 0 {
+			return c
+		}
+		return strings.Compare(aID.String(), bID.String())
+	})
+	return nil
+}
+
+// compareStringPtr compares two optional strings, nil values are ordered first.
+func compareStringPtr(a, b *string) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return cmp.Compare(*a, *b)
+}
+
+// paginate returns the requested page of objects. Pages start at 1,
+// a limit of zero or less returns all objects.
+func paginate[T any](objects []T, page, limit int) []T {
+	if limit <= 0 {
+		return objects
+	}
+	if page < 1 {
+		page = 1
+	}
+	// pages beyond the objects are checked before multiplying, huge pages would overflow
+	if page-1 > len(objects)/limit {
+		return []T{}
+	}
+	start := (page - 1) * limit
+	if start >= len(objects) {
+		return []T{}
+	}
+	end := start + min(limit, len(objects)-start)
+	return objects[start:end]
+}
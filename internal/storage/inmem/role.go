@@ -0,0 +1,157 @@
+package inmem
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+var (
+	_ apiv1.RoleStore = (*RoleInMemStorage)(nil)
+)
+
+type RoleInMemStorage struct {
+	mu    sync.RWMutex
+	roles map[string]*apiv1.Role
+}
+
+func NewRoleInMemStorage() *RoleInMemStorage {
+	roleCatalogManager := uuid.New()
+	roleSupport := uuid.New()
+
+	return &RoleInMemStorage{
+		roles: map[string]*apiv1.Role{
+			roleCatalogManager.String(): {
+				ID:        roleCatalogManager,
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+				Version:   1,
+
+				Name:        "catalog-manager",
+				Description: "Maintains the items of the catalog",
+				Permissions: []string{apiv1.PermissionItemsWrite},
+			},
+			roleSupport.String(): {
+				ID:        roleSupport,
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+				Version:   1,
+
+				Name:        "support",
+				Description: "Looks into the carts and checkouts of customers",
+				Permissions: []string{apiv1.PermissionUsersRead, apiv1.PermissionCartsRead, apiv1.PermissionCheckoutsRead},
+			},
+		},
+	}
+}
+
+func (s *RoleInMemStorage) Create(ctx context.Context, role *apiv1.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if role.ID == uuid.Nil {
+		for {
+			id := uuid.New()
+			if _, exists := s.roles[id.String()]; exists {
+				continue
+			}
+			role.ID = id
+			break
+		}
+	}
+
+	if _, exists := s.roles[role.ID.String()]; exists {
+		return fmt.Errorf("role with this ID %w", apiv1.ErrAlreadyExists)
+	}
+	if s.nameTaken(role.Name, role.ID) {
+		return fmt.Errorf("role with this name %w", apiv1.ErrAlreadyExists)
+	}
+	role.Version = 1
+	s.roles[role.ID.String()] = cloneRole(role)
+	return nil
+}
+
+// nameTaken reports whether another role than id has the given name
+func (s *RoleInMemStorage) nameTaken(name string, id uuid.UUID) bool {
+	for _, existing := range s.roles {
+		if existing.ID != id && existing.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// roleComparators defines the fields roles can be sorted by
+var roleComparators = comparators[apiv1.Role]{
+	"name":        func(a, b *apiv1.Role) int { return cmp.Compare(a.Name, b.Name) },
+	"description": func(a, b *apiv1.Role) int { return cmp.Compare(a.Description, b.Description) },
+	"created_at":  func(a, b *apiv1.Role) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated_at":  func(a, b *apiv1.Role) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+}
+
+func (s *RoleInMemStorage) List(ctx context.Context, opts apiv1.ListOptions) ([]apiv1.Role, int, error) {
+	s.mu.RLock()
+	roles := make([]apiv1.Role, 0, len(s.roles))
+	for _, role := range s.roles {
+		roles = append(roles, *cloneRole(role))
+	}
+	s.mu.RUnlock()
+
+	err := orderBy(roles, opts.Sort, roleComparators, func(role *apiv1.Role) (time.Time, uuid.UUID) {
+		return role.CreatedAt, role.ID
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return paginate(roles, opts.Page, opts.Limit), len(roles), nil
+}
+
+func (s *RoleInMemStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	role, exists := s.roles[id.String()]
+	if !exists {
+		return nil, fmt.Errorf("role %w", apiv1.ErrNotFound)
+	}
+	return cloneRole(role), nil
+}
+
+func (s *RoleInMemStorage) Update(ctx context.Context, role *apiv1.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.roles[role.ID.String()]
+	if !exists {
+		return fmt.Errorf("role %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("role", existing.Version, role.Version); err != nil {
+		return err
+	}
+	if s.nameTaken(role.Name, role.ID) {
+		return fmt.Errorf("role with this name %w", apiv1.ErrAlreadyExists)
+	}
+	role.Version = existing.Version + 1
+	s.roles[role.ID.String()] = cloneRole(role)
+	return nil
+}
+
+func (s *RoleInMemStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.roles[id.String()]
+	if !exists {
+		return fmt.Errorf("role %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("role", existing.Version, version); err != nil {
+		return err
+	}
+	delete(s.roles, id.String())
+	return nil
+}
@@ -0,0 +1,119 @@
+package inmem
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+var (
+	_ apiv1.SessionStore = (*SessionInMemStorage)(nil)
+)
+
+// SessionInMemStorage keeps sessions in memory. Expired sessions are removed
+// when the sessions of their user are listed or revoked.
+type SessionInMemStorage struct {
+	mu       sync.RWMutex
+	sessions map[string]*apiv1.Session
+}
+
+func NewSessionInMemStorage() *SessionInMemStorage {
+	return &SessionInMemStorage{
+		sessions: map[string]*apiv1.Session{},
+	}
+}
+
+func (s *SessionInMemStorage) Create(ctx context.Context, session *apiv1.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.sessions[session.ID]; exists && !existing.Expired(time.Now()) {
+		return fmt.Errorf("session with this ID %w", apiv1.ErrAlreadyExists)
+	}
+	c := cloneSession(session)
+	c.Current = false
+	s.sessions[session.ID] = c
+	return nil
+}
+
+func (s *SessionInMemStorage) Get(ctx context.Context, id string) (*apiv1.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[id]
+	if !exists || session.Expired(time.Now()) {
+		return nil, fmt.Errorf("session %w", apiv1.ErrNotFound)
+	}
+	return cloneSession(session), nil
+}
+
+func (s *SessionInMemStorage) Touch(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists || session.Expired(time.Now()) {
+		return fmt.Errorf("session %w", apiv1.ErrNotFound)
+	}
+	session.LastSeenAt = lastSeenAt
+	session.ExpiresAt = expiresAt
+	return nil
+}
+
+func (s *SessionInMemStorage) ListByUser(ctx context.Context, userID uuid.UUID) ([]apiv1.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	sessions := []apiv1.Session{}
+	for id, session := range s.sessions {
+		if session.Expired(now) {
+			delete(s.sessions, id)
+			continue
+		}
+		if session.UserID == userID {
+			sessions = append(sessions, *cloneSession(session))
+		}
+	}
+	slices.SortFunc(sessions, func(a, b apiv1.Session) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return sessions, nil
+}
+
+func (s *SessionInMemStorage) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists || session.Expired(time.Now()) {
+		return fmt.Errorf("session %w", apiv1.ErrNotFound)
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *SessionInMemStorage) DeleteByUser(ctx context.Context, userID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	revoked := 0
+	for id, session := range s.sessions {
+		switch {
+		case session.Expired(now):
+			delete(s.sessions, id)
+		case session.UserID == userID:
+			delete(s.sessions, id)
+			revoked++
+		}
+	}
+	return revoked, nil
+}
@@ -2,11 +2,13 @@ package inmem
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/password"
 	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
 )
 
@@ -15,13 +17,28 @@ var (
 	defaultRegUser = uuid.New()
 
 	_ apiv1.UserStore = (*UserInMemStorage)(nil)
+
+	// defaultPasswordHashes hashes the passwords of the default users once, hashing is deliberately slow
+	defaultPasswordHashes = sync.OnceValues(func() (string, string) {
+		return mustHash("root"), mustHash("userpassword")
+	})
 )
 
+func mustHash(pw string) string {
+	hash, err := password.Hash(pw)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
 type UserInMemStorage struct {
+	mu    sync.RWMutex
 	users map[string]*apiv1.UserModificationRequest
 }
 
 func NewUserInMemStorage() *UserInMemStorage {
+	rootPassword, userPassword := defaultPasswordHashes()
 	return &UserInMemStorage{
 		users: map[string]*apiv1.UserModificationRequest{
 			defaultUser.String(): {
@@ -29,6 +46,7 @@ func NewUserInMemStorage() *UserInMemStorage {
 					ID:        defaultUser,
 					CreatedAt: time.Now(),
 					UpdatedAt: time.Now(),
+					Version:   1,
 
 					Username:      utils.StringPtr("root"),
 					Email:         utils.StringPtr("root@localhost"),
@@ -40,13 +58,14 @@ func NewUserInMemStorage() *UserInMemStorage {
 
 					IsAdmin: true,
 				},
-				Password: utils.StringPtr("root"),
+				Password: utils.StringPtr(rootPassword),
 			},
 			defaultRegUser.String(): {
 				User: apiv1.User{
 					ID:        defaultRegUser,
 					CreatedAt: time.Now(),
 					UpdatedAt: time.Now(),
+					Version:   1,
 
 					Username:      utils.StringPtr("user"),
 					Email:         utils.StringPtr("user@localhost"),
@@ -58,51 +77,221 @@ func NewUserInMemStorage() *UserInMemStorage {
 
 					IsAdmin: false,
 				},
-				Password: utils.StringPtr("userpassword"),
+				Password: utils.StringPtr(userPassword),
 			},
 		},
 	}
 }
 
 func (s *UserInMemStorage) Create(ctx context.Context, user *apiv1.UserModificationRequest) error {
-	for {
-		id := uuid.New()
-		if _, exists := s.users[id.String()]; exists {
-			continue
+	// hashing is slow by design, it must not block the store
+	stored := cloneUserModificationRequest(user)
+	if err := hashPassword(stored); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID == uuid.Nil {
+		for {
+			id := uuid.New()
+			if _, exists := s.users[id.String()]; exists {
+				continue
+			}
+			user.ID = id
+			break
 		}
-		user.ID = id
-		break
 	}
-	s.users[user.ID.String()] = user
+
+	if _, exists := s.users[user.ID.String()]; exists {
+		return fmt.Errorf("user with this ID %w", apiv1.ErrAlreadyExists)
+	}
+	if s.usernameTaken(user.Username, user.ID) {
+		return fmt.Errorf("user with this username %w", apiv1.ErrAlreadyExists)
+	}
+	if s.subjectTaken(user.Issuer, user.Subject, user.ID) {
+		return fmt.Errorf("user with this subject %w", apiv1.ErrAlreadyExists)
+	}
+	stored.ID = user.ID
+	user.Version = 1
+	stored.Version = 1
+	s.users[user.ID.String()] = stored
 	return nil
 }
 
-func (s *UserInMemStorage) List(ctx context.Context, page, limit int) ([]apiv1.User, error) {
-	var users []apiv1.User
+// usernameTaken reports whether another user than id has the given username
+func (s *UserInMemStorage) usernameTaken(username *string, id uuid.UUID) bool {
+	if username == nil {
+		return false
+	}
+	for _, existing := range s.users {
+		if existing.ID != id && existing.Username != nil && *existing.Username == *username {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectTaken reports whether another user than id is linked to the subject of the issuer
+func (s *UserInMemStorage) subjectTaken(issuer, subject *string, id uuid.UUID) bool {
+	if issuer == nil || subject == nil {
+		return false
+	}
+	for _, existing := range s.users {
+		if existing.ID != id && linkedTo(&existing.User, *issuer, *subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkedTo reports whether the user is linked to the subject of the issuer
+func linkedTo(user *apiv1.User, issuer, subject string) bool {
+	return user.Issuer != nil && user.Subject != nil && *user.Issuer == issuer && *user.Subject == subject
+}
+
+// hashPassword replaces the password of the stored copy of a user by its hash
+func hashPassword(user *apiv1.UserModificationRequest) error {
+	if user.Password == nil {
+		return nil
+	}
+	hash, err := password.Hash(*user.Password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.Password = &hash
+	return nil
+}
+
+// userComparators defines the fields users can be sorted by
+var userComparators = comparators[apiv1.User]{
+	"username":       func(a, b *apiv1.User) int { return compareStringPtr(a.Username, b.Username) },
+	"email":          func(a, b *apiv1.User) int { return compareStringPtr(a.Email, b.Email) },
+	"preferred_name": func(a, b *apiv1.User) int { return compareStringPtr(a.PreferredName, b.PreferredName) },
+	"given_name":     func(a, b *apiv1.User) int { return compareStringPtr(a.GivenName, b.GivenName) },
+	"family_name":    func(a, b *apiv1.User) int { return compareStringPtr(a.FamilyName, b.FamilyName) },
+	"created_at":     func(a, b *apiv1.User) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated_at":     func(a, b *apiv1.User) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+}
+
+func (s *UserInMemStorage) List(ctx context.Context, opts apiv1.ListOptions) ([]apiv1.User, int, error) {
+	s.mu.RLock()
+	users := make([]apiv1.User, 0, len(s.users))
 	for _, user := range s.users {
-		users = append(users, user.User)
+		users = append(users, *cloneUser(&user.User))
 	}
-	return users, nil
+	s.mu.RUnlock()
+
+	err := orderBy(users, opts.Sort, userComparators, func(user *apiv1.User) (time.Time, uuid.UUID) {
+		return user.CreatedAt, user.ID
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return paginate(users, opts.Page, opts.Limit), len(users), nil
 }
 
 func (s *UserInMemStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	user, exists := s.users[id.String()]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, fmt.Errorf("user %w", apiv1.ErrNotFound)
+	}
+	return cloneUser(&user.User), nil
+}
+
+func (s *UserInMemStorage) GetBySubject(ctx context.Context, issuer, subject string) (*apiv1.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if linkedTo(&user.User, issuer, subject) {
+			return cloneUser(&user.User), nil
+		}
 	}
-	return &user.User, nil
+	return nil, fmt.Errorf("user %w", apiv1.ErrNotFound)
 }
 
 func (s *UserInMemStorage) Update(ctx context.Context, user *apiv1.UserModificationRequest) error {
+	updated := cloneUserModificationRequest(user)
+	if err := hashPassword(updated); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	existingUser, exists := s.users[user.ID.String()]
 	if !exists {
-		return errors.New("user not found")
+		return fmt.Errorf("user %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("user", existingUser.Version, user.Version); err != nil {
+		return err
+	}
+	if s.usernameTaken(user.Username, user.ID) {
+		return fmt.Errorf("user with this username %w", apiv1.ErrAlreadyExists)
+	}
+	if s.subjectTaken(user.Issuer, user.Subject, user.ID) {
+		return fmt.Errorf("user with this subject %w", apiv1.ErrAlreadyExists)
+	}
+	// the password is only changed if a new one has been provided
+	if updated.Password == nil {
+		updated.Password = existingUser.Password
 	}
-	existingUser.User = user.User
+	user.Version = existingUser.Version + 1
+	updated.Version = user.Version
+	s.users[user.ID.String()] = updated
 	return nil
 }
 
-func (s *UserInMemStorage) Delete(ctx context.Context, id uuid.UUID) error {
+func (s *UserInMemStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.users[id.String()]
+	if !exists {
+		return fmt.Errorf("user %w", apiv1.ErrNotFound)
+	}
+	if err := checkVersion("user", existing.Version, version); err != nil {
+		return err
+	}
 	delete(s.users, id.String())
 	return nil
 }
+
+func (s *UserInMemStorage) ValidateCredentials(ctx context.Context, username, pw string) (*apiv1.User, error) {
+	s.mu.RLock()
+	var stored *apiv1.UserModificationRequest
+	for _, user := range s.users {
+		if user.Username != nil && *user.Username == username {
+			stored = cloneUserModificationRequest(user)
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if stored == nil || stored.Password == nil {
+		password.Fail(pw)
+		return nil, fmt.Errorf("%w: invalid username or password", apiv1.ErrUnauthorized)
+	}
+	ok, needsRehash := password.Verify(*stored.Password, pw)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid username or password", apiv1.ErrUnauthorized)
+	}
+	if needsRehash {
+		hash, err := password.Hash(pw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		s.mu.Lock()
+		// the password is left alone if it has been changed in the meantime
+		if current, exists := s.users[stored.ID.String()]; exists && current.Password != nil && *current.Password == *stored.Password {
+			current.Password = &hash
+		}
+		s.mu.Unlock()
+	}
+	return &stored.User, nil
+}
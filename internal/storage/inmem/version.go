@@ -0,0 +1,16 @@
+package inmem
+
+import (
+	"fmt"
+
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+// checkVersion compares the expected version of an update or delete with the stored one.
+// An expected version of 0 matches any stored version.
+func checkVersion(kind string, stored, expected int64) error {
+	if expected != 0 && expected != stored {
+		return fmt.Errorf("%s %w: expected version %d, current version is %d", kind, apiv1.ErrPreconditionFailed, expected, stored)
+	}
+	return nil
+}
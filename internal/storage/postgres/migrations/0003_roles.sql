@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id          UUID PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    version     BIGINT NOT NULL DEFAULT 1,
+    name        TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    permissions JSONB NOT NULL DEFAULT '[]'
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS roles JSONB NOT NULL DEFAULT '[]';
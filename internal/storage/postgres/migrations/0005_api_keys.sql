@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id         UUID PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    user_id    UUID NOT NULL,
+    name       TEXT NOT NULL,
+    prefix     TEXT NOT NULL,
+    scopes     JSONB NOT NULL DEFAULT '[]',
+    expires_at TIMESTAMPTZ,
+    key_hash   TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
@@ -0,0 +1,108 @@
+// Package postgres provides PostgreSQL backed implementations of the api/v1 store interfaces.
+// The stores are implemented by package sqlstore, this package provides the dialect and the schema.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/sqlstore"
+
+	// register the pgx driver for database/sql
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	// migrationLockID is the advisory lock key used to serialize migrations
+	// when several replicas start at the same time.
+	migrationLockID = 7318264501
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open opens a connection pool to the PostgreSQL database identified by dsn
+// and applies all pending schema migrations.
+func Open(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(30 * time.Minute)
+
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if err := Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate applies all embedded schema migrations that have not been applied yet.
+// Each migration runs in its own transaction and is recorded in the schema_migrations table.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	return sqlstore.New(db, Dialect).Migrate(ctx, migrations)
+}
+
+// Dialect adapts the queries of the stores to PostgreSQL
+var Dialect = sqlstore.Dialect{
+	Placeholder: func(n int) string {
+		return "$" + strconv.Itoa(n)
+	},
+	// LIMIT NULL is the same as omitting the LIMIT clause
+	NoLimit:       nil,
+	TimestampType: "TIMESTAMPTZ",
+	IsUniqueViolation: func(err error) bool {
+		var pgErr *pgconn.PgError
+		return errors.As(err, &pgErr) && pgErr.Code == "23505"
+	},
+	LockMigrations: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return nil, err
+		}
+		return func() {
+			if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+				slog.Error("Failed to release migration lock", "error", err)
+			}
+		}, nil
+	},
+}
+
+func NewItemPostgresStorage(db *sql.DB) *sqlstore.ItemStorage {
+	return sqlstore.NewItemStorage(sqlstore.New(db, Dialect))
+}
+
+func NewUserPostgresStorage(db *sql.DB) *sqlstore.UserStorage {
+	return sqlstore.NewUserStorage(sqlstore.New(db, Dialect))
+}
+
+func NewRolePostgresStorage(db *sql.DB) *sqlstore.RoleStorage {
+	return sqlstore.NewRoleStorage(sqlstore.New(db, Dialect))
+}
+
+func NewAPIKeyPostgresStorage(db *sql.DB) *sqlstore.APIKeyStorage {
+	return sqlstore.NewAPIKeyStorage(sqlstore.New(db, Dialect))
+}
+
+func NewCartPostgresStorage(db *sql.DB) *sqlstore.CartStorage {
+	return sqlstore.NewCartStorage(sqlstore.New(db, Dialect))
+}
+
+func NewCheckoutPostgresStorage(db *sql.DB) *sqlstore.CheckoutStorage {
+	return sqlstore.NewCheckoutStorage(sqlstore.New(db, Dialect))
+}
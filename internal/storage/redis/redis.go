@@ -0,0 +1,310 @@
+// Package redis implements stores backed by Redis or any server speaking its protocol,
+// e.g. Valkey or KeyDB. It ships a minimal RESP2 client covering the commands used by
+// the stores, so no client library is required.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxIdleConns is the number of idle connections kept for reuse
+	maxIdleConns = 8
+	// maxIdleTime is how long a connection may be idle before it is closed instead of reused,
+	// servers and proxies drop idle connections
+	maxIdleTime = 5 * time.Minute
+	// dialTimeout is how long connecting to the server may take
+	dialTimeout = 5 * time.Second
+	// defaultTimeout is how long a command may take if its context has no deadline
+	defaultTimeout = 5 * time.Second
+)
+
+// Error is an error reply sent by the server, e.g. for an unknown command.
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Client is a connection pool to a single server. It is safe for concurrent use.
+type Client struct {
+	addr     string
+	username string
+	password string
+	db       int
+	dialer   net.Dialer
+	// tlsConfig is set for rediss:// URLs
+	tlsConfig *tls.Config
+	// timeout is how long a command may take if its context has no deadline
+	timeout time.Duration
+	idle    chan *conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+	// idleSince is the time the connection has been returned to the pool
+	idleSince time.Time
+}
+
+// Open connects to the server described by rawURL and verifies the connection with a PING.
+// The URL is either redis://:password@localhost:6379/0, or rediss:// for TLS.
+func Open(ctx context.Context, rawURL string) (*Client, error) {
+	c, err := newClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Do(ctx, "PING"); err != nil {
+		return nil, fmt.Errorf("failed to ping redis: %w", err)
+	}
+	return c, nil
+}
+
+// newClient returns a client of the server described by rawURL without connecting to it
+func newClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse redis url: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("unsupported redis url scheme %q", u.Scheme)
+	}
+
+	c := &Client{
+		addr:     u.Host,
+		username: u.User.Username(),
+		dialer:   net.Dialer{Timeout: dialTimeout},
+		timeout:  defaultTimeout,
+		idle:     make(chan *conn, maxIdleConns),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.Scheme == "rediss" {
+		c.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	c.password, _ = u.User.Password()
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		c.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database %q: %w", db, err)
+		}
+	}
+	return c, nil
+}
+
+// Ping verifies that the server is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Close closes all idle connections.
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Do sends a command and returns its reply. Replies are returned as string, int64, nil
+// or []any for arrays, error replies as Error. Error replies nested in arrays are
+// returned as elements of the array.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	cn, reused, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(ctx, args)
+	if reused && isStale(err) {
+		// the server closed the idle connection, the command did not reach it
+		cn.Close()
+		if cn, err = c.dial(ctx); err != nil {
+			return nil, err
+		}
+		reply, err = cn.do(ctx, args)
+	}
+
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		// the state of the connection is unknown after network or protocol errors
+		cn.Close()
+		return nil, err
+	}
+
+	cn.idleSince = time.Now()
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+	return reply, err
+}
+
+// isStale reports whether err has been caused by a connection closed by the server
+func isStale(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// conn returns an idle connection or dials a new one, reused reports whether the connection
+// has been idle
+func (c *Client) conn(ctx context.Context) (cn *conn, reused bool, err error) {
+	for {
+		select {
+		case cn := <-c.idle:
+			if time.Since(cn.idleSince) > maxIdleTime {
+				cn.Close()
+				continue
+			}
+			return cn, true, nil
+		default:
+		}
+		cn, err := c.dial(ctx)
+		return cn, false, err
+	}
+}
+
+// dial connects to the server, authenticates and selects the database
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	var nc net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		dialer := tls.Dialer{NetDialer: &c.dialer, Config: c.tlsConfig}
+		nc, err = dialer.DialContext(ctx, "tcp", c.addr)
+	} else {
+		nc, err = c.dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := cn.do(ctx, args); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.do(ctx, []string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("failed to select database: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+func (cn *conn) do(ctx context.Context, args []string) (any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(cn.r)
+}
+
+// readReply reads a single RESP2 reply
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := readLength(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := readLength(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]any, n)
+		for i := range values {
+			values[i], err = readReply(r)
+			var replyErr Error
+			if errors.As(err, &replyErr) {
+				// keep reading, the remaining elements belong to this reply
+				values[i] = replyErr
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// readLength parses the length of a bulk string or array reply, -1 is the null reply
+func readLength(line string) (int, error) {
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < -1 {
+		return 0, fmt.Errorf("redis: invalid length in reply %q", line)
+	}
+	return n, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// timestamp formats t as unix milliseconds, the unit of PXAT and sorted set scores
+func timestamp(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
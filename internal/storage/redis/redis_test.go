@@ -0,0 +1,227 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/storagetest"
+)
+
+// openTestClient connects to the server referenced by REDIS_TEST_URL and empties its
+// database, or to an in-process stand-in if the variable is not set. To run the tests
+// against a throwaway Redis instance:
+//
+//	podman run --rm -p 6379:6379 redis:8
+//	REDIS_TEST_URL=redis://localhost:6379/15 go test ./internal/storage/redis/...
+func openTestClient(t *testing.T) *Client {
+	t.Helper()
+	url := os.Getenv("REDIS_TEST_URL")
+	if url == "" {
+		url = "redis://" + newStandin(t, "")
+	}
+
+	client, err := Open(context.Background(), url)
+	if err != nil {
+		t.Fatalf("Failed to open redis: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	if os.Getenv("REDIS_TEST_URL") != "" {
+		if _, err := client.Do(context.Background(), "FLUSHDB"); err != nil {
+			t.Fatalf("Failed to flush database: %v", err)
+		}
+	}
+	return client
+}
+
+func TestSessionRedisStorage_Conformance(t *testing.T) {
+	storagetest.TestSessionStore(t, func(t *testing.T) apiv1.SessionStore {
+		return NewSessionRedisStorage(openTestClient(t))
+	})
+}
+
+func TestOpen_Auth(t *testing.T) {
+	ctx := context.Background()
+	addr := newStandin(t, "secret")
+
+	client, err := Open(ctx, "redis://:secret@"+addr+"/1")
+	if err != nil {
+		t.Fatalf("Failed to open redis: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Do(ctx, "GET", "missing"); err != nil {
+		t.Errorf("Expected authenticated command to succeed, got %v", err)
+	}
+
+	if _, err := Open(ctx, "redis://:wrong@"+addr); err == nil {
+		t.Error("Expected Open to fail with a wrong password")
+	}
+}
+
+func TestClient_ErrorReply(t *testing.T) {
+	ctx := context.Background()
+	client := openTestClient(t)
+
+	_, err := client.Do(ctx, "NOSUCHCOMMAND")
+	var replyErr Error
+	if !errors.As(err, &replyErr) {
+		t.Fatalf("Expected error reply, got %v", err)
+	}
+	// the connection stays usable after an error reply
+	if _, err := client.Do(ctx, "GET", "missing"); err != nil {
+		t.Errorf("Expected command after error reply to succeed, got %v", err)
+	}
+}
+
+func TestOpen_TLS(t *testing.T) {
+	ctx := context.Background()
+	addr, roots := newTLSStandin(t)
+
+	client, err := newClient("rediss://" + addr)
+	if err != nil {
+		t.Fatalf("newClient failed: %v", err)
+	}
+	defer client.Close()
+	client.tlsConfig.RootCAs = roots
+	if err := client.Ping(ctx); err != nil {
+		t.Errorf("Expected the TLS connection to succeed, got %v", err)
+	}
+
+	// the certificate of the server is verified
+	if _, err := Open(ctx, "rediss://"+addr); err == nil {
+		t.Error("Expected Open to fail for an untrusted certificate")
+	}
+	if _, err := Open(ctx, "redis://"+addr); err == nil {
+		t.Error("Expected Open to fail without TLS")
+	}
+}
+
+// newClosingServer starts a server that answers a single command per connection with +PONG
+// and closes the connection, like a server dropping idle connections. It returns its address
+// and the number of accepted connections.
+func newClosingServer(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer c.Close()
+				if _, err := readCommand(bufio.NewReader(c)); err == nil {
+					io.WriteString(c, "+PONG\r\n")
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), &accepted
+}
+
+func TestClient_StaleConnection(t *testing.T) {
+	ctx := context.Background()
+	addr, accepted := newClosingServer(t)
+	client, err := Open(ctx, "redis://"+addr)
+	if err != nil {
+		t.Fatalf("Failed to open redis: %v", err)
+	}
+	defer client.Close()
+
+	// the idle connection has been closed by the server, the command is sent again on a new one
+	if err := client.Ping(ctx); err != nil {
+		t.Errorf("Expected the command to be retried on a new connection, got %v", err)
+	}
+	if got := accepted.Load(); got != 2 {
+		t.Errorf("Expected 2 connections, got %d", got)
+	}
+
+	// connections idle for too long are not reused
+	cn := <-client.idle
+	cn.idleSince = time.Now().Add(-2 * maxIdleTime)
+	client.idle <- cn
+	if err := client.Ping(ctx); err != nil {
+		t.Errorf("Expected the command to succeed on a new connection, got %v", err)
+	}
+	if got := accepted.Load(); got != 3 {
+		t.Errorf("Expected 3 connections, got %d", got)
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	// the server accepts connections but never replies
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	client, err := newClient("redis://" + l.Addr().String())
+	if err != nil {
+		t.Fatalf("newClient failed: %v", err)
+	}
+	client.timeout = 50 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() { done <- client.Ping(context.Background()) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("Expected the command to time out, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the command without deadline to time out")
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		expected any
+		wantErr  bool
+	}{
+		{name: "null bulk string", reply: "$-1\r\n", expected: nil},
+		{name: "null array", reply: "*-1\r\n", expected: nil},
+		{name: "bulk string", reply: "$2\r\nok\r\n", expected: "ok"},
+		{name: "invalid bulk string length", reply: "$-2\r\n", wantErr: true},
+		{name: "invalid array length", reply: "*-5\r\n", wantErr: true},
+		{name: "malformed length", reply: "$abc\r\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := readReply(bufio.NewReader(strings.NewReader(tt.reply)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if reply != tt.expected {
+				t.Errorf("Expected reply %v, got %v", tt.expected, reply)
+			}
+		})
+	}
+}
+
+func TestOpen_InvalidURL(t *testing.T) {
+	for _, url := range []string{"http://localhost:6379", "redis://localhost:6379/db"} {
+		if _, err := Open(context.Background(), url); err == nil {
+			t.Errorf("Expected Open(%q) to fail", url)
+		}
+	}
+}
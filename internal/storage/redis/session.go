@@ -0,0 +1,218 @@
+package redis
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+var (
+	_ apiv1.SessionStore = (*SessionRedisStorage)(nil)
+)
+
+// keyPrefix namespaces all keys written by the stores
+const keyPrefix = "demo-shop:"
+
+// SessionRedisStorage stores every session as JSON string that expires together with the
+// session. A sorted set per user indexes the IDs of the sessions by their expiry, expired
+// entries are removed from it when sessions are created, listed or revoked.
+// It requires Redis 6.2 or later.
+type SessionRedisStorage struct {
+	client *Client
+}
+
+func NewSessionRedisStorage(client *Client) *SessionRedisStorage {
+	return &SessionRedisStorage{client: client}
+}
+
+func sessionKey(id string) string {
+	return keyPrefix + "session:" + id
+}
+
+func userSessionsKey(userID uuid.UUID) string {
+	return keyPrefix + "user-sessions:" + userID.String()
+}
+
+func (s *SessionRedisStorage) Create(ctx context.Context, session *apiv1.Session) error {
+	index := userSessionsKey(session.UserID)
+	if _, err := s.client.Do(ctx, "ZREMRANGEBYSCORE", index, "-inf", timestamp(time.Now())); err != nil {
+		return err
+	}
+	// the index is written first, a session must never exist without being revocable by DeleteByUser
+	if _, err := s.client.Do(ctx, "ZADD", index, timestamp(session.ExpiresAt), session.ID); err != nil {
+		return err
+	}
+
+	reply, err := s.set(ctx, session, "NX")
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		if _, err := s.client.Do(ctx, "ZREM", index, session.ID); err != nil {
+			return err
+		}
+		return fmt.Errorf("session with this ID %w", apiv1.ErrAlreadyExists)
+	}
+	return nil
+}
+
+// set writes the session with its expiry, condition is either NX or XX
+func (s *SessionRedisStorage) set(ctx context.Context, session *apiv1.Session, condition string) (any, error) {
+	stored := *session
+	stored.Current = false
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, "SET", sessionKey(session.ID), string(data), "PXAT", timestamp(session.ExpiresAt), condition)
+}
+
+func (s *SessionRedisStorage) Get(ctx context.Context, id string) (*apiv1.Session, error) {
+	reply, err := s.client.Do(ctx, "GET", sessionKey(id))
+	if err != nil {
+		return nil, err
+	}
+	data, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("session %w", apiv1.ErrNotFound)
+	}
+
+	var session apiv1.Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	// the server expires the key, this only guards against clock skew
+	if session.Expired(time.Now()) {
+		return nil, fmt.Errorf("session %w", apiv1.ErrNotFound)
+	}
+	return &session, nil
+}
+
+func (s *SessionRedisStorage) Touch(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error {
+	session, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	session.LastSeenAt = lastSeenAt
+	session.ExpiresAt = expiresAt
+
+	if _, err := s.client.Do(ctx, "ZADD", userSessionsKey(session.UserID), timestamp(expiresAt), id); err != nil {
+		return err
+	}
+	// XX does not bring back a session that has been revoked in the meantime
+	reply, err := s.set(ctx, session, "XX")
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return fmt.Errorf("session %w", apiv1.ErrNotFound)
+	}
+	return nil
+}
+
+func (s *SessionRedisStorage) ListByUser(ctx context.Context, userID uuid.UUID) ([]apiv1.Session, error) {
+	ids, err := s.sessionIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []apiv1.Session{}
+	if len(ids) == 0 {
+		return sessions, nil
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+	reply, err := s.client.Do(ctx, append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	values, _ := reply.([]any)
+
+	now := time.Now()
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// the session expired before the index has been cleaned up
+			continue
+		}
+		var session apiv1.Session
+		if err := json.Unmarshal([]byte(data), &session); err != nil {
+			return nil, fmt.Errorf("failed to decode session %s: %w", ids[i], err)
+		}
+		if session.UserID != userID || session.Expired(now) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	slices.SortFunc(sessions, func(a, b apiv1.Session) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return sessions, nil
+}
+
+// sessionIDs removes expired entries from the index of the user and returns the remaining IDs
+func (s *SessionRedisStorage) sessionIDs(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	index := userSessionsKey(userID)
+	if _, err := s.client.Do(ctx, "ZREMRANGEBYSCORE", index, "-inf", timestamp(time.Now())); err != nil {
+		return nil, err
+	}
+	reply, err := s.client.Do(ctx, "ZRANGE", index, "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+	values, _ := reply.([]any)
+	ids := make([]string, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *SessionRedisStorage) Delete(ctx context.Context, id string) error {
+	session, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	reply, err := s.client.Do(ctx, "DEL", sessionKey(id))
+	if err != nil {
+		return err
+	}
+	if deleted, _ := reply.(int64); deleted == 0 {
+		return fmt.Errorf("session %w", apiv1.ErrNotFound)
+	}
+	_, err = s.client.Do(ctx, "ZREM", userSessionsKey(session.UserID), id)
+	return err
+}
+
+func (s *SessionRedisStorage) DeleteByUser(ctx context.Context, userID uuid.UUID) (int, error) {
+	ids, err := s.sessionIDs(ctx, userID)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+	reply, err := s.client.Do(ctx, append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	// only the revoked IDs are removed, sessions created in the meantime stay indexed
+	if _, err := s.client.Do(ctx, append([]string{"ZREM", userSessionsKey(userID)}, ids...)...); err != nil {
+		return 0, err
+	}
+	deleted, _ := reply.(int64)
+	return int(deleted), nil
+}
@@ -0,0 +1,266 @@
+package redis
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// standin is an in-process server speaking RESP2. It implements the subset of the Redis
+// commands used by the stores, so the tests run without a Redis installation.
+type standin struct {
+	mu       sync.Mutex
+	password string
+	strings  map[string]string
+	expiry   map[string]time.Time
+	zsets    map[string]map[string]float64
+}
+
+// newStandin starts a stand-in server and returns its address.
+func newStandin(t *testing.T, password string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	return serveStandin(t, l, password)
+}
+
+// newTLSStandin starts a stand-in server accepting TLS connections only and returns its
+// address and the pool of certificates it is trusted by.
+func newTLSStandin(t *testing.T) (string, *x509.CertPool) {
+	t.Helper()
+	// borrow the certificate of a TLS test server, it is valid for 127.0.0.1
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	config := server.TLS.Clone()
+	roots := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	server.Close()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	return serveStandin(t, l, ""), roots
+}
+
+// serveStandin serves a stand-in server on l and returns its address.
+func serveStandin(t *testing.T, l net.Listener, password string) string {
+	t.Cleanup(func() { l.Close() })
+
+	s := &standin{
+		password: password,
+		strings:  map[string]string{},
+		expiry:   map[string]time.Time{},
+		zsets:    map[string]map[string]float64{},
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func (s *standin) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authenticated := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authenticated = args[len(args)-1] == s.password
+			reply = "+OK\r\n"
+			if !authenticated {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		default:
+			reply = s.exec(cmd, args[1:])
+		}
+		if _, err := io.WriteString(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(line, "*"))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := readLine(r); err != nil {
+			return nil, err
+		}
+		if args[i], err = readLine(r); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+func (s *standin) exec(cmd string, args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	switch cmd {
+	case "PING", "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := s.strings[args[0]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(value)
+	case "MGET":
+		reply := fmt.Sprintf("*%d\r\n", len(args))
+		for _, key := range args {
+			value, ok := s.strings[key]
+			if !ok {
+				reply += "$-1\r\n"
+				continue
+			}
+			reply += bulk(value)
+		}
+		return reply
+	case "SET":
+		key, value := args[0], args[1]
+		_, exists := s.strings[key]
+		var at time.Time
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if exists {
+					return "$-1\r\n"
+				}
+			case "XX":
+				if !exists {
+					return "$-1\r\n"
+				}
+			case "PXAT":
+				i++
+				ms, _ := strconv.ParseInt(args[i], 10, 64)
+				at = time.UnixMilli(ms)
+			}
+		}
+		s.strings[key] = value
+		delete(s.expiry, key)
+		if !at.IsZero() {
+			s.expiry[key] = at
+		}
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args {
+			_, isString := s.strings[key]
+			_, isZSet := s.zsets[key]
+			if isString || isZSet {
+				deleted++
+			}
+			delete(s.strings, key)
+			delete(s.expiry, key)
+			delete(s.zsets, key)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "ZADD":
+		zset := s.zsets[args[0]]
+		if zset == nil {
+			zset = map[string]float64{}
+			s.zsets[args[0]] = zset
+		}
+		added := 0
+		for i := 1; i+1 < len(args); i += 2 {
+			score, _ := strconv.ParseFloat(args[i], 64)
+			if _, exists := zset[args[i+1]]; !exists {
+				added++
+			}
+			zset[args[i+1]] = score
+		}
+		return fmt.Sprintf(":%d\r\n", added)
+	case "ZREM":
+		removed := 0
+		for _, member := range args[1:] {
+			if _, exists := s.zsets[args[0]][member]; exists {
+				removed++
+			}
+			delete(s.zsets[args[0]], member)
+		}
+		s.dropEmpty(args[0])
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "ZREMRANGEBYSCORE":
+		// only the "-inf <max>" form used by the stores is supported
+		limit, _ := strconv.ParseFloat(args[2], 64)
+		removed := 0
+		for member, score := range s.zsets[args[0]] {
+			if score <= limit {
+				delete(s.zsets[args[0]], member)
+				removed++
+			}
+		}
+		s.dropEmpty(args[0])
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "ZRANGE":
+		// only the "0 -1" form used by the stores is supported
+		zset := s.zsets[args[0]]
+		members := slices.SortedFunc(maps.Keys(zset), func(a, b string) int {
+			return cmp.Or(cmp.Compare(zset[a], zset[b]), strings.Compare(a, b))
+		})
+		reply := fmt.Sprintf("*%d\r\n", len(members))
+		for _, member := range members {
+			reply += bulk(member)
+		}
+		return reply
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", cmd)
+	}
+}
+
+// expire removes the expired keys
+func (s *standin) expire() {
+	for key, at := range s.expiry {
+		if !time.Now().Before(at) {
+			delete(s.strings, key)
+			delete(s.expiry, key)
+		}
+	}
+}
+
+func (s *standin) dropEmpty(key string) {
+	if len(s.zsets[key]) == 0 {
+		delete(s.zsets, key)
+	}
+}
+
+func bulk(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
@@ -0,0 +1,21 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// cgoEnabled reports whether the driver has been built with SQLite, it requires cgo
+const cgoEnabled = true
+
+// isUniqueViolation reports whether err has been caused by a unique or primary key constraint violation.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return isUniqueViolationMessage(err)
+	}
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
@@ -0,0 +1,17 @@
+//go:build !cgo
+
+package sqlite
+
+import (
+	// registers the stub of the driver, which fails to open databases
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// cgoEnabled reports whether the driver has been built with SQLite, it requires cgo
+const cgoEnabled = false
+
+// isUniqueViolation reports whether err has been caused by a unique or primary key constraint violation.
+// The error codes of the driver are only available with cgo, the message is matched instead.
+func isUniqueViolation(err error) bool {
+	return isUniqueViolationMessage(err)
+}
@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS items (
+    id          TEXT PRIMARY KEY,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    price       REAL NOT NULL,
+    quantity    INTEGER NOT NULL DEFAULT 0,
+    location    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id             TEXT PRIMARY KEY,
+    created_at     TIMESTAMP NOT NULL,
+    updated_at     TIMESTAMP NOT NULL,
+    username       TEXT UNIQUE,
+    email          TEXT,
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    preferred_name TEXT,
+    given_name     TEXT,
+    family_name    TEXT,
+    locale         TEXT,
+    is_admin       BOOLEAN NOT NULL DEFAULT FALSE,
+    password       TEXT
+);
+
+CREATE TABLE IF NOT EXISTS carts (
+    id         TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    owner_id   TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS carts_owner_id_idx ON carts (owner_id);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+    cart_id  TEXT NOT NULL REFERENCES carts (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    item_id  TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    PRIMARY KEY (cart_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS checkouts (
+    id         TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id    TEXT NOT NULL,
+    cart_id    TEXT NOT NULL,
+    total      REAL NOT NULL DEFAULT 0,
+    status     TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,4 @@
+ALTER TABLE items ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE carts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE checkouts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id          TEXT PRIMARY KEY,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL,
+    version     INTEGER NOT NULL DEFAULT 1,
+    name        TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    permissions TEXT NOT NULL DEFAULT '[]'
+);
+
+ALTER TABLE users ADD COLUMN roles TEXT NOT NULL DEFAULT '[]';
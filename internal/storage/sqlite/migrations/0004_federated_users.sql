@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN issuer TEXT;
+ALTER TABLE users ADD COLUMN subject TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_issuer_subject_idx ON users (issuer, subject);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id         TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id    TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    prefix     TEXT NOT NULL,
+    scopes     TEXT NOT NULL DEFAULT '[]',
+    expires_at TIMESTAMP,
+    key_hash   TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
@@ -0,0 +1,93 @@
+// Package sqlite provides SQLite backed implementations of the api/v1 store interfaces.
+// It is intended for single-node deployments where running a database server is not an option.
+// The stores are implemented by package sqlstore, this package provides the dialect and the schema.
+//
+// The package relies on github.com/mattn/go-sqlite3 and therefore requires a cgo enabled build.
+// Binaries built without cgo compile, but Open fails.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/sqlstore"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open opens the SQLite database file at path, creating it if it does not exist,
+// and applies all pending schema migrations.
+func Open(ctx context.Context, path string) (*sql.DB, error) {
+	if !cgoEnabled {
+		return nil, errors.New("the sqlite backend requires a binary built with CGO_ENABLED=1")
+	}
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL", path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows a single writer only, serializing all access through one
+	// connection avoids "database is locked" errors under concurrent requests.
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database file %s: %w", path, err)
+	}
+
+	if err := Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate applies all embedded schema migrations that have not been applied yet.
+// Each migration runs in its own transaction and is recorded in the schema_migrations table.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	return sqlstore.New(db, Dialect).Migrate(ctx, migrations)
+}
+
+// Dialect adapts the queries of the stores to SQLite. Migrations are not locked, a database
+// file is only used by a single process.
+var Dialect = sqlstore.Dialect{
+	// a negative LIMIT means no upper bound in SQLite
+	NoLimit:           -1,
+	TimestampType:     "TIMESTAMP",
+	IsUniqueViolation: isUniqueViolation,
+}
+
+// isUniqueViolationMessage reports whether the message of err is the one SQLite uses for
+// unique and primary key constraint violations, e.g. "UNIQUE constraint failed: users.username"
+func isUniqueViolationMessage(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func NewItemSQLiteStorage(db *sql.DB) *sqlstore.ItemStorage {
+	return sqlstore.NewItemStorage(sqlstore.New(db, Dialect))
+}
+
+func NewUserSQLiteStorage(db *sql.DB) *sqlstore.UserStorage {
+	return sqlstore.NewUserStorage(sqlstore.New(db, Dialect))
+}
+
+func NewRoleSQLiteStorage(db *sql.DB) *sqlstore.RoleStorage {
+	return sqlstore.NewRoleStorage(sqlstore.New(db, Dialect))
+}
+
+func NewAPIKeySQLiteStorage(db *sql.DB) *sqlstore.APIKeyStorage {
+	return sqlstore.NewAPIKeyStorage(sqlstore.New(db, Dialect))
+}
+
+func NewCartSQLiteStorage(db *sql.DB) *sqlstore.CartStorage {
+	return sqlstore.NewCartStorage(sqlstore.New(db, Dialect))
+}
+
+func NewCheckoutSQLiteStorage(db *sql.DB) *sqlstore.CheckoutStorage {
+	return sqlstore.NewCheckoutStorage(sqlstore.New(db, Dialect))
+}
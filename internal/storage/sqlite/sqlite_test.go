@@ -0,0 +1,297 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/storage/storagetest"
+	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
+)
+
+// openTestDB creates a fresh database file in a temporary directory.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if !cgoEnabled {
+		t.Skip("the sqlite backend requires cgo")
+	}
+	db, err := Open(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrate_Idempotent(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Expected second migration run to succeed, got %v", err)
+	}
+}
+
+func TestItemSQLiteStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewItemSQLiteStorage(openTestDB(t))
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for i, name := range []string{"Apple", "Banana", "Orange"} {
+		item := &apiv1.Item{
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+			UpdatedAt: now,
+			Name:      name,
+			Price:     1.5,
+			Quantity:  10,
+		}
+		if err := store.Create(ctx, item); err != nil {
+			t.Fatalf("Failed to create item: %v", err)
+		}
+		if item.ID == uuid.Nil {
+			t.Fatal("Expected item ID to be set")
+		}
+	}
+
+	page, _, err := store.List(ctx, apiv1.ListOptions{Page: 2, Limit: 2})
+	if err != nil {
+		t.Fatalf("Failed to list items: %v", err)
+	}
+	if len(page) != 1 || page[0].Name != "Orange" {
+		t.Errorf("Expected second page to contain only Orange, got %+v", page)
+	}
+
+	all, total, err := store.List(ctx, apiv1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list items: %v", err)
+	}
+	if len(all) != 3 || total != 3 {
+		t.Fatalf("Expected 3 items, got %d with a total of %d", len(all), total)
+	}
+
+	item := all[0]
+	item.Price = 2.25
+	if err := store.Update(ctx, &item); err != nil {
+		t.Fatalf("Failed to update item: %v", err)
+	}
+	got, err := store.Get(ctx, item.ID)
+	if err != nil {
+		t.Fatalf("Failed to get item: %v", err)
+	}
+	if got.Price != 2.25 {
+		t.Errorf("Expected price 2.25, got %f", got.Price)
+	}
+
+	if err := store.Update(ctx, &apiv1.Item{ID: uuid.New(), Name: "Ghost"}); err == nil {
+		t.Error("Expected error when updating a non-existent item")
+	}
+
+	if err := store.Delete(ctx, item.ID, 0); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+	if _, err := store.Get(ctx, item.ID); err == nil {
+		t.Error("Expected error when getting a deleted item")
+	}
+}
+
+func TestUserSQLiteStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewUserSQLiteStorage(openTestDB(t))
+
+	user := &apiv1.UserModificationRequest{
+		User: apiv1.User{
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Username:  utils.StringPtr("jdoe"),
+			Email:     utils.StringPtr("jdoe@localhost"),
+		},
+		Password: utils.StringPtr("supersecretpassword"),
+	}
+	if err := store.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	duplicate := &apiv1.UserModificationRequest{User: apiv1.User{Username: utils.StringPtr("jdoe")}}
+	if err := store.Create(ctx, duplicate); err == nil {
+		t.Error("Expected error when creating a user with a duplicate username")
+	}
+
+	user.GivenName = utils.StringPtr("John")
+	user.Password = nil
+	if err := store.Update(ctx, user); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+
+	got, err := store.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if got.GivenName == nil || *got.GivenName != "John" {
+		t.Errorf("Expected given name John, got %v", got.GivenName)
+	}
+	if got.PreferredName != nil {
+		t.Errorf("Expected preferred name to be nil, got %v", *got.PreferredName)
+	}
+
+	users, _, err := store.List(ctx, apiv1.ListOptions{Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to list users: %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("Expected 1 user, got %d", len(users))
+	}
+}
+
+func TestUserSQLiteStorage_PasswordHashing(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	store := NewUserSQLiteStorage(db)
+
+	user := &apiv1.UserModificationRequest{
+		User:     apiv1.User{Username: utils.StringPtr("jdoe"), Email: utils.StringPtr("jdoe@localhost")},
+		Password: utils.StringPtr("supersecretpassword"),
+	}
+	if err := store.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	stored := func() string {
+		t.Helper()
+		var hash string
+		if err := db.QueryRowContext(ctx, `SELECT password FROM users WHERE id = ?`, user.ID).Scan(&hash); err != nil {
+			t.Fatalf("Failed to read password: %v", err)
+		}
+		return hash
+	}
+	if hash := stored(); !strings.HasPrefix(hash, "$2") {
+		t.Fatalf("Expected a bcrypt hash to be stored, got %q", hash)
+	}
+
+	// passwords stored before hashing was introduced are replaced by a hash on the next login
+	if _, err := db.ExecContext(ctx, `UPDATE users SET password = 'legacypassword' WHERE id = ?`, user.ID); err != nil {
+		t.Fatalf("Failed to store plaintext password: %v", err)
+	}
+	if _, err := store.ValidateCredentials(ctx, "jdoe", "legacypassword"); err != nil {
+		t.Fatalf("Expected plaintext password to be accepted, got %v", err)
+	}
+	if hash := stored(); !strings.HasPrefix(hash, "$2") {
+		t.Errorf("Expected plaintext password to be rehashed, got %q", hash)
+	}
+	got, err := store.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if got.Version != user.Version {
+		t.Errorf("Expected rehashing to keep version %d, got %d", user.Version, got.Version)
+	}
+	if _, err := store.ValidateCredentials(ctx, "jdoe", "legacypassword"); err != nil {
+		t.Errorf("Expected rehashed password to be accepted, got %v", err)
+	}
+}
+
+func TestCartSQLiteStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewCartSQLiteStorage(openTestDB(t))
+
+	cart := &apiv1.Cart{
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		OwnerID:   uuid.New(),
+		Items: []apiv1.CartItem{
+			{ItemID: uuid.New(), Quantity: 1},
+			{ItemID: uuid.New(), Quantity: 3},
+		},
+	}
+	if err := store.Create(ctx, cart); err != nil {
+		t.Fatalf("Failed to create cart: %v", err)
+	}
+
+	cart.Items = cart.Items[1:]
+	if err := store.Update(ctx, cart); err != nil {
+		t.Fatalf("Failed to update cart: %v", err)
+	}
+
+	got, err := store.Get(ctx, cart.ID)
+	if err != nil {
+		t.Fatalf("Failed to get cart: %v", err)
+	}
+	if len(got.Items) != 1 || got.Items[0].Quantity != 3 {
+		t.Errorf("Expected single cart item with quantity 3, got %+v", got.Items)
+	}
+
+	if err := store.Delete(ctx, cart.ID, 0); err != nil {
+		t.Fatalf("Failed to delete cart: %v", err)
+	}
+	if _, err := store.Get(ctx, cart.ID); err == nil {
+		t.Error("Expected error when getting a deleted cart")
+	}
+}
+
+func TestCheckoutSQLiteStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewCheckoutSQLiteStorage(openTestDB(t))
+
+	checkout := &apiv1.Checkout{
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    uuid.New(),
+		CartID:    uuid.New(),
+		Total:     12.5,
+		Status:    "pending",
+	}
+	if err := store.Create(ctx, checkout); err != nil {
+		t.Fatalf("Failed to create checkout: %v", err)
+	}
+
+	checkout.Status = "completed"
+	if err := store.Update(ctx, checkout); err != nil {
+		t.Fatalf("Failed to update checkout: %v", err)
+	}
+
+	got, err := store.Get(ctx, checkout.ID)
+	if err != nil {
+		t.Fatalf("Failed to get checkout: %v", err)
+	}
+	if got.Status != "completed" {
+		t.Errorf("Expected status completed, got %s", got.Status)
+	}
+}
+
+func TestItemSQLiteStorage_Conformance(t *testing.T) {
+	storagetest.TestItemStore(t, func(t *testing.T) apiv1.ItemStore {
+		return NewItemSQLiteStorage(openTestDB(t))
+	})
+}
+
+func TestUserSQLiteStorage_Conformance(t *testing.T) {
+	storagetest.TestUserStore(t, func(t *testing.T) apiv1.UserStore {
+		return NewUserSQLiteStorage(openTestDB(t))
+	})
+}
+
+func TestRoleSQLiteStorage_Conformance(t *testing.T) {
+	storagetest.TestRoleStore(t, func(t *testing.T) apiv1.RoleStore {
+		return NewRoleSQLiteStorage(openTestDB(t))
+	})
+}
+
+func TestCartSQLiteStorage_Conformance(t *testing.T) {
+	storagetest.TestCartStore(t, func(t *testing.T) apiv1.CartStore {
+		return NewCartSQLiteStorage(openTestDB(t))
+	})
+}
+
+func TestCheckoutSQLiteStorage_Conformance(t *testing.T) {
+	storagetest.TestCheckoutStore(t, func(t *testing.T) apiv1.CheckoutStore {
+		return NewCheckoutSQLiteStorage(openTestDB(t))
+	})
+}
+
+func TestAPIKeySQLiteStorage_Conformance(t *testing.T) {
+	storagetest.TestAPIKeyStore(t, func(t *testing.T) apiv1.APIKeyStore {
+		return NewAPIKeySQLiteStorage(openTestDB(t))
+	})
+}
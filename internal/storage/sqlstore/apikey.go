@@ -0,0 +1,100 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+var (
+	_ apiv1.APIKeyStore = (*APIKeyStorage)(nil)
+)
+
+const apiKeyColumns = `id, created_at, user_id, name, prefix, scopes, expires_at`
+
+type APIKeyStorage struct {
+	db *DB
+}
+
+func NewAPIKeyStorage(db *DB) *APIKeyStorage {
+	return &APIKeyStorage{
+		db: db,
+	}
+}
+
+func (s *APIKeyStorage) Create(ctx context.Context, key *apiv1.APIKey) error {
+	if key.Key == "" {
+		return apiv1.NewValidationError(apiv1.Violation{Field: "key", Message: "must not be empty"})
+	}
+	if key.ID == uuid.Nil {
+		key.ID = uuid.New()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (`+apiKeyColumns+`, key_hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.CreatedAt, key.UserID, key.Name, key.Prefix, stringList(key.Scopes), key.ExpiresAt, apiv1.HashAPIKey(key.Key),
+	)
+	return s.db.createError(err, "api key")
+}
+
+func (s *APIKeyStorage) ListByUser(ctx context.Context, userID uuid.UUID) ([]apiv1.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []apiv1.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *APIKeyStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.APIKey, error) {
+	return s.get(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id)
+}
+
+func (s *APIKeyStorage) GetByKey(ctx context.Context, key string) (*apiv1.APIKey, error) {
+	return s.get(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, apiv1.HashAPIKey(key))
+}
+
+func (s *APIKeyStorage) get(ctx context.Context, query string, args ...any) (*apiv1.APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("api key %w", apiv1.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *APIKeyStorage) Delete(ctx context.Context, id uuid.UUID) error {
+	err := s.db.QueryRowContext(ctx, `DELETE FROM api_keys WHERE id = ? RETURNING id`, id).Scan(new(uuid.UUID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("api key %w", apiv1.ErrNotFound)
+	}
+	return err
+}
+
+// scanAPIKey scans the apiKeyColumns
+func scanAPIKey(row rowScanner) (*apiv1.APIKey, error) {
+	var key apiv1.APIKey
+	err := row.Scan(&key.ID, &key.CreatedAt, &key.UserID, &key.Name, &key.Prefix, (*stringList)(&key.Scopes), &key.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
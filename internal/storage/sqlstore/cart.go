@@ -0,0 +1,159 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+var (
+	_ apiv1.CartStore = (*CartStorage)(nil)
+)
+
+type CartStorage struct {
+	db *DB
+}
+
+func NewCartStorage(db *DB) *CartStorage {
+	return &CartStorage{
+		db: db,
+	}
+}
+
+func (c *CartStorage) Create(ctx context.Context, cart *apiv1.Cart) error {
+	// If cart ID is not provided, generate a new one
+	if cart.ID == uuid.Nil {
+		cart.ID = uuid.New()
+	}
+
+	return c.withTx(ctx, func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO carts (id, created_at, updated_at, version, owner_id) VALUES (?, ?, ?, 1, ?)`,
+			cart.ID, cart.CreatedAt, cart.UpdatedAt, cart.OwnerID,
+		)
+		if err != nil {
+			return c.db.createError(err, "cart")
+		}
+		if err := insertCartItems(ctx, tx, cart); err != nil {
+			return err
+		}
+		cart.Version = 1
+		return nil
+	})
+}
+
+func (c *CartStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.Cart, error) {
+	cart := &apiv1.Cart{Items: []apiv1.CartItem{}}
+	err := c.db.QueryRowContext(ctx,
+		`SELECT id, created_at, updated_at, version, owner_id FROM carts WHERE id = ?`,
+		id,
+	).Scan(&cart.ID, &cart.CreatedAt, &cart.UpdatedAt, &cart.Version, &cart.OwnerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("cart %w", apiv1.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT item_id, quantity FROM cart_items WHERE cart_id = ? ORDER BY position`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item apiv1.CartItem
+		if err := rows.Scan(&item.ItemID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		cart.Items = append(cart.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+func (c *CartStorage) GetByOwner(ctx context.Context, ownerID uuid.UUID) (*apiv1.Cart, error) {
+	var id uuid.UUID
+	err := c.db.QueryRowContext(ctx,
+		`SELECT id FROM carts WHERE owner_id = ? ORDER BY created_at, id LIMIT 1`,
+		ownerID,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("cart %w", apiv1.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, id)
+}
+
+func (c *CartStorage) Update(ctx context.Context, cart *apiv1.Cart) error {
+	return c.withTx(ctx, func(tx *Tx) error {
+		var version int64
+		err := tx.QueryRowContext(ctx,
+			`UPDATE carts SET updated_at = ?, version = version + 1, owner_id = ?
+			WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+			cart.UpdatedAt, cart.OwnerID, cart.ID, cart.Version, cart.Version,
+		).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return versionError(ctx, tx, "carts", "cart", cart.ID, cart.Version)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = ?`, cart.ID); err != nil {
+			return err
+		}
+		if err := insertCartItems(ctx, tx, cart); err != nil {
+			return err
+		}
+		cart.Version = version
+		return nil
+	})
+}
+
+func (c *CartStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	// cart items are removed by the ON DELETE CASCADE constraint
+	err := c.db.QueryRowContext(ctx,
+		`DELETE FROM carts WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+		id, version, version,
+	).Scan(new(int64))
+	if errors.Is(err, sql.ErrNoRows) {
+		return versionError(ctx, c.db, "carts", "cart", id, version)
+	}
+	return err
+}
+
+func (c *CartStorage) withTx(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertCartItems(ctx context.Context, tx *Tx, cart *apiv1.Cart) error {
+	for pos, item := range cart.Items {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO cart_items (cart_id, position, item_id, quantity) VALUES (?, ?, ?, ?)`,
+			cart.ID, pos, item.ItemID, item.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
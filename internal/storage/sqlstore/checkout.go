@@ -0,0 +1,80 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+var (
+	_ apiv1.CheckoutStore = (*CheckoutStorage)(nil)
+)
+
+type CheckoutStorage struct {
+	db *DB
+}
+
+func NewCheckoutStorage(db *DB) *CheckoutStorage {
+	return &CheckoutStorage{
+		db: db,
+	}
+}
+
+func (c *CheckoutStorage) Create(ctx context.Context, checkout *apiv1.Checkout) error {
+	if checkout.ID == uuid.Nil {
+		checkout.ID = uuid.New()
+	}
+
+	_, err := c.db.ExecContext(ctx,
+		`INSERT INTO checkouts (id, created_at, updated_at, version, user_id, cart_id, total, status)
+		VALUES (?, ?, ?, 1, ?, ?, ?, ?)`,
+		checkout.ID, checkout.CreatedAt, checkout.UpdatedAt, checkout.UserID, checkout.CartID, checkout.Total, checkout.Status,
+	)
+	if err != nil {
+		return c.db.createError(err, "checkout")
+	}
+	checkout.Version = 1
+	return nil
+}
+
+func (c *CheckoutStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.Checkout, error) {
+	var checkout apiv1.Checkout
+	err := c.db.QueryRowContext(ctx,
+		`SELECT id, created_at, updated_at, version, user_id, cart_id, total, status FROM checkouts WHERE id = ?`,
+		id,
+	).Scan(&checkout.ID, &checkout.CreatedAt, &checkout.UpdatedAt, &checkout.Version, &checkout.UserID, &checkout.CartID, &checkout.Total, &checkout.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("checkout %w", apiv1.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+func (c *CheckoutStorage) Update(ctx context.Context, checkout *apiv1.Checkout) error {
+	err := c.db.QueryRowContext(ctx,
+		`UPDATE checkouts SET updated_at = ?, version = version + 1, user_id = ?, cart_id = ?, total = ?, status = ?
+		WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+		checkout.UpdatedAt, checkout.UserID, checkout.CartID, checkout.Total, checkout.Status, checkout.ID, checkout.Version, checkout.Version,
+	).Scan(&checkout.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return versionError(ctx, c.db, "checkouts", "checkout", checkout.ID, checkout.Version)
+	}
+	return err
+}
+
+func (c *CheckoutStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	err := c.db.QueryRowContext(ctx,
+		`DELETE FROM checkouts WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+		id, version, version,
+	).Scan(new(int64))
+	if errors.Is(err, sql.ErrNoRows) {
+		return versionError(ctx, c.db, "checkouts", "checkout", id, version)
+	}
+	return err
+}
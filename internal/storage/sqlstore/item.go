@@ -0,0 +1,126 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+var (
+	_ apiv1.ItemStore = (*ItemStorage)(nil)
+)
+
+type ItemStorage struct {
+	db *DB
+}
+
+func NewItemStorage(db *DB) *ItemStorage {
+	return &ItemStorage{
+		db: db,
+	}
+}
+
+func (i *ItemStorage) Create(ctx context.Context, item *apiv1.Item) error {
+	if item.ID == uuid.Nil {
+		item.ID = uuid.New()
+	}
+
+	_, err := i.db.ExecContext(ctx,
+		`INSERT INTO items (id, created_at, updated_at, version, name, description, price, quantity, location)
+		VALUES (?, ?, ?, 1, ?, ?, ?, ?, ?)`,
+		item.ID, item.CreatedAt, item.UpdatedAt, item.Name, item.Description, item.Price, item.Quantity, item.Location,
+	)
+	if err != nil {
+		return i.db.createError(err, "item")
+	}
+	item.Version = 1
+	return nil
+}
+
+// itemSortColumns maps the sortable item fields to their columns
+var itemSortColumns = map[string]string{
+	"name":        "name",
+	"description": "description",
+	"price":       "price",
+	"quantity":    "quantity",
+	"location":    "location",
+	"created_at":  "created_at",
+	"updated_at":  "updated_at",
+}
+
+func (i *ItemStorage) List(ctx context.Context, opts apiv1.ListOptions) ([]apiv1.Item, int, error) {
+	orderBy, err := orderByClause(opts.Sort, itemSortColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := i.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM items`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	lim, offset := i.db.pageOffset(opts.Page, opts.Limit)
+	rows, err := i.db.QueryContext(ctx,
+		`SELECT id, created_at, updated_at, version, name, description, price, quantity, location
+		FROM items `+orderBy+` LIMIT ? OFFSET ?`,
+		lim, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []apiv1.Item{}
+	for rows.Next() {
+		var item apiv1.Item
+		err := rows.Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt, &item.Version, &item.Name, &item.Description, &item.Price, &item.Quantity, &item.Location)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, total, rows.Err()
+}
+
+func (i *ItemStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.Item, error) {
+	var item apiv1.Item
+	err := i.db.QueryRowContext(ctx,
+		`SELECT id, created_at, updated_at, version, name, description, price, quantity, location
+		FROM items WHERE id = ?`,
+		id,
+	).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt, &item.Version, &item.Name, &item.Description, &item.Price, &item.Quantity, &item.Location)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("item %w", apiv1.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (i *ItemStorage) Update(ctx context.Context, item *apiv1.Item) error {
+	err := i.db.QueryRowContext(ctx,
+		`UPDATE items SET updated_at = ?, version = version + 1, name = ?, description = ?, price = ?, quantity = ?, location = ?
+		WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+		item.UpdatedAt, item.Name, item.Description, item.Price, item.Quantity, item.Location, item.ID, item.Version, item.Version,
+	).Scan(&item.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return versionError(ctx, i.db, "items", "item", item.ID, item.Version)
+	}
+	return err
+}
+
+func (i *ItemStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	err := i.db.QueryRowContext(ctx,
+		`DELETE FROM items WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+		id, version, version,
+	).Scan(new(int64))
+	if errors.Is(err, sql.ErrNoRows) {
+		return versionError(ctx, i.db, "items", "item", id, version)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+var (
+	_ apiv1.RoleStore = (*RoleStorage)(nil)
+)
+
+const roleColumns = `id, created_at, updated_at, version, name, description, permissions`
+
+type RoleStorage struct {
+	db *DB
+}
+
+func NewRoleStorage(db *DB) *RoleStorage {
+	return &RoleStorage{
+		db: db,
+	}
+}
+
+func (s *RoleStorage) Create(ctx context.Context, role *apiv1.Role) error {
+	if role.ID == uuid.Nil {
+		role.ID = uuid.New()
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO roles (`+roleColumns+`) VALUES (?, ?, ?, 1, ?, ?, ?)`,
+		role.ID, role.CreatedAt, role.UpdatedAt, role.Name, role.Description, stringList(role.Permissions),
+	)
+	if err != nil {
+		return s.db.createError(err, "role")
+	}
+	role.Version = 1
+	return nil
+}
+
+// roleSortColumns maps the sortable role fields to their columns
+var roleSortColumns = map[string]string{
+	"name":        "name",
+	"description": "description",
+	"created_at":  "created_at",
+	"updated_at":  "updated_at",
+}
+
+func (s *RoleStorage) List(ctx context.Context, opts apiv1.ListOptions) ([]apiv1.Role, int, error) {
+	orderBy, err := orderByClause(opts.Sort, roleSortColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM roles`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	lim, offset := s.db.pageOffset(opts.Page, opts.Limit)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+roleColumns+` FROM roles `+orderBy+` LIMIT ? OFFSET ?`,
+		lim, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	roles := []apiv1.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		roles = append(roles, *role)
+	}
+	return roles, total, rows.Err()
+}
+
+func (s *RoleStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.Role, error) {
+	role, err := scanRole(s.db.QueryRowContext(ctx, `SELECT `+roleColumns+` FROM roles WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("role %w", apiv1.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (s *RoleStorage) Update(ctx context.Context, role *apiv1.Role) error {
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE roles SET updated_at = ?, version = version + 1, name = ?, description = ?, permissions = ?
+		WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+		role.UpdatedAt, role.Name, role.Description, stringList(role.Permissions), role.ID, role.Version, role.Version,
+	).Scan(&role.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return versionError(ctx, s.db, "roles", "role", role.ID, role.Version)
+	}
+	return s.db.createError(err, "role")
+}
+
+func (s *RoleStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	err := s.db.QueryRowContext(ctx,
+		`DELETE FROM roles WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+		id, version, version,
+	).Scan(new(int64))
+	if errors.Is(err, sql.ErrNoRows) {
+		return versionError(ctx, s.db, "roles", "role", id, version)
+	}
+	return err
+}
+
+// scanRole scans the roleColumns
+func scanRole(row rowScanner) (*apiv1.Role, error) {
+	var role apiv1.Role
+	err := row.Scan(&role.ID, &role.CreatedAt, &role.UpdatedAt, &role.Version, &role.Name, &role.Description, (*stringList)(&role.Permissions))
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
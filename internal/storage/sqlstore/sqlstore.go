@@ -0,0 +1,286 @@
+// Package sqlstore provides implementations of the api/v1 store interfaces on top of database/sql.
+// The queries are shared by the SQL storage backends, a Dialect adapts them to the database.
+//
+// Queries are written with ? placeholders and use SQL understood by both PostgreSQL and SQLite,
+// e.g. RETURNING and NULLS FIRST.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+// Dialect describes the differences between the databases the stores run on
+type Dialect struct {
+	// Placeholder returns the n-th query parameter, starting at 1. The ? placeholders of the
+	// queries are kept if nil.
+	Placeholder func(n int) string
+	// NoLimit is passed as LIMIT to return all rows
+	NoLimit any
+	// TimestampType is the column type of timestamps in the schema_migrations table
+	TimestampType string
+	// IsUniqueViolation reports whether err has been caused by a unique or primary key constraint violation
+	IsUniqueViolation func(err error) bool
+	// LockMigrations serializes the migrations of replicas starting at the same time, it is held
+	// on conn until unlock is called. Migrations are not locked if nil.
+	LockMigrations func(ctx context.Context, conn *sql.Conn) (unlock func(), err error)
+}
+
+// rebind replaces the ? placeholders of query with the placeholders of the dialect
+func (d Dialect) rebind(query string) string {
+	if d.Placeholder == nil || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString(d.Placeholder(n))
+	}
+	return b.String()
+}
+
+// DB is a database connection pool speaking a dialect
+type DB struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// New returns db speaking dialect
+func New(db *sql.DB, dialect Dialect) *DB {
+	return &DB{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.db.ExecContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.db.QueryContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.db.QueryRowContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := d.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx: tx, dialect: d.dialect}, nil
+}
+
+// Tx is a transaction speaking the dialect of the DB it has been started on
+type Tx struct {
+	tx      *sql.Tx
+	dialect Dialect
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *Tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *Tx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// Migrate applies all migrations/*.sql files of migrations that have not been applied yet.
+// Each migration runs in its own transaction and is recorded in the schema_migrations table.
+func (d *DB) Migrate(ctx context.Context, migrations fs.FS) error {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if d.dialect.LockMigrations != nil {
+		unlock, err := d.dialect.LockMigrations(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer unlock()
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at `+d.dialect.TimestampType+` NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		var applied bool
+		err := conn.QueryRowContext(ctx, d.dialect.rebind("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)"), file).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", file, err)
+		}
+		if applied {
+			continue
+		}
+
+		stmt, err := fs.ReadFile(migrations, file)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %s: %w", file, err)
+		}
+		if _, err := tx.ExecContext(ctx, string(stmt)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to apply migration %s: %w", file, err)
+		}
+		if _, err := tx.ExecContext(ctx, d.dialect.rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)"), file, time.Now()); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %w", file, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %w", file, err)
+		}
+		slog.Info("Applied database migration", "version", file)
+	}
+	return nil
+}
+
+// pageOffset translates the page and limit arguments of the List methods
+// into LIMIT and OFFSET values. Pages start at 1, a limit of zero or less
+// returns all rows. Offsets that do not fit into an int are capped, no rows are returned then.
+func (d *DB) pageOffset(page, limit int) (any, int) {
+	if limit <= 0 {
+		return d.dialect.NoLimit, 0
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page-1 > math.MaxInt/limit {
+		return limit, math.MaxInt
+	}
+	return limit, (page - 1) * limit
+}
+
+// orderByClause builds the ORDER BY clause for the sort fields of a List call.
+// columns maps the sortable fields to their column names, unknown fields are rejected
+// so user input never ends up in the query. Rows are always ordered by creation time
+// and ID last, resulting in a stable list order.
+func orderByClause(fields []apiv1.SortField, columns map[string]string) (string, error) {
+	terms := make([]string, 0, len(fields)+2)
+	for _, field := range fields {
+		column, ok := columns[field.Field]
+		if !ok {
+			return "", fmt.Errorf("%w: unsupported sort field %q", apiv1.ErrValidation, field.Field)
+		}
+		// order NULL values first like the other storage backends do
+		if field.Descending {
+			column += " DESC NULLS LAST"
+		} else {
+			column += " NULLS FIRST"
+		}
+		terms = append(terms, column)
+	}
+	terms = append(terms, "created_at", "id")
+	return "ORDER BY " + strings.Join(terms, ", "), nil
+}
+
+// queryRower is implemented by *DB and *Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// versionError explains why an update or delete guarded by the expected version did not
+// affect any row, either the row does not exist or it has a different version.
+func versionError(ctx context.Context, q queryRower, table, kind string, id uuid.UUID, expected int64) error {
+	var current int64
+	err := q.QueryRowContext(ctx, `SELECT version FROM `+table+` WHERE id = ?`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s %w", kind, apiv1.ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%s %w: expected version %d, current version is %d", kind, apiv1.ErrPreconditionFailed, expected, current)
+}
+
+// createError translates unique constraint violations into apiv1.ErrAlreadyExists.
+func (d *DB) createError(err error, kind string) error {
+	if err == nil {
+		return nil
+	}
+	if d.dialect.IsUniqueViolation != nil && d.dialect.IsUniqueViolation(err) {
+		return fmt.Errorf("%s %w: %v", kind, apiv1.ErrAlreadyExists, err)
+	}
+	return err
+}
+
+// stringList stores a list of strings as JSON array in a single column
+type stringList []string
+
+// Value implements driver.Valuer.
+func (l stringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	return string(data), err
+}
+
+// Scan implements sql.Scanner.
+func (l *stringList) Scan(src any) error {
+	var data []byte
+	switch src := src.(type) {
+	case string:
+		data = []byte(src)
+	case []byte:
+		data = src
+	case nil:
+		*l = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a string list", src)
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		list = nil
+	}
+	*l = list
+	return nil
+}
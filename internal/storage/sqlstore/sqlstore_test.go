@@ -0,0 +1,60 @@
+package sqlstore
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+)
+
+func TestDialect_Rebind(t *testing.T) {
+	numbered := Dialect{Placeholder: func(n int) string { return "$" + strconv.Itoa(n) }}
+
+	tests := []struct {
+		name     string
+		dialect  Dialect
+		query    string
+		expected string
+	}{
+		{name: "numbered", dialect: numbered, query: `UPDATE items SET name = ? WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?)`, expected: `UPDATE items SET name = $1 WHERE id = $2 AND (CAST($3 AS BIGINT) = 0 OR version = $4)`},
+		{name: "without placeholders", dialect: numbered, query: `SELECT COUNT(*) FROM items`, expected: `SELECT COUNT(*) FROM items`},
+		{name: "kept", dialect: Dialect{}, query: `SELECT * FROM items WHERE id = ?`, expected: `SELECT * FROM items WHERE id = ?`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.rebind(tt.query); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDB_PageOffset(t *testing.T) {
+	db := New(nil, Dialect{NoLimit: -1})
+	if limit, offset := db.pageOffset(3, 10); limit != 10 || offset != 20 {
+		t.Errorf("Expected limit 10 and offset 20, got %v and %d", limit, offset)
+	}
+	if limit, offset := db.pageOffset(0, 0); limit != -1 || offset != 0 {
+		t.Errorf("Expected the limit of the dialect for all rows, got %v and %d", limit, offset)
+	}
+	if limit, offset := db.pageOffset(4611686018427387904, 4); limit != 4 || offset != math.MaxInt {
+		t.Errorf("Expected the offset of a huge page to be capped, got %v and %d", limit, offset)
+	}
+}
+
+func TestOrderByClause(t *testing.T) {
+	columns := map[string]string{"name": "name", "price": "price"}
+	clause, err := orderByClause([]apiv1.SortField{{Field: "name"}, {Field: "price", Descending: true}}, columns)
+	if err != nil {
+		t.Fatalf("orderByClause failed: %v", err)
+	}
+	if expected := "ORDER BY name NULLS FIRST, price DESC NULLS LAST, created_at, id"; clause != expected {
+		t.Errorf("Expected %q, got %q", expected, clause)
+	}
+	if _, err := orderByClause([]apiv1.SortField{{Field: "password"}}, columns); !errors.Is(err, apiv1.ErrValidation) {
+		t.Errorf("Expected a validation error for an unknown field, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/password"
+)
+
+var (
+	_ apiv1.UserStore = (*UserStorage)(nil)
+)
+
+const userColumns = `id, created_at, updated_at, version, username, email, email_verified,
+	preferred_name, given_name, family_name, locale, is_admin, roles, issuer, subject`
+
+type UserStorage struct {
+	db *DB
+}
+
+func NewUserStorage(db *DB) *UserStorage {
+	return &UserStorage{
+		db: db,
+	}
+}
+
+func (s *UserStorage) Create(ctx context.Context, user *apiv1.UserModificationRequest) error {
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO users (`+userColumns+`, password)
+		VALUES (?, ?, ?, 1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID, user.CreatedAt, user.UpdatedAt, user.Username, user.Email, user.EmailVerified,
+		user.PreferredName, user.GivenName, user.FamilyName, user.Locale, user.IsAdmin, stringList(user.Roles), user.Issuer, user.Subject, hash,
+	)
+	if err != nil {
+		return s.db.createError(err, "user")
+	}
+	user.Version = 1
+	return nil
+}
+
+// userSortColumns maps the sortable user fields to their columns
+var userSortColumns = map[string]string{
+	"username":       "username",
+	"email":          "email",
+	"preferred_name": "preferred_name",
+	"given_name":     "given_name",
+	"family_name":    "family_name",
+	"created_at":     "created_at",
+	"updated_at":     "updated_at",
+}
+
+func (s *UserStorage) List(ctx context.Context, opts apiv1.ListOptions) ([]apiv1.User, int, error) {
+	orderBy, err := orderByClause(opts.Sort, userSortColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	lim, offset := s.db.pageOffset(opts.Page, opts.Limit)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+userColumns+` FROM users `+orderBy+` LIMIT ? OFFSET ?`,
+		lim, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []apiv1.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+	return users, total, rows.Err()
+}
+
+func (s *UserStorage) Get(ctx context.Context, id uuid.UUID) (*apiv1.User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %w", apiv1.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserStorage) GetBySubject(ctx context.Context, issuer, subject string) (*apiv1.User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE issuer = ? AND subject = ?`, issuer, subject,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %w", apiv1.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserStorage) Update(ctx context.Context, user *apiv1.UserModificationRequest) error {
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	// the password is only changed if a new one has been provided
+	err = s.db.QueryRowContext(ctx,
+		`UPDATE users SET updated_at = ?, version = version + 1, username = ?, email = ?, email_verified = ?,
+			preferred_name = ?, given_name = ?, family_name = ?, locale = ?, is_admin = ?, roles = ?,
+			issuer = ?, subject = ?, password = COALESCE(?, password)
+		WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+		user.UpdatedAt, user.Username, user.Email, user.EmailVerified,
+		user.PreferredName, user.GivenName, user.FamilyName, user.Locale, user.IsAdmin, stringList(user.Roles), user.Issuer, user.Subject, hash,
+		user.ID, user.Version, user.Version,
+	).Scan(&user.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return versionError(ctx, s.db, "users", "user", user.ID, user.Version)
+	}
+	return err
+}
+
+func (s *UserStorage) Delete(ctx context.Context, id uuid.UUID, version int64) error {
+	err := s.db.QueryRowContext(ctx,
+		`DELETE FROM users WHERE id = ? AND (CAST(? AS BIGINT) = 0 OR version = ?) RETURNING version`,
+		id, version, version,
+	).Scan(new(int64))
+	if errors.Is(err, sql.ErrNoRows) {
+		return versionError(ctx, s.db, "users", "user", id, version)
+	}
+	return err
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser scans the userColumns, extra receives the values of additionally selected columns
+func scanUser(row rowScanner, extra ...any) (*apiv1.User, error) {
+	var user apiv1.User
+	err := row.Scan(append([]any{
+		&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.Username, &user.Email, &user.EmailVerified,
+		&user.PreferredName, &user.GivenName, &user.FamilyName, &user.Locale, &user.IsAdmin, (*stringList)(&user.Roles),
+		&user.Issuer, &user.Subject,
+	}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *UserStorage) ValidateCredentials(ctx context.Context, username, pw string) (*apiv1.User, error) {
+	var hash sql.NullString
+	user, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+`, password FROM users WHERE username = ?`, username), &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		password.Fail(pw)
+		return nil, fmt.Errorf("%w: invalid username or password", apiv1.ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, needsRehash := password.Verify(hash.String, pw)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid username or password", apiv1.ErrUnauthorized)
+	}
+	if needsRehash {
+		newHash, err := password.Hash(pw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		// the version is not incremented as the user did not change, a password changed in the meantime is kept
+		_, err = s.db.ExecContext(ctx,
+			`UPDATE users SET password = ? WHERE id = ? AND password = ?`,
+			newHash, user.ID, hash.String,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rehash password: %w", err)
+		}
+	}
+	return user, nil
+}
+
+// hashPassword returns the hash of password, or nil if no password is set
+func hashPassword(pw *string) (*string, error) {
+	if pw == nil {
+		return nil, nil
+	}
+	hash, err := password.Hash(*pw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return &hash, nil
+}
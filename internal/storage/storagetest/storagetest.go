@@ -0,0 +1,1322 @@
+// Package storagetest provides a conformance test suite for implementations of the
+// ItemStore, UserStore, RoleStore, CartStore, CheckoutStore, SessionStore and APIKeyStore interfaces
+// defined in api/v1.
+//
+// Every store implementation, including the HTTP clients in clients/v1, is expected to
+// follow the same semantics:
+//
+//   - Create assigns a new ID if the object does not have one yet.
+//   - Get, Update and Delete return an error wrapping apiv1.ErrNotFound if the object does not exist.
+//     Update never creates missing objects.
+//   - List returns objects in a stable order. Pages start at 1 and a limit of zero or less returns all objects.
+//     The total number of objects is returned regardless of the requested page.
+//   - List orders objects by the requested sort fields first and rejects unknown fields.
+//   - Create sets the version to 1 and Update increments it. Update and Delete fail with an error
+//     wrapping apiv1.ErrPreconditionFailed if a non-zero version does not match the stored one.
+//   - User stores keep the password if an update does not set one. ValidateCredentials fails
+//     with an error wrapping apiv1.ErrUnauthorized for unknown usernames and wrong passwords alike.
+//   - User stores reject a second user linked to the same subject of an OpenID Connect provider
+//     with an error wrapping apiv1.ErrAlreadyExists. GetBySubject returns an error wrapping
+//     apiv1.ErrNotFound if no user is linked to the subject.
+//   - Cart stores return the oldest cart of a user from GetByOwner, or an error wrapping
+//     apiv1.ErrNotFound if the user has none.
+//   - Role stores reject a second role with the same name with an error wrapping apiv1.ErrAlreadyExists.
+//   - Session stores treat expired sessions as if they did not exist.
+//   - API key stores keep the hash of the key only. The keys they return never hold the secret,
+//     GetByKey looks them up by the secret.
+//
+// The stores passed to the suite may already contain objects, e.g. seeded demo data.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	apiv1 "github.com/leonsteinhaeuser/demo-shop/api/v1"
+	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
+)
+
+// paginationObjects is the number of objects created by the pagination tests
+const paginationObjects = 5
+
+// TestItemStore runs the conformance suite against the ItemStore returned by newStore.
+// newStore is called once per sub test.
+func TestItemStore(t *testing.T, newStore func(t *testing.T) apiv1.ItemStore) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		item := newItem(0)
+		if err := store.Create(ctx, item); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if item.ID == uuid.Nil {
+			t.Fatal("Expected Create to assign an ID")
+		}
+
+		got, err := store.Get(ctx, item.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertItemEqual(t, item, got)
+	})
+
+	t.Run("GetNotFound", func(t *testing.T) {
+		_, err := newStore(t).Get(context.Background(), uuid.New())
+		assertNotFound(t, err)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		item := newItem(0)
+		if err := store.Create(ctx, item); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		item.Description = "An updated description"
+		item.Price = 42.5
+		item.UpdatedAt = time.Now()
+		if err := store.Update(ctx, item); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		got, err := store.Get(ctx, item.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertItemEqual(t, item, got)
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		item := newItem(0)
+		item.ID = uuid.New()
+		assertNotFound(t, newStore(t).Update(context.Background(), item))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		item := newItem(0)
+		if err := store.Create(ctx, item); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := store.Delete(ctx, item.ID, item.Version); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		_, err := store.Get(ctx, item.ID)
+		assertNotFound(t, err)
+	})
+
+	t.Run("DeleteNotFound", func(t *testing.T) {
+		assertNotFound(t, newStore(t).Delete(context.Background(), uuid.New(), 0))
+	})
+
+	t.Run("Versioning", func(t *testing.T) {
+		testVersioning(t, newStore(t), newItem(0), func(item *apiv1.Item) uuid.UUID { return item.ID })
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		for i := range paginationObjects {
+			if err := store.Create(ctx, newItem(i)); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+		}
+		assertPagination(t, func(opts apiv1.ListOptions) ([]uuid.UUID, int, error) {
+			items, total, err := store.List(ctx, opts)
+			ids := make([]uuid.UUID, 0, len(items))
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			return ids, total, err
+		})
+	})
+
+	t.Run("Sort", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		for i := range paginationObjects {
+			if err := store.Create(ctx, newItem(i)); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+		}
+		items, _, err := store.List(ctx, apiv1.ListOptions{Sort: []apiv1.SortField{{Field: "price", Descending: true}}})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for i := 1; i < len(items); i++ {
+			if items[i-1].Price < items[i].Price {
+				t.Fatalf("Expected items to be sorted by descending price, got %f before %f", items[i-1].Price, items[i].Price)
+			}
+		}
+		assertPagination(t, func(opts apiv1.ListOptions) ([]uuid.UUID, int, error) {
+			opts.Sort = []apiv1.SortField{{Field: "location"}}
+			items, total, err := store.List(ctx, opts)
+			ids := make([]uuid.UUID, 0, len(items))
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			return ids, total, err
+		})
+
+		_, _, err = store.List(ctx, apiv1.ListOptions{Sort: []apiv1.SortField{{Field: "unknown"}}})
+		if !errors.Is(err, apiv1.ErrValidation) {
+			t.Errorf("Expected List to reject an unknown sort field with %v, got %v", apiv1.ErrValidation, err)
+		}
+	})
+}
+
+// TestUserStore runs the conformance suite against the UserStore returned by newStore.
+// newStore is called once per sub test.
+func TestUserStore(t *testing.T, newStore func(t *testing.T) apiv1.UserStore) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		user := newUser(0)
+		if err := store.Create(ctx, user); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if user.ID == uuid.Nil {
+			t.Fatal("Expected Create to assign an ID")
+		}
+
+		got, err := store.Get(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertUserEqual(t, &user.User, got)
+	})
+
+	t.Run("GetNotFound", func(t *testing.T) {
+		_, err := newStore(t).Get(context.Background(), uuid.New())
+		assertNotFound(t, err)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		user := newUser(0)
+		if err := store.Create(ctx, user); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		user.GivenName = utils.StringPtr("Updated")
+		user.EmailVerified = true
+		user.Password = nil
+		user.UpdatedAt = time.Now()
+		if err := store.Update(ctx, user); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		got, err := store.Get(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertUserEqual(t, &user.User, got)
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		user := newUser(0)
+		user.ID = uuid.New()
+		assertNotFound(t, newStore(t).Update(context.Background(), user))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		user := newUser(0)
+		if err := store.Create(ctx, user); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := store.Delete(ctx, user.ID, user.Version); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		_, err := store.Get(ctx, user.ID)
+		assertNotFound(t, err)
+	})
+
+	t.Run("DeleteNotFound", func(t *testing.T) {
+		assertNotFound(t, newStore(t).Delete(context.Background(), uuid.New(), 0))
+	})
+
+	t.Run("Versioning", func(t *testing.T) {
+		testVersioning(t, newStore(t), newUser(0), func(user *apiv1.UserModificationRequest) uuid.UUID { return user.ID })
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		for i := range paginationObjects {
+			if err := store.Create(ctx, newUser(i)); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+		}
+		assertPagination(t, func(opts apiv1.ListOptions) ([]uuid.UUID, int, error) {
+			users, total, err := store.List(ctx, opts)
+			ids := make([]uuid.UUID, 0, len(users))
+			for _, user := range users {
+				ids = append(ids, user.ID)
+			}
+			return ids, total, err
+		})
+	})
+
+	t.Run("Sort", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		for i := range paginationObjects {
+			if err := store.Create(ctx, newUser(i)); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+		}
+		users, _, err := store.List(ctx, apiv1.ListOptions{Sort: []apiv1.SortField{{Field: "username"}}})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for i := 1; i < len(users); i++ {
+			if users[i-1].Username != nil && users[i].Username != nil && *users[i-1].Username > *users[i].Username {
+				t.Fatalf("Expected users to be sorted by username, got %q before %q", *users[i-1].Username, *users[i].Username)
+			}
+		}
+
+		_, _, err = store.List(ctx, apiv1.ListOptions{Sort: []apiv1.SortField{{Field: "password"}}})
+		if !errors.Is(err, apiv1.ErrValidation) {
+			t.Errorf("Expected List to reject an unknown sort field with %v, got %v", apiv1.ErrValidation, err)
+		}
+	})
+
+	t.Run("ValidateCredentials", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		user := newUser(0)
+		username, password := *user.Username, *user.Password
+		if err := store.Create(ctx, user); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		got, err := store.ValidateCredentials(ctx, username, password)
+		if err != nil {
+			t.Fatalf("ValidateCredentials failed: %v", err)
+		}
+		assertUserEqual(t, &user.User, got)
+
+		_, err = store.ValidateCredentials(ctx, username, "wrong-password")
+		assertUnauthorized(t, err)
+		_, err = store.ValidateCredentials(ctx, "unknown-"+username, password)
+		assertUnauthorized(t, err)
+	})
+
+	t.Run("FederatedUser", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		user := newUser(0)
+		user.Issuer = utils.StringPtr("https://idp.example.com")
+		user.Subject = utils.StringPtr(uuid.NewString())
+		if err := store.Create(ctx, user); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		got, err := store.GetBySubject(ctx, *user.Issuer, *user.Subject)
+		if err != nil {
+			t.Fatalf("GetBySubject failed: %v", err)
+		}
+		assertUserEqual(t, &user.User, got)
+
+		_, err = store.GetBySubject(ctx, "https://other.example.com", *user.Subject)
+		assertNotFound(t, err)
+		_, err = store.GetBySubject(ctx, *user.Issuer, uuid.NewString())
+		assertNotFound(t, err)
+
+		duplicate := newUser(1)
+		duplicate.Issuer, duplicate.Subject = user.Issuer, user.Subject
+		if err := store.Create(ctx, duplicate); !errors.Is(err, apiv1.ErrAlreadyExists) {
+			t.Errorf("Expected a second user linked to the same subject to fail with %v, got %v", apiv1.ErrAlreadyExists, err)
+		}
+	})
+
+	t.Run("UpdatePassword", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		user := newUser(0)
+		username, oldPassword := *user.Username, *user.Password
+		if err := store.Create(ctx, user); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		// the password is kept if the update does not set one
+		user.Password = nil
+		user.UpdatedAt = time.Now()
+		if err := store.Update(ctx, user); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if _, err := store.ValidateCredentials(ctx, username, oldPassword); err != nil {
+			t.Fatalf("Expected the password to be kept, got %v", err)
+		}
+
+		user.Password = utils.StringPtr("changed-conformance-password")
+		if err := store.Update(ctx, user); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		_, err := store.ValidateCredentials(ctx, username, oldPassword)
+		assertUnauthorized(t, err)
+		if _, err := store.ValidateCredentials(ctx, username, "changed-conformance-password"); err != nil {
+			t.Errorf("Expected the new password to be valid, got %v", err)
+		}
+	})
+}
+
+// TestRoleStore runs the conformance suite against the RoleStore returned by newStore.
+// newStore is called once per sub test.
+func TestRoleStore(t *testing.T, newStore func(t *testing.T) apiv1.RoleStore) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		role := newRole(0)
+		if err := store.Create(ctx, role); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if role.ID == uuid.Nil {
+			t.Fatal("Expected Create to assign an ID")
+		}
+
+		got, err := store.Get(ctx, role.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertRoleEqual(t, role, got)
+	})
+
+	t.Run("GetNotFound", func(t *testing.T) {
+		_, err := newStore(t).Get(context.Background(), uuid.New())
+		assertNotFound(t, err)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		role := newRole(0)
+		if err := store.Create(ctx, role); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		role.Description = "An updated description"
+		role.Permissions = []string{apiv1.PermissionItemsWrite}
+		role.UpdatedAt = time.Now()
+		if err := store.Update(ctx, role); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		got, err := store.Get(ctx, role.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertRoleEqual(t, role, got)
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		role := newRole(0)
+		role.ID = uuid.New()
+		assertNotFound(t, newStore(t).Update(context.Background(), role))
+	})
+
+	t.Run("DuplicateName", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		role := newRole(0)
+		if err := store.Create(ctx, role); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		duplicate := newRole(1)
+		duplicate.Name = role.Name
+		if err := store.Create(ctx, duplicate); !errors.Is(err, apiv1.ErrAlreadyExists) {
+			t.Fatalf("Expected Create with a taken name to fail with %v, got %v", apiv1.ErrAlreadyExists, err)
+		}
+
+		other := newRole(2)
+		if err := store.Create(ctx, other); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		other.Name = role.Name
+		if err := store.Update(ctx, other); !errors.Is(err, apiv1.ErrAlreadyExists) {
+			t.Errorf("Expected Update to a taken name to fail with %v, got %v", apiv1.ErrAlreadyExists, err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		role := newRole(0)
+		if err := store.Create(ctx, role); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := store.Delete(ctx, role.ID, role.Version); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		_, err := store.Get(ctx, role.ID)
+		assertNotFound(t, err)
+	})
+
+	t.Run("DeleteNotFound", func(t *testing.T) {
+		assertNotFound(t, newStore(t).Delete(context.Background(), uuid.New(), 0))
+	})
+
+	t.Run("Versioning", func(t *testing.T) {
+		testVersioning(t, newStore(t), newRole(0), func(role *apiv1.Role) uuid.UUID { return role.ID })
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		for i := range paginationObjects {
+			if err := store.Create(ctx, newRole(i)); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+		}
+		assertPagination(t, func(opts apiv1.ListOptions) ([]uuid.UUID, int, error) {
+			roles, total, err := store.List(ctx, opts)
+			ids := make([]uuid.UUID, 0, len(roles))
+			for _, role := range roles {
+				ids = append(ids, role.ID)
+			}
+			return ids, total, err
+		})
+	})
+
+	t.Run("Sort", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		for i := range paginationObjects {
+			if err := store.Create(ctx, newRole(i)); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+		}
+		roles, _, err := store.List(ctx, apiv1.ListOptions{Sort: []apiv1.SortField{{Field: "name", Descending: true}}})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for i := 1; i < len(roles); i++ {
+			if roles[i-1].Name < roles[i].Name {
+				t.Fatalf("Expected roles to be sorted by descending name, got %q before %q", roles[i-1].Name, roles[i].Name)
+			}
+		}
+
+		_, _, err = store.List(ctx, apiv1.ListOptions{Sort: []apiv1.SortField{{Field: "unknown"}}})
+		if !errors.Is(err, apiv1.ErrValidation) {
+			t.Errorf("Expected List to reject an unknown sort field with %v, got %v", apiv1.ErrValidation, err)
+		}
+	})
+}
+
+// TestCartStore runs the conformance suite against the CartStore returned by newStore.
+// newStore is called once per sub test.
+func TestCartStore(t *testing.T, newStore func(t *testing.T) apiv1.CartStore) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		cart := newCart()
+		if err := store.Create(ctx, cart); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if cart.ID == uuid.Nil {
+			t.Fatal("Expected Create to assign an ID")
+		}
+
+		got, err := store.Get(ctx, cart.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertCartEqual(t, cart, got)
+	})
+
+	t.Run("GetNotFound", func(t *testing.T) {
+		_, err := newStore(t).Get(context.Background(), uuid.New())
+		assertNotFound(t, err)
+	})
+
+	t.Run("GetByOwner", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		cart := newCart()
+		if err := store.Create(ctx, cart); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		newer := newCart()
+		newer.OwnerID = cart.OwnerID
+		newer.CreatedAt = cart.CreatedAt.Add(time.Minute)
+		if err := store.Create(ctx, newer); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		got, err := store.GetByOwner(ctx, cart.OwnerID)
+		if err != nil {
+			t.Fatalf("GetByOwner failed: %v", err)
+		}
+		assertCartEqual(t, cart, got)
+
+		_, err = store.GetByOwner(ctx, uuid.New())
+		assertNotFound(t, err)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		cart := newCart()
+		if err := store.Create(ctx, cart); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		cart.Items = append(cart.Items[1:], apiv1.CartItem{ItemID: uuid.New(), Quantity: 7})
+		cart.UpdatedAt = time.Now()
+		if err := store.Update(ctx, cart); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		got, err := store.Get(ctx, cart.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertCartEqual(t, cart, got)
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		cart := newCart()
+		cart.ID = uuid.New()
+		assertNotFound(t, newStore(t).Update(context.Background(), cart))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		cart := newCart()
+		if err := store.Create(ctx, cart); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := store.Delete(ctx, cart.ID, cart.Version); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		_, err := store.Get(ctx, cart.ID)
+		assertNotFound(t, err)
+	})
+
+	t.Run("DeleteNotFound", func(t *testing.T) {
+		assertNotFound(t, newStore(t).Delete(context.Background(), uuid.New(), 0))
+	})
+
+	t.Run("Versioning", func(t *testing.T) {
+		testVersioning(t, newStore(t), newCart(), func(cart *apiv1.Cart) uuid.UUID { return cart.ID })
+	})
+}
+
+// TestCheckoutStore runs the conformance suite against the CheckoutStore returned by newStore.
+// newStore is called once per sub test.
+func TestCheckoutStore(t *testing.T, newStore func(t *testing.T) apiv1.CheckoutStore) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		checkout := newCheckout()
+		if err := store.Create(ctx, checkout); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if checkout.ID == uuid.Nil {
+			t.Fatal("Expected Create to assign an ID")
+		}
+
+		got, err := store.Get(ctx, checkout.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertCheckoutEqual(t, checkout, got)
+	})
+
+	t.Run("GetNotFound", func(t *testing.T) {
+		_, err := newStore(t).Get(context.Background(), uuid.New())
+		assertNotFound(t, err)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		checkout := newCheckout()
+		if err := store.Create(ctx, checkout); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		checkout.Status = "completed"
+		checkout.UpdatedAt = time.Now()
+		if err := store.Update(ctx, checkout); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		got, err := store.Get(ctx, checkout.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertCheckoutEqual(t, checkout, got)
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		checkout := newCheckout()
+		checkout.ID = uuid.New()
+		assertNotFound(t, newStore(t).Update(context.Background(), checkout))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		checkout := newCheckout()
+		if err := store.Create(ctx, checkout); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := store.Delete(ctx, checkout.ID, checkout.Version); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		_, err := store.Get(ctx, checkout.ID)
+		assertNotFound(t, err)
+	})
+
+	t.Run("DeleteNotFound", func(t *testing.T) {
+		assertNotFound(t, newStore(t).Delete(context.Background(), uuid.New(), 0))
+	})
+
+	t.Run("Versioning", func(t *testing.T) {
+		testVersioning(t, newStore(t), newCheckout(), func(checkout *apiv1.Checkout) uuid.UUID { return checkout.ID })
+	})
+}
+
+// TestSessionStore runs the conformance suite against the SessionStore returned by newStore.
+// newStore is called once per sub test.
+func TestSessionStore(t *testing.T, newStore func(t *testing.T) apiv1.SessionStore) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		session := newSession(uuid.New())
+		if err := store.Create(ctx, session); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		got, err := store.Get(ctx, session.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertSessionEqual(t, session, got)
+
+		err = store.Create(ctx, session)
+		if !errors.Is(err, apiv1.ErrAlreadyExists) {
+			t.Errorf("Expected error wrapping %v, got %v", apiv1.ErrAlreadyExists, err)
+		}
+	})
+
+	t.Run("GetNotFound", func(t *testing.T) {
+		_, err := newStore(t).Get(context.Background(), apiv1.NewSessionID())
+		assertNotFound(t, err)
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		session := newSession(uuid.New())
+		if err := store.Create(ctx, session); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		session.LastSeenAt = session.LastSeenAt.Add(time.Minute)
+		session.ExpiresAt = session.ExpiresAt.Add(time.Hour)
+		if err := store.Touch(ctx, session.ID, session.LastSeenAt, session.ExpiresAt); err != nil {
+			t.Fatalf("Touch failed: %v", err)
+		}
+		got, err := store.Get(ctx, session.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertSessionEqual(t, session, got)
+
+		assertNotFound(t, store.Touch(ctx, apiv1.NewSessionID(), time.Now(), time.Now().Add(time.Hour)))
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		session := newSession(uuid.New())
+		if err := store.Create(ctx, session); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := store.Touch(ctx, session.ID, time.Now(), time.Now().Add(50*time.Millisecond)); err != nil {
+			t.Fatalf("Touch failed: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		_, err := store.Get(ctx, session.ID)
+		assertNotFound(t, err)
+		sessions, err := store.ListByUser(ctx, session.UserID)
+		if err != nil {
+			t.Fatalf("ListByUser failed: %v", err)
+		}
+		if len(sessions) != 0 {
+			t.Errorf("Expected expired session not to be listed, got %d sessions", len(sessions))
+		}
+		assertNotFound(t, store.Delete(ctx, session.ID))
+	})
+
+	t.Run("ListByUser", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		userID := uuid.New()
+		var want []*apiv1.Session
+		for i := range 3 {
+			session := newSession(userID)
+			session.CreatedAt = session.CreatedAt.Add(time.Duration(i) * time.Second)
+			if err := store.Create(ctx, session); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			want = append(want, session)
+		}
+		if err := store.Create(ctx, newSession(uuid.New())); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		got, err := store.ListByUser(ctx, userID)
+		if err != nil {
+			t.Fatalf("ListByUser failed: %v", err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d sessions, got %d", len(want), len(got))
+		}
+		for i := range want {
+			assertSessionEqual(t, want[i], &got[i])
+		}
+
+		none, err := store.ListByUser(ctx, uuid.New())
+		if err != nil {
+			t.Fatalf("ListByUser failed: %v", err)
+		}
+		if none == nil || len(none) != 0 {
+			t.Errorf("Expected empty list for a user without sessions, got %v", none)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		session := newSession(uuid.New())
+		if err := store.Create(ctx, session); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := store.Delete(ctx, session.ID); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		_, err := store.Get(ctx, session.ID)
+		assertNotFound(t, err)
+		assertNotFound(t, store.Delete(ctx, session.ID))
+
+		sessions, err := store.ListByUser(ctx, session.UserID)
+		if err != nil {
+			t.Fatalf("ListByUser failed: %v", err)
+		}
+		if len(sessions) != 0 {
+			t.Errorf("Expected deleted session not to be listed, got %d sessions", len(sessions))
+		}
+	})
+
+	t.Run("DeleteByUser", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		userID := uuid.New()
+		for range 2 {
+			if err := store.Create(ctx, newSession(userID)); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+		}
+		other := newSession(uuid.New())
+		if err := store.Create(ctx, other); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		revoked, err := store.DeleteByUser(ctx, userID)
+		if err != nil {
+			t.Fatalf("DeleteByUser failed: %v", err)
+		}
+		if revoked != 2 {
+			t.Errorf("Expected 2 revoked sessions, got %d", revoked)
+		}
+		sessions, err := store.ListByUser(ctx, userID)
+		if err != nil {
+			t.Fatalf("ListByUser failed: %v", err)
+		}
+		if len(sessions) != 0 {
+			t.Errorf("Expected no sessions after DeleteByUser, got %d", len(sessions))
+		}
+		if _, err := store.Get(ctx, other.ID); err != nil {
+			t.Errorf("Expected sessions of other users to be kept, got %v", err)
+		}
+
+		revoked, err = store.DeleteByUser(ctx, userID)
+		if err != nil || revoked != 0 {
+			t.Errorf("Expected no revoked sessions, got %d and %v", revoked, err)
+		}
+	})
+}
+
+// TestAPIKeyStore runs the conformance suite against the APIKeyStore returned by newStore.
+// newStore is called once per sub test.
+func TestAPIKeyStore(t *testing.T, newStore func(t *testing.T) apiv1.APIKeyStore) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		key := newAPIKey(uuid.New())
+		secret := key.Key
+		if err := store.Create(ctx, key); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if key.ID == uuid.Nil {
+			t.Fatal("Expected Create to assign an ID")
+		}
+
+		got, err := store.Get(ctx, key.ID)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		assertAPIKeyEqual(t, key, got)
+		if got.Key != "" {
+			t.Errorf("Expected the secret not to be returned, got %q", got.Key)
+		}
+
+		got, err = store.GetByKey(ctx, secret)
+		if err != nil {
+			t.Fatalf("GetByKey failed: %v", err)
+		}
+		assertAPIKeyEqual(t, key, got)
+
+		err = store.Create(ctx, key)
+		if !errors.Is(err, apiv1.ErrAlreadyExists) {
+			t.Errorf("Expected error wrapping %v, got %v", apiv1.ErrAlreadyExists, err)
+		}
+	})
+
+	t.Run("GetNotFound", func(t *testing.T) {
+		store := newStore(t)
+		_, err := store.Get(context.Background(), uuid.New())
+		assertNotFound(t, err)
+		_, err = store.GetByKey(context.Background(), apiv1.NewAPIKey())
+		assertNotFound(t, err)
+	})
+
+	t.Run("ListByUser", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		userID := uuid.New()
+		var want []*apiv1.APIKey
+		for i := range 3 {
+			key := newAPIKey(userID)
+			key.CreatedAt = key.CreatedAt.Add(time.Duration(i) * time.Second)
+			if err := store.Create(ctx, key); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			want = append(want, key)
+		}
+		if err := store.Create(ctx, newAPIKey(uuid.New())); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		got, err := store.ListByUser(ctx, userID)
+		if err != nil {
+			t.Fatalf("ListByUser failed: %v", err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d keys, got %d", len(want), len(got))
+		}
+		for i := range want {
+			assertAPIKeyEqual(t, want[i], &got[i])
+			if got[i].Key != "" {
+				t.Errorf("Expected the secret not to be listed, got %q", got[i].Key)
+			}
+		}
+
+		none, err := store.ListByUser(ctx, uuid.New())
+		if err != nil {
+			t.Fatalf("ListByUser failed: %v", err)
+		}
+		if none == nil || len(none) != 0 {
+			t.Errorf("Expected empty list for a user without keys, got %v", none)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		store := newStore(t)
+
+		key := newAPIKey(uuid.New())
+		secret := key.Key
+		if err := store.Create(ctx, key); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := store.Delete(ctx, key.ID); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		_, err := store.Get(ctx, key.ID)
+		assertNotFound(t, err)
+		_, err = store.GetByKey(ctx, secret)
+		assertNotFound(t, err)
+		assertNotFound(t, store.Delete(ctx, key.ID))
+	})
+}
+
+// versionedStore is the part of the store interfaces covered by testVersioning
+type versionedStore[T any] interface {
+	Create(ctx context.Context, obj T) error
+	Update(ctx context.Context, obj T) error
+	Delete(ctx context.Context, id uuid.UUID, version int64) error
+}
+
+// versionedObject is implemented by pointers to the api/v1 resources
+type versionedObject interface {
+	ResourceVersion() int64
+	SetResourceVersion(version int64)
+}
+
+// testVersioning checks the optimistic concurrency control of Update and Delete.
+func testVersioning[T versionedObject](t *testing.T, store versionedStore[T], obj T, id func(T) uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := store.Create(ctx, obj); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if obj.ResourceVersion() != 1 {
+		t.Fatalf("Expected Create to set version 1, got %d", obj.ResourceVersion())
+	}
+
+	if err := store.Update(ctx, obj); err != nil {
+		t.Fatalf("Update with current version failed: %v", err)
+	}
+	if obj.ResourceVersion() != 2 {
+		t.Fatalf("Expected Update to increment the version to 2, got %d", obj.ResourceVersion())
+	}
+
+	obj.SetResourceVersion(1)
+	if err := store.Update(ctx, obj); !errors.Is(err, apiv1.ErrPreconditionFailed) {
+		t.Fatalf("Expected Update with stale version to fail with %v, got %v", apiv1.ErrPreconditionFailed, err)
+	}
+
+	obj.SetResourceVersion(0)
+	if err := store.Update(ctx, obj); err != nil {
+		t.Fatalf("Unconditional Update failed: %v", err)
+	}
+	if obj.ResourceVersion() != 3 {
+		t.Fatalf("Expected unconditional Update to increment the version to 3, got %d", obj.ResourceVersion())
+	}
+
+	if err := store.Delete(ctx, id(obj), 2); !errors.Is(err, apiv1.ErrPreconditionFailed) {
+		t.Fatalf("Expected Delete with stale version to fail with %v, got %v", apiv1.ErrPreconditionFailed, err)
+	}
+	if err := store.Delete(ctx, id(obj), 3); err != nil {
+		t.Fatalf("Delete with current version failed: %v", err)
+	}
+}
+
+func newItem(i int) *apiv1.Item {
+	now := time.Now()
+	return &apiv1.Item{
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Name:        fmt.Sprintf("Conformance Item %d", i),
+		Description: "An item created by the storage conformance suite",
+		Price:       1.25 + float64(i),
+		Quantity:    10 + i,
+		Location:    "Aisle 42",
+	}
+}
+
+func newUser(i int) *apiv1.UserModificationRequest {
+	now := time.Now()
+	// usernames have to be unique, the suite may run against a store that already contains users
+	suffix := uuid.NewString()[:8]
+	return &apiv1.UserModificationRequest{
+		User: apiv1.User{
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			Username:   utils.StringPtr(fmt.Sprintf("conformance-%d-%s", i, suffix)),
+			Email:      utils.StringPtr(fmt.Sprintf("conformance-%d-%s@localhost", i, suffix)),
+			GivenName:  utils.StringPtr("Conformance"),
+			FamilyName: utils.StringPtr("Test"),
+			Locale:     utils.StringPtr("en/US"),
+			// the role is seeded by the in-memory role store the HTTP clients are tested against
+			Roles: []string{"support"},
+		},
+		Password: utils.StringPtr("conformance-password"),
+	}
+}
+
+func newRole(i int) *apiv1.Role {
+	now := time.Now()
+	// role names have to be unique, the suite may run against a store that already contains roles
+	return &apiv1.Role{
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Name:        fmt.Sprintf("conformance-%d-%s", i, uuid.NewString()[:8]),
+		Description: "A role created by the storage conformance suite",
+		Permissions: []string{apiv1.PermissionCartsRead, apiv1.PermissionCheckoutsRead},
+	}
+}
+
+func newCart() *apiv1.Cart {
+	now := time.Now()
+	return &apiv1.Cart{
+		CreatedAt: now,
+		UpdatedAt: now,
+		OwnerID:   uuid.New(),
+		Items: []apiv1.CartItem{
+			{ItemID: uuid.New(), Quantity: 1},
+			{ItemID: uuid.New(), Quantity: 3},
+		},
+	}
+}
+
+func newCheckout() *apiv1.Checkout {
+	now := time.Now()
+	return &apiv1.Checkout{
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    uuid.New(),
+		CartID:    uuid.New(),
+		Total:     19.99,
+		Status:    "pending",
+	}
+}
+
+func newSession(userID uuid.UUID) *apiv1.Session {
+	now := time.Now()
+	return &apiv1.Session{
+		ID:         apiv1.NewSessionID(),
+		UserID:     userID,
+		CartID:     uuid.New(),
+		Username:   "session-user",
+		UserAgent:  "storagetest",
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(time.Hour),
+	}
+}
+
+func newAPIKey(userID uuid.UUID) *apiv1.APIKey {
+	now := time.Now()
+	key := apiv1.NewAPIKey()
+	expiresAt := now.Add(time.Hour)
+	return &apiv1.APIKey{
+		CreatedAt: now,
+		UserID:    userID,
+		Name:      "storagetest",
+		Prefix:    key[:8],
+		Scopes:    []string{apiv1.PermissionItemsWrite, apiv1.PermissionUsersRead},
+		ExpiresAt: &expiresAt,
+		Key:       key,
+	}
+}
+
+func assertNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, apiv1.ErrNotFound) {
+		t.Errorf("Expected error wrapping %v, got %v", apiv1.ErrNotFound, err)
+	}
+}
+
+func assertUnauthorized(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, apiv1.ErrUnauthorized) {
+		t.Errorf("Expected error wrapping %v, got %v", apiv1.ErrUnauthorized, err)
+	}
+}
+
+// assertPagination walks all pages of a list and compares them with the unpaginated list.
+func assertPagination(t *testing.T, list func(opts apiv1.ListOptions) ([]uuid.UUID, int, error)) {
+	t.Helper()
+
+	all, total, err := list(apiv1.ListOptions{})
+	if err != nil {
+		t.Fatalf("List without limit failed: %v", err)
+	}
+	if len(all) < paginationObjects {
+		t.Fatalf("Expected at least %d objects, got %d", paginationObjects, len(all))
+	}
+	if total != len(all) {
+		t.Fatalf("Expected total of %d, got %d", len(all), total)
+	}
+
+	again, _, err := list(apiv1.ListOptions{})
+	if err != nil {
+		t.Fatalf("List without limit failed: %v", err)
+	}
+	assertIDsEqual(t, "repeated list", all, again)
+
+	const limit = 2
+	var paged []uuid.UUID
+	for page := 1; ; page++ {
+		ids, pageTotal, err := list(apiv1.ListOptions{Page: page, Limit: limit})
+		if err != nil {
+			t.Fatalf("List of page %d failed: %v", page, err)
+		}
+		if len(ids) > limit {
+			t.Fatalf("Expected at most %d objects on page %d, got %d", limit, page, len(ids))
+		}
+		if pageTotal != total {
+			t.Fatalf("Expected total of %d on page %d, got %d", total, page, pageTotal)
+		}
+		paged = append(paged, ids...)
+		if len(ids) < limit {
+			break
+		}
+	}
+	assertIDsEqual(t, "concatenated pages", all, paged)
+
+	beyond, _, err := list(apiv1.ListOptions{Page: len(all) + 1, Limit: limit})
+	if err != nil {
+		t.Fatalf("List beyond the last page failed: %v", err)
+	}
+	if len(beyond) != 0 {
+		t.Errorf("Expected no objects beyond the last page, got %d", len(beyond))
+	}
+}
+
+func assertIDsEqual(t *testing.T, name string, want, got []uuid.UUID) {
+	t.Helper()
+	if len(want) != len(got) {
+		t.Fatalf("%s: expected %d objects, got %d", name, len(want), len(got))
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			t.Fatalf("%s: expected object %s at position %d, got %s", name, want[i], i, got[i])
+		}
+	}
+}
+
+func assertItemEqual(t *testing.T, want, got *apiv1.Item) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Expected item, got nil")
+	}
+	if got.ID != want.ID || got.Version != want.Version || got.Name != want.Name || got.Description != want.Description ||
+		got.Price != want.Price || got.Quantity != want.Quantity || got.Location != want.Location {
+		t.Errorf("Expected item %+v, got %+v", *want, *got)
+	}
+}
+
+func assertUserEqual(t *testing.T, want, got *apiv1.User) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Expected user, got nil")
+	}
+	if got.ID != want.ID || got.Version != want.Version || got.EmailVerified != want.EmailVerified || got.IsAdmin != want.IsAdmin ||
+		!equalStringPtr(got.Username, want.Username) || !equalStringPtr(got.Email, want.Email) ||
+		!equalStringPtr(got.PreferredName, want.PreferredName) || !equalStringPtr(got.GivenName, want.GivenName) ||
+		!equalStringPtr(got.FamilyName, want.FamilyName) || !equalStringPtr(got.Locale, want.Locale) ||
+		!equalStringPtr(got.Issuer, want.Issuer) || !equalStringPtr(got.Subject, want.Subject) ||
+		!slices.Equal(got.Roles, want.Roles) {
+		t.Errorf("Expected user %+v, got %+v", *want, *got)
+	}
+}
+
+func assertRoleEqual(t *testing.T, want, got *apiv1.Role) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Expected role, got nil")
+	}
+	if got.ID != want.ID || got.Version != want.Version || got.Name != want.Name || got.Description != want.Description ||
+		!slices.Equal(got.Permissions, want.Permissions) {
+		t.Errorf("Expected role %+v, got %+v", *want, *got)
+	}
+}
+
+func assertCartEqual(t *testing.T, want, got *apiv1.Cart) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Expected cart, got nil")
+	}
+	if got.ID != want.ID || got.Version != want.Version || got.OwnerID != want.OwnerID || len(got.Items) != len(want.Items) {
+		t.Fatalf("Expected cart %+v, got %+v", *want, *got)
+	}
+	for i := range want.Items {
+		if got.Items[i] != want.Items[i] {
+			t.Errorf("Expected cart item %+v at position %d, got %+v", want.Items[i], i, got.Items[i])
+		}
+	}
+}
+
+func assertCheckoutEqual(t *testing.T, want, got *apiv1.Checkout) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Expected checkout, got nil")
+	}
+	if got.ID != want.ID || got.Version != want.Version || got.UserID != want.UserID || got.CartID != want.CartID ||
+		got.Total != want.Total || got.Status != want.Status {
+		t.Errorf("Expected checkout %+v, got %+v", *want, *got)
+	}
+}
+
+func assertSessionEqual(t *testing.T, want, got *apiv1.Session) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Expected session, got nil")
+	}
+	if got.ID != want.ID || got.UserID != want.UserID || got.CartID != want.CartID || got.Username != want.Username ||
+		got.IsAdmin != want.IsAdmin || got.UserAgent != want.UserAgent || !got.CreatedAt.Equal(want.CreatedAt) ||
+		!got.LastSeenAt.Equal(want.LastSeenAt) || !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("Expected session %+v, got %+v", *want, *got)
+	}
+}
+
+func assertAPIKeyEqual(t *testing.T, want, got *apiv1.APIKey) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Expected API key, got nil")
+	}
+	expiryEqual := want.ExpiresAt == nil && got.ExpiresAt == nil ||
+		want.ExpiresAt != nil && got.ExpiresAt != nil && want.ExpiresAt.Equal(*got.ExpiresAt)
+	if got.ID != want.ID || got.UserID != want.UserID || got.Name != want.Name || got.Prefix != want.Prefix ||
+		!slices.Equal(got.Scopes, want.Scopes) || !got.CreatedAt.Equal(want.CreatedAt) || !expiryEqual {
+		t.Errorf("Expected API key %+v, got %+v", *want, *got)
+	}
+}
+
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
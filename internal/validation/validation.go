@@ -0,0 +1,118 @@
+// Package validation provides the declarative request validation used by internal/handlers.
+//
+// Request types implement Validatable and describe their rules with a Violations collector:
+//
+//	func (i Item) Validate(op validation.Operation) error {
+//		var v validation.Violations
+//		v.NotEmpty("name", i.Name)
+//		v.Check(i.Price > 0, "price", "must be greater than zero")
+//		return v.Err()
+//	}
+//
+// The handlers validate decoded request bodies before calling the store functions
+// and report all violations at once in the problem details of the response.
+package validation
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+)
+
+// Operation is the kind of request an object is validated for.
+type Operation int
+
+const (
+	// Create validates the body of a POST request
+	Create Operation = iota
+	// Update validates the body of a PUT or PATCH request
+	Update
+)
+
+func (o Operation) String() string {
+	switch o {
+	case Create:
+		return "create"
+	case Update:
+		return "update"
+	default:
+		return fmt.Sprintf("Operation(%d)", int(o))
+	}
+}
+
+// Validatable is implemented by request objects that validate themselves.
+// Validate returns nil or an error wrapping router.ErrValidation, typically created by Violations.Err.
+type Validatable interface {
+	Validate(op Operation) error
+}
+
+// Validate validates obj if it implements Validatable and returns nil otherwise.
+func Validate(obj any, op Operation) error {
+	v, ok := obj.(Validatable)
+	if !ok {
+		return nil
+	}
+	return v.Validate(op)
+}
+
+// Violations collects the violations found while validating an object.
+// The zero value is ready to use.
+type Violations []router.Violation
+
+// Add records a violation of field.
+func (v *Violations) Add(field, message string) {
+	*v = append(*v, router.Violation{Field: field, Message: message})
+}
+
+// Check records a violation of field if ok is false.
+func (v *Violations) Check(ok bool, field, message string) {
+	if !ok {
+		v.Add(field, message)
+	}
+}
+
+// NotEmpty records a violation if value is empty.
+func (v *Violations) NotEmpty(field, value string) {
+	v.Check(value != "", field, "cannot be empty")
+}
+
+// Required records a violation if value is nil or empty.
+func (v *Violations) Required(field string, value *string) {
+	v.Check(value != nil && *value != "", field, "is required")
+}
+
+// NotEmptyIfSet records a violation if value is set but empty.
+// It is used for optional fields that must not be cleared.
+func (v *Violations) NotEmptyIfSet(field string, value *string) {
+	v.Check(value == nil || *value != "", field, "cannot be empty")
+}
+
+// MinLength records a violation if value is set and shorter than min characters.
+// Empty values are left to Required and NotEmptyIfSet.
+func (v *Violations) MinLength(field string, value *string, min int) {
+	v.Check(value == nil || *value == "" || len([]rune(*value)) >= min, field, fmt.Sprintf("must be at least %d characters long", min))
+}
+
+// NotNilUUID records a violation if id is the nil UUID.
+func (v *Violations) NotNilUUID(field string, id uuid.UUID) {
+	v.Check(id != uuid.Nil, field, "cannot be empty")
+}
+
+// OneOf records a violation if value is not one of the allowed values.
+func (v *Violations) OneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Add(field, fmt.Sprintf("must be one of %q", allowed))
+}
+
+// Err returns a *router.ValidationError holding all violations, or nil if there are none.
+func (v Violations) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return router.NewValidationError(v...)
+}
@@ -0,0 +1,70 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/leonsteinhaeuser/demo-shop/internal/router"
+	"github.com/leonsteinhaeuser/demo-shop/internal/utils"
+)
+
+type testObject struct {
+	Name  string
+	Email *string
+}
+
+func (o testObject) Validate(op Operation) error {
+	var v Violations
+	v.NotEmpty("name", o.Name)
+	if op == Create {
+		v.Required("email", o.Email)
+	}
+	return v.Err()
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(&testObject{Name: "test", Email: utils.StringPtr("test@localhost")}, Create); err != nil {
+		t.Errorf("Expected valid object, got %v", err)
+	}
+	if err := Validate(struct{}{}, Create); err != nil {
+		t.Errorf("Expected objects without rules to be valid, got %v", err)
+	}
+
+	err := Validate(&testObject{}, Create)
+	if !errors.Is(err, router.ErrValidation) {
+		t.Fatalf("Expected error wrapping %v, got %v", router.ErrValidation, err)
+	}
+	var verr *router.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %T", err)
+	}
+	if len(verr.Violations) != 2 {
+		t.Errorf("Expected all violations to be reported, got %+v", verr.Violations)
+	}
+
+	if err := Validate(&testObject{Name: "test"}, Update); err != nil {
+		t.Errorf("Expected operation specific rules to be skipped, got %v", err)
+	}
+}
+
+func TestViolations(t *testing.T) {
+	var v Violations
+	v.NotEmptyIfSet("nil", nil)
+	v.NotEmptyIfSet("empty", utils.StringPtr(""))
+	v.MinLength("short", utils.StringPtr("abc"), 4)
+	v.MinLength("unset", nil, 4)
+	v.NotNilUUID("id", uuid.Nil)
+	v.OneOf("status", "unknown", "pending", "completed")
+	v.OneOf("known", "pending", "pending", "completed")
+
+	want := []string{"empty", "short", "id", "status"}
+	if len(v) != len(want) {
+		t.Fatalf("Expected violations of %v, got %+v", want, v)
+	}
+	for i, field := range want {
+		if v[i].Field != field {
+			t.Errorf("Expected violation %d to be of field %s, got %s", i, field, v[i].Field)
+		}
+	}
+}